@@ -0,0 +1,345 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"container/list"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+// AuthMod A challenge/response authentication scheme which is compatible with FMS (Adobe) and Limelight.
+type AuthMod string
+
+const (
+	AuthModAdobe AuthMod = "adobe"
+	AuthModLLNW  AuthMod = "llnw"
+)
+
+// ErrNoSuchUser is returned by CredentialStore when a user is not found.
+var ErrNoSuchUser = errors.New("No such user")
+
+// CredentialStore Provides passwords of users to Authenticator.
+type CredentialStore interface {
+	// Password returns a password of user. It must return ErrNoSuchUser if user is not found.
+	Password(user string) (string, error)
+}
+
+// StaticCredentialStore A CredentialStore which has pairs of a user and a password.
+type StaticCredentialStore map[string]string
+
+func (s StaticCredentialStore) Password(user string) (string, error) {
+	password, ok := s[user]
+	if !ok {
+		return "", ErrNoSuchUser
+	}
+	return password, nil
+}
+
+// AuthenticatorConfig Configurations of Authenticator.
+type AuthenticatorConfig struct {
+	// Mod is a scheme which clients are required to use. Default is AuthModAdobe.
+	Mod AuthMod
+
+	Credentials CredentialStore
+
+	// ChallengeTimeout limits how long a challenge is valid. Default is 1min.
+	ChallengeTimeout time.Duration
+
+	// MaxChallenges limits challenges which are issued and not answered yet. If it is exceeded, the oldest one is
+	// discarded. Default is 1024. Unlimited if negative.
+	MaxChallenges int
+}
+
+func (cb *AuthenticatorConfig) normalize() *AuthenticatorConfig {
+	c := AuthenticatorConfig(*cb)
+
+	if c.Mod == "" {
+		c.Mod = AuthModAdobe
+	}
+
+	if c.Credentials == nil {
+		c.Credentials = StaticCredentialStore{}
+	}
+
+	if c.ChallengeTimeout == 0 {
+		c.ChallengeTimeout = 1 * time.Minute
+	}
+
+	if c.MaxChallenges == 0 {
+		c.MaxChallenges = 1024
+	}
+
+	return &c
+}
+
+// Authenticator Authenticates connect commands at server side. Clients are rejected with challenges and
+// connect again with responses, so an Authenticator must be shared by connections via ConnConfig.Authenticator.
+//
+// Authentication parameters are removed from app and tcUrl of connect commands before Handler.OnConnect is called.
+type Authenticator struct {
+	config     *AuthenticatorConfig
+	challenges map[string]*list.Element // Keyed by opaque (adobe) or nonce (llnw)
+	order      *list.List               // Challenges in order of issue, which is also an order of expiration
+	m          sync.Mutex
+}
+
+type authChallenge struct {
+	key       string
+	user      string
+	salt      string // adobe only
+	challenge string // adobe only
+	expiresAt time.Time
+}
+
+func NewAuthenticator(config *AuthenticatorConfig) *Authenticator {
+	if config == nil {
+		config = &AuthenticatorConfig{}
+	}
+
+	return &Authenticator{
+		config:     config.normalize(),
+		challenges: make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// authenticate Verifies authentication parameters in cmd, and removes them if succeeded.
+func (a *Authenticator) authenticate(cmd *message.NetConnectionConnect) error {
+	app, query := splitAuthQuery(cmd.Command.App)
+	if query == "" {
+		_, query = splitAuthQuery(cmd.Command.TCURL)
+	}
+	params := parseAuthParams(query)
+
+	mod := a.config.Mod
+	user := params["user"]
+	if AuthMod(params["authmod"]) != mod || user == "" {
+		return a.reject(fmt.Sprintf("[ code=403 need auth; authmod=%s ]", mod), "")
+	}
+	if strings.ContainsAny(user, "&=") {
+		// User names are put into challenges as they are, so they must not break parameters
+		return a.reject(fmt.Sprintf("[ authmod=%s ]", mod), "?reason=authfailed")
+	}
+
+	password, err := a.config.Credentials.Password(user)
+	if err == ErrNoSuchUser {
+		return a.reject(fmt.Sprintf("[ authmod=%s ]", mod), "?reason=nosuchuser")
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get password: User = %s", user)
+	}
+
+	if params["response"] == "" {
+		return a.rejectWithChallenge(user)
+	}
+
+	var ok bool
+	switch mod {
+	case AuthModAdobe:
+		c := a.takeChallenge(params["opaque"], user)
+		ok = c != nil && equalAuthResponse(
+			params["response"], adobeAuthResponse(user, password, c.salt, params["opaque"], params["challenge"]),
+		)
+
+	case AuthModLLNW:
+		c := a.takeChallenge(params["nonce"], user)
+		ok = c != nil && equalAuthResponse(
+			params["response"], llnwAuthResponse(user, password, app, params["nonce"], params["nc"], params["cnonce"]),
+		)
+
+	default:
+		return errors.Errorf("Unsupported authmod: %s", mod)
+	}
+	if !ok {
+		return a.reject(fmt.Sprintf("[ authmod=%s ]", mod), "?reason=authfailed")
+	}
+
+	cmd.Command.App = stripAuthParams(cmd.Command.App)
+	cmd.Command.TCURL = stripAuthParams(cmd.Command.TCURL)
+
+	return nil
+}
+
+func (a *Authenticator) rejectWithChallenge(user string) error {
+	c := &authChallenge{
+		user:      user,
+		expiresAt: time.Now().Add(a.config.ChallengeTimeout),
+	}
+
+	mod := a.config.Mod
+	var info string
+	switch mod {
+	case AuthModAdobe:
+		c.salt, c.challenge = randomHex(8), randomHex(8)
+		opaque := randomHex(8)
+		a.putChallenge(opaque, c)
+
+		info = fmt.Sprintf("?reason=needauth&user=%s&salt=%s&challenge=%s&opaque=%s", user, c.salt, c.challenge, opaque)
+
+	case AuthModLLNW:
+		nonce := randomHex(16)
+		a.putChallenge(nonce, c)
+
+		info = fmt.Sprintf("?reason=needauth&user=%s&nonce=%s", user, nonce)
+
+	default:
+		return errors.Errorf("Unsupported authmod: %s", mod)
+	}
+
+	return a.reject(fmt.Sprintf("[ authmod=%s ]", mod), info)
+}
+
+func (a *Authenticator) reject(detail, info string) error {
+	return NewConnectRejection(fmt.Sprintf("[ AccessManager.Reject ] : %s : %s", detail, info), nil)
+}
+
+func (a *Authenticator) putChallenge(key string, c *authChallenge) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	// Challenges expire in order of issue, so only the oldest ones are checked
+	now := time.Now()
+	for e := a.order.Front(); e != nil; e = a.order.Front() {
+		isFull := a.config.MaxChallenges >= 0 && a.order.Len() >= a.config.MaxChallenges
+		if !isFull && !now.After(e.Value.(*authChallenge).expiresAt) {
+			break
+		}
+		a.removeChallenge(e)
+	}
+
+	c.key = key
+	a.challenges[key] = a.order.PushBack(c)
+}
+
+// takeChallenge Returns a challenge issued to user. A challenge can be used only once.
+func (a *Authenticator) takeChallenge(key, user string) *authChallenge {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	e, ok := a.challenges[key]
+	if !ok {
+		return nil
+	}
+	c := a.removeChallenge(e)
+
+	if c.user != user || time.Now().After(c.expiresAt) {
+		return nil
+	}
+	return c
+}
+
+func (a *Authenticator) removeChallenge(e *list.Element) *authChallenge {
+	c := a.order.Remove(e).(*authChallenge)
+	delete(a.challenges, c.key)
+
+	return c
+}
+
+// adobeAuthResponse base64(md5(base64(md5(user + salt + password)) + opaque + challenge))
+func adobeAuthResponse(user, password, salt, opaque, challenge string) string {
+	h := md5.Sum([]byte(user + salt + password))
+	hash1 := base64.StdEncoding.EncodeToString(h[:])
+
+	h = md5.Sum([]byte(hash1 + opaque + challenge))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// llnwAuthResponse An HTTP digest (qop=auth) of "publish" to the app with realm "live".
+func llnwAuthResponse(user, password, app, nonce, nc, cnonce string) string {
+	if !strings.Contains(app, "/") {
+		app += "/_definst_"
+	}
+
+	ha1 := md5Hex(user + ":live:" + password)
+	ha2 := md5Hex("publish:/" + app)
+	return md5Hex(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":auth:" + ha2)
+}
+
+func md5Hex(s string) string {
+	h := md5.Sum([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var authParamKeys = map[string]bool{
+	"authmod":   true,
+	"user":      true,
+	"salt":      true,
+	"challenge": true,
+	"response":  true,
+	"opaque":    true,
+	"nonce":     true,
+	"cnonce":    true,
+	"nc":        true,
+}
+
+func splitAuthQuery(s string) (string, string) {
+	if i := strings.Index(s, "?"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// equalAuthResponse Compares responses in constant time not to leak how many leading characters are correct.
+func equalAuthResponse(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// parseAuthParams Parses "k1=v1&k2=v2". Values are not unescaped as FFmpeg does not.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for _, kv := range strings.Split(s, "&") {
+		if kv == "" {
+			continue
+		}
+		elems := strings.SplitN(kv, "=", 2)
+		if len(elems) == 1 {
+			params[elems[0]] = ""
+		} else {
+			params[elems[0]] = elems[1]
+		}
+	}
+	return params
+}
+
+// stripAuthParams Removes authentication parameters from a query of s and keeps others.
+func stripAuthParams(s string) string {
+	base, query := splitAuthQuery(s)
+	if query == "" {
+		return s
+	}
+
+	var kept []string
+	for _, kv := range strings.Split(query, "&") {
+		if authParamKeys[strings.SplitN(kv, "=", 2)[0]] {
+			continue
+		}
+		kept = append(kept, kv)
+	}
+	if len(kept) == 0 {
+		return base
+	}
+	return base + "?" + strings.Join(kept, "&")
+}
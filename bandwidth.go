@@ -0,0 +1,282 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+// BandwidthCheckConfig Configures bandwidth checks which are compatible with FMS (checkBandwidth, onBWCheck and onBWDone).
+// A measuring side calls onBWCheck of a peer with payloads, and estimates bandwidth from times until results are returned.
+type BandwidthCheckConfig struct {
+	// OnConnect makes servers check bandwidth to clients just after connect, because some encoders wait for onBWDone.
+	// Clients which do not reply to onBWCheck receive onBWDone without results after Timeout.
+	// Servers check bandwidth when clients call checkBandwidth regardless of it.
+	OnConnect bool
+
+	// Duration No more payloads are sent after Duration. Default is 1s.
+	Duration time.Duration
+	// Timeout A limit of a check including waiting for results. Default is 10s.
+	Timeout time.Duration
+	// PayloadSize A size of a payload of each onBWCheck. Default is 16KB, and it must be less than 64KB.
+	PayloadSize int
+	// MaxBytes No more payloads are sent after MaxBytes are sent. Default is 4MB.
+	MaxBytes int64
+}
+
+func (cb *BandwidthCheckConfig) normalize() *BandwidthCheckConfig {
+	c := BandwidthCheckConfig(*cb)
+
+	if c.Duration == 0 {
+		c.Duration = 1 * time.Second
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+
+	if c.PayloadSize == 0 {
+		c.PayloadSize = 16 * 1024
+	}
+	if c.PayloadSize > 0xffff {
+		c.PayloadSize = 0xffff // Long strings are not supported by AMF0 encoders
+	}
+
+	if c.MaxBytes == 0 {
+		c.MaxBytes = 4 * 1024 * 1024
+	}
+
+	return &c
+}
+
+// BandwidthResult A result of a bandwidth check.
+type BandwidthResult struct {
+	Kbps     float64       // Estimated bandwidth from the measuring side to the peer
+	Bytes    int64         // Bytes of payloads which are sent
+	Duration time.Duration // Time to send payloads excluding latencies
+	Latency  time.Duration // A round-trip time of onBWCheck without payloads
+}
+
+func newBandwidthResult(done *message.NetConnectionOnBWDone) *BandwidthResult {
+	return &BandwidthResult{
+		Kbps:     done.KbitDown,
+		Bytes:    int64(done.DeltaDown * 1024),
+		Duration: time.Duration(done.DeltaTime * float64(time.Millisecond)),
+		Latency:  time.Duration(done.Latency * float64(time.Millisecond)),
+	}
+}
+
+func (r *BandwidthResult) toOnBWDone() *message.NetConnectionOnBWDone {
+	return &message.NetConnectionOnBWDone{
+		KbitDown:  r.Kbps,
+		DeltaDown: float64(r.Bytes) / 1024,
+		DeltaTime: float64(r.Duration) / float64(time.Millisecond),
+		Latency:   float64(r.Latency) / float64(time.Millisecond),
+	}
+}
+
+// bandwidthChunkStreamID A chunk stream to send commands of bandwidth checks. Same as other commands.
+const bandwidthChunkStreamID = 3
+
+// bandwidthCommandNames Names of commands to check bandwidth. Peers which call _checkbw expect _onbwcheck and _onbwdone.
+type bandwidthCommandNames struct {
+	check string
+	done  string
+}
+
+var (
+	bandwidthCommandNamesFMS    = bandwidthCommandNames{check: "onBWCheck", done: "onBWDone"}
+	bandwidthCommandNamesLegacy = bandwidthCommandNames{check: "_onbwcheck", done: "_onbwdone"}
+)
+
+func bandwidthCommandNamesFor(checkCommandName string) bandwidthCommandNames {
+	if checkCommandName == "_checkbw" {
+		return bandwidthCommandNamesLegacy
+	}
+	return bandwidthCommandNamesFMS
+}
+
+// bandwidthState States of bandwidth checks of a connection.
+type bandwidthState struct {
+	isChecking int32 // Server only. 1 while checking bandwidth to a client
+	checkCount int64 // The number of onBWCheck which are received
+
+	waiters []chan *BandwidthResult // Client only. Waiting for onBWDone
+	m       sync.Mutex
+}
+
+func (bs *bandwidthState) wait() chan *BandwidthResult {
+	bs.m.Lock()
+	defer bs.m.Unlock()
+
+	ch := make(chan *BandwidthResult, 1)
+	bs.waiters = append(bs.waiters, ch)
+
+	return ch
+}
+
+func (bs *bandwidthState) cancel(ch chan *BandwidthResult) {
+	bs.m.Lock()
+	defer bs.m.Unlock()
+
+	for i, w := range bs.waiters {
+		if w == ch {
+			bs.waiters = append(bs.waiters[:i], bs.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+func (bs *bandwidthState) done(result *BandwidthResult) {
+	bs.m.Lock()
+	defer bs.m.Unlock()
+
+	for _, ch := range bs.waiters {
+		ch <- result
+	}
+	bs.waiters = nil
+}
+
+// replyOnBWCheck Replies to onBWCheck with the number of received onBWCheck as FMS clients do.
+func replyOnBWCheck(sh *streamHandler, chunkStreamID int, timestamp uint32, transactionID int64) error {
+	count := atomic.AddInt64(&sh.stream.currentConn().bandwidth.checkCount, 1)
+	if transactionID == 0 {
+		return nil // No results are required
+	}
+
+	return sh.stream.writeCommandMessage(
+		chunkStreamID, timestamp,
+		"_result",
+		transactionID,
+		&message.NetConnectionOnBWCheckResult{Count: float64(count)},
+	)
+}
+
+// startBandwidthCheck Checks bandwidth to a client and sends onBWDone in background, not to block reading results of
+// onBWCheck. It does nothing while another check is running.
+func (s *Stream) startBandwidthCheck(names bandwidthCommandNames) {
+	conn := s.currentConn()
+	if !atomic.CompareAndSwapInt32(&conn.bandwidth.isChecking, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&conn.bandwidth.isChecking, 0)
+
+		config := &conn.config.BandwidthCheck
+		ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+		defer cancel()
+
+		result, err := measureBandwidth(ctx, s, config, names.check)
+		if err == ErrConnectionClosed {
+			return
+		}
+		if err != nil {
+			s.logger().Warnf("Failed to check bandwidth: Err = %+v", err)
+			result = &BandwidthResult{} // Clients which wait for onBWDone can continue
+		}
+
+		if err := s.writeCommandMessage(bandwidthChunkStreamID, 0, names.done, 0, result.toOnBWDone()); err != nil {
+			s.logger().Warnf("Failed to send %s: Err = %+v", names.done, err)
+			return
+		}
+		s.logger().Infof("Bandwidth checked: Kbps = %.1f, Latency = %s", result.Kbps, result.Latency)
+
+		if bh, ok := s.userHandler().(BandwidthHandler); ok {
+			bh.OnBandwidthChecked(result)
+		}
+	}()
+}
+
+// measureBandwidth Calls onBWCheck of a peer and estimates bandwidth to the peer. Payloads are doubled in each round
+// until Duration is elapsed or MaxBytes are sent.
+func measureBandwidth(
+	ctx context.Context,
+	s *Stream,
+	config *BandwidthCheckConfig,
+	commandName string,
+) (*BandwidthResult, error) {
+	start := time.Now()
+	if err := s.callOnBWCheck(ctx, commandName, "", 1); err != nil {
+		return nil, err
+	}
+	result := &BandwidthResult{
+		Latency: time.Since(start),
+	}
+
+	payload := strings.Repeat("x", config.PayloadSize)
+	for count := 1; time.Since(start) < config.Duration && result.Bytes < config.MaxBytes; count *= 2 {
+		roundStart := time.Now()
+		if err := s.callOnBWCheck(ctx, commandName, payload, count); err != nil {
+			return nil, err
+		}
+
+		elapsed := time.Since(roundStart) - result.Latency
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		result.Bytes += int64(count * len(payload))
+		result.Duration += elapsed
+	}
+
+	duration := result.Duration
+	if duration < time.Millisecond {
+		duration = time.Millisecond // Too fast to be measured
+	}
+	result.Kbps = float64(result.Bytes*8) / (float64(duration) / float64(time.Millisecond))
+
+	return result, nil
+}
+
+// callOnBWCheck Calls onBWCheck count times without waiting, and waits for all results.
+// Transactions which are not resolved are deleted when ctx is done.
+func (s *Stream) callOnBWCheck(ctx context.Context, commandName string, payload string, count int) error {
+	transactionIDs := make([]int64, 0, count)
+	ts := make([]*transaction, 0, count)
+	deleteTransactions := func() {
+		for _, transactionID := range transactionIDs {
+			_ = s.transactions.Delete(transactionID) // Resolved ones are deleted already
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		transactionID, t := s.transactions.CreateNext()
+		transactionIDs = append(transactionIDs, transactionID)
+		ts = append(ts, t)
+
+		err := s.writeCommandMessage(
+			bandwidthChunkStreamID, 0,
+			commandName,
+			transactionID,
+			&message.NetConnectionOnBWCheck{Payload: payload},
+		)
+		if err != nil {
+			deleteTransactions()
+			return err
+		}
+	}
+
+	for _, t := range ts {
+		select {
+		case <-ctx.Done():
+			deleteTransactions()
+			return ctx.Err()
+		case <-s.currentConn().loopDoneCh:
+			return ErrConnectionClosed
+		case <-t.doneCh: // _error is also a result
+		}
+	}
+
+	return nil
+}
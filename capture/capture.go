@@ -0,0 +1,202 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package capture records raw bytes of RTMP connections and replays them.
+//
+// A capture consists of a magic "RTMPCAP1" followed by records. Each record has a 1 byte type,
+// an 8 bytes elapsed time in nanoseconds since the capture is started, a 4 bytes length and data (big endian).
+// Records of RecordTypeRead are bytes which were received from a peer, and RecordTypeWrite are bytes which were sent.
+// RecordTypeHandshakeDone separates handshakes from chunks.
+//
+// RTMPE connections are captured as ciphertext because a capture wraps a connection before decryption.
+// TLS connections are captured as plaintext because a capture wraps a connection after TLS.
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const magic = "RTMPCAP1"
+
+// RecordType A type of records.
+type RecordType byte
+
+const (
+	RecordTypeRead          RecordType = 1
+	RecordTypeWrite         RecordType = 2
+	RecordTypeHandshakeDone RecordType = 3
+)
+
+func (t RecordType) String() string {
+	switch t {
+	case RecordTypeRead:
+		return "Read"
+	case RecordTypeWrite:
+		return "Write"
+	case RecordTypeHandshakeDone:
+		return "HandshakeDone"
+	default:
+		return "<Unknown>"
+	}
+}
+
+// Record A record of a capture.
+type Record struct {
+	Type RecordType
+	Time time.Duration // Elapsed time since the capture is started
+	Data []byte
+}
+
+// Writer Writes records in the capture format. It is goroutine-safe.
+type Writer struct {
+	w         io.Writer
+	startedAt time.Time
+	isStarted bool
+	err       error
+	m         sync.Mutex
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w: w,
+	}
+}
+
+// WriteRecord writes a record of typ with the current time. data can be reused after returning.
+func (w *Writer) WriteRecord(typ RecordType, data []byte) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	now := time.Now()
+	if !w.isStarted {
+		w.isStarted = true
+		w.startedAt = now
+		if _, err := io.WriteString(w.w, magic); err != nil {
+			w.err = errors.Wrap(err, "Failed to write magic")
+			return w.err
+		}
+	}
+
+	var header [13]byte
+	header[0] = byte(typ)
+	binary.BigEndian.PutUint64(header[1:9], uint64(now.Sub(w.startedAt)))
+	binary.BigEndian.PutUint32(header[9:13], uint32(len(data)))
+	if _, err := w.w.Write(header[:]); err != nil {
+		w.err = errors.Wrap(err, "Failed to write record header")
+		return w.err
+	}
+	if _, err := w.w.Write(data); err != nil {
+		w.err = errors.Wrap(err, "Failed to write record data")
+		return w.err
+	}
+
+	return nil
+}
+
+// Err returns the first error of writing.
+func (w *Writer) Err() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.err
+}
+
+// Reader Reads records in the capture format.
+type Reader struct {
+	r         *bufio.Reader
+	isStarted bool
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r: bufio.NewReader(r),
+	}
+}
+
+// ReadRecord returns a next record. It returns io.EOF at the end of the capture.
+func (r *Reader) ReadRecord() (*Record, error) {
+	if !r.isStarted {
+		var m [len(magic)]byte
+		if _, err := io.ReadFull(r.r, m[:]); err != nil {
+			if err == io.EOF {
+				return nil, io.EOF // An empty capture
+			}
+			return nil, errors.Wrap(err, "Failed to read magic")
+		}
+		if string(m[:]) != magic {
+			return nil, errors.Errorf("Not a capture: Magic = %q", m[:])
+		}
+		r.isStarted = true
+	}
+
+	var header [13]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errors.Wrap(err, "Failed to read record header")
+	}
+
+	rec := &Record{
+		Type: RecordType(header[0]),
+		Time: time.Duration(binary.BigEndian.Uint64(header[1:9])),
+		Data: make([]byte, binary.BigEndian.Uint32(header[9:13])),
+	}
+	if _, err := io.ReadFull(r.r, rec.Data); err != nil {
+		return nil, errors.Wrap(err, "Failed to read record data")
+	}
+
+	return rec, nil
+}
+
+// ReadAll reads all records of a capture.
+func ReadAll(r io.Reader) ([]*Record, error) {
+	cr := NewReader(r)
+
+	var records []*Record
+	for {
+		rec, err := cr.ReadRecord()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+}
+
+// Chunks returns a reader of bytes of typ after a handshake. It can be fed to rtmp.NewChunkStreamer.
+// All bytes of typ are returned if records do not have RecordTypeHandshakeDone.
+func Chunks(records []*Record, typ RecordType) io.Reader {
+	start := 0
+	for i, rec := range records {
+		if rec.Type == RecordTypeHandshakeDone {
+			start = i + 1
+			break
+		}
+	}
+
+	var readers []io.Reader
+	for _, rec := range records[start:] {
+		if rec.Type == typ {
+			readers = append(readers, bytes.NewReader(rec.Data))
+		}
+	}
+	return io.MultiReader(readers...)
+}
@@ -0,0 +1,120 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package capture
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterAndReader(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	require.Nil(t, w.WriteRecord(RecordTypeWrite, []byte{0x03}))
+	require.Nil(t, w.WriteRecord(RecordTypeRead, []byte{0x03, 0x00}))
+	require.Nil(t, w.WriteRecord(RecordTypeHandshakeDone, nil))
+	require.Nil(t, w.WriteRecord(RecordTypeRead, []byte{0x01, 0x02}))
+	require.Nil(t, w.WriteRecord(RecordTypeWrite, []byte{0x04}))
+	require.Nil(t, w.WriteRecord(RecordTypeRead, []byte{0x03}))
+
+	records, err := ReadAll(&buf)
+	require.Nil(t, err)
+	require.Equal(t, 6, len(records))
+	require.Equal(t, RecordTypeHandshakeDone, records[2].Type)
+	for i := 1; i < len(records); i++ {
+		require.True(t, records[i-1].Time <= records[i].Time)
+	}
+
+	chunks, err := ioutil.ReadAll(Chunks(records, RecordTypeRead))
+	require.Nil(t, err)
+	require.Equal(t, []byte{0x01, 0x02, 0x03}, chunks)
+}
+
+func TestReaderRejectsInvalidMagic(t *testing.T) {
+	_, err := ReadAll(bytes.NewReader([]byte("NOTACAPTURE")))
+	require.NotNil(t, err)
+}
+
+type nopCloser struct {
+	io.ReadWriter
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func TestConnRecordsBothDirections(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewConn(nopCloser{ReadWriter: bytes.NewBuffer([]byte("pong"))}, NewWriter(&buf))
+
+	_, err := c.Write([]byte("ping"))
+	require.Nil(t, err)
+	c.MarkHandshakeDone()
+
+	b := make([]byte, 4)
+	_, err = io.ReadFull(c, b)
+	require.Nil(t, err)
+
+	records, err := ReadAll(&buf)
+	require.Nil(t, err)
+	require.Equal(t, []RecordType{RecordTypeWrite, RecordTypeHandshakeDone, RecordTypeRead}, []RecordType{
+		records[0].Type, records[1].Type, records[2].Type,
+	})
+	require.Equal(t, []byte("ping"), records[0].Data)
+	require.Equal(t, []byte("pong"), records[2].Data)
+}
+
+func TestReplayOrdersWrites(t *testing.T) {
+	records := []*Record{
+		{Type: RecordTypeRead, Data: []byte("hello")},
+		{Type: RecordTypeWrite, Data: []byte("hi")},
+		{Type: RecordTypeRead, Data: []byte("bye")},
+	}
+
+	peer, conn := net.Pipe()
+	defer peer.Close()
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Replay(ctx, peer, records, SidePeer)
+	}()
+
+	b := make([]byte, 5)
+	_, err := io.ReadFull(conn, b)
+	require.Nil(t, err)
+	require.Equal(t, "hello", string(b))
+
+	// "bye" is not written until conn writes 2 bytes
+	_, err = conn.Write([]byte("h"))
+	require.Nil(t, err)
+	_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err = conn.Read(b)
+	require.NotNil(t, err)
+	_ = conn.SetReadDeadline(time.Time{})
+
+	_, err = conn.Write([]byte("i"))
+	require.Nil(t, err)
+	b = make([]byte, 3)
+	_, err = io.ReadFull(conn, b)
+	require.Nil(t, err)
+	require.Equal(t, "bye", string(b))
+
+	require.Nil(t, <-errCh)
+}
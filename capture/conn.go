@@ -0,0 +1,59 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package capture
+
+import (
+	"io"
+)
+
+// Conn Wraps a connection and records bytes which are read and written.
+// Failures of recording do not affect the connection. See Writer.Err.
+type Conn struct {
+	rwc io.ReadWriteCloser
+	w   *Writer
+}
+
+var _ io.ReadWriteCloser = (*Conn)(nil)
+
+func NewConn(rwc io.ReadWriteCloser, w *Writer) *Conn {
+	return &Conn{
+		rwc: rwc,
+		w:   w,
+	}
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.rwc.Read(b)
+	if n > 0 {
+		_ = c.w.WriteRecord(RecordTypeRead, b[:n])
+	}
+	return n, err
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	n, err := c.rwc.Write(b)
+	if n > 0 {
+		_ = c.w.WriteRecord(RecordTypeWrite, b[:n])
+	}
+	return n, err
+}
+
+// Close closes the wrapped connection. The Writer is not closed.
+func (c *Conn) Close() error {
+	return c.rwc.Close()
+}
+
+// MarkHandshakeDone records that a handshake is finished and following bytes are chunks.
+func (c *Conn) MarkHandshakeDone() {
+	_ = c.w.WriteRecord(RecordTypeHandshakeDone, nil)
+}
+
+// Writer returns the Writer of the connection.
+func (c *Conn) Writer() *Writer {
+	return c.w
+}
@@ -0,0 +1,126 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package capture
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Side A side of a captured connection which Replay plays.
+type Side int
+
+const (
+	// SidePeer plays the peer of the captured connection. Records of RecordTypeRead are written to a connection.
+	// e.g. A capture of a server is replayed against a new server.
+	SidePeer Side = iota
+	// SideSelf plays the captured connection itself. Records of RecordTypeWrite are written to a connection.
+	// e.g. A capture of a server is replayed against a new client.
+	SideSelf
+)
+
+// Replay Plays side of a captured connection as a scripted fake peer of conn (e.g. an end of net.Pipe).
+//
+// Bytes which side sent are written to conn in order. Before each write, it waits until conn writes as many bytes
+// as the other side sent until then, so writes are ordered as captured regardless of timing. Contents of bytes
+// written by conn are not compared, and they are discarded.
+// It returns when all bytes are written and conn writes all expected bytes. conn should be closed after that
+// because it is still read in background until it is closed.
+//
+// Random bytes of handshakes are not reproduced, so a Conn under replay must set SkipHandshakeVerification.
+// RTMPE captures cannot be replayed.
+func Replay(ctx context.Context, conn io.ReadWriter, records []*Record, side Side) error {
+	sendType, recvType := RecordTypeRead, RecordTypeWrite
+	if side == SideSelf {
+		sendType, recvType = RecordTypeWrite, RecordTypeRead
+	}
+
+	d := newDrainer(conn)
+	go d.run()
+
+	var expected int64
+	for _, rec := range records {
+		switch rec.Type {
+		case recvType:
+			expected += int64(len(rec.Data))
+
+		case sendType:
+			if err := d.wait(ctx, expected); err != nil {
+				return err
+			}
+			if _, err := conn.Write(rec.Data); err != nil {
+				return errors.Wrap(err, "Failed to write a record")
+			}
+		}
+	}
+
+	return d.wait(ctx, expected)
+}
+
+// drainer Reads a connection in background and counts bytes.
+type drainer struct {
+	r io.Reader
+
+	n        int64
+	err      error
+	notifyCh chan struct{}
+	m        sync.Mutex
+}
+
+func newDrainer(r io.Reader) *drainer {
+	return &drainer{
+		r:        r,
+		notifyCh: make(chan struct{}, 1),
+	}
+}
+
+func (d *drainer) run() {
+	buf := make([]byte, 4*1024)
+	for {
+		n, err := d.r.Read(buf)
+
+		d.m.Lock()
+		d.n += int64(n)
+		d.err = err
+		d.m.Unlock()
+
+		select {
+		case d.notifyCh <- struct{}{}:
+		default:
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wait Waits until n bytes are read.
+func (d *drainer) wait(ctx context.Context, n int64) error {
+	for {
+		d.m.Lock()
+		read, err := d.n, d.err
+		d.m.Unlock()
+
+		if read >= n {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Connection is closed before receiving expected bytes: Expected = %d, Actual = %d", n, read)
+		}
+
+		select {
+		case <-d.notifyCh:
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "Timeout: Expected = %d, Actual = %d", n, read)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"crypto/tls"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GetCertificateFunc is a type of tls.Config.GetCertificate.
+type GetCertificateFunc func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+// CertificateReloader holds a certificate loaded from files and reloads it when the files are modified.
+// Assign GetCertificate to tls.Config.GetCertificate to rotate certificates without restarting servers.
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+	m           sync.RWMutex
+}
+
+// NewCertificateReloader loads a certificate pair. It returns an error if the files cannot be loaded.
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload loads the certificate pair from the files unconditionally.
+func (r *CertificateReloader) Reload() error {
+	certModTime, keyModTime, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "Failed to load a certificate")
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.cert = &cert
+	r.certModTime = certModTime
+	r.keyModTime = keyModTime
+
+	return nil
+}
+
+// GetCertificate returns the current certificate. The certificate is reloaded if the files are updated.
+// When reloading fails, the previously loaded certificate is kept being used.
+func (r *CertificateReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certModTime, keyModTime, err := r.modTimes()
+	if err == nil && r.isModified(certModTime, keyModTime) {
+		_ = r.Reload() // Keep the previous one if the files are incomplete
+	}
+
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return r.cert, nil
+}
+
+func (r *CertificateReloader) isModified(certModTime, keyModTime time.Time) bool {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return !certModTime.Equal(r.certModTime) || !keyModTime.Equal(r.keyModTime)
+}
+
+func (r *CertificateReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Wrap(err, "Failed to stat a certificate file")
+	}
+
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Wrap(err, "Failed to stat a key file")
+	}
+
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// SNICertificates selects certificates by the server name indicated by clients (SNI).
+// A server name can be a wildcard such as "*.example.com", which matches one label.
+// Assign GetCertificate to tls.Config.GetCertificate to serve multiple hostnames.
+type SNICertificates struct {
+	// Default is used when no server name is matched. It can be nil.
+	Default GetCertificateFunc
+
+	entries map[string]GetCertificateFunc
+	m       sync.RWMutex
+}
+
+// Add registers a certificate provider for the server name.
+func (s *SNICertificates) Add(serverName string, f GetCertificateFunc) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.entries == nil {
+		s.entries = make(map[string]GetCertificateFunc)
+	}
+	s.entries[strings.ToLower(serverName)] = f
+}
+
+// AddCertificate registers a static certificate for the server name.
+func (s *SNICertificates) AddCertificate(serverName string, cert *tls.Certificate) {
+	s.Add(serverName, func(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return cert, nil
+	})
+}
+
+// Remove deregisters the server name.
+func (s *SNICertificates) Remove(serverName string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	delete(s.entries, strings.ToLower(serverName))
+}
+
+// GetCertificate returns a certificate for the server name in hello.
+func (s *SNICertificates) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	f := s.lookup(strings.ToLower(strings.TrimSuffix(hello.ServerName, ".")))
+	if f == nil {
+		return nil, errors.Errorf("No certificate for the server name: ServerName = %s", hello.ServerName)
+	}
+
+	return f(hello)
+}
+
+func (s *SNICertificates) lookup(serverName string) GetCertificateFunc {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	if f, ok := s.entries[serverName]; ok {
+		return f
+	}
+
+	if i := strings.Index(serverName, "."); i > 0 {
+		if f, ok := s.entries["*"+serverName[i:]]; ok {
+			return f
+		}
+	}
+
+	return s.Default
+}
@@ -28,3 +28,29 @@ type ChunkStreamReader struct {
 func (r *ChunkStreamReader) Read(b []byte) (int, error) {
 	return r.buf.Read(b)
 }
+
+// Len returns the number of unread bytes of the message.
+func (r *ChunkStreamReader) Len() int {
+	return r.buf.Len()
+}
+
+func (r *ChunkStreamReader) ChunkStreamID() int {
+	return r.basicHeader.chunkStreamID
+}
+
+// Timestamp returns an absolute timestamp of a message. It is valid after a message is completed.
+func (r *ChunkStreamReader) Timestamp() uint32 {
+	return r.timestamp
+}
+
+func (r *ChunkStreamReader) MessageLength() uint32 {
+	return r.messageLength
+}
+
+func (r *ChunkStreamReader) MessageTypeID() byte {
+	return r.messageTypeID
+}
+
+func (r *ChunkStreamReader) MessageStreamID() uint32 {
+	return r.messageStreamID
+}
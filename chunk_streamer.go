@@ -12,6 +12,7 @@ import (
 	"io"
 	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -40,7 +41,6 @@ type ChunkStreamer struct {
 	writerSched *chunkStreamerWriterSched
 
 	msgDec *message.Decoder
-	msgEnc *message.Encoder
 
 	selfState *StreamControlState
 	peerState *StreamControlState
@@ -50,6 +50,12 @@ type ChunkStreamer struct {
 
 	controlStreamWriter func(chunkStreamID int, timestamp uint32, msg message.Message) error
 
+	observer ConnObserver
+
+	chunkReadHook func(h *ChunkHeader)
+
+	ackSent uint32 // Accessed atomically
+
 	cacheBuffer []byte
 	config      *StreamControlStateConfig
 	logger      logrus.FieldLogger
@@ -62,10 +68,12 @@ func NewChunkStreamer(r io.Reader, w io.Writer, config *StreamControlStateConfig
 
 	cs := &ChunkStreamer{
 		r: &ChunkStreamerReader{
-			reader: r,
+			reader:   r,
+			observer: nopConnObserver{},
 		},
 		w: &ChunkStreamerWriter{
-			writer: w,
+			writer:   w,
+			observer: nopConnObserver{},
 		},
 
 		readers: make(map[int]*ChunkStreamReader),
@@ -77,13 +85,14 @@ func NewChunkStreamer(r io.Reader, w io.Writer, config *StreamControlStateConfig
 		},
 
 		msgDec: message.NewDecoder(nil),
-		msgEnc: message.NewEncoder(nil),
 
 		selfState: NewStreamControlState(config),
 		peerState: NewStreamControlState(config),
 
 		done: make(chan struct{}),
 
+		observer: nopConnObserver{},
+
 		cacheBuffer: make([]byte, 64*1024), // cache 64KB
 		config:      config,
 		logger:      logrus.StandardLogger(),
@@ -106,6 +115,7 @@ func (cs *ChunkStreamer) Read(cmsg *ChunkMessage) (int, uint32, error) {
 	}
 
 	cmsg.StreamID = reader.messageStreamID
+	cs.observer.OnMessageRead(reader.messageStreamID, message.TypeID(reader.messageTypeID), reader.messageLength)
 
 	return reader.basicHeader.chunkStreamID, uint32(reader.timestamp), nil
 }
@@ -122,14 +132,16 @@ func (cs *ChunkStreamer) Write(
 	}
 	//defer writer.Close()
 
-	cs.msgEnc.Reset(writer)
-	if err := cs.msgEnc.Encode(cmsg.Message); err != nil {
+	// An encoder per message, because messages are written from multiple streams concurrently
+	msgEnc := message.NewEncoder(writer)
+	if err := msgEnc.Encode(cmsg.Message); err != nil {
 		return err
 	}
 	writer.timestamp = timestamp
 	writer.messageLength = uint32(writer.buf.Len())
 	writer.messageTypeID = byte(cmsg.Message.TypeID())
 	writer.messageStreamID = cmsg.StreamID
+	cs.observer.OnMessageWritten(writer.messageStreamID, cmsg.Message.TypeID(), writer.messageLength)
 
 	return cs.Sched(writer)
 }
@@ -172,6 +184,43 @@ func (cs *ChunkStreamer) Sched(writer *ChunkStreamWriter) error {
 	return cs.writerSched.Sched(writer)
 }
 
+// ChunkHeader A header of a chunk which is read. Fields which are omitted by compressed headers are inherited
+// from previous chunks of the same chunk stream.
+type ChunkHeader struct {
+	Fmt           byte
+	ChunkStreamID int
+
+	// Timestamp is a value of the timestamp field. It is an absolute timestamp if Fmt is 0,
+	// a delta if Fmt is 1 or 2 and zero if Fmt is 3.
+	Timestamp       uint32
+	MessageLength   uint32
+	MessageTypeID   byte
+	MessageStreamID uint32
+
+	// PayloadLength is the length of a payload in the chunk.
+	PayloadLength int
+}
+
+// SetChunkReadHook sets f which is called with a header of each chunk after it is read. It is intended for dissectors.
+//
+// A ChunkStreamer which is used only to read chunks (e.g. bytes of one direction of a capture) does not send
+// acknowledgements, because it has no control stream.
+func (cs *ChunkStreamer) SetChunkReadHook(f func(h *ChunkHeader)) {
+	cs.chunkReadHook = f
+}
+
+// setObserver Sets an observer which receives events of reading and writing.
+func (cs *ChunkStreamer) setObserver(o ConnObserver) {
+	cs.observer = o
+	cs.r.observer = o
+	cs.w.observer = o
+}
+
+// lastAckSent Returns a sequence number of the last acknowledgement.
+func (cs *ChunkStreamer) lastAckSent() uint32 {
+	return atomic.LoadUint32(&cs.ackSent)
+}
+
 func (cs *ChunkStreamer) SelfState() *StreamControlState {
 	return cs.selfState
 }
@@ -244,9 +293,10 @@ func (cs *ChunkStreamer) readChunk() (*ChunkStreamReader, error) {
 	//cs.logger.Debugf("(READ) MessageLength = %d, Current = %d", reader.messageLength, reader.buf.Len())
 
 	expectLen := int(reader.messageLength) - reader.buf.Len()
-	if expectLen <= 0 {
+	if expectLen < 0 {
 		panic("invalid state") // TODO fix
 	}
+	// expectLen is 0 for an empty message, which completes with this chunk
 
 	if uint32(expectLen) > cs.peerState.chunkSize {
 		expectLen = int(cs.peerState.chunkSize)
@@ -254,11 +304,33 @@ func (cs *ChunkStreamer) readChunk() (*ChunkStreamReader, error) {
 	//cs.logger.Debugf("(READ) Length = %d", expectLen)
 
 	lr := io.LimitReader(cs.r, int64(expectLen))
-	if _, err := io.CopyBuffer(&reader.buf, lr, cs.cacheBuffer); err != nil {
+	n, err := io.CopyBuffer(&reader.buf, lr, cs.cacheBuffer)
+	if err != nil {
 		return nil, err
 	}
+	if n != int64(expectLen) {
+		return nil, io.ErrUnexpectedEOF
+	}
 	//cs.logger.Debugf("(READ) Buffer: %+v", reader.buf.Bytes())
 
+	if cs.chunkReadHook != nil {
+		h := &ChunkHeader{
+			Fmt:             bh.fmt,
+			ChunkStreamID:   bh.chunkStreamID,
+			MessageLength:   reader.messageLength,
+			MessageTypeID:   reader.messageTypeID,
+			MessageStreamID: reader.messageStreamID,
+			PayloadLength:   expectLen,
+		}
+		switch bh.fmt {
+		case 0:
+			h.Timestamp = mh.timestamp
+		case 1, 2:
+			h.Timestamp = mh.timestampDelta
+		}
+		cs.chunkReadHook(h)
+	}
+
 	if int(reader.messageLength)-reader.buf.Len() != 0 {
 		// fragmented
 		return reader, nil
@@ -385,6 +457,7 @@ func (cs *ChunkStreamer) prepareChunkReader(chunkStreamID int) (*ChunkStreamRead
 
 		reader = &ChunkStreamReader{}
 		cs.readers[chunkStreamID] = reader
+		cs.observer.OnChunkStreamCreated(chunkStreamID, false)
 	}
 
 	return reader, nil
@@ -418,13 +491,19 @@ func (cs *ChunkStreamer) prepareChunkWriter(chunkStreamID int) (*ChunkStreamWrit
 		}
 		close(writer.doneCh)
 		cs.writers[chunkStreamID] = writer
+		cs.observer.OnChunkStreamCreated(chunkStreamID, true)
 	}
 
 	return writer, nil
 }
 
 func (cs *ChunkStreamer) sendAck(readBytes uint32) error {
+	if cs.controlStreamWriter == nil {
+		return nil // Read only
+	}
+
 	cs.logger.Debugf("Sending Ack...: Bytes = %d", readBytes)
+	atomic.StoreUint32(&cs.ackSent, readBytes)
 	// TODO: fix timestamp
 	return cs.controlStreamWriter(ctrlMsgChunkStreamID, 0, &message.Ack{
 		SequenceNumber: readBytes,
@@ -439,6 +518,7 @@ type chunkStreamerWriterSched struct {
 
 func (sched *chunkStreamerWriterSched) Sched(writer *ChunkStreamWriter) error {
 	sched.writers <- writer
+	sched.streamer.observer.OnWriteQueueDepth(len(sched.writers))
 
 	return nil
 }
@@ -13,11 +13,14 @@ import (
 )
 
 type ChunkStreamerWriter struct {
-	writer io.Writer
+	writer   io.Writer
+	observer ConnObserver
 }
 
 func (w *ChunkStreamerWriter) Write(buf []byte) (int, error) {
-	return w.writer.Write(buf)
+	n, err := w.writer.Write(buf)
+	w.observer.OnBytesWritten(n)
+	return n, err
 }
 
 func (w *ChunkStreamerWriter) Flush() error {
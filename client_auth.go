@@ -0,0 +1,116 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// clientAuth A state of authmod=adobe or authmod=llnw authentication at client side. It follows FFmpeg.
+//
+//	connect                                 -> "[ code=403 need auth; authmod=adobe ]"
+//	connect(authmod=adobe&user=...)         -> "?reason=needauth&user=...&salt=...&challenge=...&opaque=..."
+//	connect(authmod=adobe&...&response=...) -> success or "?reason=authfailed"
+type clientAuth struct {
+	user        string
+	password    string
+	mod         AuthMod
+	params      string // Appended to app and tcUrl
+	isResponded bool
+}
+
+func newClientAuth(u *URL, mod AuthMod) *clientAuth {
+	a := &clientAuth{
+		user:     u.User,
+		password: u.Password,
+		mod:      mod,
+	}
+	if a.user != "" && mod != "" {
+		// The server is known to require authentication. Skip the first rejection
+		a.params = fmt.Sprintf("authmod=%s&user=%s", mod, a.user)
+	}
+
+	return a
+}
+
+func (a *clientAuth) appendParams(s string) string {
+	if a.params == "" {
+		return s
+	}
+	return s + "?" + a.params
+}
+
+// handleRejection Updates parameters to connect again. It returns an error if the client should not connect again.
+func (a *clientAuth) handleRejection(app string, err error) error {
+	rejected, ok := errors.Cause(err).(*ConnectRejectedError)
+	if !ok || a.user == "" {
+		return err
+	}
+	desc := rejected.Result.Information.Description
+
+	switch {
+	case strings.Contains(desc, "?reason=authfailed"):
+		return errors.Wrap(err, "Authentication failed: Incorrect user or password")
+	case strings.Contains(desc, "?reason=nosuchuser"):
+		return errors.Wrapf(err, "Authentication failed: No such user: User = %s", a.user)
+	case a.isResponded:
+		return errors.Wrap(err, "Authentication failed")
+	}
+
+	switch {
+	case strings.Contains(desc, "authmod=adobe"):
+		a.mod = AuthModAdobe
+	case strings.Contains(desc, "authmod=llnw"):
+		a.mod = AuthModLLNW
+	default:
+		return err // Not rejected by authentication
+	}
+
+	if !strings.Contains(desc, "?reason=needauth") {
+		if a.params != "" || !strings.Contains(desc, "code=403 need auth") {
+			return err
+		}
+		a.params = fmt.Sprintf("authmod=%s&user=%s", a.mod, a.user)
+
+		return nil
+	}
+
+	_, query := splitAuthQuery(desc)
+	params := parseAuthParams(query)
+
+	switch a.mod {
+	case AuthModAdobe:
+		opaque := params["opaque"]
+		if opaque == "" {
+			opaque = params["challenge"]
+		}
+		challenge := randomHex(4)
+		response := adobeAuthResponse(a.user, a.password, params["salt"], opaque, challenge)
+
+		a.params = fmt.Sprintf("authmod=%s&user=%s&challenge=%s&response=%s", a.mod, a.user, challenge, response)
+		if params["opaque"] != "" {
+			a.params += "&opaque=" + params["opaque"]
+		}
+
+	case AuthModLLNW:
+		nonce, cnonce, nc := params["nonce"], randomHex(4), "00000001"
+		response := llnwAuthResponse(a.user, a.password, app, nonce, nc, cnonce)
+
+		a.params = fmt.Sprintf(
+			"authmod=%s&user=%s&nonce=%s&cnonce=%s&nc=%s&response=%s",
+			a.mod, a.user, nonce, cnonce, nc, response,
+		)
+
+	}
+	a.isResponded = true
+
+	return nil
+}
@@ -8,8 +8,11 @@
 package rtmp
 
 import (
+	"context"
+	"crypto/tls"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -19,20 +22,51 @@ import (
 
 // ClientConn A wrapper of a connection. It prorives client-side specific features.
 type ClientConn struct {
-	conn    *Conn
-	lastErr error
-	m       sync.RWMutex
+	conn           *Conn
+	config         *ConnConfig
+	url            *URL
+	tlsConfig      *tls.Config
+	connectCmd     *message.NetConnectionConnect
+	connectResult  *message.NetConnectionConnectResult
+	authMod        AuthMod // Required by the server. Used to authenticate again when reconnecting
+	lastErr        error
+	isReconnecting bool
+	isClosed       bool
+	closeCh        chan struct{} // Closed by Close to stop reconnecting
+	m              sync.RWMutex
 }
 
+// reconnectTimeout A timeout to dial, handshake and connect when a server requests reconnecting.
+const reconnectTimeout = 10 * time.Second
+
 func newClientConnWithSetup(c net.Conn, config *ConnConfig) (*ClientConn, error) {
+	conn, err := setupClientConn(c, config)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := &ClientConn{
+		conn:    conn,
+		config:  config,
+		closeCh: make(chan struct{}),
+	}
+	conn.onReconnectRequest = cc.handleReconnectRequest
+	conn.onWriteError = func() bool { return cc.handleWriteError(conn) }
+	go cc.startHandleMessageLoop(conn)
+
+	return cc, nil
+}
+
+func setupClientConn(c net.Conn, config *ConnConfig) (*Conn, error) {
 	conn := newConn(c, config)
+	conn.netConn = c
 
-	if err := handshake.HandshakeWithServer(conn.rwc, conn.rwc, &handshake.Config{
-		SkipHandshakeVerification: conn.config.SkipHandshakeVerification,
-	}); err != nil {
+	result, err := handshake.NegotiateWithServer(conn.rwc, conn.rwc, conn.handshakeConfig())
+	if err != nil {
 		_ = conn.Close()
 		return nil, errors.Wrap(err, "Failed to handshake")
 	}
+	conn.setHandshakeResult(result)
 
 	ctrlStream, err := conn.streams.Create(ControlStreamID)
 	if err != nil {
@@ -43,16 +77,28 @@ func newClientConnWithSetup(c net.Conn, config *ConnConfig) (*ClientConn, error)
 
 	conn.streamer.controlStreamWriter = ctrlStream.Write
 
-	cc := &ClientConn{
-		conn: conn,
+	return conn, nil
+}
+
+func (cc *ClientConn) Close() error {
+	cc.m.Lock()
+	if !cc.isClosed {
+		close(cc.closeCh)
 	}
-	go cc.startHandleMessageLoop()
+	cc.isClosed = true
+	conn := cc.conn
+	cc.m.Unlock()
 
-	return cc, nil
+	return conn.Close()
 }
 
-func (cc *ClientConn) Close() error {
-	return cc.conn.Close()
+// URL returns the URL which the client is dialed with. It returns nil if the client is not created by DialURL.
+// It is updated when the client reconnects to another server.
+func (cc *ClientConn) URL() *URL {
+	cc.m.RLock()
+	defer cc.m.RUnlock()
+
+	return cc.url
 }
 
 func (cc *ClientConn) LastError() error {
@@ -62,33 +108,60 @@ func (cc *ClientConn) LastError() error {
 	return cc.lastErr
 }
 
+// Done returns a channel which is closed when a message loop of the current connection is finished.
+// LastError returns the reason.
+func (cc *ClientConn) Done() <-chan struct{} {
+	return cc.currentConn().loopDoneCh
+}
+
 func (cc *ClientConn) Connect(body *message.NetConnectionConnect) error {
+	return cc.ConnectWithContext(context.TODO(), body)
+}
+
+// ConnectWithContext sends a connect command and waits for the result until ctx is done.
+func (cc *ClientConn) ConnectWithContext(ctx context.Context, body *message.NetConnectionConnect) error {
 	if err := cc.controllable(); err != nil {
 		return err
 	}
 
-	stream, err := cc.conn.streams.At(ControlStreamID)
+	stream, err := cc.currentConn().streams.At(ControlStreamID)
 	if err != nil {
 		return err
 	}
 
-	result, err := stream.Connect(body)
+	if body == nil {
+		body = &message.NetConnectionConnect{}
+	}
+
+	result, err := stream.ConnectWithContext(ctx, body)
 	if err != nil {
 		return err // TODO: wrap an error
 	}
 
-	// TODO: check result
-	_ = result
+	cc.m.Lock()
+	cc.connectCmd = body
+	cc.connectResult = result
+	cc.m.Unlock()
 
 	return nil
 }
 
+// ConnectResult returns a result of the connect command. It returns nil if the connection is not connected yet.
+// Properties contain Enhanced RTMP capabilities accepted by the server.
+func (cc *ClientConn) ConnectResult() *message.NetConnectionConnectResult {
+	cc.m.RLock()
+	defer cc.m.RUnlock()
+
+	return cc.connectResult
+}
+
 func (cc *ClientConn) CreateStream(body *message.NetConnectionCreateStream, chunkSize uint32) (*Stream, error) {
 	if err := cc.controllable(); err != nil {
 		return nil, err
 	}
 
-	stream, err := cc.conn.streams.At(ControlStreamID)
+	conn := cc.currentConn()
+	stream, err := conn.streams.At(ControlStreamID)
 	if err != nil {
 		return nil, err
 	}
@@ -100,10 +173,11 @@ func (cc *ClientConn) CreateStream(body *message.NetConnectionCreateStream, chun
 
 	// TODO: check result
 
-	newStream, err := cc.conn.streams.Create(result.StreamID)
+	newStream, err := conn.streams.Create(result.StreamID)
 	if err != nil {
 		return nil, err
 	}
+	newStream.handler.ChangeState(streamStateClientData)
 
 	return newStream, nil
 }
@@ -113,13 +187,14 @@ func (cc *ClientConn) DeleteStream(body *message.NetStreamDeleteStream) error {
 		return err
 	}
 
-	ctrlStream, err := cc.conn.streams.At(ControlStreamID)
+	conn := cc.currentConn()
+	ctrlStream, err := conn.streams.At(ControlStreamID)
 	if err != nil {
 		return err
 	}
 
 	// Check if stream id exists
-	if _, err := cc.conn.streams.At(body.StreamID); err != nil {
+	if _, err := conn.streams.At(body.StreamID); err != nil {
 		return err
 	}
 
@@ -127,20 +202,342 @@ func (cc *ClientConn) DeleteStream(body *message.NetStreamDeleteStream) error {
 		return err
 	}
 
-	return cc.conn.streams.Delete(body.StreamID)
+	return conn.streams.Delete(body.StreamID)
+}
+
+func (cc *ClientConn) GetStreamLength(body *message.NetStreamGetStreamLength) (*message.NetStreamGetStreamLengthResult, error) {
+	if err := cc.controllable(); err != nil {
+		return nil, err
+	}
+
+	conn := cc.currentConn()
+	ctrlStream, err := conn.streams.At(ControlStreamID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ctrlStream.GetStreamLength(body)
+}
+
+// CheckBandwidth requests the server to check bandwidth from the server by checkBandwidth, and waits for onBWDone.
+func (cc *ClientConn) CheckBandwidth(ctx context.Context) (*BandwidthResult, error) {
+	if err := cc.controllable(); err != nil {
+		return nil, err
+	}
+
+	conn := cc.currentConn()
+	ctrlStream, err := conn.streams.At(ControlStreamID)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := conn.bandwidth.wait()
+	defer conn.bandwidth.cancel(ch)
+
+	chunkStreamID := 3 // TODO: fix
+	err = ctrlStream.writeCommandMessage(
+		chunkStreamID, 0,
+		"checkBandwidth",
+		0, // No results are required
+		&message.NetConnectionCheckBandwidth{},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-conn.loopDoneCh:
+		return nil, ErrConnectionClosed
+	case result := <-ch:
+		return result, nil
+	}
+}
+
+// CheckUplinkBandwidth checks bandwidth to the server by calling onBWCheck of the server.
+// It is configured by ConnConfig.BandwidthCheck.
+func (cc *ClientConn) CheckUplinkBandwidth(ctx context.Context) (*BandwidthResult, error) {
+	if err := cc.controllable(); err != nil {
+		return nil, err
+	}
+
+	conn := cc.currentConn()
+	ctrlStream, err := conn.streams.At(ControlStreamID)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &conn.config.BandwidthCheck
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+
+	return measureBandwidth(ctx, ctrlStream, config, bandwidthCommandNamesFMS.check)
+}
+
+func (cc *ClientConn) startHandleMessageLoop(conn *Conn) {
+	if err := conn.handleMessageLoop(); err != nil {
+		cc.m.Lock()
+		defer cc.m.Unlock()
+
+		// Ignore errors of connections which are replaced by reconnecting
+		if cc.conn != conn {
+			return
+		}
+
+		if conn.config.Reconnect.Enabled && !cc.isClosed && !cc.isReconnecting && cc.connectCmd != nil {
+			cc.isReconnecting = true
+			go cc.autoReconnect(conn, err)
+			return
+		}
+		cc.lastErr = err
+	}
+}
+
+func (cc *ClientConn) currentConn() *Conn {
+	cc.m.RLock()
+	defer cc.m.RUnlock()
+
+	return cc.conn
 }
 
-func (cc *ClientConn) startHandleMessageLoop() {
-	if err := cc.conn.handleMessageLoop(); err != nil {
-		cc.setLastError(err)
+// handleWriteError Closes conn if the client reconnects after failing to write to it. A socket may be dropped before
+// the message loop notices it, and closing it makes the loop fail and start reconnecting.
+func (cc *ClientConn) handleWriteError(conn *Conn) bool {
+	cc.m.RLock()
+	defer cc.m.RUnlock()
+
+	if !conn.config.Reconnect.Enabled || cc.isClosed || cc.conn != conn || cc.connectCmd == nil {
+		return false
 	}
+	_ = conn.netConn.Close()
+
+	return true
 }
 
-func (cc *ClientConn) setLastError(err error) {
+// handleReconnectRequest Reconnects in background when a server sends NetConnection.Connect.ReconnectRequest.
+func (cc *ClientConn) handleReconnectRequest(tcURL string) {
 	cc.m.Lock()
 	defer cc.m.Unlock()
 
-	cc.lastErr = err
+	if cc.isReconnecting || cc.isClosed {
+		return
+	}
+	cc.isReconnecting = true
+
+	go func() {
+		err := cc.reconnect(tcURL)
+
+		cc.m.Lock()
+		cc.isReconnecting = false
+		cc.m.Unlock()
+
+		if err != nil {
+			cc.currentConn().logger.Warnf("Failed to reconnect: TCURL = %s, Err = %+v", tcURL, err)
+		}
+	}()
+}
+
+// reconnect Dials tcURL (or the current URL if empty), connects with the same connect command and
+// publishes streams which were publishing again. Streams returned by CreateStream keep working on the new connection.
+// Streams which are not publishing are closed with the previous connection. Metadata and sequence headers are sent
+// again only if ReconnectConfig is enabled, because they are kept only then.
+func (cc *ClientConn) reconnect(tcURL string) error {
+	cc.m.RLock()
+	prevConn, prevURL, connectCmd := cc.conn, cc.url, cc.connectCmd
+	cc.m.RUnlock()
+
+	if connectCmd == nil {
+		return errors.New("Client is not connected")
+	}
+
+	u := prevURL
+	if tcURL != "" {
+		next, err := parseTCURL(tcURL)
+		if err != nil {
+			return err
+		}
+		if prevURL != nil {
+			next.StreamName, next.RawQuery = prevURL.StreamName, prevURL.RawQuery
+			next.User, next.Password = prevURL.User, prevURL.Password
+		}
+		u = next
+	}
+	if u == nil {
+		return errors.New("URL to reconnect is unknown")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reconnectTimeout)
+	defer cancel()
+
+	connected, err := cc.dialAndConnect(ctx, u, connectCmd)
+	if err != nil {
+		return err
+	}
+	conn := connected.conn
+
+	ctrlStream, err := conn.streams.At(ControlStreamID)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	// Create streams for publishing first not to break streams if it is failed
+	chunkSize := prevConn.streamer.SelfState().ChunkSize()
+	var publishingStreams []*Stream
+	var streamIDs []uint32
+	for _, s := range prevConn.streams.list() {
+		if s.publishCommand() == nil {
+			continue
+		}
+
+		res, err := ctrlStream.CreateStream(nil, chunkSize)
+		if err != nil {
+			_ = conn.Close()
+			return errors.Wrap(err, "Failed to create stream")
+		}
+
+		publishingStreams = append(publishingStreams, s)
+		streamIDs = append(streamIDs, res.StreamID)
+	}
+
+	cc.m.Lock()
+	if cc.isClosed {
+		cc.m.Unlock()
+		_ = conn.Close()
+		return errors.New("Client is closed")
+	}
+	cc.conn = conn
+	cc.url = connected.url
+	cc.connectCmd = connected.cmd
+	cc.connectResult = connected.result
+	cc.m.Unlock()
+
+	_ = conn.netConn.SetDeadline(time.Time{})
+
+	// Move all streams first to keep them in the current connection even if publishing is failed
+	for i, s := range publishingStreams {
+		s.rebind(conn, streamIDs[i])
+		if err := conn.streams.add(s); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range publishingStreams {
+		if err := s.Publish(s.publishCommand()); err != nil {
+			return errors.Wrap(err, "Failed to publish")
+		}
+
+		if err := s.resumePublishing(); err != nil {
+			return errors.Wrap(err, "Failed to resume publishing")
+		}
+	}
+
+	return prevConn.Close()
+}
+
+// clientConnected A connection which is connected by dialAndConnect.
+type clientConnected struct {
+	conn   *Conn
+	url    *URL // A URL after redirections
+	cmd    *message.NetConnectionConnect
+	result *message.NetConnectionConnectResult
+}
+
+// dialAndConnect Dials u and sends a connect command based on body. App and tcUrl are filled with u.
+// If the server requires authentication and u has a user, it connects again with authentication parameters.
+// Redirections are followed up to ConnConfig.MaxConnectRedirects times.
+// A deadline of ctx is set to the returned connection.
+func (cc *ClientConn) dialAndConnect(
+	ctx context.Context,
+	u *URL,
+	body *message.NetConnectionConnect,
+) (*clientConnected, error) {
+	maxRedirects := 0
+	if cc.config != nil {
+		maxRedirects = cc.config.MaxConnectRedirects
+	}
+
+	cc.m.RLock()
+	auth := newClientAuth(u, cc.authMod)
+	cc.m.RUnlock()
+
+	redirects := 0
+	for {
+		cmd := *body
+		cmd.Command.App = auth.appendParams(u.ConnectApp())
+		cmd.Command.TCURL = auth.appendParams(u.TCURL())
+
+		conn, result, err := cc.dialAndConnectOnce(ctx, u, &cmd)
+		if err == nil {
+			cc.m.Lock()
+			cc.authMod = auth.mod
+			cc.m.Unlock()
+
+			return &clientConnected{
+				conn:   conn,
+				url:    u,
+				cmd:    &cmd,
+				result: result,
+			}, nil
+		}
+
+		if rejected, ok := errors.Cause(err).(*ConnectRejectedError); ok {
+			if tcURL, ok := rejected.Redirect(); ok && redirects < maxRedirects {
+				next, err := parseTCURL(tcURL)
+				if err != nil {
+					return nil, errors.Wrapf(err, "Invalid redirection: TCURL = %s", tcURL)
+				}
+				next.StreamName, next.RawQuery = u.StreamName, u.RawQuery
+				next.User, next.Password = u.User, u.Password
+
+				u = next
+				auth = newClientAuth(u, "")
+				redirects++
+				continue
+			}
+		}
+
+		if err := auth.handleRejection(u.ConnectApp(), err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (cc *ClientConn) dialAndConnectOnce(
+	ctx context.Context,
+	u *URL,
+	cmd *message.NetConnectionConnect,
+) (*Conn, *message.NetConnectionConnectResult, error) {
+	rwc, err := dialURL(ctx, u, cc.tlsConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = rwc.SetDeadline(deadline)
+	}
+
+	conn, err := setupClientConn(rwc, cc.config)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.onReconnectRequest = cc.handleReconnectRequest
+	conn.onWriteError = func() bool { return cc.handleWriteError(conn) }
+	go cc.startHandleMessageLoop(conn)
+
+	ctrlStream, err := conn.streams.At(ControlStreamID)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	result, err := ctrlStream.ConnectWithContext(ctx, cmd)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, result, nil
 }
 
 func (cc *ClientConn) controllable() error {
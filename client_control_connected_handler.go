@@ -0,0 +1,83 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"github.com/yutopp/go-rtmp/internal"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+var _ stateHandler = (*clientControlConnectedHandler)(nil)
+
+// clientControlConnectedHandler Handle control messages from a server after connected.
+//
+//	transitions:
+//	  | _ -> self
+type clientControlConnectedHandler struct {
+	sh *streamHandler
+}
+
+func (h *clientControlConnectedHandler) onMessage(
+	chunkStreamID int,
+	timestamp uint32,
+	msg message.Message,
+) error {
+	return internal.ErrPassThroughMsg
+}
+
+func (h *clientControlConnectedHandler) onData(
+	chunkStreamID int,
+	timestamp uint32,
+	dataMsg *message.DataMessage,
+	body interface{},
+) error {
+	return internal.ErrPassThroughMsg
+}
+
+func (h *clientControlConnectedHandler) onCommand(
+	chunkStreamID int,
+	timestamp uint32,
+	cmdMsg *message.CommandMessage,
+	body interface{},
+) error {
+	l := h.sh.Logger()
+
+	switch cmd := body.(type) {
+	case *message.NetStreamOnStatus:
+		if string(cmd.InfoObject.Code) != string(message.NetConnectionConnectCodeReconnectRequest) {
+			return internal.ErrPassThroughMsg
+		}
+
+		conn := h.sh.stream.currentConn()
+		if conn.onReconnectRequest == nil {
+			return internal.ErrPassThroughMsg
+		}
+
+		l.Infof("Reconnect requested: TCURL = %s", cmd.InfoObject.TCURL)
+		conn.onReconnectRequest(cmd.InfoObject.TCURL)
+
+		return nil
+
+	case *message.NetConnectionOnBWCheck:
+		return replyOnBWCheck(h.sh, chunkStreamID, timestamp, cmdMsg.TransactionID)
+
+	case *message.NetConnectionOnBWDone:
+		result := newBandwidthResult(cmd)
+		l.Infof("Bandwidth checked: Kbps = %.1f, Latency = %s", result.Kbps, result.Latency)
+
+		h.sh.stream.currentConn().bandwidth.done(result)
+		if bh, ok := h.sh.stream.userHandler().(BandwidthHandler); ok {
+			bh.OnBandwidthChecked(result)
+		}
+
+		return nil
+
+	default:
+		return internal.ErrPassThroughMsg
+	}
+}
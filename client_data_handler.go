@@ -0,0 +1,72 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"github.com/yutopp/go-rtmp/internal"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+var _ stateHandler = (*clientDataHandler)(nil)
+
+// clientDataHandler Handle data messages from a server at client side. All messages are passed to a user handler.
+// onStatus and onPlayStatus are passed to StatusHandler if the user handler implements it.
+//
+//	transitions:
+//	  | _ -> self
+type clientDataHandler struct {
+	sh *streamHandler
+}
+
+func (h *clientDataHandler) onMessage(
+	chunkStreamID int,
+	timestamp uint32,
+	msg message.Message,
+) error {
+	return internal.ErrPassThroughMsg
+}
+
+func (h *clientDataHandler) onData(
+	chunkStreamID int,
+	timestamp uint32,
+	dataMsg *message.DataMessage,
+	body interface{},
+) error {
+	switch data := body.(type) {
+	case *message.NetStreamOnPlayStatus:
+		sh, ok := h.sh.stream.userHandler().(StatusHandler)
+		if !ok {
+			return internal.ErrPassThroughMsg
+		}
+
+		return sh.OnPlayStatus(timestamp, data)
+
+	default:
+		return internal.ErrPassThroughMsg
+	}
+}
+
+func (h *clientDataHandler) onCommand(
+	chunkStreamID int,
+	timestamp uint32,
+	cmdMsg *message.CommandMessage,
+	body interface{},
+) error {
+	switch cmd := body.(type) {
+	case *message.NetStreamOnStatus:
+		sh, ok := h.sh.stream.userHandler().(StatusHandler)
+		if !ok {
+			return internal.ErrPassThroughMsg
+		}
+
+		return sh.OnStatus(timestamp, cmd)
+
+	default:
+		return internal.ErrPassThroughMsg
+	}
+}
@@ -0,0 +1,396 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/yutopp/go-rtmp/media"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+// ReconnectMediaPolicy Decides what happens to media which are written while a client is disconnected.
+type ReconnectMediaPolicy int
+
+const (
+	// ReconnectDropMedia drops media while disconnected. Video is resumed from a next key frame.
+	ReconnectDropMedia ReconnectMediaPolicy = iota
+	// ReconnectBufferMedia buffers media while disconnected and sends them after resuming.
+	// If the buffer overflows, buffered media are dropped and video is buffered again from a next key frame.
+	ReconnectBufferMedia
+)
+
+// ReconnectConfig Configurations of automatic reconnection of clients. It is disabled by default.
+//
+// When a connection is lost, a client dials the same URL with exponential backoff, connects with the same command,
+// creates streams which were publishing and publishes them again with the same names. Streams returned by
+// CreateStream keep working, and metadata and sequence headers are sent again after resuming.
+// Only clients created by DialURL can reconnect.
+type ReconnectConfig struct {
+	Enabled bool
+
+	// MinBackoff is a first interval between attempts. It is doubled on each failure up to MaxBackoff.
+	// Default is 500ms and 30s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// MaxRetries is the number of attempts before giving up. Unlimited if zero.
+	MaxRetries int
+
+	MediaPolicy ReconnectMediaPolicy
+
+	// MaxBufferedMessages limits media buffered by ReconnectBufferMedia per stream. Default is 1024.
+	MaxBufferedMessages int
+
+	// OnEvent is called when a state of reconnection is changed. It must not block.
+	OnEvent func(ev *ReconnectEvent)
+}
+
+func (cb *ReconnectConfig) normalize() *ReconnectConfig {
+	c := ReconnectConfig(*cb)
+
+	if c.MinBackoff == 0 {
+		c.MinBackoff = 500 * time.Millisecond
+	}
+
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = 30 * time.Second
+	}
+
+	if c.MaxBufferedMessages == 0 {
+		c.MaxBufferedMessages = 1024
+	}
+
+	return &c
+}
+
+// ReconnectEventType A type of reconnection events.
+type ReconnectEventType int
+
+const (
+	ReconnectEventDisconnected ReconnectEventType = iota + 1
+	ReconnectEventReconnecting
+	ReconnectEventResumed
+	ReconnectEventGaveUp
+)
+
+func (t ReconnectEventType) String() string {
+	switch t {
+	case ReconnectEventDisconnected:
+		return "Disconnected"
+	case ReconnectEventReconnecting:
+		return "Reconnecting"
+	case ReconnectEventResumed:
+		return "Resumed"
+	case ReconnectEventGaveUp:
+		return "GaveUp"
+	default:
+		return "<Unknown>"
+	}
+}
+
+// ReconnectEvent An event of reconnection.
+type ReconnectEvent struct {
+	Type    ReconnectEventType
+	Attempt int   // 1-origin. Zero for ReconnectEventDisconnected
+	Err     error // A reason of disconnection or the last failure
+}
+
+// autoReconnect Reconnects until it succeeds, the client is closed or it gives up.
+func (cc *ClientConn) autoReconnect(prevConn *Conn, cause error) {
+	config := &prevConn.config.Reconnect
+	l := prevConn.logger
+
+	defer func() {
+		cc.m.Lock()
+		cc.isReconnecting = false
+		cc.m.Unlock()
+	}()
+
+	for _, s := range prevConn.streams.list() {
+		s.suspend()
+	}
+
+	l.Warnf("Connection is lost. Reconnecting...: Err = %+v", cause)
+	config.emit(&ReconnectEvent{Type: ReconnectEventDisconnected, Err: cause})
+
+	backoff := config.MinBackoff
+	for attempt := 1; ; attempt++ {
+		config.emit(&ReconnectEvent{Type: ReconnectEventReconnecting, Attempt: attempt})
+
+		err := cc.reconnect("")
+		if err == nil {
+			l.Infof("Reconnected: Attempt = %d", attempt)
+			config.emit(&ReconnectEvent{Type: ReconnectEventResumed, Attempt: attempt})
+			return
+		}
+		l.Warnf("Failed to reconnect: Attempt = %d, Err = %+v", attempt, err)
+
+		// Streams may be moved to a new connection which is broken, or some of them may be resumed already
+		for _, s := range cc.currentConn().streams.list() {
+			s.suspend()
+		}
+
+		if config.MaxRetries > 0 && attempt >= config.MaxRetries {
+			cc.m.Lock()
+			cc.lastErr = errors.Wrapf(cause, "Gave up reconnecting: Err = %+v", err)
+			cc.m.Unlock()
+
+			config.emit(&ReconnectEvent{Type: ReconnectEventGaveUp, Attempt: attempt, Err: err})
+			return
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-cc.closeCh:
+			timer.Stop()
+			return
+		}
+
+		backoff *= 2
+		if backoff > config.MaxBackoff {
+			backoff = config.MaxBackoff
+		}
+	}
+}
+
+func (c *ReconnectConfig) emit(ev *ReconnectEvent) {
+	if c.OnEvent != nil {
+		c.OnEvent(ev)
+	}
+}
+
+// pendingMessage A media message which can be sent again if its payload is kept.
+type pendingMessage struct {
+	chunkStreamID int
+	timestamp     uint32
+	typeID        message.TypeID
+	encoding      message.EncodingType // @setDataFrame only
+	body          io.Reader            // Can be read only once. nil if kept
+	payload       []byte
+	isKeyFrame    bool
+}
+
+// keep Copies the body to send the message again.
+func (pm *pendingMessage) keep() error {
+	if pm.body == nil {
+		return nil // Already kept
+	}
+
+	b, err := ioutil.ReadAll(pm.body)
+	if err != nil {
+		return err
+	}
+	pm.body, pm.payload = nil, b
+
+	return nil
+}
+
+func (pm *pendingMessage) message() message.Message {
+	body := pm.body
+	if body == nil {
+		body = bytes.NewReader(pm.payload)
+	}
+
+	switch pm.typeID {
+	case message.TypeIDAudioMessage:
+		return &message.AudioMessage{Payload: body}
+	case message.TypeIDVideoMessage:
+		return &message.VideoMessage{Payload: body}
+	default:
+		return &message.DataMessage{
+			Name:     "@setDataFrame",
+			Encoding: pm.encoding,
+			Body:     body,
+		}
+	}
+}
+
+// peekAudioFrame Decodes a header of a payload to know a type of it, and returns a reader of the whole payload.
+// Only multitrack payloads are read into memory to know a codec of the first track. Payloads which cannot be decoded
+// leave f empty.
+func peekAudioFrame(r io.Reader, f *media.AudioFrame) (io.Reader, error) {
+	var peeked bytes.Buffer
+	if err := message.DecodeAudioHeader(io.TeeReader(r, &peeked), &f.AudioHeader); err != nil || !f.IsMultitrack {
+		return io.MultiReader(&peeked, r), nil
+	}
+
+	b, err := ioutil.ReadAll(io.MultiReader(&peeked, r))
+	if err != nil {
+		return nil, err
+	}
+	if frames, err := media.DecodeAudioFrames(bytes.NewReader(b)); err == nil && len(frames) > 0 {
+		*f = frames[0]
+	}
+
+	return bytes.NewReader(b), nil
+}
+
+// peekVideoFrame Decodes a header of a payload to know a type of it, and returns a reader of the whole payload.
+// Only multitrack payloads are read into memory to know a codec of the first track. Payloads which cannot be decoded
+// leave f empty.
+func peekVideoFrame(r io.Reader, f *media.VideoFrame) (io.Reader, error) {
+	var peeked bytes.Buffer
+	if err := message.DecodeVideoHeader(io.TeeReader(r, &peeked), &f.VideoHeader); err != nil || !f.IsMultitrack {
+		return io.MultiReader(&peeked, r), nil
+	}
+
+	b, err := ioutil.ReadAll(io.MultiReader(&peeked, r))
+	if err != nil {
+		return nil, err
+	}
+	if frames, err := media.DecodeVideoFrames(bytes.NewReader(b)); err == nil && len(frames) > 0 {
+		*f = frames[0]
+	}
+
+	return bytes.NewReader(b), nil
+}
+
+// publishSession Keeps metadata and sequence headers of a publishing stream to resume it on a new connection,
+// and buffers or drops media while the stream is suspended. Fields are guarded by Stream.wm.
+type publishSession struct {
+	config *ReconnectConfig
+
+	metaData       *pendingMessage
+	audioSeqHeader *pendingMessage
+	videoSeqHeader *pendingMessage
+
+	isSuspended  bool
+	waitKeyFrame bool // Drops video until a key frame
+	pending      []*pendingMessage
+}
+
+func newPublishSession(config *ReconnectConfig) *publishSession {
+	return &publishSession{
+		config: config,
+	}
+}
+
+// record Keeps headers, and returns a message which should be sent now with its record. It returns nil if the
+// message is buffered or dropped. Payloads of media are decoded only by headers, and copied only if they are sequence
+// headers or can be buffered. Other messages are returned as they are.
+func (ps *publishSession) record(
+	chunkStreamID int,
+	timestamp uint32,
+	msg message.Message,
+) (message.Message, *pendingMessage, error) {
+	pm := &pendingMessage{chunkStreamID: chunkStreamID, timestamp: timestamp, typeID: msg.TypeID()}
+	switch msg := msg.(type) {
+	case *message.AudioMessage:
+		var f media.AudioFrame
+		body, err := peekAudioFrame(msg.Payload, &f)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Failed to read audio payload")
+		}
+		pm.body = body
+
+		if f.IsSequenceHeader() {
+			ps.audioSeqHeader = pm
+		}
+
+	case *message.VideoMessage:
+		var f media.VideoFrame
+		body, err := peekVideoFrame(msg.Payload, &f)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Failed to read video payload")
+		}
+		pm.body = body
+		pm.isKeyFrame = f.IsKeyFrame()
+
+		isSeqHeader := f.IsSequenceHeader()
+		if isSeqHeader {
+			ps.videoSeqHeader = pm
+		}
+
+		if ps.waitKeyFrame && !isSeqHeader {
+			if !pm.isKeyFrame {
+				return nil, nil, nil // Dropped
+			}
+			ps.waitKeyFrame = false
+		}
+
+	case *message.DataMessage:
+		if msg.Name != "@setDataFrame" {
+			return msg, nil, nil
+		}
+		pm.encoding = msg.Encoding
+		pm.body = msg.Body
+		ps.metaData = pm
+
+	default:
+		return msg, nil, nil
+	}
+
+	// Media which are not buffered are sent only once. They may be buffered when writing them fails
+	if ps.isHeader(pm) || ps.config.MediaPolicy == ReconnectBufferMedia {
+		if err := pm.keep(); err != nil {
+			return nil, nil, errors.Wrap(err, "Failed to read payload")
+		}
+	}
+
+	if !ps.isSuspended {
+		return pm.message(), pm, nil
+	}
+	ps.enqueue(pm)
+
+	return nil, nil, nil
+}
+
+// enqueue Buffers or drops a message while the stream is suspended.
+func (ps *publishSession) enqueue(pm *pendingMessage) {
+	if ps.isHeader(pm) {
+		return // Sent when resuming
+	}
+
+	if ps.config.MediaPolicy != ReconnectBufferMedia {
+		ps.waitKeyFrame = ps.videoSeqHeader != nil
+		return
+	}
+
+	if len(ps.pending) >= ps.config.MaxBufferedMessages {
+		// Headers are sent when resuming, so video can be restarted from a next key frame
+		ps.pending = nil
+		ps.waitKeyFrame = ps.videoSeqHeader != nil && !pm.isKeyFrame
+		if ps.waitKeyFrame {
+			return
+		}
+	}
+	ps.pending = append(ps.pending, pm)
+}
+
+func (ps *publishSession) isHeader(pm *pendingMessage) bool {
+	return pm == ps.metaData || pm == ps.videoSeqHeader || pm == ps.audioSeqHeader
+}
+
+func (ps *publishSession) suspend() {
+	ps.isSuspended = true
+}
+
+// resume Returns messages to send on a new connection. Headers come first.
+// The stream is kept suspended until resumed is called after all of them are sent.
+func (ps *publishSession) resume() []*pendingMessage {
+	var messages []*pendingMessage
+	for _, pm := range []*pendingMessage{ps.metaData, ps.videoSeqHeader, ps.audioSeqHeader} {
+		if pm != nil {
+			messages = append(messages, pm)
+		}
+	}
+	return append(messages, ps.pending...)
+}
+
+// resumed Drops buffered media which are sent by resume, and stops suspending.
+func (ps *publishSession) resumed() {
+	ps.isSuspended = false
+	ps.pending = nil
+}
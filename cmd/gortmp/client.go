@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	flvtag "github.com/yutopp/go-flv/tag"
+
+	"github.com/yutopp/go-rtmp"
+	"github.com/yutopp/go-rtmp/internal"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+const (
+	clientChunkStreamIDAudio = 4
+	clientChunkStreamIDData  = 5
+	clientChunkStreamIDVideo = 6
+)
+
+// clientConfig Options shared by publish, play and probe.
+type clientConfig struct {
+	ChunkSize uint32
+	Timeout   time.Duration // Limits connecting and waiting for NetStream.Publish.Start or NetStream.Play.Start
+	Logger    logrus.FieldLogger
+}
+
+// clientSession A connection which has a stream to publish or play URL.PlayPath().
+type clientSession struct {
+	cc      *rtmp.ClientConn
+	stream  *rtmp.Stream
+	handler *clientHandler
+}
+
+// dialSession Dials rawurl and creates a stream. Media which are played are passed to onTag if it is not nil.
+func dialSession(ctx context.Context, rawurl string, config *clientConfig, onTag func(tag *flvTag) error) (*clientSession, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+
+	h := &clientHandler{
+		statusCh: make(chan *message.NetStreamOnStatus, 16),
+		onTag:    onTag,
+	}
+	cc, err := rtmp.DialURL(ctx, rawurl, &rtmp.ConnConfig{
+		Handler: h,
+		Logger:  config.Logger,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to connect")
+	}
+
+	// Abort waiting for responses by closing the connection
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = cc.Close()
+		case <-doneCh:
+		}
+	}()
+
+	s, err := cc.CreateStream(nil, config.ChunkSize)
+	if err != nil {
+		_ = cc.Close()
+		return nil, errors.Wrap(err, "Failed to create stream")
+	}
+
+	return &clientSession{
+		cc:      cc,
+		stream:  s,
+		handler: h,
+	}, nil
+}
+
+func (s *clientSession) Name() string {
+	return s.cc.URL().PlayPath()
+}
+
+// Publish sends publish and waits for NetStream.Publish.Start.
+func (s *clientSession) Publish(ctx context.Context, timeout time.Duration) error {
+	if err := s.stream.Publish(&message.NetStreamPublish{
+		PublishingName: s.Name(),
+		PublishingType: "live",
+	}); err != nil {
+		return errors.Wrap(err, "Failed to publish")
+	}
+
+	return s.waitStatus(ctx, timeout, message.NetStreamOnStatusCodePublishStart)
+}
+
+// Play sends play and waits for NetStream.Play.Start.
+func (s *clientSession) Play(ctx context.Context, timeout time.Duration) error {
+	if err := s.stream.Play(&message.NetStreamPlay{
+		StreamName: s.Name(),
+		Start:      -2,
+		Duration:   -1,
+	}); err != nil {
+		return errors.Wrap(err, "Failed to play")
+	}
+
+	return s.waitStatus(ctx, timeout, message.NetStreamOnStatusCodePlayStart)
+}
+
+// WriteTag writes a tag of an FLV file. Script data other than onMetaData are skipped.
+func (s *clientSession) WriteTag(tag *flvTag) error {
+	switch tag.Type {
+	case flvtag.TagTypeAudio:
+		return s.stream.Write(clientChunkStreamIDAudio, tag.Timestamp, &message.AudioMessage{
+			Payload: bytes.NewReader(tag.Body),
+		})
+
+	case flvtag.TagTypeVideo:
+		return s.stream.Write(clientChunkStreamIDVideo, tag.Timestamp, &message.VideoMessage{
+			Payload: bytes.NewReader(tag.Body),
+		})
+
+	case flvtag.TagTypeScriptData:
+		if name, _, _ := internal.SplitAMF0String(tag.Body); name != "onMetaData" {
+			return nil
+		}
+		return s.stream.Write(clientChunkStreamIDData, tag.Timestamp, &message.DataMessage{
+			Name:     "@setDataFrame",
+			Encoding: message.EncodingTypeAMF0,
+			Body:     bytes.NewReader(tag.Body),
+		})
+
+	default:
+		return nil
+	}
+}
+
+// Err returns an error if the stream is stopped by the server or the connection is closed. It does not block.
+func (s *clientSession) Err() error {
+	for {
+		select {
+		case status := <-s.handler.statusCh:
+			if err := statusError(status); err != nil {
+				return err
+			}
+		case <-s.cc.Done():
+			return s.connError()
+		default:
+			return nil
+		}
+	}
+}
+
+// Wait blocks until the stream is finished by the server, the connection is closed or ctx is done.
+// It returns nil when players are notified that the stream is finished.
+func (s *clientSession) Wait(ctx context.Context) error {
+	for {
+		select {
+		case status := <-s.handler.statusCh:
+			switch status.InfoObject.Code {
+			case message.NetStreamOnStatusCodePlayStop, message.NetStreamOnStatusCodePlayUnpublishNotify:
+				return nil
+			}
+			if err := statusError(status); err != nil {
+				return err
+			}
+		case <-s.cc.Done():
+			return s.connError()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close deletes the stream and closes the connection. Written messages are flushed.
+func (s *clientSession) Close() error {
+	_ = s.cc.DeleteStream(&message.NetStreamDeleteStream{StreamID: s.stream.StreamID()})
+	return s.cc.Close()
+}
+
+func (s *clientSession) waitStatus(ctx context.Context, timeout time.Duration, code message.NetStreamOnStatusCode) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		select {
+		case status := <-s.handler.statusCh:
+			if status.InfoObject.Code == code {
+				return nil
+			}
+			if err := statusError(status); err != nil {
+				return err
+			}
+		case <-s.cc.Done():
+			return s.connError()
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "Failed to wait for %s", code)
+		}
+	}
+}
+
+func (s *clientSession) connError() error {
+	if err := s.cc.LastError(); err != nil {
+		return errors.Wrap(err, "Connection is closed")
+	}
+	return rtmp.ErrConnectionClosed
+}
+
+func statusError(status *message.NetStreamOnStatus) error {
+	if status.InfoObject.Level != message.NetStreamOnStatusLevelError {
+		return nil
+	}
+	return errors.Errorf("%s: %s", status.InfoObject.Code, status.InfoObject.Description)
+}
+
+var _ rtmp.StatusHandler = (*clientHandler)(nil)
+
+// clientHandler Receives statuses and played media of a stream.
+type clientHandler struct {
+	rtmp.DefaultHandler
+	statusCh chan *message.NetStreamOnStatus
+
+	onTag func(tag *flvTag) error
+	m     sync.Mutex
+}
+
+func (h *clientHandler) OnStatus(_ uint32, status *message.NetStreamOnStatus) error {
+	select {
+	case h.statusCh <- status:
+	default:
+		// Statuses are dropped not to block the connection
+	}
+	return nil
+}
+
+func (h *clientHandler) OnPlayStatus(_ uint32, _ *message.NetStreamOnPlayStatus) error {
+	return nil
+}
+
+func (h *clientHandler) OnUnknownMessage(timestamp uint32, msg message.Message) error {
+	switch msg := msg.(type) {
+	case *message.AudioMessage:
+		return h.handleTag(flvtag.TagTypeAudio, timestamp, msg.Payload)
+	case *message.VideoMessage:
+		return h.handleTag(flvtag.TagTypeVideo, timestamp, msg.Payload)
+	default:
+		return nil
+	}
+}
+
+func (h *clientHandler) OnUnknownDataMessage(timestamp uint32, data *message.DataMessage) error {
+	if data.Name != "onMetaData" || data.Encoding != message.EncodingTypeAMF0 {
+		return nil
+	}
+
+	// Restore a body of a script tag which is sent by @setDataFrame
+	return h.handleTag(flvtag.TagTypeScriptData, timestamp, io.MultiReader(
+		bytes.NewReader(internal.AppendAMF0String(nil, data.Name)),
+		data.Body,
+	))
+}
+
+func (h *clientHandler) handleTag(ty flvtag.TagType, timestamp uint32, payload io.Reader) error {
+	if h.onTag == nil {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return err
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.onTag(&flvTag{
+		Type:      ty,
+		Timestamp: timestamp,
+		Body:      body,
+	})
+}
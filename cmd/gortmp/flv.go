@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/yutopp/go-flv"
+	flvtag "github.com/yutopp/go-flv/tag"
+)
+
+const (
+	flvTagHeaderLength  = 11
+	flvPrevTagSizeBytes = 4
+)
+
+// flvTag A tag whose body is kept as it is, so that Enhanced RTMP payloads are passed through.
+type flvTag struct {
+	Type      flvtag.TagType
+	Timestamp uint32
+	Body      []byte
+}
+
+// flvReader Reads tags of an FLV file sequentially. It works with stdin, which cannot seek.
+type flvReader struct {
+	r *bufio.Reader
+}
+
+func newFLVReader(r io.Reader) (*flvReader, error) {
+	br := bufio.NewReader(r)
+
+	header, err := flv.DecodeFlvHeader(br)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to decode FLV header")
+	}
+	if header.DataOffset > flv.HeaderLength {
+		if _, err := br.Discard(int(header.DataOffset - flv.HeaderLength)); err != nil {
+			return nil, errors.Wrap(err, "Failed to skip FLV header")
+		}
+	}
+	if _, err := br.Discard(flvPrevTagSizeBytes); err != nil {
+		return nil, errors.Wrap(err, "Failed to read the first PreviousTagSize")
+	}
+
+	return &flvReader{r: br}, nil
+}
+
+// ReadTag returns io.EOF at the end of the file.
+func (r *flvReader) ReadTag() (*flvTag, error) {
+	var header [flvTagHeaderLength]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errors.Wrap(err, "Failed to read tag header")
+	}
+
+	size := uint32(header[1])<<16 | uint32(header[2])<<8 | uint32(header[3])
+	timestamp := uint32(header[7])<<24 | uint32(header[4])<<16 | uint32(header[5])<<8 | uint32(header[6])
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return nil, errors.Wrap(err, "Failed to read tag body")
+	}
+
+	// A truncated PreviousTagSize of the last tag is allowed
+	if _, err := r.r.Discard(flvPrevTagSizeBytes); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "Failed to read PreviousTagSize")
+	}
+
+	return &flvTag{
+		Type:      flvtag.TagType(header[0] & 0x1f),
+		Timestamp: timestamp,
+		Body:      body,
+	}, nil
+}
+
+// flvWriter Writes tags to an FLV file sequentially.
+type flvWriter struct {
+	w *bufio.Writer
+}
+
+func newFLVWriter(w io.Writer) (*flvWriter, error) {
+	bw := bufio.NewWriter(w)
+
+	if err := flv.EncodeFlvHeader(bw, &flv.Header{
+		Version:    1,
+		Flags:      flv.FlagsAudio | flv.FlagsVideo,
+		DataOffset: flv.HeaderLength,
+	}); err != nil {
+		return nil, errors.Wrap(err, "Failed to encode FLV header")
+	}
+	if _, err := bw.Write(make([]byte, flvPrevTagSizeBytes)); err != nil {
+		return nil, errors.Wrap(err, "Failed to write the first PreviousTagSize")
+	}
+
+	return &flvWriter{w: bw}, nil
+}
+
+func (w *flvWriter) WriteTag(tag *flvTag) error {
+	var header [flvTagHeaderLength]byte
+	header[0] = byte(tag.Type)
+	header[1], header[2], header[3] = byte(len(tag.Body)>>16), byte(len(tag.Body)>>8), byte(len(tag.Body))
+	header[4], header[5], header[6] = byte(tag.Timestamp>>16), byte(tag.Timestamp>>8), byte(tag.Timestamp)
+	header[7] = byte(tag.Timestamp >> 24)
+
+	var prevTagSize [flvPrevTagSizeBytes]byte
+	binary.BigEndian.PutUint32(prevTagSize[:], uint32(flvTagHeaderLength+len(tag.Body)))
+
+	for _, b := range [][]byte{header[:], tag.Body, prevTagSize[:]} {
+		if _, err := w.w.Write(b); err != nil {
+			return errors.Wrap(err, "Failed to write tag")
+		}
+	}
+
+	return nil
+}
+
+func (w *flvWriter) Flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/yutopp/go-amf0"
+	flvtag "github.com/yutopp/go-flv/tag"
+
+	"github.com/yutopp/go-rtmp/internal"
+	"github.com/yutopp/go-rtmp/relay"
+)
+
+var (
+	testAVCSeqHeader = []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01, 0x64, 0x00, 0x1f, 0xff, 0xe0, 0x00}
+	testAVCKeyFrame  = []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0xaa}
+	testAVCInter     = []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0xbb}
+	testAACSeqHeader = []byte{0xaf, 0x00, 0x12, 0x10}
+	testAACRaw       = []byte{0xaf, 0x01, 0xcc}
+)
+
+func discardLogger() *logrus.Logger {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	return l
+}
+
+// newTestFLV Creates a file which has key frames every 300ms, inter frames every 100ms and audio every 100ms until 900ms.
+func newTestFLV(t *testing.T) []byte {
+	var metaData bytes.Buffer
+	metaData.Write(internal.AppendAMF0String(nil, "onMetaData"))
+	require.Nil(t, amf0.NewEncoder(&metaData).Encode(amf0.ECMAArray{"width": float64(1280)}))
+
+	var buf bytes.Buffer
+	w, err := newFLVWriter(&buf)
+	require.Nil(t, err)
+
+	tags := []*flvTag{
+		{Type: flvtag.TagTypeScriptData, Timestamp: 0, Body: metaData.Bytes()},
+		{Type: flvtag.TagTypeVideo, Timestamp: 0, Body: testAVCSeqHeader},
+		{Type: flvtag.TagTypeAudio, Timestamp: 0, Body: testAACSeqHeader},
+	}
+	for ts := uint32(0); ts <= 900; ts += 100 {
+		video := testAVCInter
+		if ts%300 == 0 {
+			video = testAVCKeyFrame
+		}
+		tags = append(tags,
+			&flvTag{Type: flvtag.TagTypeVideo, Timestamp: ts, Body: video},
+			&flvTag{Type: flvtag.TagTypeAudio, Timestamp: ts, Body: testAACRaw},
+		)
+	}
+	for _, tag := range tags {
+		require.Nil(t, w.WriteTag(tag))
+	}
+	require.Nil(t, w.Flush())
+
+	return buf.Bytes()
+}
+
+func readTestFLV(t *testing.T, b []byte) []*flvTag {
+	r, err := newFLVReader(bytes.NewReader(b))
+	require.Nil(t, err)
+
+	var tags []*flvTag
+	for {
+		tag, err := r.ReadTag()
+		if err == io.EOF {
+			return tags
+		}
+		require.Nil(t, err)
+		tags = append(tags, tag)
+	}
+}
+
+func startTestServer(t *testing.T) (string, *relay.Hub, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	require.Nil(t, err)
+
+	srv, hub := newRelayServer(&serveConfig{
+		Hub:    &relay.HubConfig{},
+		Logger: discardLogger(),
+	})
+	go func() {
+		_ = srv.Serve(l)
+	}()
+
+	return "rtmp://" + l.Addr().String() + "/live/key?token=x", hub, func() {
+		_ = srv.Close()
+		_ = hub.Close()
+	}
+}
+
+func testClientConfig() clientConfig {
+	return clientConfig{
+		ChunkSize: 128, // Default of RTMP
+		Timeout:   5 * time.Second,
+		Logger:    discardLogger(),
+	}
+}
+
+func TestFLVReaderWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newFLVWriter(&buf)
+	require.Nil(t, err)
+	require.Nil(t, w.WriteTag(&flvTag{Type: flvtag.TagTypeVideo, Timestamp: 0x01234567, Body: testAVCKeyFrame}))
+	require.Nil(t, w.WriteTag(&flvTag{Type: flvtag.TagTypeAudio, Timestamp: 1, Body: testAACRaw}))
+	require.Nil(t, w.Flush())
+
+	tags := readTestFLV(t, buf.Bytes())
+	require.Equal(t, []*flvTag{
+		{Type: flvtag.TagTypeVideo, Timestamp: 0x01234567, Body: testAVCKeyFrame},
+		{Type: flvtag.TagTypeAudio, Timestamp: 1, Body: testAACRaw},
+	}, tags)
+}
+
+func TestPublishPlayAndProbe(t *testing.T) {
+	url, hub, closeServer := startTestServer(t)
+	defer closeServer()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	file := newTestFLV(t)
+	publishErrCh := make(chan error, 1)
+	go func() {
+		publishErrCh <- publish(ctx, url, &publishConfig{
+			clientConfig: testClientConfig(),
+			Open: func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(file)), nil
+			},
+		})
+	}()
+
+	// Streams are named by app and stream names without queries
+	require.Eventually(t, func() bool {
+		sub, err := hub.Subscribe("live/key")
+		if err != nil {
+			return false
+		}
+		_ = sub.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var played bytes.Buffer
+	playErrCh := make(chan error, 1)
+	go func() {
+		config := &playConfig{clientConfig: testClientConfig()}
+		playErrCh <- play(ctx, url, &played, config)
+	}()
+
+	report, err := probe(ctx, url, &probeConfig{
+		clientConfig: testClientConfig(),
+		Duration:     5 * time.Second, // Finished by the end of the stream
+	})
+	require.Nil(t, err)
+	require.Nil(t, <-publishErrCh)
+	require.Nil(t, <-playErrCh)
+
+	// Players start from cached headers and the latest GOP, and stop when the stream is unpublished
+	tags := readTestFLV(t, played.Bytes())
+	require.True(t, len(tags) > 3)
+	require.Equal(t, flvtag.TagTypeScriptData, tags[0].Type)
+	name, _, _ := internal.SplitAMF0String(tags[0].Body)
+	require.Equal(t, "onMetaData", name)
+	require.Equal(t, uint32(0), tags[0].Timestamp)
+	last := tags[len(tags)-1]
+	require.Equal(t, testAACRaw, last.Body)
+
+	require.Equal(t, "key?token=x", report.Name) // Queries are sent to servers
+	require.NotNil(t, report.Video)
+	require.Equal(t, "avc1", report.Video.Codec)
+	require.True(t, report.Video.Frames > 0)
+	require.True(t, report.Video.KeyFrames > 0)
+	require.NotNil(t, report.Audio)
+	require.Equal(t, "mp4a", report.Audio.Codec)
+	require.Equal(t, 44100, report.Audio.SampleRate)
+	require.Equal(t, 2, report.Audio.Channels)
+	require.Equal(t, float64(1280), report.MetaData["width"])
+
+	var text strings.Builder
+	require.Nil(t, report.WriteText(&text))
+	require.Contains(t, text.String(), "Audio:    mp4a 44100 Hz 2 ch")
+}
+
+func TestPlayNotFound(t *testing.T) {
+	url, _, closeServer := startTestServer(t)
+	defer closeServer()
+
+	err := play(context.Background(), url, ioutil.Discard, &playConfig{clientConfig: testClientConfig()})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "NetStream.Play.StreamNotFound")
+}
+
+func TestPacerContinuesTimestampsOfLoops(t *testing.T) {
+	ctx := context.Background()
+	p := &pacer{noPace: true}
+
+	var timestamps []uint32
+	for loop := 0; loop < 2; loop++ {
+		for _, ts := range []uint32{1000, 1100, 1200} {
+			shifted, err := p.wait(ctx, ts)
+			require.Nil(t, err)
+			timestamps = append(timestamps, shifted)
+		}
+		p.nextLoop()
+	}
+	require.Equal(t, []uint32{0, 100, 200, 201, 301, 401}, timestamps)
+}
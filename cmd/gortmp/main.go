@@ -0,0 +1,114 @@
+// Command gortmp is an RTMP server and client built on go-rtmp.
+//
+//	gortmp serve   [flags]              Relay live streams from publishers to players
+//	gortmp publish [flags] URL [FILE]   Publish an FLV file or stdin at real-time pace
+//	gortmp play    [flags] URL [FILE]   Play a stream and write it as FLV to a file or stdout
+//	gortmp probe   [flags] URL          Play a stream for a while and report codecs, bitrates and GOPs
+//
+// Run "gortmp COMMAND -h" to see flags of each command.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(ctx context.Context, cmd *command, args []string) error
+}
+
+var commands = []*command{serveCommand, publishCommand, playCommand, probeCommand}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage()
+		return
+	}
+
+	var cmd *command
+	for _, c := range commands {
+		if c.name == name {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "gortmp: Unknown command: %s\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	// Stop gracefully by SIGINT and SIGTERM
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		cancel()
+	}()
+
+	if err := cmd.run(ctx, cmd, os.Args[2:]); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "gortmp %s: %v\n", cmd.name, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: gortmp COMMAND [flags] [args]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun \"gortmp COMMAND -h\" to see flags of each command.\n")
+}
+
+// newFlagSet Creates flags of cmd. Parse errors are returned instead of exiting.
+func newFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet("gortmp "+cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gortmp %s %s\n\n%s\n\nFlags:\n", cmd.name, cmd.usage, cmd.description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// logFlag A log level shared by commands. Logs are written to stderr, because play writes FLV to stdout.
+type logFlag struct {
+	level *string
+}
+
+func addLogFlag(fs *flag.FlagSet) *logFlag {
+	return &logFlag{
+		level: fs.String("log-level", "warn", "Log level: debug, info, warn or error"),
+	}
+}
+
+func (f *logFlag) newLogger() (*logrus.Logger, error) {
+	level, err := logrus.ParseLevel(*f.level)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid log level")
+	}
+
+	l := logrus.New()
+	l.Out = os.Stderr
+	l.SetLevel(level)
+
+	return l, nil
+}
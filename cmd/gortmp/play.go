@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var playCommand = &command{
+	name:        "play",
+	usage:       "[flags] URL [FILE]",
+	description: "Play a stream of URL (e.g. rtmp://host/app/key) and write it as FLV. It writes to stdout if FILE is omitted or \"-\".",
+	run:         runPlay,
+}
+
+func runPlay(ctx context.Context, cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	duration := fs.Duration("duration", 0, "Stop playing after the duration. 0 means until the stream is finished")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout of connecting and starting playing")
+	logs := addLogFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	logger, err := logs.newLogger()
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if path := fs.Arg(1); path != "" && path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return errors.Wrap(err, "Failed to create FLV file")
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return play(ctx, fs.Arg(0), w, &playConfig{
+		clientConfig: clientConfig{
+			Timeout: *timeout,
+			Logger:  logger,
+		},
+		Duration: *duration,
+	})
+}
+
+type playConfig struct {
+	clientConfig
+
+	Duration time.Duration
+}
+
+// play Writes media of a stream to w as FLV until the stream is finished. Timestamps are rebased to start from 0.
+func play(ctx context.Context, rawurl string, w io.Writer, config *playConfig) error {
+	fw, err := newFLVWriter(w)
+	if err != nil {
+		return err
+	}
+
+	var base uint32
+	isBaseSet := false
+	s, err := dialSession(ctx, rawurl, &config.clientConfig, func(tag *flvTag) error {
+		if !isBaseSet {
+			base = tag.Timestamp
+			isBaseSet = true
+		}
+		timestamp := uint32(0)
+		if int32(tag.Timestamp-base) > 0 {
+			timestamp = tag.Timestamp - base
+		}
+		tag.Timestamp = timestamp
+
+		if err := fw.WriteTag(tag); err != nil {
+			return err
+		}
+		return fw.Flush() // Players which read stdout can start immediately
+	})
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.Play(ctx, config.Timeout); err != nil {
+		return err
+	}
+	config.Logger.Infof("Playing: Name = %s", s.Name())
+
+	return waitPlaying(ctx, s, config.Duration)
+}
+
+// waitPlaying Waits until the stream is finished or duration is elapsed.
+func waitPlaying(ctx context.Context, s *clientSession, duration time.Duration) error {
+	if duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+
+	err := s.Wait(ctx)
+	if err == context.DeadlineExceeded && duration > 0 {
+		return nil
+	}
+	if err == context.Canceled {
+		return nil // Interrupted
+	}
+	return err
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yutopp/go-amf0"
+	flvtag "github.com/yutopp/go-flv/tag"
+
+	"github.com/yutopp/go-rtmp/internal"
+	"github.com/yutopp/go-rtmp/media"
+)
+
+var probeCommand = &command{
+	name:        "probe",
+	usage:       "[flags] URL",
+	description: "Play a stream of URL for a while and report its codecs, bitrates and GOPs.",
+	run:         runProbe,
+}
+
+func runProbe(ctx context.Context, cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	duration := fs.Duration("duration", 5*time.Second, "Duration to play the stream")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout of connecting and starting playing")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	logs := addLogFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	logger, err := logs.newLogger()
+	if err != nil {
+		return err
+	}
+
+	report, err := probe(ctx, fs.Arg(0), &probeConfig{
+		clientConfig: clientConfig{
+			Timeout: *timeout,
+			Logger:  logger,
+		},
+		Duration: *duration,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return report.WriteText(os.Stdout)
+}
+
+type probeConfig struct {
+	clientConfig
+
+	Duration time.Duration
+}
+
+// probeReport Properties of a stream measured by playing it. Rates are computed from timestamps of media.
+type probeReport struct {
+	Name     string                 `json:"name"`
+	Duration float64                `json:"duration"` // Seconds
+	MetaData map[string]interface{} `json:"metadata,omitempty"`
+	Video    *probeVideoReport      `json:"video,omitempty"`
+	Audio    *probeAudioReport      `json:"audio,omitempty"`
+}
+
+type probeVideoReport struct {
+	Codec     string          `json:"codec"`
+	Width     int             `json:"width,omitempty"`
+	Height    int             `json:"height,omitempty"`
+	Frames    int             `json:"frames"`
+	KeyFrames int             `json:"key_frames"`
+	FrameRate float64         `json:"frame_rate"`
+	Bitrate   float64         `json:"bitrate"` // kbps
+	GOP       *probeGOPReport `json:"gop,omitempty"`
+}
+
+// probeGOPReport Statistics of GOPs which are received from a key frame to a next key frame.
+type probeGOPReport struct {
+	Count       int     `json:"count"`
+	AvgFrames   float64 `json:"avg_frames"`
+	MaxFrames   int     `json:"max_frames"`
+	AvgDuration float64 `json:"avg_duration"` // Milliseconds
+	MaxDuration uint32  `json:"max_duration"` // Milliseconds
+}
+
+type probeAudioReport struct {
+	Codec      string  `json:"codec"`
+	SampleRate int     `json:"sample_rate,omitempty"`
+	Channels   int     `json:"channels,omitempty"`
+	Frames     int     `json:"frames"`
+	Bitrate    float64 `json:"bitrate"` // kbps
+}
+
+func probe(ctx context.Context, rawurl string, config *probeConfig) (*probeReport, error) {
+	p := &prober{}
+	s, err := dialSession(ctx, rawurl, &config.clientConfig, p.addTag)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	if err := s.Play(ctx, config.Timeout); err != nil {
+		return nil, err
+	}
+
+	if err := waitPlaying(ctx, s, config.Duration); err != nil {
+		return nil, err
+	}
+
+	return p.report(s.Name()), nil
+}
+
+// prober Aggregates tags of a played stream.
+type prober struct {
+	metaData map[string]interface{}
+	video    mediaCounter
+	audio    mediaCounter
+
+	videoCodec string
+	videoInfo  *media.VideoInfo
+	keyFrames  int
+	gop        *openGOP
+	gops       []closedGOP
+
+	audioCodec string
+	audioInfo  *media.AudioInfo
+
+	m sync.Mutex
+}
+
+type mediaCounter struct {
+	frames int
+	bytes  int
+	first  uint32
+	last   uint32
+}
+
+func (c *mediaCounter) add(timestamp uint32, size int) {
+	if c.frames == 0 {
+		c.first = timestamp
+	}
+	c.frames++
+	c.bytes += size
+	c.last = timestamp
+}
+
+// span Milliseconds between the first and the last frames
+func (c *mediaCounter) span() uint32 {
+	if c.frames == 0 || int32(c.last-c.first) < 0 {
+		return 0
+	}
+	return c.last - c.first
+}
+
+func (c *mediaCounter) kbps() float64 {
+	if c.span() == 0 {
+		return 0
+	}
+	return float64(c.bytes*8) / float64(c.span())
+}
+
+type openGOP struct {
+	start  uint32
+	frames int
+}
+
+type closedGOP struct {
+	frames   int
+	duration uint32
+}
+
+func (p *prober) addTag(tag *flvTag) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	switch tag.Type {
+	case flvtag.TagTypeScriptData:
+		p.addMetaData(tag.Body)
+	case flvtag.TagTypeVideo:
+		p.addVideo(tag)
+	case flvtag.TagTypeAudio:
+		p.addAudio(tag)
+	}
+
+	return nil
+}
+
+func (p *prober) addMetaData(body []byte) {
+	_, values, ok := internal.SplitAMF0String(body)
+	if !ok {
+		values = body
+	}
+
+	var v interface{}
+	if err := amf0.NewDecoder(bytes.NewReader(values)).Decode(&v); err != nil {
+		return
+	}
+	switch v := v.(type) {
+	case amf0.ECMAArray:
+		p.metaData = map[string]interface{}(v)
+	case map[string]interface{}:
+		p.metaData = v
+	}
+}
+
+func (p *prober) addVideo(tag *flvTag) {
+	frames, err := media.DecodeVideoFrames(bytes.NewReader(tag.Body))
+	if err != nil || len(frames) == 0 {
+		return
+	}
+	f := &frames[0] // The first track of multitrack packets
+
+	if p.videoCodec == "" {
+		p.videoCodec = videoCodecName(f)
+	}
+	if f.IsSequenceHeader() {
+		if info, err := media.ParseVideoInfo(f); err == nil {
+			p.videoInfo = info
+		}
+		return
+	}
+
+	p.video.add(tag.Timestamp, len(tag.Body))
+	if f.IsKeyFrame() {
+		p.keyFrames++
+		if p.gop != nil {
+			p.gops = append(p.gops, closedGOP{frames: p.gop.frames, duration: tag.Timestamp - p.gop.start})
+		}
+		p.gop = &openGOP{start: tag.Timestamp}
+	}
+	if p.gop != nil {
+		p.gop.frames++
+	}
+}
+
+func (p *prober) addAudio(tag *flvTag) {
+	frames, err := media.DecodeAudioFrames(bytes.NewReader(tag.Body))
+	if err != nil || len(frames) == 0 {
+		return
+	}
+	f := &frames[0]
+
+	if p.audioCodec == "" {
+		p.audioCodec = audioCodecName(f)
+	}
+	if f.IsSequenceHeader() {
+		if info, err := media.ParseAudioInfo(f); err == nil {
+			p.audioInfo = info
+		}
+		return
+	}
+
+	p.audio.add(tag.Timestamp, len(tag.Body))
+}
+
+func (p *prober) report(name string) *probeReport {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	r := &probeReport{
+		Name:     name,
+		MetaData: p.metaData,
+	}
+
+	if p.videoCodec != "" {
+		v := &probeVideoReport{
+			Codec:     p.videoCodec,
+			Frames:    p.video.frames,
+			KeyFrames: p.keyFrames,
+			Bitrate:   p.video.kbps(),
+		}
+		if p.videoInfo != nil {
+			v.Width, v.Height = p.videoInfo.Width, p.videoInfo.Height
+		}
+		if span := p.video.span(); span > 0 {
+			v.FrameRate = float64(p.video.frames-1) * 1000 / float64(span)
+		}
+		if len(p.gops) > 0 {
+			g := &probeGOPReport{Count: len(p.gops)}
+			var frames int
+			var duration uint32
+			for _, gop := range p.gops {
+				frames += gop.frames
+				duration += gop.duration
+				if gop.frames > g.MaxFrames {
+					g.MaxFrames = gop.frames
+				}
+				if gop.duration > g.MaxDuration {
+					g.MaxDuration = gop.duration
+				}
+			}
+			g.AvgFrames = float64(frames) / float64(len(p.gops))
+			g.AvgDuration = float64(duration) / float64(len(p.gops))
+			v.GOP = g
+		}
+		r.Video = v
+	}
+
+	if p.audioCodec != "" {
+		a := &probeAudioReport{
+			Codec:   p.audioCodec,
+			Frames:  p.audio.frames,
+			Bitrate: p.audio.kbps(),
+		}
+		if p.audioInfo != nil {
+			a.SampleRate, a.Channels = p.audioInfo.SampleRate, p.audioInfo.Channels
+		}
+		r.Audio = a
+	}
+
+	span := p.video.span()
+	if s := p.audio.span(); s > span {
+		span = s
+	}
+	r.Duration = float64(span) / 1000
+
+	return r
+}
+
+func (r *probeReport) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Stream:   %s\n", r.Name)
+	fmt.Fprintf(&b, "Duration: %.2fs\n", r.Duration)
+
+	if v := r.Video; v != nil {
+		fmt.Fprintf(&b, "Video:    %s", v.Codec)
+		if v.Width > 0 {
+			fmt.Fprintf(&b, " %dx%d", v.Width, v.Height)
+		}
+		fmt.Fprintf(&b, ", %.2f fps, %.1f kbps, %d frames (%d key frames)\n", v.FrameRate, v.Bitrate, v.Frames, v.KeyFrames)
+		if g := v.GOP; g != nil {
+			fmt.Fprintf(&b, "GOP:      avg %.1f frames / %.0f ms, max %d frames / %d ms (%d GOPs)\n",
+				g.AvgFrames, g.AvgDuration, g.MaxFrames, g.MaxDuration, g.Count,
+			)
+		} else {
+			fmt.Fprintf(&b, "GOP:      unknown (less than 2 key frames)\n")
+		}
+	} else {
+		fmt.Fprintf(&b, "Video:    none\n")
+	}
+
+	if a := r.Audio; a != nil {
+		fmt.Fprintf(&b, "Audio:    %s", a.Codec)
+		if a.SampleRate > 0 {
+			fmt.Fprintf(&b, " %d Hz %d ch", a.SampleRate, a.Channels)
+		}
+		fmt.Fprintf(&b, ", %.1f kbps, %d frames\n", a.Bitrate, a.Frames)
+	} else {
+		fmt.Fprintf(&b, "Audio:    none\n")
+	}
+
+	if len(r.MetaData) > 0 {
+		keys := make([]string, 0, len(r.MetaData))
+		for k := range r.MetaData {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(&b, "Metadata:\n")
+		for _, k := range keys {
+			fmt.Fprintf(&b, "  %s: %v\n", k, r.MetaData[k])
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func videoCodecName(f *media.VideoFrame) string {
+	if f.FourCC != 0 {
+		return f.FourCC.String()
+	}
+	return fmt.Sprintf("codec_id_%d", f.CodecID)
+}
+
+func audioCodecName(f *media.AudioFrame) string {
+	if f.FourCC != 0 {
+		return f.FourCC.String()
+	}
+	return fmt.Sprintf("sound_format_%d", f.SoundFormat)
+}
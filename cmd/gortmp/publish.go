@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var publishCommand = &command{
+	name:        "publish",
+	usage:       "[flags] URL [FILE]",
+	description: "Publish an FLV file to URL (e.g. rtmp://host/app/key) at real-time pace. It reads stdin if FILE is omitted or \"-\".",
+	run:         runPublish,
+}
+
+func runPublish(ctx context.Context, cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	chunkSize := fs.Uint("chunk-size", 4096, "Chunk size to send")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout of connecting and starting publishing")
+	noPace := fs.Bool("no-pace", false, "Send tags as fast as possible instead of pacing them by timestamps")
+	loop := fs.Bool("loop", false, "Publish FILE repeatedly. Timestamps continue across loops")
+	logs := addLogFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	logger, err := logs.newLogger()
+	if err != nil {
+		return err
+	}
+
+	path := fs.Arg(1)
+	if *loop && (path == "" || path == "-") {
+		return errors.New("-loop cannot be used with stdin")
+	}
+
+	return publish(ctx, fs.Arg(0), &publishConfig{
+		clientConfig: clientConfig{
+			ChunkSize: uint32(*chunkSize),
+			Timeout:   *timeout,
+			Logger:    logger,
+		},
+		Open: func() (io.ReadCloser, error) {
+			if path == "" || path == "-" {
+				return ioutil.NopCloser(os.Stdin), nil
+			}
+			return os.Open(path)
+		},
+		NoPace: *noPace,
+		Loop:   *loop,
+	})
+}
+
+type publishConfig struct {
+	clientConfig
+
+	Open   func() (io.ReadCloser, error) // Opens an FLV file for each loop
+	NoPace bool
+	Loop   bool
+}
+
+func publish(ctx context.Context, rawurl string, config *publishConfig) error {
+	s, err := dialSession(ctx, rawurl, &config.clientConfig, nil)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.Publish(ctx, config.Timeout); err != nil {
+		return err
+	}
+	config.Logger.Infof("Publishing: Name = %s", s.Name())
+
+	p := &pacer{noPace: config.NoPace}
+	for {
+		if err := publishFile(ctx, s, config, p); err != nil {
+			return err
+		}
+		if !config.Loop {
+			return nil
+		}
+		p.nextLoop()
+	}
+}
+
+func publishFile(ctx context.Context, s *clientSession, config *publishConfig, p *pacer) error {
+	f, err := config.Open()
+	if err != nil {
+		return errors.Wrap(err, "Failed to open FLV file")
+	}
+	defer f.Close()
+
+	r, err := newFLVReader(f)
+	if err != nil {
+		return err
+	}
+
+	for {
+		tag, err := r.ReadTag()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		timestamp, err := p.wait(ctx, tag.Timestamp)
+		if err != nil {
+			return err
+		}
+		if err := s.Err(); err != nil {
+			return err
+		}
+
+		tag.Timestamp = timestamp
+		if err := s.WriteTag(tag); err != nil {
+			return errors.Wrap(err, "Failed to write tag")
+		}
+	}
+}
+
+// pacer Sends tags along timestamps relative to the first tag, and shifts timestamps of loops.
+type pacer struct {
+	noPace bool
+
+	isStarted bool
+	startedAt time.Time
+	base      uint32 // A timestamp of the first tag
+
+	offset      uint32 // Added to timestamps of the current loop
+	isLoopBase  bool
+	loopBase    uint32 // A timestamp of the first tag of the current loop
+	lastWritten uint32
+}
+
+// wait Blocks until a tag of timestamp should be sent and returns its shifted timestamp.
+func (p *pacer) wait(ctx context.Context, timestamp uint32) (uint32, error) {
+	if !p.isLoopBase {
+		p.loopBase = timestamp
+		p.isLoopBase = true
+	}
+	shifted := p.offset
+	if int32(timestamp-p.loopBase) > 0 {
+		shifted += timestamp - p.loopBase
+	}
+	if !p.isStarted {
+		p.startedAt = time.Now()
+		p.base = shifted
+		p.isStarted = true
+	}
+
+	if !p.noPace {
+		due := p.startedAt.Add(time.Duration(shifted-p.base) * time.Millisecond)
+		if d := time.Until(due); d > 0 {
+			t := time.NewTimer(d)
+			defer t.Stop()
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		} else if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	p.lastWritten = shifted
+	return shifted, nil
+}
+
+// nextLoop Continues timestamps of the next loop from the last tag.
+func (p *pacer) nextLoop() {
+	p.offset = p.lastWritten + 1
+	p.isLoopBase = false
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/yutopp/go-rtmp"
+	"github.com/yutopp/go-rtmp/message"
+	"github.com/yutopp/go-rtmp/relay"
+)
+
+var serveCommand = &command{
+	name:        "serve",
+	usage:       "[flags]",
+	description: "Relay live streams from publishers to players. Streams are distinguished by app and stream names.",
+	run:         runServe,
+}
+
+const (
+	relayChunkStreamIDCtrl   = 2
+	relayChunkStreamIDStatus = 5
+)
+
+func runServe(ctx context.Context, cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	addr := fs.String("addr", ":1935", "TCP address to listen for RTMP")
+	tlsAddr := fs.String("tls-addr", "", "TCP address to listen for RTMPS. -cert and -key are required")
+	certFile := fs.String("cert", "", "Certificate file of RTMPS. It is reloaded when modified")
+	keyFile := fs.String("key", "", "Private key file of RTMPS")
+	auth := fs.String("auth", "", "USER:PASSWORD which clients must authenticate with (authmod=adobe)")
+	recordDir := fs.String("record-dir", "", "Directory to record published streams as FLV files named after stream names")
+	vodDir := fs.String("vod-dir", "", "Directory of FLV files which are played as \"<stream name>.flv\" when streams are not live")
+	metricsAddr := fs.String("metrics-addr", "", "HTTP address to serve Prometheus metrics on /metrics")
+	metricsPerConn := fs.Bool("metrics-per-conn", false, "Serve metrics of each connection and stream in addition to totals")
+	queueSize := fs.Int("queue-size", 0, "Number of packets buffered for each player (default 512)")
+	gopSize := fs.Int("gop-size", 0, "Maximum number of packets of a cached GOP (default 512)")
+	slowConsumer := fs.String("slow-consumer", "drop", "What happens to slow players: drop (frames) or disconnect")
+	replacePublisher := fs.Bool("replace-publisher", false, "Replace a publisher by a new one instead of rejecting the new one")
+	logs := addLogFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.Errorf("Unexpected arguments: %v", fs.Args())
+	}
+
+	logger, err := logs.newLogger()
+	if err != nil {
+		return err
+	}
+
+	config := &serveConfig{
+		Hub: &relay.HubConfig{
+			QueueSize:  *queueSize,
+			MaxGOPSize: *gopSize,
+		},
+		Metrics: rtmp.NewMetrics(&rtmp.MetricsConfig{PerConnection: *metricsPerConn}),
+		Logger:  logger,
+	}
+	switch *slowConsumer {
+	case "drop":
+		config.Hub.SlowConsumerPolicy = relay.SlowConsumerDropFrames
+	case "disconnect":
+		config.Hub.SlowConsumerPolicy = relay.SlowConsumerDisconnect
+	default:
+		return errors.Errorf("Unknown slow consumer policy: %s", *slowConsumer)
+	}
+	if *replacePublisher {
+		config.Hub.DuplicatePublisherPolicy = relay.DuplicatePublisherReplace
+	}
+	if *auth != "" {
+		kv := strings.SplitN(*auth, ":", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return errors.Errorf("Invalid auth: %s", *auth)
+		}
+		config.Authenticator = rtmp.NewAuthenticator(&rtmp.AuthenticatorConfig{
+			Credentials: rtmp.StaticCredentialStore{kv[0]: kv[1]},
+		})
+	}
+	if *recordDir != "" {
+		config.RecordStorage = &rtmp.DirRecordStorage{Dir: *recordDir}
+	}
+	if *vodDir != "" {
+		config.VODStorage = &rtmp.DirVODStorage{Dir: *vodDir}
+	}
+
+	srv, hub := newRelayServer(config)
+	defer hub.Close()
+	defer srv.Close()
+
+	errCh := make(chan error, 3)
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return errors.Wrap(err, "Failed to listen")
+	}
+	logger.Infof("Listening RTMP: Addr = %s", l.Addr())
+	go func() {
+		errCh <- srv.Serve(l)
+	}()
+
+	if *tlsAddr != "" {
+		reloader, err := rtmp.NewCertificateReloader(*certFile, *keyFile)
+		if err != nil {
+			return errors.Wrap(err, "Failed to load certificates")
+		}
+		tl, err := tls.Listen("tcp", *tlsAddr, &tls.Config{GetCertificate: reloader.GetCertificate})
+		if err != nil {
+			return errors.Wrap(err, "Failed to listen TLS")
+		}
+		logger.Infof("Listening RTMPS: Addr = %s", tl.Addr())
+		go func() {
+			errCh <- srv.Serve(tl)
+		}()
+	}
+
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			if err := config.Metrics.WritePrometheus(w); err != nil {
+				logger.Warnf("Failed to write metrics: Err = %+v", err)
+			}
+		})
+		httpSrv := &http.Server{Addr: *metricsAddr, Handler: mux}
+		defer httpSrv.Close()
+		go func() {
+			errCh <- httpSrv.ListenAndServe()
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errCh:
+		return err
+	}
+}
+
+// serveConfig Configurations of a relay server.
+type serveConfig struct {
+	Hub           *relay.HubConfig
+	Authenticator *rtmp.Authenticator
+	RecordStorage rtmp.RecordStorage
+	VODStorage    rtmp.VODStorage
+	Metrics       *rtmp.Metrics
+	Logger        logrus.FieldLogger
+}
+
+// newRelayServer Creates a server whose connections share a hub. The hub must be closed after the server.
+func newRelayServer(config *serveConfig) (*rtmp.Server, *relay.Hub) {
+	hub := relay.NewHub(config.Hub)
+
+	var observer rtmp.Observer
+	if config.Metrics != nil {
+		observer = config.Metrics
+	}
+
+	srv := rtmp.NewServer(&rtmp.ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *rtmp.ConnConfig) {
+			logger := config.Logger.WithField("remote_addr", conn.RemoteAddr().String())
+
+			return conn, &rtmp.ConnConfig{
+				Handler: &relayHandler{
+					hub:    hub,
+					config: config,
+					logger: logger,
+					subs:   make(map[uint32]*relay.Subscriber),
+				},
+				Authenticator: config.Authenticator,
+				Logger:        logger,
+			}
+		},
+		Observer: observer,
+	})
+
+	return srv, hub
+}
+
+var _ rtmp.Handler = (*relayHandler)(nil)
+
+// relayHandler Publishes and plays streams of a hub. A connection can publish a stream, and play streams.
+type relayHandler struct {
+	rtmp.DefaultHandler
+	hub    *relay.Hub
+	config *serveConfig
+	logger logrus.FieldLogger
+
+	conn *rtmp.Conn
+	app  string
+
+	pub         *relay.Publisher
+	pubStreamID uint32
+	subs        map[uint32]*relay.Subscriber // Keyed by stream IDs
+}
+
+func (h *relayHandler) OnServe(conn *rtmp.Conn) {
+	h.conn = conn
+}
+
+func (h *relayHandler) OnConnect(_ uint32, cmd *message.NetConnectionConnect) error {
+	h.app = cmd.Command.App
+	return nil
+}
+
+func (h *relayHandler) OnPublish(ctx *rtmp.StreamContext, _ uint32, cmd *message.NetStreamPublish) error {
+	if h.pub != nil {
+		return rtmp.NewPublishBadNameError("Connection is already publishing.", cmd.PublishingName)
+	}
+	if cmd.PublishingName == "" {
+		return rtmp.NewPublishBadNameError("Stream name is empty.", cmd.PublishingName)
+	}
+
+	key := h.streamKey(cmd.PublishingName)
+	pub, err := h.hub.Publish(key)
+	if err == relay.ErrAlreadyPublished {
+		return rtmp.NewPublishBadNameError("Stream is already published.", cmd.PublishingName)
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to publish")
+	}
+
+	if h.config.RecordStorage != nil {
+		rec, err := rtmp.NewRecorder(cmd, &rtmp.RecorderConfig{Storage: h.config.RecordStorage})
+		if err != nil {
+			_ = pub.Close()
+			return errors.Wrap(err, "Failed to create recorder")
+		}
+		if err := ctx.AttachRecorder(rec); err != nil {
+			h.logger.Warnf("Failed to close a previous recorder: Err = %+v", err)
+		}
+	}
+
+	h.pub = pub
+	h.pubStreamID = ctx.StreamID
+	h.logger.Infof("Published: Stream = %s", key)
+
+	return nil
+}
+
+func (h *relayHandler) OnPlay(ctx *rtmp.StreamContext, _ uint32, cmd *message.NetStreamPlay) error {
+	if _, ok := h.subs[ctx.StreamID]; ok {
+		return errors.New("Stream is already playing")
+	}
+
+	key := h.streamKey(cmd.StreamName)
+	sub, err := h.hub.Subscribe(key)
+	if err == relay.ErrNotPublished && h.config.VODStorage != nil {
+		err := ctx.PlayFile(h.config.VODStorage, cmd.StreamName+".flv")
+		if os.IsNotExist(errors.Cause(err)) {
+			return rtmp.NewPlayStreamNotFoundError("Stream is not found.", cmd.StreamName)
+		}
+		return err
+	}
+	if err == relay.ErrNotPublished {
+		return rtmp.NewPlayStreamNotFoundError("Stream is not found.", cmd.StreamName)
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to subscribe")
+	}
+
+	h.subs[ctx.StreamID] = sub
+	h.logger.Infof("Playing: Stream = %s", key)
+
+	go func(streamID uint32) {
+		err := relay.Forward(context.Background(), sub, h.conn, streamID)
+		if err == relay.ErrUnpublished {
+			if err := h.notifyUnpublished(streamID); err != nil {
+				h.logger.Debugf("Failed to notify unpublishing: Err = %+v", err)
+			}
+		}
+		h.logger.Infof("Forwarding is finished: Stream = %s, Err = %v", key, err)
+	}(ctx.StreamID)
+
+	return nil
+}
+
+func (h *relayHandler) OnSetDataFrame(timestamp uint32, data *message.NetStreamSetDataFrame) error {
+	if h.pub == nil {
+		return nil
+	}
+	return h.pub.WriteMetaData(timestamp, data.Payload)
+}
+
+func (h *relayHandler) OnAudio(timestamp uint32, payload io.Reader) error {
+	if h.pub == nil {
+		return nil
+	}
+	return h.pub.WriteAudio(timestamp, payload)
+}
+
+func (h *relayHandler) OnVideo(timestamp uint32, payload io.Reader) error {
+	if h.pub == nil {
+		return nil
+	}
+	return h.pub.WriteVideo(timestamp, payload)
+}
+
+func (h *relayHandler) OnDeleteStream(_ uint32, cmd *message.NetStreamDeleteStream) error {
+	if h.pub != nil && cmd.StreamID == h.pubStreamID {
+		_ = h.pub.Close()
+		h.pub = nil
+	}
+	if sub, ok := h.subs[cmd.StreamID]; ok {
+		_ = sub.Close()
+		delete(h.subs, cmd.StreamID)
+	}
+	return nil
+}
+
+func (h *relayHandler) OnClose() {
+	if h.pub != nil {
+		_ = h.pub.Close()
+	}
+	for _, sub := range h.subs {
+		_ = sub.Close()
+	}
+}
+
+// streamKey Names streams by app and stream names. Queries of stream names (e.g. "?token=...") are dropped.
+func (h *relayHandler) streamKey(name string) string {
+	if i := strings.IndexByte(name, '?'); i >= 0 {
+		name = name[:i]
+	}
+	return h.app + "/" + name
+}
+
+// notifyUnpublished Tells a player that the stream is finished, so that it can stop playing.
+func (h *relayHandler) notifyUnpublished(streamID uint32) error {
+	body := new(bytes.Buffer)
+	amfEnc := message.NewAMFEncoder(body, message.EncodingTypeAMF0)
+	if err := message.EncodeBodyAnyValues(amfEnc, &message.NetStreamOnStatus{
+		InfoObject: message.NetStreamOnStatusInfoObject{
+			Level:       message.NetStreamOnStatusLevelStatus,
+			Code:        message.NetStreamOnStatusCodePlayUnpublishNotify,
+			Description: "Stream is unpublished.",
+		},
+	}); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := h.conn.Write(ctx, relayChunkStreamIDStatus, 0, &rtmp.ChunkMessage{
+		StreamID: streamID,
+		Message: &message.CommandMessage{
+			CommandName:   "onStatus",
+			TransactionID: 0,
+			Encoding:      message.EncodingTypeAMF0,
+			Body:          body,
+		},
+	}); err != nil {
+		return err
+	}
+
+	return h.conn.Write(ctx, relayChunkStreamIDCtrl, 0, &rtmp.ChunkMessage{
+		StreamID: rtmp.ControlStreamID,
+		Message: &message.UserCtrl{
+			Event: &message.UserCtrlEventStreamEOF{StreamID: streamID},
+		},
+	})
+}
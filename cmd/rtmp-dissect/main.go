@@ -0,0 +1,128 @@
+// Command rtmp-dissect prints handshakes, chunks and messages of one direction of an RTMP connection.
+//
+//	rtmp-dissect [flags] [FILE]
+//
+// FILE is a raw byte stream by default. Use -input=capture for files of package capture,
+// and -input=pcap for pcap or pcapng files. It reads stdin if FILE is omitted or "-".
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/yutopp/go-rtmp/capture"
+	"github.com/yutopp/go-rtmp/dissect"
+)
+
+func main() {
+	format := flag.String("format", "text", "Output format: text or json")
+	input := flag.String("input", "raw", "Input format: raw, capture or pcap (pcap or pcapng files)")
+	dir := flag.String("dir", "read", "Direction of captures: read or write")
+	from := flag.String("from", "client", "Sender of bytes in pcap files: client or server")
+	port := flag.Uint("port", 1935, "TCP port of the server in pcap files")
+	skipHandshake := flag.Bool("skip-handshake", false, "Bytes start from chunks")
+	flag.Parse()
+
+	if err := run(flag.Arg(0), &options{
+		format:        dissect.Format(*format),
+		input:         *input,
+		dir:           *dir,
+		from:          *from,
+		port:          uint16(*port),
+		skipHandshake: *skipHandshake,
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "rtmp-dissect: %+v\n", err)
+		os.Exit(1)
+	}
+}
+
+type options struct {
+	format        dissect.Format
+	input         string
+	dir           string
+	from          string
+	port          uint16
+	skipHandshake bool
+}
+
+func run(path string, opts *options) error {
+	var in io.Reader = os.Stdin
+	if path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	r, err := openStream(in, opts)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	emit, err := dissect.NewEventWriter(w, opts.format)
+	if err != nil {
+		return err
+	}
+
+	return dissect.Dissect(r, &dissect.Config{SkipHandshake: opts.skipHandshake}, emit)
+}
+
+func openStream(in io.Reader, opts *options) (io.Reader, error) {
+	switch opts.input {
+	case "raw":
+		return in, nil
+
+	case "capture":
+		var typ capture.RecordType
+		switch opts.dir {
+		case "read":
+			typ = capture.RecordTypeRead
+		case "write":
+			typ = capture.RecordTypeWrite
+		default:
+			return nil, errors.Errorf("Unknown direction: %s", opts.dir)
+		}
+
+		records, err := capture.ReadAll(in)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		for _, rec := range records {
+			if rec.Type == typ {
+				buf.Write(rec.Data)
+			}
+		}
+		return &buf, nil
+
+	case "pcap":
+		if opts.from != "client" && opts.from != "server" {
+			return nil, errors.Errorf("Unknown sender: %s", opts.from)
+		}
+
+		b, err := dissect.ReadPcapStream(in, &dissect.PcapConfig{
+			ServerPort: opts.port,
+			FromServer: opts.from == "server",
+		})
+		if err == dissect.ErrTCPStreamGap {
+			fmt.Fprintf(os.Stderr, "rtmp-dissect: %v. Bytes before the gap are dissected\n", err)
+		} else if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(b), nil
+
+	default:
+		return nil, errors.Errorf("Unknown input format: %s", opts.input)
+	}
+}
@@ -10,19 +10,25 @@ package rtmp
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"io"
 	"io/ioutil"
+	"net"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/yutopp/go-rtmp/capture"
+	"github.com/yutopp/go-rtmp/handshake"
 	"github.com/yutopp/go-rtmp/message"
 )
 
 type Conn struct {
 	rwc      io.ReadWriteCloser
+	netConn  net.Conn // An underlying connection. It may be nil if a connection is not created from net.Conn
 	bufr     *bufio.Reader
 	bufw     *bufio.Writer
 	streamer *ChunkStreamer
@@ -34,6 +40,22 @@ type Conn struct {
 
 	ignoredMessages uint32
 
+	handshakeResult *handshake.Result
+
+	onReconnectRequest func(tcURL string) // Client only. Called when a server requests reconnecting
+	onWriteError       func() bool        // Client only. Returns true if the client reconnects after failing to write
+
+	loopDoneCh chan struct{} // Closed when a message loop is finished
+
+	observer ConnObserver
+	stats    *connStats
+
+	capture *capture.Conn // Not nil if ConnConfig.Capture is set
+
+	bandwidth bandwidthState
+
+	createdAt time.Time
+
 	m        sync.Mutex
 	isClosed bool
 }
@@ -42,6 +64,14 @@ type ConnConfig struct {
 	Handler                   Handler
 	SkipHandshakeVerification bool
 
+	// HandshakeVersion is an RTMP version which clients request in C0. e.g. handshake.VersionRTMPE
+	// Plain RTMP is used if zero.
+	HandshakeVersion handshake.S0C0
+	// AllowEncryptedHandshake makes servers accept RTMPE connections.
+	AllowEncryptedHandshake bool
+	// HandshakeSignatureKeys are key tables for handshake.VersionRTMPEXTEA and handshake.VersionRTMPEBlowfish.
+	HandshakeSignatureKeys *handshake.SignatureKeys
+
 	IgnoreMessagesOnNotExistStream          bool
 	IgnoreMessagesOnNotExistStreamThreshold uint32
 
@@ -50,6 +80,29 @@ type ConnConfig struct {
 
 	ControlState StreamControlStateConfig
 
+	EnhancedRTMP EnhancedRTMPConfig
+
+	// Authenticator requires clients to authenticate with authmod=adobe or authmod=llnw. Server only.
+	// It must be shared by connections.
+	Authenticator *Authenticator
+
+	// MaxConnectRedirects is the number of redirections of connect (ex.code = 302) which clients created by DialURL follow.
+	// Redirections are returned as ConnectRejectedError if zero.
+	MaxConnectRedirects int
+
+	// Observer observes the connection to collect metrics. ServerConfig.Observer is used if nil.
+	Observer Observer
+
+	// Capture records the handshake and raw chunks of the connection in both directions with timestamps.
+	// A capture can be replayed by capture.Replay. It is not closed by the connection.
+	Capture io.Writer
+
+	// Reconnect enables automatic reconnection of clients.
+	Reconnect ReconnectConfig
+
+	// BandwidthCheck configures bandwidth checks by servers (checkBandwidth) and ClientConn.CheckUplinkBandwidth.
+	BandwidthCheck BandwidthCheckConfig
+
 	Logger  logrus.FieldLogger
 	RPreset ResponsePreset
 }
@@ -71,6 +124,10 @@ func (cb *ConnConfig) normalize() *ConnConfig {
 
 	c.ControlState = *c.ControlState.normalize()
 
+	c.Reconnect = *c.Reconnect.normalize()
+
+	c.BandwidthCheck = *c.BandwidthCheck.normalize()
+
 	if c.Logger == nil {
 		l := logrus.New()
 		l.Out = ioutil.Discard
@@ -87,6 +144,12 @@ func newConn(rwc io.ReadWriteCloser, config *ConnConfig) *Conn {
 	}
 	config = config.normalize()
 
+	var cc *capture.Conn
+	if config.Capture != nil {
+		cc = capture.NewConn(rwc, capture.NewWriter(config.Capture))
+		rwc = cc
+	}
+
 	conn := &Conn{
 		rwc:     rwc,
 		bufr:    bufio.NewReaderSize(rwc, config.ReaderBufferSize),
@@ -95,10 +158,20 @@ func newConn(rwc io.ReadWriteCloser, config *ConnConfig) *Conn {
 
 		config: config,
 		logger: config.Logger,
+
+		loopDoneCh: make(chan struct{}),
+
+		capture: cc,
+
+		createdAt: time.Now(),
 	}
 
+	conn.stats = newConnStats(newConnObserver(config.Observer, conn))
+	conn.observer = conn.stats
+
 	conn.streamer = NewChunkStreamer(conn.bufr, conn.bufw, &conn.config.ControlState)
 	conn.streamer.logger = conn.logger
+	conn.streamer.setObserver(conn.observer)
 
 	conn.streams = newStreams(conn)
 
@@ -109,6 +182,70 @@ func (c *Conn) GetChunkStreamer() *ChunkStreamer {
 	return c.streamer
 }
 
+// TLSConnectionState returns the state of a TLS connection (RTMPS).
+// ok is false if the connection is not established over TLS.
+func (c *Conn) TLSConnectionState() (state tls.ConnectionState, ok bool) {
+	type connectionStater interface {
+		ConnectionState() tls.ConnectionState
+	}
+
+	for _, v := range []interface{}{c.netConn, c.rwc} {
+		if cs, isTLS := v.(connectionStater); isTLS {
+			return cs.ConnectionState(), true
+		}
+	}
+
+	return tls.ConnectionState{}, false
+}
+
+// IsEncrypted returns true if the connection is encrypted by RTMPE.
+func (c *Conn) IsEncrypted() bool {
+	return c.handshakeResult != nil && c.handshakeResult.Cipher != nil
+}
+
+func (c *Conn) handshakeConfig() *handshake.Config {
+	return &handshake.Config{
+		SkipHandshakeVerification: c.config.SkipHandshakeVerification,
+		Version:                   c.config.HandshakeVersion,
+		AllowEncryption:           c.config.AllowEncryptedHandshake,
+		SignatureKeys:             c.config.HandshakeSignatureKeys,
+	}
+}
+
+// setHandshakeResult Wraps buffers by the cipher if the connection is encrypted.
+func (c *Conn) setHandshakeResult(result *handshake.Result) {
+	c.handshakeResult = result
+
+	if c.capture != nil {
+		c.capture.MarkHandshakeDone()
+	}
+
+	if result.Cipher != nil {
+		c.bufr.Reset(result.Cipher.NewReader(c.rwc))
+		c.bufw.Reset(result.Cipher.NewWriter(c.rwc))
+	}
+}
+
+// RequestReconnect sends an Enhanced RTMP NetConnection.Connect.ReconnectRequest to a client.
+// The client is asked to reconnect to tcURL and to publish again. If tcURL is empty, the client reconnects to the same server.
+// Clients which do not advertise message.CapsExReconnect may ignore the request.
+func (c *Conn) RequestReconnect(tcURL, description string) error {
+	stream, err := c.streams.At(ControlStreamID)
+	if err != nil {
+		return err
+	}
+
+	chunkStreamID := 3 // TODO: fix
+	return stream.NotifyStatus(chunkStreamID, 0, &message.NetStreamOnStatus{
+		InfoObject: message.NetStreamOnStatusInfoObject{
+			Level:       message.NetStreamOnStatusLevelStatus,
+			Code:        message.NetStreamOnStatusCode(message.NetConnectionConnectCodeReconnectRequest),
+			Description: description,
+			TCURL:       tcURL,
+		},
+	})
+}
+
 func (c *Conn) Close() error {
 	c.m.Lock()
 	defer c.m.Unlock()
@@ -118,6 +255,10 @@ func (c *Conn) Close() error {
 	}
 	c.isClosed = true
 
+	for _, s := range c.streams.list() {
+		s.assumeClosed()
+	}
+
 	if c.handler != nil {
 		c.handler.OnClose()
 	}
@@ -134,6 +275,8 @@ func (c *Conn) Close() error {
 		result = multierror.Append(result, err)
 	}
 
+	c.observer.OnClose()
+
 	return result
 }
 
@@ -142,6 +285,7 @@ func (c *Conn) Write(ctx context.Context, chunkStreamID int, timestamp uint32, c
 }
 
 func (c *Conn) handleMessageLoop() (err error) {
+	defer close(c.loopDoneCh)
 	defer func() {
 		if r := recover(); r != nil {
 			errTmp, ok := r.(error)
@@ -176,6 +320,10 @@ func (c *Conn) runHandleMessageLoop() error {
 }
 
 func (c *Conn) handleMessage(chunkStreamID int, timestamp uint32, cmsg *ChunkMessage) error {
+	if ack, ok := cmsg.Message.(*message.Ack); ok {
+		c.stats.onAckReceived(ack.SequenceNumber)
+	}
+
 	stream, err := c.streams.At(cmsg.StreamID)
 	if err != nil {
 		if c.config.IgnoreMessagesOnNotExistStream {
@@ -7,6 +7,55 @@
 
 package rtmp
 
+import (
+	"github.com/pkg/errors"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
 type StreamContext struct {
 	StreamID uint32
+	Info     *StreamInfo // Properties of published media. It is updated while publishing
+
+	stream  *Stream
+	playCmd *message.NetStreamPlay // Set while OnPlay is called
+}
+
+// AttachRecorder records media published to the stream by rec. rec is closed when the stream is closed.
+// A recorder which is attached previously is closed.
+func (ctx *StreamContext) AttachRecorder(rec *Recorder) error {
+	if prev := ctx.stream.attachRecorder(rec); prev != nil {
+		return prev.Close()
+	}
+	return nil
+}
+
+// AttachHealthAnalyzer analyzes media published to the stream by a. A previously attached analyzer is detached.
+func (ctx *StreamContext) AttachHealthAnalyzer(a *HealthAnalyzer) {
+	ctx.stream.attachHealthAnalyzer(a)
+}
+
+// PlayFile plays an FLV file named name in storage as video on demand. It must be called in OnPlay.
+// Start and Duration of the play command are honored, and players can seek and pause the stream.
+func (ctx *StreamContext) PlayFile(storage VODStorage, name string) error {
+	if ctx.playCmd == nil {
+		return errors.New("PlayFile must be called in OnPlay")
+	}
+
+	f, err := storage.Open(name)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open a file: Name = %s", name)
+	}
+
+	player, err := newVODPlayer(ctx.stream, f, ctx.playCmd)
+	if err != nil {
+		_ = f.Close()
+		return errors.Wrapf(err, "Failed to load a file: Name = %s", name)
+	}
+
+	if prev := ctx.stream.attachPlayer(player); prev != nil {
+		prev.stop()
+	}
+
+	return nil
 }
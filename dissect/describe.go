@@ -0,0 +1,204 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package dissect
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/yutopp/go-amf0"
+
+	"github.com/yutopp/go-rtmp/media"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+// maxPayloadDump limits bytes of payloads in fields
+const maxPayloadDump = 32
+
+// describeMessage Returns fields of a decoded message. AMF bodies are decoded into values,
+// and media payloads are summarized per frame.
+func describeMessage(m message.Message) map[string]interface{} {
+	switch m := m.(type) {
+	case *message.SetChunkSize:
+		return map[string]interface{}{"chunk_size": m.ChunkSize}
+
+	case *message.AbortMessage:
+		return map[string]interface{}{"chunk_stream_id": m.ChunkStreamID}
+
+	case *message.Ack:
+		return map[string]interface{}{"sequence_number": m.SequenceNumber}
+
+	case *message.UserCtrl:
+		return describeUserCtrlEvent(m.Event)
+
+	case *message.WinAckSize:
+		return map[string]interface{}{"size": m.Size}
+
+	case *message.SetPeerBandwidth:
+		return map[string]interface{}{"size": m.Size, "limit": m.Limit}
+
+	case *message.AudioMessage:
+		return describeAudio(m.Payload)
+
+	case *message.VideoMessage:
+		return describeVideo(m.Payload)
+
+	case *message.DataMessage:
+		fields := map[string]interface{}{"name": m.Name}
+		describeAMFBody(fields, m.Body)
+		return fields
+
+	case *message.CommandMessage:
+		fields := map[string]interface{}{
+			"name":           m.CommandName,
+			"transaction_id": m.TransactionID,
+		}
+		describeAMFBody(fields, m.Body)
+		return fields
+
+	default:
+		return nil
+	}
+}
+
+func describeUserCtrlEvent(ev message.UserCtrlEvent) map[string]interface{} {
+	switch ev := ev.(type) {
+	case *message.UserCtrlEventStreamBegin:
+		return map[string]interface{}{"event": "stream_begin", "stream_id": ev.StreamID}
+	case *message.UserCtrlEventStreamEOF:
+		return map[string]interface{}{"event": "stream_eof", "stream_id": ev.StreamID}
+	case *message.UserCtrlEventStreamDry:
+		return map[string]interface{}{"event": "stream_dry", "stream_id": ev.StreamID}
+	case *message.UserCtrlEventSetBufferLength:
+		return map[string]interface{}{"event": "set_buffer_length", "stream_id": ev.StreamID, "length_ms": ev.LengthMs}
+	case *message.UserCtrlEventStreamIsRecorded:
+		return map[string]interface{}{"event": "stream_is_recorded", "stream_id": ev.StreamID}
+	case *message.UserCtrlEventPingRequest:
+		return map[string]interface{}{"event": "ping_request", "timestamp": ev.Timestamp}
+	case *message.UserCtrlEventPingResponse:
+		return map[string]interface{}{"event": "ping_response", "timestamp": ev.Timestamp}
+	default:
+		return map[string]interface{}{"event": fmt.Sprintf("%T", ev)}
+	}
+}
+
+// describeAMFBody Decodes all AMF0 values in body. Values which cannot be decoded are dumped.
+func describeAMFBody(fields map[string]interface{}, body io.Reader) {
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		fields["error"] = err.Error()
+		return
+	}
+
+	dec := amf0.NewDecoder(bytes.NewReader(b))
+	values := []interface{}{}
+	for {
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			if err != io.EOF {
+				fields["error"] = err.Error()
+				fields["payload"] = hexPrefix(b)
+			}
+			break
+		}
+		values = append(values, v)
+	}
+	fields["body"] = values
+}
+
+func describeAudio(payload io.Reader) map[string]interface{} {
+	b, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+
+	frames, err := media.DecodeAudioFrames(bytes.NewReader(b))
+	if err != nil {
+		return map[string]interface{}{"error": err.Error(), "payload": hexPrefix(b)}
+	}
+
+	summaries := make([]map[string]interface{}, 0, len(frames))
+	for i := range frames {
+		f := &frames[i]
+		s := map[string]interface{}{
+			"codec":           audioCodecName(f),
+			"sequence_header": f.IsSequenceHeader(),
+			"size":            len(f.Data),
+		}
+		if f.IsMultitrack {
+			s["track_id"] = f.TrackID
+		}
+		if f.IsSequenceHeader() {
+			if info, err := media.ParseAudioInfo(f); err == nil {
+				s["sample_rate"] = info.SampleRate
+				s["channels"] = info.Channels
+			}
+		}
+		summaries = append(summaries, s)
+	}
+	return map[string]interface{}{"frames": summaries}
+}
+
+func describeVideo(payload io.Reader) map[string]interface{} {
+	b, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+
+	frames, err := media.DecodeVideoFrames(bytes.NewReader(b))
+	if err != nil {
+		return map[string]interface{}{"error": err.Error(), "payload": hexPrefix(b)}
+	}
+
+	summaries := make([]map[string]interface{}, 0, len(frames))
+	for i := range frames {
+		f := &frames[i]
+		s := map[string]interface{}{
+			"codec":            videoCodecName(f),
+			"key_frame":        f.IsKeyFrame(),
+			"sequence_header":  f.IsSequenceHeader(),
+			"composition_time": f.CompositionTime,
+			"size":             len(f.Data),
+		}
+		if f.IsMultitrack {
+			s["track_id"] = f.TrackID
+		}
+		if f.IsSequenceHeader() {
+			if info, err := media.ParseVideoInfo(f); err == nil && info.Width > 0 {
+				s["width"] = info.Width
+				s["height"] = info.Height
+			}
+		}
+		summaries = append(summaries, s)
+	}
+	return map[string]interface{}{"frames": summaries}
+}
+
+func audioCodecName(f *media.AudioFrame) string {
+	if f.FourCC != 0 {
+		return f.FourCC.String()
+	}
+	return fmt.Sprintf("sound_format_%d", f.SoundFormat)
+}
+
+func videoCodecName(f *media.VideoFrame) string {
+	if f.FourCC != 0 {
+		return f.FourCC.String()
+	}
+	return fmt.Sprintf("codec_id_%d", f.CodecID)
+}
+
+func hexPrefix(b []byte) string {
+	if len(b) > maxPayloadDump {
+		return hex.EncodeToString(b[:maxPayloadDump]) + "..."
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,295 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package dissect decodes bytes of one direction of an RTMP connection into handshakes, chunks and messages offline.
+//
+// Bytes are decoded by the handshake decoder and a read-only rtmp.ChunkStreamer, and chunk size changes are followed.
+// Inputs are raw byte streams (e.g. payloads dumped by proxies), captures of package capture or TCP streams
+// extracted from pcap or pcapng files by ReadPcapStream.
+package dissect
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+
+	"github.com/yutopp/go-rtmp"
+	"github.com/yutopp/go-rtmp/handshake"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+// EventKind A kind of events.
+type EventKind string
+
+const (
+	EventKindHandshake EventKind = "handshake"
+	EventKindChunk     EventKind = "chunk"
+	EventKindMessage   EventKind = "message"
+	EventKindError     EventKind = "error"
+)
+
+// Event A decoded element of a byte stream. One of Handshake, Chunk, Message or Error is set according to Kind.
+type Event struct {
+	Kind EventKind `json:"kind"`
+	// Offset is a byte offset where the element starts. Messages have an offset of their last chunk.
+	Offset int64 `json:"offset"`
+
+	Handshake *Handshake `json:"handshake,omitempty"`
+	Chunk     *Chunk     `json:"chunk,omitempty"`
+	Message   *Message   `json:"message,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Handshake A packet of a handshake.
+type Handshake struct {
+	Packet string                 `json:"packet"` // "C0/S0", "C1/S1" or "C2/S2"
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// Chunk A header of a chunk. See rtmp.ChunkHeader.
+type Chunk struct {
+	Fmt             byte   `json:"fmt"`
+	ChunkStreamID   int    `json:"chunk_stream_id"`
+	Timestamp       uint32 `json:"timestamp"`
+	MessageLength   uint32 `json:"message_length"`
+	MessageTypeID   byte   `json:"message_type_id"`
+	MessageStreamID uint32 `json:"message_stream_id"`
+	PayloadLength   int    `json:"payload_length"`
+}
+
+// Message A message which is reassembled from chunks. Fields depend on types. See describeMessage.
+type Message struct {
+	ChunkStreamID int                    `json:"chunk_stream_id"`
+	Timestamp     uint32                 `json:"timestamp"`
+	StreamID      uint32                 `json:"stream_id"`
+	TypeID        message.TypeID         `json:"type_id"`
+	Type          string                 `json:"type"`
+	Length        uint32                 `json:"length"`
+	Fields        map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Config Configurations of Dissect.
+type Config struct {
+	// SkipHandshake is true if bytes start from chunks. e.g. bytes after a handshake.
+	SkipHandshake bool
+}
+
+// Dissect decodes r and calls emit with each event in order. It returns nil when r ends at a boundary of messages.
+// Malformed messages are reported as EventKindError and decoding continues, but malformed chunks stop decoding
+// because boundaries of following chunks are unknown.
+func Dissect(r io.Reader, config *Config, emit func(ev *Event) error) error {
+	if config == nil {
+		config = &Config{}
+	}
+
+	d := &dissector{
+		r:       &countingReader{r: bufio.NewReader(r)},
+		emit:    emit,
+		pending: make(map[int]uint32),
+	}
+
+	if !config.SkipHandshake {
+		if err := d.dissectHandshake(); err != nil {
+			return err
+		}
+	}
+
+	return d.dissectChunks()
+}
+
+type dissector struct {
+	r    *countingReader
+	emit func(ev *Event) error
+
+	chunkOffset     int64 // An offset of a next chunk
+	lastChunkOffset int64
+	pending         map[int]uint32 // Bytes of incomplete messages per chunk stream
+	emitErr         error
+}
+
+func (d *dissector) dissectHandshake() error {
+	dec := handshake.NewDecoder(d.r)
+
+	offset := d.r.n
+	var c0 handshake.S0C0
+	if err := dec.DecodeS0C0(&c0); err != nil {
+		return errors.Wrap(err, "Failed to decode C0/S0")
+	}
+	if err := d.emit(&Event{
+		Kind:   EventKindHandshake,
+		Offset: offset,
+		Handshake: &Handshake{
+			Packet: "C0/S0",
+			Fields: map[string]interface{}{"version": int(c0)},
+		},
+	}); err != nil {
+		return err
+	}
+	if c0 != handshake.S0C0(handshake.RTMPVersion) {
+		return errors.Errorf("Encrypted or unknown handshakes cannot be dissected: Version = %d", c0)
+	}
+
+	offset = d.r.n
+	var c1 handshake.S1C1
+	if err := dec.DecodeS1C1(&c1); err != nil {
+		return errors.Wrap(err, "Failed to decode C1/S1")
+	}
+	if err := d.emit(&Event{
+		Kind:   EventKindHandshake,
+		Offset: offset,
+		Handshake: &Handshake{
+			Packet: "C1/S1",
+			Fields: map[string]interface{}{
+				"time":    c1.Time,
+				"version": fmt.Sprintf("%d.%d.%d.%d", c1.Version[0], c1.Version[1], c1.Version[2], c1.Version[3]),
+			},
+		},
+	}); err != nil {
+		return err
+	}
+
+	offset = d.r.n
+	var c2 handshake.S2C2
+	if err := dec.DecodeS2C2(&c2); err != nil {
+		return errors.Wrap(err, "Failed to decode C2/S2")
+	}
+	return d.emit(&Event{
+		Kind:   EventKindHandshake,
+		Offset: offset,
+		Handshake: &Handshake{
+			Packet: "C2/S2",
+			Fields: map[string]interface{}{
+				"time":  c2.Time,
+				"time2": c2.Time2,
+			},
+		},
+	})
+}
+
+func (d *dissector) dissectChunks() (err error) {
+	cs := rtmp.NewChunkStreamer(d.r, ioutil.Discard, nil)
+	defer cs.Close()
+
+	d.chunkOffset = d.r.n
+	cs.SetChunkReadHook(d.onChunk)
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("Malformed chunk: Offset = %d, Err = %+v", d.chunkOffset, r)
+		}
+	}()
+
+	for {
+		reader, err := cs.NewChunkReader()
+		if d.emitErr != nil {
+			return d.emitErr
+		}
+		if err == io.EOF {
+			for csID, n := range d.pending {
+				if n > 0 {
+					return errors.Errorf("Stream ends in the middle of a message: ChunkStreamID = %d", csID)
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read a chunk: Offset = %d", d.chunkOffset)
+		}
+
+		if err := d.dissectMessage(cs, reader); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *dissector) onChunk(h *rtmp.ChunkHeader) {
+	offset := d.chunkOffset
+	d.chunkOffset = d.r.n
+	d.lastChunkOffset = offset
+
+	d.pending[h.ChunkStreamID] += uint32(h.PayloadLength)
+	if d.pending[h.ChunkStreamID] >= h.MessageLength {
+		d.pending[h.ChunkStreamID] = 0
+	}
+
+	if d.emitErr != nil {
+		return
+	}
+	d.emitErr = d.emit(&Event{
+		Kind:   EventKindChunk,
+		Offset: offset,
+		Chunk: &Chunk{
+			Fmt:             h.Fmt,
+			ChunkStreamID:   h.ChunkStreamID,
+			Timestamp:       h.Timestamp,
+			MessageLength:   h.MessageLength,
+			MessageTypeID:   h.MessageTypeID,
+			MessageStreamID: h.MessageStreamID,
+			PayloadLength:   h.PayloadLength,
+		},
+	})
+}
+
+func (d *dissector) dissectMessage(cs *rtmp.ChunkStreamer, reader *rtmp.ChunkStreamReader) error {
+	payload, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	typeID := message.TypeID(reader.MessageTypeID())
+	msg := &Message{
+		ChunkStreamID: reader.ChunkStreamID(),
+		Timestamp:     reader.Timestamp(),
+		StreamID:      reader.MessageStreamID(),
+		TypeID:        typeID,
+		Type:          typeID.String(),
+		Length:        reader.MessageLength(),
+	}
+	offset := d.lastChunkOffset
+
+	var m message.Message
+	if err := message.NewDecoder(bytes.NewReader(payload)).Decode(typeID, &m); err != nil {
+		msg.Fields = map[string]interface{}{"payload": hexPrefix(payload)}
+		if err := d.emit(&Event{Kind: EventKindMessage, Offset: offset, Message: msg}); err != nil {
+			return err
+		}
+		return d.emit(&Event{
+			Kind:   EventKindError,
+			Offset: offset,
+			Error:  fmt.Sprintf("Failed to decode a message: Type = %s, Err = %v", typeID, err),
+		})
+	}
+
+	msg.Fields = describeMessage(m)
+	if err := d.emit(&Event{Kind: EventKindMessage, Offset: offset, Message: msg}); err != nil {
+		return err
+	}
+
+	// Follow chunk sizes of the stream
+	if m, ok := m.(*message.SetChunkSize); ok {
+		if err := cs.PeerState().SetChunkSize(m.ChunkSize); err != nil {
+			return errors.Wrap(err, "Failed to set chunk size")
+		}
+	}
+
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.n += int64(n)
+	return n, err
+}
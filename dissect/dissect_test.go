@@ -0,0 +1,313 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package dissect
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp"
+	"github.com/yutopp/go-rtmp/capture"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+var aacRaw = []byte{0xaf, 0x01, 0x21, 0x10, 0x04}
+
+func collect(t *testing.T, r io.Reader, config *Config) []*Event {
+	var events []*Event
+	err := Dissect(r, config, func(ev *Event) error {
+		events = append(events, ev)
+		return nil
+	})
+	require.Nil(t, err)
+	return events
+}
+
+func messages(events []*Event) []*Message {
+	var msgs []*Message
+	for _, ev := range events {
+		if ev.Kind == EventKindMessage {
+			msgs = append(msgs, ev.Message)
+		}
+	}
+	return msgs
+}
+
+func TestDissectClientSession(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	require.Nil(t, err)
+
+	srv := rtmp.NewServer(&rtmp.ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *rtmp.ConnConfig) {
+			return conn, nil
+		},
+	})
+	defer srv.Close()
+
+	go func() {
+		_ = srv.Serve(l)
+	}()
+
+	var buf bytes.Buffer
+	c, err := rtmp.Dial("rtmp", l.Addr().String(), &rtmp.ConnConfig{Capture: &buf})
+	require.Nil(t, err)
+
+	require.Nil(t, c.Connect(nil))
+	s, err := c.CreateStream(nil, 128)
+	require.Nil(t, err)
+	require.Nil(t, s.Publish(&message.NetStreamPublish{PublishingName: "key", PublishingType: "live"}))
+	require.Nil(t, s.Write(4, 10, &message.AudioMessage{Payload: bytes.NewReader(aacRaw)}))
+	require.Nil(t, c.Close())
+
+	records, err := capture.ReadAll(&buf)
+	require.Nil(t, err)
+	var written bytes.Buffer
+	for _, rec := range records {
+		if rec.Type == capture.RecordTypeWrite {
+			written.Write(rec.Data)
+		}
+	}
+
+	events := collect(t, &written, nil)
+	require.Equal(t, "C0/S0", events[0].Handshake.Packet)
+	require.Equal(t, "C1/S1", events[1].Handshake.Packet)
+	require.Equal(t, "C2/S2", events[2].Handshake.Packet)
+	require.Equal(t, int64(1+1536), events[2].Offset)
+	require.Equal(t, EventKindChunk, events[3].Kind)
+	require.Equal(t, int64(1+1536*2), events[3].Offset)
+
+	msgs := messages(events)
+	var names []string
+	for _, m := range msgs {
+		if m.TypeID == message.TypeIDCommandMessageAMF0 {
+			names = append(names, m.Fields["name"].(string))
+		}
+	}
+	require.Equal(t, []string{"connect", "createStream", "publish"}, names[:3])
+
+	var audio *Message
+	for _, m := range msgs {
+		if m.TypeID == message.TypeIDAudioMessage {
+			audio = m
+		}
+	}
+	require.NotNil(t, audio)
+	require.Equal(t, uint32(10), audio.Timestamp)
+	frame := audio.Fields["frames"].([]map[string]interface{})[0]
+	require.Equal(t, "mp4a", frame["codec"])
+	require.Equal(t, false, frame["sequence_header"])
+
+	// Text and JSON outputs
+	var text, js bytes.Buffer
+	writeText, err := NewEventWriter(&text, FormatText)
+	require.Nil(t, err)
+	writeJSON, err := NewEventWriter(&js, FormatJSON)
+	require.Nil(t, err)
+	for _, ev := range events {
+		require.Nil(t, writeText(ev))
+		require.Nil(t, writeJSON(ev))
+	}
+	require.Contains(t, text.String(), `command_amf0 csid=3 ts=0 msid=1`)
+	require.Contains(t, text.String(), `name="publish"`)
+
+	lines := strings.Split(strings.TrimSpace(js.String()), "\n")
+	require.Equal(t, len(events), len(lines))
+	var ev map[string]interface{}
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &ev))
+	require.Equal(t, "handshake", ev["kind"])
+}
+
+func TestDissectFollowsChunkSize(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var buf bytes.Buffer
+	cs := rtmp.NewChunkStreamer(bytes.NewReader(nil), &buf, nil)
+	defer cs.Close()
+
+	// NewChunkWriter waits until a previous message of the chunk stream is written
+	wait := func(chunkStreamID int) {
+		_, err := cs.NewChunkWriter(ctx, chunkStreamID)
+		require.Nil(t, err)
+	}
+
+	err := cs.Write(ctx, 2, 0, &rtmp.ChunkMessage{Message: &message.SetChunkSize{ChunkSize: 256}})
+	require.Nil(t, err)
+	wait(2)
+	require.Nil(t, cs.SelfState().SetChunkSize(256))
+
+	payload := append([]byte{0x17, 0x01, 0x00, 0x00, 0x00}, make([]byte, 295)...)
+	err = cs.Write(ctx, 6, 20, &rtmp.ChunkMessage{StreamID: 1, Message: &message.VideoMessage{Payload: bytes.NewReader(payload)}})
+	require.Nil(t, err)
+	wait(6)
+
+	events := collect(t, &buf, &Config{SkipHandshake: true})
+
+	var chunks []int
+	for _, ev := range events {
+		if ev.Kind == EventKindChunk {
+			chunks = append(chunks, ev.Chunk.PayloadLength)
+		}
+	}
+	require.Equal(t, []int{4, 256, 44}, chunks)
+
+	msgs := messages(events)
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, uint32(256), msgs[0].Fields["chunk_size"])
+	frame := msgs[1].Fields["frames"].([]map[string]interface{})[0]
+	require.Equal(t, true, frame["key_frame"])
+	require.Equal(t, 295, frame["size"])
+}
+
+func TestDissectReportsTruncatedStream(t *testing.T) {
+	// A basic header and a message header of a 100 bytes command, and only 3 bytes of the payload
+	b := []byte{0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x64, 0x14, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x01}
+	err := Dissect(bytes.NewReader(b), &Config{SkipHandshake: true}, func(*Event) error { return nil })
+	require.NotNil(t, err)
+}
+
+// testEthernetTCP Builds an Ethernet frame of an IPv4 TCP segment.
+func testEthernetTCP(src, dst []byte, srcPort, dstPort uint16, seq uint32, syn bool, data string) []byte {
+	tcp := make([]byte, 20)
+	binary.BigEndian.PutUint16(tcp[0:2], srcPort)
+	binary.BigEndian.PutUint16(tcp[2:4], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:8], seq)
+	tcp[12] = 5 << 4
+	if syn {
+		tcp[13] = 0x02
+	}
+	tcp = append(tcp, data...)
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(tcp)))
+	ip[9] = 6
+	copy(ip[12:16], src)
+	copy(ip[16:20], dst)
+	ip = append(ip, tcp...)
+
+	eth := make([]byte, 14)
+	binary.BigEndian.PutUint16(eth[12:14], 0x0800)
+	return append(eth, ip...)
+}
+
+func testPcapStream(t *testing.T, header []byte, writePacket func(w *bytes.Buffer, frame []byte)) {
+	var pcap bytes.Buffer
+	pcap.Write(header)
+
+	client, server := []byte{10, 0, 0, 1}, []byte{10, 0, 0, 2}
+	write := func(src, dst []byte, srcPort, dstPort uint16, seq uint32, syn bool, data string) {
+		writePacket(&pcap, testEthernetTCP(src, dst, srcPort, dstPort, seq, syn, data))
+	}
+
+	write(client, server, 50000, 1935, 1000, true, "")
+	write(server, client, 1935, 50000, 5000, true, "")
+	write(client, server, 50000, 1935, 1007, false, "world") // Out of order
+	write(server, client, 1935, 50000, 5001, false, "ignored")
+	write(client, server, 50000, 1935, 1001, false, "hello ")
+	write(client, server, 50000, 1935, 1001, false, "hello ") // Retransmission
+	write(client, server, 50001, 1935, 9000, false, "another connection")
+
+	b, err := ReadPcapStream(bytes.NewReader(pcap.Bytes()), nil)
+	require.Nil(t, err)
+	require.Equal(t, "hello world", string(b))
+
+	b, err = ReadPcapStream(bytes.NewReader(pcap.Bytes()), &PcapConfig{FromServer: true})
+	require.Nil(t, err)
+	require.Equal(t, "ignored", string(b))
+
+	// A gap
+	write(client, server, 50000, 1935, 1100, false, "lost")
+	b, err = ReadPcapStream(bytes.NewReader(pcap.Bytes()), nil)
+	require.Equal(t, ErrTCPStreamGap, err)
+	require.Equal(t, "hello world", string(b))
+}
+
+func TestReadPcapStream(t *testing.T) {
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint32(header[16:20], 65535)
+	binary.LittleEndian.PutUint32(header[20:24], linkTypeEthernet)
+
+	testPcapStream(t, header, func(w *bytes.Buffer, frame []byte) {
+		rec := make([]byte, 16)
+		binary.LittleEndian.PutUint32(rec[8:12], uint32(len(frame)))
+		binary.LittleEndian.PutUint32(rec[12:16], uint32(len(frame)))
+		w.Write(rec)
+		w.Write(frame)
+	})
+
+	// Lengths beyond snaplen are not trusted
+	rec := make([]byte, 16)
+	binary.LittleEndian.PutUint32(rec[8:12], 0xffffffff)
+	_, err := ReadPcapStream(bytes.NewReader(append(header, rec...)), nil)
+	require.NotNil(t, err)
+}
+
+func TestReadPcapngStream(t *testing.T) {
+	block := func(blockType uint32, body []byte) []byte {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		b := make([]byte, 8, 12+len(body))
+		binary.BigEndian.PutUint32(b[0:4], blockType)
+		binary.BigEndian.PutUint32(b[4:8], uint32(12+len(body)))
+		b = append(b, body...)
+		return append(b, b[4:8]...)
+	}
+
+	shb := make([]byte, 16)
+	binary.BigEndian.PutUint32(shb[0:4], 0x1a2b3c4d)
+	binary.BigEndian.PutUint16(shb[4:6], 1)
+	idb := make([]byte, 8)
+	binary.BigEndian.PutUint16(idb[0:2], linkTypeEthernet)
+	binary.BigEndian.PutUint32(idb[4:8], 65535)
+	var header []byte
+	header = append(header, block(pcapngBlockTypeSHB, shb)...)
+	header = append(header, block(pcapngBlockTypeIDB, idb)...)
+	header = append(header, block(0x00000005, make([]byte, 8))...) // Interface Statistics Block is skipped
+
+	testPcapStream(t, header, func(w *bytes.Buffer, frame []byte) {
+		epb := make([]byte, 20)
+		binary.BigEndian.PutUint32(epb[12:16], uint32(len(frame)))
+		binary.BigEndian.PutUint32(epb[16:20], uint32(len(frame)))
+		w.Write(block(pcapngBlockTypeEPB, append(epb, frame...)))
+	})
+
+	// Lengths beyond snaplen are not trusted
+	epb := make([]byte, 20)
+	binary.BigEndian.PutUint32(epb[12:16], 0xffffffff)
+	_, err := ReadPcapStream(bytes.NewReader(append(header, block(pcapngBlockTypeEPB, epb)...)), nil)
+	require.NotNil(t, err)
+}
+
+func TestFormatEventSortsFields(t *testing.T) {
+	s := FormatEvent(&Event{
+		Kind:   EventKindMessage,
+		Offset: 1,
+		Message: &Message{
+			Type: "data_amf0",
+			Fields: map[string]interface{}{
+				"name": "@setDataFrame",
+				"body": []interface{}{"onMetaData", map[string]interface{}{"width": 1280.0, "height": 720.0}},
+			},
+		},
+	})
+	require.Equal(t, fmt.Sprintf("%8d %-9s", 1, "message")+
+		` data_amf0 csid=0 ts=0 msid=0 len=0 body=["onMetaData", {height: 720, width: 1280}] name="@setDataFrame"`, s)
+}
@@ -0,0 +1,305 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package dissect
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ErrTCPStreamGap is returned with bytes before a gap when segments of a TCP stream are missing in a pcap file.
+var ErrTCPStreamGap = errors.New("Segments of the TCP stream are missing")
+
+// PcapConfig Configurations of ReadPcapStream.
+type PcapConfig struct {
+	// ServerPort is a TCP port of the server. Default is 1935.
+	ServerPort uint16
+	// FromServer selects bytes sent by the server. Bytes sent by the client are selected by default.
+	FromServer bool
+}
+
+// Link types of pcap
+const (
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLinuxSLL = 113
+)
+
+// maxPacketSize The largest snaplen of tcpdump. Lengths of packets in files are not trusted beyond it.
+const maxPacketSize = 262144
+
+// ReadPcapStream extracts bytes of one direction of the first TCP connection to the server port in a pcap or pcapng
+// file. This is a stand-in for TCP reassembly: segments are ordered by sequence numbers and retransmissions are
+// deduplicated, but IP fragments and IPv6 extension headers are not handled.
+func ReadPcapStream(r io.Reader, config *PcapConfig) ([]byte, error) {
+	if config == nil {
+		config = &PcapConfig{}
+	}
+	port := config.ServerPort
+	if port == 0 {
+		port = 1935
+	}
+
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read pcap header")
+	}
+	var pr packetReader
+	if binary.LittleEndian.Uint32(magic) == pcapngBlockTypeSHB {
+		pr = &pcapngReader{r: br}
+	} else {
+		pr, err = newPcapReader(br)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var flow *tcpFlow
+	var segments []tcpSegment
+	for {
+		packet, linkType, err := pr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		seg, ok := parseTCPSegment(packet, linkType)
+		if !ok {
+			continue
+		}
+
+		// Follow the first connection which has the server port
+		segFlow := seg.flow
+		if segFlow.dstPort != port {
+			segFlow = segFlow.reverse()
+		}
+		if segFlow.dstPort != port {
+			continue
+		}
+		if flow == nil {
+			flow = &segFlow
+		}
+		if segFlow != *flow {
+			continue
+		}
+
+		fromServer := seg.flow.srcPort == port
+		if fromServer == config.FromServer {
+			segments = append(segments, seg)
+		}
+	}
+
+	return reassemble(segments)
+}
+
+// packetReader Reads packets with their link types. It returns io.EOF at the end of a file.
+type packetReader interface {
+	next() ([]byte, uint32, error)
+}
+
+// pcapReader A packetReader of pcap files.
+type pcapReader struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	linkType uint32
+	snapLen  uint32
+}
+
+func newPcapReader(r io.Reader) (*pcapReader, error) {
+	var header [24]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, errors.Wrap(err, "Failed to read pcap header")
+	}
+
+	var order binary.ByteOrder
+	switch binary.LittleEndian.Uint32(header[0:4]) {
+	case 0xa1b2c3d4, 0xa1b23c4d: // Microseconds, nanoseconds
+		order = binary.LittleEndian
+	case 0xd4c3b2a1, 0x4d3cb2a1:
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("Not a pcap or pcapng file")
+	}
+
+	return &pcapReader{
+		r:        r,
+		order:    order,
+		linkType: order.Uint32(header[20:24]),
+		snapLen:  limitSnapLen(order.Uint32(header[16:20])),
+	}, nil
+}
+
+func (pr *pcapReader) next() ([]byte, uint32, error) {
+	var recHeader [16]byte
+	if _, err := io.ReadFull(pr.r, recHeader[:]); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, errors.Wrap(err, "Failed to read packet header")
+	}
+
+	length := pr.order.Uint32(recHeader[8:12])
+	if length > pr.snapLen {
+		return nil, 0, errors.Errorf("Packet is larger than snaplen: Length = %d, SnapLen = %d", length, pr.snapLen)
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(pr.r, packet); err != nil {
+		return nil, 0, errors.Wrap(err, "Failed to read packet")
+	}
+
+	return packet, pr.linkType, nil
+}
+
+// limitSnapLen Returns snapLen of a file up to maxPacketSize. Zero means no limits.
+func limitSnapLen(snapLen uint32) uint32 {
+	if snapLen == 0 || snapLen > maxPacketSize {
+		return maxPacketSize
+	}
+	return snapLen
+}
+
+type tcpFlow struct {
+	srcAddr, dstAddr string
+	srcPort, dstPort uint16
+}
+
+func (f tcpFlow) reverse() tcpFlow {
+	return tcpFlow{srcAddr: f.dstAddr, dstAddr: f.srcAddr, srcPort: f.dstPort, dstPort: f.srcPort}
+}
+
+type tcpSegment struct {
+	flow tcpFlow
+	seq  uint32
+	syn  bool
+	data []byte
+}
+
+func parseTCPSegment(packet []byte, linkType uint32) (tcpSegment, bool) {
+	var ip []byte
+	switch linkType {
+	case linkTypeNull:
+		if len(packet) < 4 {
+			return tcpSegment{}, false
+		}
+		ip = packet[4:]
+	case linkTypeEthernet:
+		if len(packet) < 14 {
+			return tcpSegment{}, false
+		}
+		etherType, rest := binary.BigEndian.Uint16(packet[12:14]), packet[14:]
+		for etherType == 0x8100 && len(rest) >= 4 { // VLAN
+			etherType, rest = binary.BigEndian.Uint16(rest[2:4]), rest[4:]
+		}
+		ip = rest
+	case linkTypeRaw:
+		ip = packet
+	case linkTypeLinuxSLL:
+		if len(packet) < 16 {
+			return tcpSegment{}, false
+		}
+		ip = packet[16:]
+	default:
+		return tcpSegment{}, false
+	}
+	if len(ip) < 1 {
+		return tcpSegment{}, false
+	}
+
+	var seg tcpSegment
+	var tcp []byte
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 || ip[9] != 6 { // TCP
+			return tcpSegment{}, false
+		}
+		ihl := int(ip[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(ip[2:4]))
+		if ihl < 20 || total < ihl || len(ip) < total {
+			return tcpSegment{}, false
+		}
+		seg.flow.srcAddr, seg.flow.dstAddr = string(ip[12:16]), string(ip[16:20])
+		tcp = ip[ihl:total]
+	case 6:
+		if len(ip) < 40 || ip[6] != 6 { // TCP without extension headers
+			return tcpSegment{}, false
+		}
+		payloadLen := int(binary.BigEndian.Uint16(ip[4:6]))
+		if len(ip) < 40+payloadLen {
+			return tcpSegment{}, false
+		}
+		seg.flow.srcAddr, seg.flow.dstAddr = string(ip[8:24]), string(ip[24:40])
+		tcp = ip[40 : 40+payloadLen]
+	default:
+		return tcpSegment{}, false
+	}
+
+	if len(tcp) < 20 {
+		return tcpSegment{}, false
+	}
+	dataOffset := int(tcp[12]>>4) * 4
+	if dataOffset < 20 || len(tcp) < dataOffset {
+		return tcpSegment{}, false
+	}
+	seg.flow.srcPort = binary.BigEndian.Uint16(tcp[0:2])
+	seg.flow.dstPort = binary.BigEndian.Uint16(tcp[2:4])
+	seg.seq = binary.BigEndian.Uint32(tcp[4:8])
+	seg.syn = tcp[13]&0x02 != 0
+	seg.data = tcp[dataOffset:]
+
+	return seg, true
+}
+
+// reassemble Orders segments by sequence numbers relative to the SYN or the first segment.
+func reassemble(segments []tcpSegment) ([]byte, error) {
+	if len(segments) == 0 {
+		return nil, nil
+	}
+
+	isn := segments[0].seq
+	for _, seg := range segments {
+		if seg.syn {
+			isn = seg.seq + 1
+			break
+		}
+	}
+
+	type piece struct {
+		offset int64
+		data   []byte
+	}
+	pieces := make([]piece, 0, len(segments))
+	for _, seg := range segments {
+		if len(seg.data) == 0 {
+			continue
+		}
+		pieces = append(pieces, piece{offset: int64(int32(seg.seq - isn)), data: seg.data}) // Handles wraparound
+	}
+	sort.SliceStable(pieces, func(i, j int) bool { return pieces[i].offset < pieces[j].offset })
+
+	var buf []byte
+	for _, p := range pieces {
+		end := p.offset + int64(len(p.data))
+		switch {
+		case end <= int64(len(buf)):
+			continue // Retransmission
+		case p.offset > int64(len(buf)):
+			return buf, ErrTCPStreamGap
+		}
+		buf = append(buf, p.data[int64(len(buf))-p.offset:]...)
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,164 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package dissect
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// Block types of pcapng
+const (
+	pcapngBlockTypeSHB = 0x0a0d0d0a // Section Header Block. Same in both byte orders
+	pcapngBlockTypeIDB = 0x00000001 // Interface Description Block
+	pcapngBlockTypeSPB = 0x00000003 // Simple Packet Block
+	pcapngBlockTypeEPB = 0x00000006 // Enhanced Packet Block
+)
+
+// maxPcapngBlockSize Limits blocks which are read into memory. Packets and some options are allowed.
+const maxPcapngBlockSize = maxPacketSize + 64*1024
+
+// pcapngReader A packetReader of pcapng files. Blocks other than packets and interfaces are skipped.
+type pcapngReader struct {
+	r          io.Reader
+	order      binary.ByteOrder // Decided by a section header
+	interfaces []pcapngInterface
+}
+
+type pcapngInterface struct {
+	linkType uint32
+	snapLen  uint32
+}
+
+func (pr *pcapngReader) next() ([]byte, uint32, error) {
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(pr.r, header[:]); err != nil {
+			if err == io.EOF {
+				return nil, 0, io.EOF
+			}
+			return nil, 0, errors.Wrap(err, "Failed to read block header")
+		}
+
+		blockType := binary.LittleEndian.Uint32(header[0:4])
+		if blockType == pcapngBlockTypeSHB {
+			if err := pr.readSectionHeader(header); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		if pr.order == nil {
+			return nil, 0, errors.New("Not a pcap or pcapng file")
+		}
+		blockType = pr.order.Uint32(header[0:4])
+
+		length := pr.order.Uint32(header[4:8])
+		if length < 12 || length%4 != 0 {
+			return nil, 0, errors.Errorf("Invalid block length: Type = %d, Length = %d", blockType, length)
+		}
+		bodyLen := int64(length) - 12 // Without the header and the trailing length
+
+		switch blockType {
+		case pcapngBlockTypeIDB, pcapngBlockTypeSPB, pcapngBlockTypeEPB:
+		default:
+			if _, err := io.CopyN(ioutil.Discard, pr.r, bodyLen+4); err != nil {
+				return nil, 0, errors.Wrap(err, "Failed to skip block")
+			}
+			continue
+		}
+
+		if length > maxPcapngBlockSize {
+			return nil, 0, errors.Errorf("Block is too large: Type = %d, Length = %d", blockType, length)
+		}
+		body := make([]byte, bodyLen+4)
+		if _, err := io.ReadFull(pr.r, body); err != nil {
+			return nil, 0, errors.Wrap(err, "Failed to read block")
+		}
+		body = body[:bodyLen]
+
+		switch blockType {
+		case pcapngBlockTypeIDB:
+			if len(body) < 8 {
+				return nil, 0, errors.New("Interface description block is too short")
+			}
+			pr.interfaces = append(pr.interfaces, pcapngInterface{
+				linkType: uint32(pr.order.Uint16(body[0:2])),
+				snapLen:  limitSnapLen(pr.order.Uint32(body[4:8])),
+			})
+
+		case pcapngBlockTypeEPB:
+			if len(body) < 20 {
+				return nil, 0, errors.New("Enhanced packet block is too short")
+			}
+			iface, err := pr.iface(pr.order.Uint32(body[0:4]))
+			if err != nil {
+				return nil, 0, err
+			}
+			capLen := pr.order.Uint32(body[12:16])
+			if capLen > iface.snapLen || int64(capLen) > int64(len(body)-20) {
+				return nil, 0, errors.Errorf("Invalid captured length: Length = %d, SnapLen = %d", capLen, iface.snapLen)
+			}
+			return body[20 : 20+capLen], iface.linkType, nil
+
+		case pcapngBlockTypeSPB:
+			if len(body) < 4 {
+				return nil, 0, errors.New("Simple packet block is too short")
+			}
+			iface, err := pr.iface(0)
+			if err != nil {
+				return nil, 0, err
+			}
+			// The captured length is not recorded, so it is the original length up to snaplen
+			capLen := int64(pr.order.Uint32(body[0:4]))
+			if capLen > int64(iface.snapLen) {
+				capLen = int64(iface.snapLen)
+			}
+			if capLen > int64(len(body)-4) {
+				capLen = int64(len(body) - 4)
+			}
+			return body[4 : 4+capLen], iface.linkType, nil
+		}
+	}
+}
+
+// readSectionHeader Reads a byte order of a new section and skips the rest. Interfaces are reset per section.
+func (pr *pcapngReader) readSectionHeader(header [8]byte) error {
+	var magic [4]byte
+	if _, err := io.ReadFull(pr.r, magic[:]); err != nil {
+		return errors.Wrap(err, "Failed to read section header")
+	}
+	switch binary.LittleEndian.Uint32(magic[:]) {
+	case 0x1a2b3c4d:
+		pr.order = binary.LittleEndian
+	case 0x4d3c2b1a:
+		pr.order = binary.BigEndian
+	default:
+		return errors.New("Not a pcap or pcapng file")
+	}
+	pr.interfaces = nil
+
+	length := pr.order.Uint32(header[4:8])
+	if length < 28 || length%4 != 0 {
+		return errors.Errorf("Invalid section header length: %d", length)
+	}
+	if _, err := io.CopyN(ioutil.Discard, pr.r, int64(length)-12); err != nil {
+		return errors.Wrap(err, "Failed to read section header")
+	}
+
+	return nil
+}
+
+func (pr *pcapngReader) iface(id uint32) (*pcapngInterface, error) {
+	if int64(id) >= int64(len(pr.interfaces)) {
+		return nil, errors.Errorf("Unknown interface: ID = %d", id)
+	}
+	return &pr.interfaces[id], nil
+}
@@ -0,0 +1,128 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package dissect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Format A format of outputs.
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// NewEventWriter returns a function which writes events to w in format. It can be passed to Dissect.
+// FormatJSON writes an event as a JSON object per line.
+func NewEventWriter(w io.Writer, format Format) (func(ev *Event) error, error) {
+	switch format {
+	case FormatText:
+		return func(ev *Event) error {
+			_, err := io.WriteString(w, FormatEvent(ev)+"\n")
+			return err
+		}, nil
+
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		return func(ev *Event) error {
+			return enc.Encode(ev)
+		}, nil
+
+	default:
+		return nil, errors.Errorf("Unsupported format: %s", format)
+	}
+}
+
+// FormatEvent returns a line of text which describes ev. Fields are sorted by keys.
+func FormatEvent(ev *Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%8d %-9s", ev.Offset, ev.Kind)
+
+	switch {
+	case ev.Handshake != nil:
+		fmt.Fprintf(&b, " %s", ev.Handshake.Packet)
+		writeFields(&b, ev.Handshake.Fields)
+
+	case ev.Chunk != nil:
+		c := ev.Chunk
+		fmt.Fprintf(&b, " fmt=%d csid=%d ts=%d len=%d type=%d msid=%d payload=%d",
+			c.Fmt, c.ChunkStreamID, c.Timestamp, c.MessageLength, c.MessageTypeID, c.MessageStreamID, c.PayloadLength,
+		)
+
+	case ev.Message != nil:
+		m := ev.Message
+		fmt.Fprintf(&b, " %s csid=%d ts=%d msid=%d len=%d", m.Type, m.ChunkStreamID, m.Timestamp, m.StreamID, m.Length)
+		writeFields(&b, m.Fields)
+
+	default:
+		fmt.Fprintf(&b, " %s", ev.Error)
+	}
+
+	return b.String()
+}
+
+func writeFields(b *strings.Builder, fields map[string]interface{}) {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(b, " %s=%s", k, formatValue(fields[k]))
+	}
+}
+
+// formatValue Formats AMF values and summaries. Keys of maps are sorted to make outputs stable.
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		keys := make([]string, 0, rv.Len())
+		for _, k := range rv.MapKeys() {
+			keys = append(keys, fmt.Sprint(k.Interface()))
+		}
+		sort.Strings(keys)
+
+		elems := make([]string, 0, len(keys))
+		for _, k := range keys {
+			elems = append(elems, fmt.Sprintf("%s: %s", k, formatValue(rv.MapIndex(reflect.ValueOf(k).Convert(rv.Type().Key())).Interface())))
+		}
+		return "{" + strings.Join(elems, ", ") + "}"
+
+	case reflect.Slice, reflect.Array:
+		elems := make([]string, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			elems = append(elems, formatValue(rv.Index(i).Interface()))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,119 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"github.com/yutopp/go-rtmp/message"
+)
+
+// EnhancedRTMPConfig Capabilities of Enhanced RTMP which servers reply to clients requesting them in connect.
+type EnhancedRTMPConfig struct {
+	// FourCcList is a list of codecs which servers accept. e.g. []string{"hvc1", "av01"}
+	// All codecs requested by clients are accepted if empty because go-rtmp does not depend on codecs.
+	FourCcList []string
+
+	// VideoFourCcInfoMap and AudioFourCcInfoMap are capabilities of servers for each codec. e.g.
+	// map[string]int{"hvc1": message.FourCcInfoCanForward}. "*" represents any codecs.
+	// Flags requested by clients are intersected with them. Only forwarding is supported if empty because go-rtmp
+	// does not decode nor encode media.
+	VideoFourCcInfoMap map[string]int
+	AudioFourCcInfoMap map[string]int
+
+	// CapsEx is extended capabilities which servers support. e.g. message.CapsExReconnect
+	CapsEx int
+}
+
+// negotiate Fills Enhanced RTMP properties of a connect result for a connect command.
+// Nothing is filled if the client does not request Enhanced RTMP.
+func (c *EnhancedRTMPConfig) negotiate(
+	cmd *message.NetConnectionConnectCommand,
+	props *message.NetConnectionConnectResultProperties,
+) {
+	if !cmd.IsEnhanced() {
+		return
+	}
+
+	props.FourCcList = negotiateFourCcList(cmd.FourCcList, c.FourCcList)
+	props.VideoFourCcInfoMap = negotiateFourCcInfoMap(cmd.VideoFourCcInfoMap, c.VideoFourCcInfoMap)
+	props.AudioFourCcInfoMap = negotiateFourCcInfoMap(cmd.AudioFourCcInfoMap, c.AudioFourCcInfoMap)
+	props.CapsEx = cmd.CapsEx & c.CapsEx
+}
+
+func negotiateFourCcList(requested, supported []string) []string {
+	if len(supported) == 0 || containsFourCc(supported, message.FourCCWildcard) {
+		return requested
+	}
+	if containsFourCc(requested, message.FourCCWildcard) {
+		return supported
+	}
+
+	list := make([]string, 0, len(requested))
+	for _, fourCc := range requested {
+		if containsFourCc(supported, fourCc) {
+			list = append(list, fourCc)
+		}
+	}
+
+	return list
+}
+
+var defaultFourCcInfoMap = map[string]int{
+	message.FourCCWildcard: message.FourCcInfoCanForward,
+}
+
+// negotiateFourCcInfoMap Intersects flags of each codec. Codecs which have no flags in common are omitted.
+func negotiateFourCcInfoMap(requested, supported map[string]int) map[string]int {
+	if len(requested) == 0 {
+		return nil
+	}
+	if len(supported) == 0 {
+		supported = defaultFourCcInfoMap
+	}
+
+	infoMap := make(map[string]int)
+	for fourCc, flags := range requested {
+		if fourCc == message.FourCCWildcard {
+			continue
+		}
+
+		supportedFlags, ok := supported[fourCc]
+		if !ok {
+			supportedFlags = supported[message.FourCCWildcard]
+		}
+		if v := flags & supportedFlags; v != 0 {
+			infoMap[fourCc] = v
+		}
+	}
+
+	// Clients requesting "*" accept any codecs which servers support
+	if flags, ok := requested[message.FourCCWildcard]; ok {
+		for fourCc, supportedFlags := range supported {
+			if _, ok := requested[fourCc]; ok {
+				continue
+			}
+			if v := flags & supportedFlags; v != 0 {
+				infoMap[fourCc] = v
+			}
+		}
+	}
+
+	if len(infoMap) == 0 {
+		return nil
+	}
+
+	return infoMap
+}
+
+func containsFourCc(list []string, fourCc string) bool {
+	for _, v := range list {
+		if v == fourCc {
+			return true
+		}
+	}
+	return false
+}
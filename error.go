@@ -17,6 +17,10 @@ import (
 
 var ErrClosed = errors.New("Server is closed")
 
+// ErrConnectionClosed is returned when a connection is closed while waiting for a response.
+var ErrConnectionClosed = errors.New("Connection is closed")
+
+// ConnectRejectedError is returned to clients when a server rejects connect.
 type ConnectRejectedError struct {
 	TransactionID int64
 	Result        *message.NetConnectionConnectResult
@@ -30,6 +34,58 @@ func (err *ConnectRejectedError) Error() string {
 	)
 }
 
+// Redirect returns a tcUrl if the server redirects the client (ex.code = 302).
+func (err *ConnectRejectedError) Redirect() (string, bool) {
+	ex := err.Result.Information.Ex
+	if ex == nil || ex.Code != message.NetConnectionConnectResultExCodeRedirect || ex.Redirect == "" {
+		return "", false
+	}
+	return ex.Redirect, true
+}
+
+// ConnectRejection An error which Handler.OnConnect returns to reply a specific error result to connect.
+// Other errors are replied as NetConnection.Connect.Failed.
+type ConnectRejection struct {
+	Code        message.NetConnectionConnectCode // NetConnection.Connect.Rejected if empty
+	Description string
+	Application interface{}                           // Sent as information.application if not nil
+	Ex          *message.NetConnectionConnectResultEx // Sent as information.ex if not nil
+}
+
+// NewConnectRejection returns NetConnection.Connect.Rejected with an application object such as
+// application.rejectConnection of FMS. application may be nil.
+func NewConnectRejection(description string, application interface{}) *ConnectRejection {
+	return &ConnectRejection{
+		Code:        message.NetConnectionConnectCodeRejected,
+		Description: description,
+		Application: application,
+	}
+}
+
+// NewConnectInvalidApp returns NetConnection.Connect.InvalidApp.
+func NewConnectInvalidApp(description string) *ConnectRejection {
+	return &ConnectRejection{
+		Code:        message.NetConnectionConnectCodeInvalidApp,
+		Description: description,
+	}
+}
+
+// NewConnectRedirect returns NetConnection.Connect.Rejected which redirects clients to tcURL (ex.code = 302).
+func NewConnectRedirect(tcURL, description string) *ConnectRejection {
+	return &ConnectRejection{
+		Code:        message.NetConnectionConnectCodeRejected,
+		Description: description,
+		Ex: &message.NetConnectionConnectResultEx{
+			Code:     message.NetConnectionConnectResultExCodeRedirect,
+			Redirect: tcURL,
+		},
+	}
+}
+
+func (err *ConnectRejection) Error() string {
+	return fmt.Sprintf("Connect is rejected: Code = %s, Description = %s", err.Code, err.Description)
+}
+
 type CreateStreamRejectedError struct {
 	TransactionID int64
 	Result        *message.NetConnectionCreateStreamResult
@@ -42,3 +98,55 @@ func (err *CreateStreamRejectedError) Error() string {
 		err.Result,
 	)
 }
+
+// StatusError An error which Handler.OnPublish and Handler.OnPlay return to reply a specific onStatus.
+// Other errors are replied as NetStream.Publish.Failed or NetStream.Play.Failed.
+type StatusError struct {
+	Level       message.NetStreamOnStatusLevel // "error" if empty
+	Code        message.NetStreamOnStatusCode
+	Description string
+	Details     string // Sent as info.details if not empty. e.g. A stream name
+
+	// KeepConnection keeps the connection open after replying. The connection is closed by default.
+	KeepConnection bool
+}
+
+// NewPublishBadNameError returns NetStream.Publish.BadName. e.g. The name is already in use
+func NewPublishBadNameError(description, details string) *StatusError {
+	return &StatusError{
+		Code:        message.NetStreamOnStatusCodePublishBadName,
+		Description: description,
+		Details:     details,
+	}
+}
+
+// NewPublishDeniedError returns NetStream.Publish.Denied. e.g. The client is not authorized
+func NewPublishDeniedError(description, details string) *StatusError {
+	return &StatusError{
+		Code:        message.NetStreamOnStatusCodePublishDenied,
+		Description: description,
+		Details:     details,
+	}
+}
+
+// NewPlayStreamNotFoundError returns NetStream.Play.StreamNotFound.
+func NewPlayStreamNotFoundError(description, details string) *StatusError {
+	return &StatusError{
+		Code:        message.NetStreamOnStatusCodePlayStreamNotFound,
+		Description: description,
+		Details:     details,
+	}
+}
+
+// NewPlayFailedError returns NetStream.Play.Failed.
+func NewPlayFailedError(description, details string) *StatusError {
+	return &StatusError{
+		Code:        message.NetStreamOnStatusCodePlayFailed,
+		Description: description,
+		Details:     details,
+	}
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("Rejected with status: Code = %s, Description = %s", err.Code, err.Description)
+}
@@ -1,14 +1,14 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"io"
 	"log"
 
 	"github.com/pkg/errors"
-	flvtag "github.com/yutopp/go-flv/tag"
 	"github.com/yutopp/go-rtmp"
 	rtmpmsg "github.com/yutopp/go-rtmp/message"
+	"github.com/yutopp/go-rtmp/relay"
 )
 
 var _ rtmp.Handler = (*Handler)(nil)
@@ -16,14 +16,14 @@ var _ rtmp.Handler = (*Handler)(nil)
 // Handler An RTMP connection handler
 type Handler struct {
 	rtmp.DefaultHandler
-	relayService *RelayService
+	relayHub *relay.Hub
 
 	//
 	conn *rtmp.Conn
 
 	//
-	pub *Pub
-	sub *Sub
+	pub *relay.Publisher
+	sub *relay.Subscriber
 }
 
 func (h *Handler) OnServe(conn *rtmp.Conn) {
@@ -56,13 +56,14 @@ func (h *Handler) OnPublish(_ *rtmp.StreamContext, timestamp uint32, cmd *rtmpms
 		return errors.New("PublishingName is empty")
 	}
 
-	pubsub, err := h.relayService.NewPubsub(cmd.PublishingName)
+	pub, err := h.relayHub.Publish(cmd.PublishingName)
+	if err == relay.ErrAlreadyPublished {
+		return rtmp.NewPublishBadNameError("Stream is already published.", cmd.PublishingName)
+	}
 	if err != nil {
-		return errors.Wrap(err, "Failed to create pubsub")
+		return errors.Wrap(err, "Failed to publish")
 	}
 
-	pub := pubsub.Pub()
-
 	h.pub = pub
 
 	return nil
@@ -73,80 +74,34 @@ func (h *Handler) OnPlay(ctx *rtmp.StreamContext, timestamp uint32, cmd *rtmpmsg
 		return errors.New("Cannot play on this stream")
 	}
 
-	pubsub, err := h.relayService.GetPubsub(cmd.StreamName)
+	sub, err := h.relayHub.Subscribe(cmd.StreamName)
+	if err == relay.ErrNotPublished {
+		return rtmp.NewPlayStreamNotFoundError("Stream is not found.", cmd.StreamName)
+	}
 	if err != nil {
-		return errors.Wrap(err, "Failed to get pubsub")
+		return errors.Wrap(err, "Failed to subscribe")
 	}
 
-	sub := pubsub.Sub()
-	sub.eventCallback = onEventCallback(h.conn, ctx.StreamID)
-
 	h.sub = sub
 
+	go func(streamID uint32) {
+		err := relay.Forward(context.Background(), sub, h.conn, streamID)
+		log.Printf("Forwarding is finished: Err = %+v", err)
+	}(ctx.StreamID)
+
 	return nil
 }
 
 func (h *Handler) OnSetDataFrame(timestamp uint32, data *rtmpmsg.NetStreamSetDataFrame) error {
-	r := bytes.NewReader(data.Payload)
-
-	var script flvtag.ScriptData
-	if err := flvtag.DecodeScriptData(r, &script); err != nil {
-		log.Printf("Failed to decode script data: Err = %+v", err)
-		return nil // ignore
-	}
-
-	log.Printf("SetDataFrame: Script = %#v", script)
-
-	_ = h.pub.Publish(&flvtag.FlvTag{
-		TagType:   flvtag.TagTypeScriptData,
-		Timestamp: timestamp,
-		Data:      &script,
-	})
-
-	return nil
+	return h.pub.WriteMetaData(timestamp, data.Payload)
 }
 
 func (h *Handler) OnAudio(timestamp uint32, payload io.Reader) error {
-	var audio flvtag.AudioData
-	if err := flvtag.DecodeAudioData(payload, &audio); err != nil {
-		return err
-	}
-
-	flvBody := new(bytes.Buffer)
-	if _, err := io.Copy(flvBody, audio.Data); err != nil {
-		return err
-	}
-	audio.Data = flvBody
-
-	_ = h.pub.Publish(&flvtag.FlvTag{
-		TagType:   flvtag.TagTypeAudio,
-		Timestamp: timestamp,
-		Data:      &audio,
-	})
-
-	return nil
+	return h.pub.WriteAudio(timestamp, payload)
 }
 
 func (h *Handler) OnVideo(timestamp uint32, payload io.Reader) error {
-	var video flvtag.VideoData
-	if err := flvtag.DecodeVideoData(payload, &video); err != nil {
-		return err
-	}
-
-	// Need deep copy because payload will be recycled
-	flvBody := new(bytes.Buffer)
-	if _, err := io.Copy(flvBody, video.Data); err != nil {
-		return err
-	}
-	video.Data = flvBody
-
-	_ = h.pub.Publish(&flvtag.FlvTag{
-		TagType:   flvtag.TagTypeVideo,
-		Timestamp: timestamp,
-		Data:      &video,
-	})
-
-	return nil
+	return h.pub.WriteVideo(timestamp, payload)
 }
 
 func (h *Handler) OnClose() {
@@ -12,5 +12,5 @@ require (
 	github.com/stretchr/testify v1.8.1
 	github.com/yutopp/go-amf0 v0.1.0
 	github.com/yutopp/go-flv v0.3.1
-	golang.org/x/sys v0.3.0 // indirect
+	golang.org/x/crypto v0.9.0
 )
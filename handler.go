@@ -10,6 +10,7 @@ package rtmp
 import (
 	"io"
 
+	"github.com/yutopp/go-rtmp/media"
 	"github.com/yutopp/go-rtmp/message"
 )
 
@@ -31,3 +32,43 @@ type Handler interface {
 	OnUnknownDataMessage(timestamp uint32, data *message.DataMessage) error
 	OnClose()
 }
+
+// TrackHandler is an optional interface of Handler to receive media per track (Enhanced RTMP multitrack).
+// If a Handler implements it, OnAudioTrack and OnVideoTrack are called for each track instead of OnAudio and OnVideo.
+// Media which are not multitrack are delivered as a track whose ID is 0. Payloads which cannot be decoded such as
+// empty ones are delivered to OnAudio and OnVideo as they are.
+type TrackHandler interface {
+	OnAudioTrack(timestamp uint32, header *message.AudioHeader, track *message.AudioTrack) error
+	OnVideoTrack(timestamp uint32, header *message.VideoHeader, track *message.VideoTrack) error
+}
+
+// FrameHandler is an optional interface of Handler to receive media as typed frames parsed by the media package.
+// If a Handler implements it, OnAudioFrame and OnVideoFrame are called instead of OnAudio and OnVideo, so they are
+// exclusive. Call OnAudio and OnVideo from OnAudioFrame and OnVideoFrame if both are needed.
+// TrackHandler takes precedence over FrameHandler. Multitrack media are delivered as a frame per track.
+// Payloads which cannot be decoded such as empty ones are delivered to OnAudio and OnVideo as they are.
+type FrameHandler interface {
+	OnAudioFrame(timestamp uint32, frame *media.AudioFrame) error
+	OnVideoFrame(timestamp uint32, frame *media.VideoFrame) error
+}
+
+// StreamLengthHandler is an optional interface of Handler to answer getStreamLength commands.
+// If a Handler implements it, the returned length in seconds is replied as _result. An error is replied as _error.
+// VODStreamLength can be used to compute the length of files in a VODStorage.
+type StreamLengthHandler interface {
+	OnGetStreamLength(timestamp uint32, cmd *message.NetStreamGetStreamLength) (float64, error)
+}
+
+// BandwidthHandler is an optional interface of Handler to receive results of bandwidth checks.
+// At server side, it is called from another goroutine when a check of bandwidth to a client is finished.
+// At client side, it is called when a server sends onBWDone.
+type BandwidthHandler interface {
+	OnBandwidthChecked(result *BandwidthResult)
+}
+
+// StatusHandler is an optional interface of Handler to receive onStatus and onPlayStatus messages at client side.
+// If a Handler does not implement it, these messages are passed to OnUnknownCommandMessage and OnUnknownDataMessage.
+type StatusHandler interface {
+	OnStatus(timestamp uint32, status *message.NetStreamOnStatus) error
+	OnPlayStatus(timestamp uint32, status *message.NetStreamOnPlayStatus) error
+}
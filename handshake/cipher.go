@@ -0,0 +1,143 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package handshake
+
+import (
+	"crypto/cipher"
+	"crypto/rc4"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blowfish"
+	"golang.org/x/crypto/xtea"
+)
+
+// Cipher holds RC4 stream ciphers negotiated by an RTMPE handshake.
+type Cipher struct {
+	in  *rc4.Cipher
+	out *rc4.Cipher
+}
+
+// newCipher Initializes keys in the same way as librtmp.
+// A key to send data is derived from a public key of the peer, and a key to receive data is from the own one.
+func newCipher(secret, selfPublic, peerPublic []byte) (*Cipher, error) {
+	out, err := rc4.NewCipher(hmacSHA256(secret, peerPublic)[:16])
+	if err != nil {
+		return nil, err
+	}
+
+	in, err := rc4.NewCipher(hmacSHA256(secret, selfPublic)[:16])
+	if err != nil {
+		return nil, err
+	}
+
+	// Both sides skip keystreams for the size of a handshake signature
+	var dummy [sigSize]byte
+	in.XORKeyStream(dummy[:], dummy[:])
+	out.XORKeyStream(dummy[:], dummy[:])
+
+	return &Cipher{
+		in:  in,
+		out: out,
+	}, nil
+}
+
+// NewReader returns a reader which decrypts data from r.
+func (c *Cipher) NewReader(r io.Reader) io.Reader {
+	return &cipher.StreamReader{S: c.in, R: r}
+}
+
+// NewWriter returns a writer which encrypts data to w.
+func (c *Cipher) NewWriter(w io.Writer) io.Writer {
+	return &cipher.StreamWriter{S: c.out, W: w}
+}
+
+// SignatureKeys are key tables to sign S2/C2 of RTMPE handshakes by XTEA (version 8) or Blowfish (version 9) as
+// rtmpe8_sig and rtmpe9_sig of librtmp. A key of each 8 bytes block is chosen by a byte of an intermediate digest
+// modulo 15, so each table must have 15 entries. XTEA keys are words as rtmpe8_keys of librtmp.
+// The tables are not distributed with this package. Supply ones which are compatible with peers.
+type SignatureKeys struct {
+	XTEA     [][4]uint32
+	Blowfish [][24]byte
+}
+
+const signatureKeyCount = 15
+
+func (k *SignatureKeys) validate(version S0C0) error {
+	if version != VersionRTMPEXTEA && version != VersionRTMPEBlowfish {
+		return nil
+	}
+	if k == nil {
+		return errors.Errorf("Signature keys are required: Version = %d", version)
+	}
+
+	switch version {
+	case VersionRTMPEXTEA:
+		if len(k.XTEA) < signatureKeyCount {
+			return errors.Errorf("XTEA keys are too few: Len = %d", len(k.XTEA))
+		}
+	case VersionRTMPEBlowfish:
+		if len(k.Blowfish) < signatureKeyCount {
+			return errors.Errorf("Blowfish keys are too few: Len = %d", len(k.Blowfish))
+		}
+	}
+
+	return nil
+}
+
+// signSignature Encrypts a S2/C2 signature in place by 8 bytes blocks for version 8 and 9.
+// digestKey is a HMAC of a peer digest, which is a key of the signature. A byte of it at the offset of each block
+// chooses a key of the block.
+func (k *SignatureKeys) signSignature(version S0C0, signature []byte, digestKey []byte) error {
+	for i := 0; i+8 <= len(signature); i += 8 {
+		index := int(digestKey[i]) % signatureKeyCount
+
+		var block cipher.Block
+		var err error
+		switch version {
+		case VersionRTMPEXTEA:
+			block, err = xtea.NewCipher(xteaKeyBytes(k.XTEA[index]))
+		case VersionRTMPEBlowfish:
+			block, err = blowfish.NewCipher(k.Blowfish[index][:])
+		default:
+			return nil // Not signed
+		}
+		if err != nil {
+			return err
+		}
+
+		encryptLittleEndian(block, signature[i:i+8])
+	}
+
+	return nil
+}
+
+// xteaKeyBytes Encodes key words in the byte order of xtea.NewCipher.
+func xteaKeyBytes(key [4]uint32) []byte {
+	b := make([]byte, 16)
+	for i, w := range key {
+		binary.BigEndian.PutUint32(b[i*4:], w)
+	}
+
+	return b
+}
+
+// encryptLittleEndian Encrypts a 8 bytes block in place whose halves are little-endian words as librtmp does.
+// Ciphers of golang.org/x/crypto load words as big-endian, so bytes are swapped around them.
+func encryptLittleEndian(block cipher.Block, b []byte) {
+	swapWords(b)
+	block.Encrypt(b, b)
+	swapWords(b)
+}
+
+func swapWords(b []byte) {
+	for i := 0; i+4 <= len(b); i += 4 {
+		b[i], b[i+1], b[i+2], b[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+}
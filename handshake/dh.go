@@ -0,0 +1,71 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package handshake
+
+import (
+	"crypto/rand"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+const dhKeySize = 128 // 1024 bits
+
+// dhPrime The 1024-bit MODP group (RFC 2409, 6.2) used by RTMPE
+var dhPrime, _ = new(big.Int).SetString(
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1"+
+		"29024E088A67CC74020BBEA63B139B22514A08798E3404DD"+
+		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245"+
+		"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE65381"+
+		"FFFFFFFFFFFFFFFF",
+	16,
+)
+
+var dhGenerator = big.NewInt(2)
+
+type dhKey struct {
+	private *big.Int
+	public  []byte
+}
+
+func newDHKey() (*dhKey, error) {
+	max := new(big.Int).Sub(dhPrime, big.NewInt(3))
+	x, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return nil, err
+	}
+	x.Add(x, big.NewInt(2)) // [2, p-2]
+
+	y := new(big.Int).Exp(dhGenerator, x, dhPrime)
+
+	return &dhKey{
+		private: x,
+		public:  padKey(y.Bytes()),
+	}, nil
+}
+
+// sharedSecret Computes a shared secret from a public key of a peer.
+func (k *dhKey) sharedSecret(peerPublic []byte) ([]byte, error) {
+	y := new(big.Int).SetBytes(peerPublic)
+
+	// 1 < y < p-1
+	if y.Cmp(big.NewInt(1)) <= 0 || y.Cmp(new(big.Int).Sub(dhPrime, big.NewInt(1))) >= 0 {
+		return nil, errors.New("Invalid DH public key")
+	}
+
+	s := new(big.Int).Exp(y, k.private, dhPrime)
+
+	return padKey(s.Bytes()), nil
+}
+
+func padKey(b []byte) []byte {
+	key := make([]byte, dhKeySize)
+	copy(key[dhKeySize-len(b):], b)
+	return key
+}
@@ -0,0 +1,103 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package handshake
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+const (
+	sigSize    = 1536 // time(4) + version(4) + random(1528)
+	digestSize = sha256.Size
+)
+
+var keyCommon = []byte{
+	0xf0, 0xee, 0xc2, 0x4a, 0x80, 0x68, 0xbe, 0xe8, 0x2e, 0x00, 0xd0, 0xd1,
+	0x02, 0x9e, 0x7e, 0x57, 0x6e, 0xec, 0x5d, 0x2d, 0x29, 0x80, 0x6f, 0xab,
+	0x93, 0xb8, 0xe6, 0x36, 0xcf, 0xeb, 0x31, 0xae,
+}
+
+// genuineFMSKey "Genuine Adobe Flash Media Server 001" + common key (68 bytes)
+var genuineFMSKey = append([]byte("Genuine Adobe Flash Media Server 001"), keyCommon...)
+
+// genuineFPKey "Genuine Adobe Flash Player 001" + common key (62 bytes)
+var genuineFPKey = append([]byte("Genuine Adobe Flash Player 001"), keyCommon...)
+
+// Digest versions which are sent in S1/C1 to announce digest (Flash Player 9+) handshakes
+var (
+	DigestServerVersion = [4]byte{4, 5, 0, 1}
+	DigestClientVersion = [4]byte{128, 0, 7, 2}
+)
+
+// digestScheme Positions of a digest and a DH public key in C1/S1.
+//
+//	scheme 0: | time(4) | version(4) | digest block(764) | key block(764) |
+//	scheme 1: | time(4) | version(4) | key block(764)    | digest block(764) |
+type digestScheme int
+
+func (s digestScheme) digestOffset(sig []byte) int {
+	switch s {
+	case 0:
+		return (int(sig[8])+int(sig[9])+int(sig[10])+int(sig[11]))%728 + 12
+	default:
+		return (int(sig[772])+int(sig[773])+int(sig[774])+int(sig[775]))%728 + 776
+	}
+}
+
+func (s digestScheme) dhOffset(sig []byte) int {
+	switch s {
+	case 0:
+		return (int(sig[1532])+int(sig[1533])+int(sig[1534])+int(sig[1535]))%632 + 772
+	default:
+		return (int(sig[768])+int(sig[769])+int(sig[770])+int(sig[771]))%632 + 8
+	}
+}
+
+// calcDigest Calculates a digest of sig excluding the digest area at the offset.
+func calcDigest(sig []byte, offset int, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(sig[:offset])
+	_, _ = mac.Write(sig[offset+digestSize:])
+	return mac.Sum(nil)
+}
+
+// putDigest Writes a digest into sig and returns it.
+func putDigest(sig []byte, scheme digestScheme, key []byte) []byte {
+	offset := scheme.digestOffset(sig)
+	digest := calcDigest(sig, offset, key)
+	copy(sig[offset:], digest)
+
+	return digest
+}
+
+// findDigest Verifies a digest in sig by each scheme and returns the matched one.
+func findDigest(sig []byte, key []byte) (digestScheme, []byte, bool) {
+	for _, scheme := range []digestScheme{0, 1} {
+		offset := scheme.digestOffset(sig)
+		digest := calcDigest(sig, offset, key)
+		if hmac.Equal(digest, sig[offset:offset+digestSize]) {
+			return scheme, digest, true
+		}
+	}
+
+	return 0, nil, false
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// responseSignature Calculates a signature of S2/C2 which is stored at the tail of sig.
+// It also returns an intermediate key derived from the peer digest.
+func responseSignature(sig []byte, peerDigest []byte, key []byte) ([]byte, []byte) {
+	digestKey := hmacSHA256(key, peerDigest)
+	return hmacSHA256(digestKey, sig[:sigSize-digestSize]), digestKey
+}
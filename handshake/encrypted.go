@@ -0,0 +1,243 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package handshake
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// handshakeWithClientEncrypted An RTMPE handshake of the server side. C0 is already received.
+//
+//	C1: client digest + client DH public key
+//	S0, S1: server digest + server DH public key (uses the same scheme as C1)
+//	S2: signed by the client digest
+//	C2: signed by the server digest
+func handshakeWithClientEncrypted(r io.Reader, w io.Writer, version S0C0, config *Config) (*Result, error) {
+	// Recv C1
+	c1 := make([]byte, sigSize)
+	if _, err := io.ReadFull(r, c1); err != nil {
+		return nil, err
+	}
+
+	scheme, clientDigest, ok := findDigest(c1, genuineFPKey[:30])
+	if !ok {
+		if !config.SkipHandshakeVerification {
+			return nil, errors.New("Client digest is not matched")
+		}
+		offset := scheme.digestOffset(c1)
+		clientDigest = c1[offset : offset+digestSize]
+	}
+
+	key, err := newDHKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to generate DH key")
+	}
+
+	clientPublic := c1[scheme.dhOffset(c1):][:dhKeySize]
+	secret, err := key.sharedSecret(clientPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	cipher, err := newCipher(secret, key.public, clientPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send S0 + S1
+	s1, serverDigest, err := newDigestSig(DigestServerVersion, scheme, genuineFMSKey[:36], key.public)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append([]byte{byte(version)}, s1...)); err != nil {
+		return nil, err
+	}
+
+	// Send S2
+	s2, err := newResponseSig(version, clientDigest, genuineFMSKey, config.SignatureKeys)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(s2); err != nil {
+		return nil, err
+	}
+
+	// Recv C2
+	c2 := make([]byte, sigSize)
+	if _, err := io.ReadFull(r, c2); err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Version: version,
+		Cipher:  cipher,
+	}
+	copy(result.PeerVersion[:], c1[4:8])
+
+	if config.SkipHandshakeVerification {
+		return result, nil
+	}
+
+	if err := verifyResponseSig(version, c2, serverDigest, genuineFPKey, config.SignatureKeys); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// handshakeWithServerEncrypted An RTMPE handshake of the client side.
+func handshakeWithServerEncrypted(r io.Reader, w io.Writer, version S0C0, config *Config) (*Result, error) {
+	key, err := newDHKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to generate DH key")
+	}
+
+	// Signed types put a digest at the tail as librtmp does
+	scheme := digestScheme(0)
+	if version != VersionRTMPE {
+		scheme = 1
+	}
+
+	// Send C0 + C1
+	c1, clientDigest, err := newDigestSig(DigestClientVersion, scheme, genuineFPKey[:30], key.public)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append([]byte{byte(version)}, c1...)); err != nil {
+		return nil, errors.Wrap(err, "Failed to send c0 and c1")
+	}
+
+	// Recv S0
+	var s0 [1]byte
+	if _, err := io.ReadFull(r, s0[:]); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode s0")
+	}
+	if S0C0(s0[0]) != version {
+		return nil, errors.Errorf("Unexpected RTMP version: Expected = %d, Actual = %d", version, s0[0])
+	}
+
+	// Recv S1
+	s1 := make([]byte, sigSize)
+	if _, err := io.ReadFull(r, s1); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode s1")
+	}
+
+	serverScheme, serverDigest, ok := findDigest(s1, genuineFMSKey[:36])
+	if !ok {
+		if !config.SkipHandshakeVerification {
+			return nil, errors.New("Server digest is not matched")
+		}
+		serverScheme = scheme
+		offset := serverScheme.digestOffset(s1)
+		serverDigest = s1[offset : offset+digestSize]
+	}
+
+	serverPublic := s1[serverScheme.dhOffset(s1):][:dhKeySize]
+	secret, err := key.sharedSecret(serverPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	cipher, err := newCipher(secret, key.public, serverPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send C2
+	c2, err := newResponseSig(version, serverDigest, genuineFPKey, config.SignatureKeys)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(c2); err != nil {
+		return nil, errors.Wrap(err, "Failed to encode c2")
+	}
+
+	// Recv S2
+	s2 := make([]byte, sigSize)
+	if _, err := io.ReadFull(r, s2); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode s2")
+	}
+
+	result := &Result{
+		Version: version,
+		Cipher:  cipher,
+	}
+	copy(result.PeerVersion[:], s1[4:8])
+
+	if config.SkipHandshakeVerification {
+		return result, nil
+	}
+
+	if err := verifyResponseSig(version, s2, clientDigest, genuineFMSKey, config.SignatureKeys); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// newDigestSig Makes C1/S1 which contain a digest and a DH public key.
+func newDigestSig(version [4]byte, scheme digestScheme, digestKey []byte, public []byte) ([]byte, []byte, error) {
+	sig := make([]byte, sigSize)
+	if _, err := rand.Read(sig[8:]); err != nil { // Random Seq
+		return nil, nil, err
+	}
+	binary.BigEndian.PutUint32(sig[0:4], uint32(timeNow().UnixNano()/int64(time.Millisecond)))
+	copy(sig[4:8], version[:])
+
+	// Offsets do not depend on the areas of a key and a digest
+	copy(sig[scheme.dhOffset(sig):], public)
+	digest := putDigest(sig, scheme, digestKey)
+
+	return sig, digest, nil
+}
+
+// newResponseSig Makes S2/C2 which have a signature of the peer digest at the tail.
+func newResponseSig(version S0C0, peerDigest []byte, key []byte, keys *SignatureKeys) ([]byte, error) {
+	sig := make([]byte, sigSize)
+	if _, err := rand.Read(sig); err != nil { // Random Seq
+		return nil, err
+	}
+
+	signature, err := calcResponseSignature(version, sig, peerDigest, key, keys)
+	if err != nil {
+		return nil, err
+	}
+	copy(sig[sigSize-digestSize:], signature)
+
+	return sig, nil
+}
+
+func verifyResponseSig(version S0C0, sig []byte, digest []byte, key []byte, keys *SignatureKeys) error {
+	signature, err := calcResponseSignature(version, sig, digest, key, keys)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal(signature, sig[sigSize-digestSize:]) {
+		return errors.New("Signature is not matched")
+	}
+
+	return nil
+}
+
+func calcResponseSignature(version S0C0, sig []byte, digest []byte, key []byte, keys *SignatureKeys) ([]byte, error) {
+	signature, digestKey := responseSignature(sig, digest, key)
+	if keys != nil {
+		if err := keys.signSignature(version, signature, digestKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return signature, nil
+}
@@ -36,26 +36,79 @@ var Version = [4]byte{0, 0, 0, 0} // TODO: fix
 
 var timeNow = time.Now // For mock
 
+// RTMP versions in C0/S0
+const (
+	VersionPlain         S0C0 = 3 // Plain RTMP
+	VersionRTMPE         S0C0 = 6 // RTMPE (DH key exchange + RC4)
+	VersionRTMPEXTEA     S0C0 = 8 // RTMPE with XTEA signed S2/C2. Experimental, see SignatureKeys
+	VersionRTMPEBlowfish S0C0 = 9 // RTMPE with Blowfish signed S2/C2. Experimental, see SignatureKeys
+)
+
+func (v S0C0) IsEncrypted() bool {
+	return v == VersionRTMPE || v == VersionRTMPEXTEA || v == VersionRTMPEBlowfish
+}
+
 type Config struct {
 	SkipHandshakeVerification bool
+
+	// Version is requested by clients in C0. RTMPVersion is used if zero.
+	// Set VersionRTMPE to establish encrypted connections.
+	Version S0C0
+
+	// AllowEncryption makes servers accept RTMPE handshakes.
+	AllowEncryption bool
+
+	// SignatureKeys are required to handle VersionRTMPEXTEA and VersionRTMPEBlowfish, which are experimental.
+	// Servers respond to them as plain RTMP if it is nil.
+	SignatureKeys *SignatureKeys
+}
+
+// Result Negotiated parameters by a handshake.
+type Result struct {
+	Version     S0C0    // An RTMP version in C0/S0
+	PeerVersion [4]byte // A version in C1/S1 sent by the peer. e.g. [9 0 124 2]
+	Cipher      *Cipher // Not nil if the connection is encrypted (RTMPE)
 }
 
+// HandshakeWithClient does a handshake with a client. Encrypted handshakes are not accepted even if
+// config.AllowEncryption is true. Use NegotiateWithClient to handle encrypted connections.
 func HandshakeWithClient(r io.Reader, w io.Writer, config *Config) error {
+	c := *config
+	c.AllowEncryption = false
+
+	_, err := NegotiateWithClient(r, w, &c)
+	return err
+}
+
+// NegotiateWithClient does a handshake with a client and returns negotiated parameters.
+// If Result.Cipher is not nil, subsequent data must be read and written through it.
+func NegotiateWithClient(r io.Reader, w io.Writer, config *Config) (*Result, error) {
 	d := NewDecoder(r)
-	e := NewEncoder(w)
 
 	// Recv C0
 	var c0 S0C0
 	if err := d.DecodeS0C0(&c0); err != nil {
-		return err
+		return nil, err
 	}
 
-	// TODO: check c0 RTMP version
+	if c0 < VersionPlain {
+		return nil, errors.Errorf("Unsupported RTMP version: Version = %d", c0)
+	}
 
+	// Signed versions are accepted only if signature keys are supplied explicitly
+	if c0.IsEncrypted() && config.AllowEncryption && config.SignatureKeys.validate(c0) == nil {
+		return handshakeWithClientEncrypted(r, w, c0, config)
+	}
+
+	// A server that does not recognize the requested version should respond with 3
+	return handshakeWithClientPlain(d, NewEncoder(w), config)
+}
+
+func handshakeWithClientPlain(d *Decoder, e *Encoder, config *Config) (*Result, error) {
 	// Send S0
 	s0 := S0C0(RTMPVersion)
 	if err := e.EncodeS0C0(&s0); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Send S1
@@ -64,20 +117,18 @@ func HandshakeWithClient(r io.Reader, w io.Writer, config *Config) error {
 	}
 	copy(s1.Version[:], Version[:])
 	if _, err := rand.Read(s1.Random[:]); err != nil { // Random Seq
-		return err
+		return nil, err
 	}
 	if err := e.EncodeS1C1(&s1); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Recv C1
 	var c1 S1C1
 	if err := d.DecodeS1C1(&c1); err != nil {
-		return err
+		return nil, err
 	}
 
-	// TODO: check c1 Client version. e.g. [9 0 124 2]
-
 	// Send S2
 	s2 := S2C2{
 		Time:  c1.Time,
@@ -85,35 +136,70 @@ func HandshakeWithClient(r io.Reader, w io.Writer, config *Config) error {
 	}
 	copy(s2.Random[:], c1.Random[:]) // echo c1 random
 	if err := e.EncodeS2C2(&s2); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Recv C2
 	var c2 S2C2
 	if err := d.DecodeS2C2(&c2); err != nil {
-		return err
+		return nil, err
+	}
+
+	result := &Result{
+		Version:     s0,
+		PeerVersion: c1.Version,
 	}
 
 	if config.SkipHandshakeVerification {
-		return nil
+		return result, nil
 	}
 
 	// Check random echo
 	if !bytes.Equal(c2.Random[:], s1.Random[:]) {
-		return errors.New("Random echo is not matched")
+		return nil, errors.New("Random echo is not matched")
 	}
 
-	return nil
+	return result, nil
 }
 
+// HandshakeWithServer does a handshake with a server. config.Version must not be an encrypted one.
+// Use NegotiateWithServer to establish encrypted connections.
 func HandshakeWithServer(r io.Reader, w io.Writer, config *Config) error {
-	d := NewDecoder(r)
-	e := NewEncoder(w)
+	if config.Version.IsEncrypted() {
+		return errors.New("Encrypted handshakes must be done by NegotiateWithServer")
+	}
+
+	_, err := NegotiateWithServer(r, w, config)
+	return err
+}
+
+// NegotiateWithServer does a handshake with a server and returns negotiated parameters.
+// If Result.Cipher is not nil, subsequent data must be read and written through it.
+func NegotiateWithServer(r io.Reader, w io.Writer, config *Config) (*Result, error) {
+	version := config.Version
+	if version == 0 {
+		version = S0C0(RTMPVersion)
+	}
+
+	if version.IsEncrypted() {
+		if err := config.SignatureKeys.validate(version); err != nil {
+			return nil, err
+		}
+		return handshakeWithServerEncrypted(r, w, version, config)
+	}
+
+	if version != VersionPlain {
+		return nil, errors.Errorf("Unsupported RTMP version: Version = %d", version)
+	}
+
+	return handshakeWithServerPlain(NewDecoder(r), NewEncoder(w), config)
+}
 
+func handshakeWithServerPlain(d *Decoder, e *Encoder, config *Config) (*Result, error) {
 	// Send C0
 	c0 := S0C0(RTMPVersion)
 	if err := e.EncodeS0C0(&c0); err != nil {
-		return errors.Wrap(err, "Failed to encode c0")
+		return nil, errors.Wrap(err, "Failed to encode c0")
 	}
 
 	// Send C1
@@ -122,32 +208,32 @@ func HandshakeWithServer(r io.Reader, w io.Writer, config *Config) error {
 	}
 	copy(c1.Version[:], Version[:])
 	if _, err := rand.Read(c1.Random[:]); err != nil { // Random Seq
-		return err
+		return nil, err
 	}
 	if err := e.EncodeS1C1(&c1); err != nil {
-		return errors.Wrap(err, "Failed to encode c1")
+		return nil, errors.Wrap(err, "Failed to encode c1")
 	}
 
 	// Recv S0
 	var s0 S0C0
 	if err := d.DecodeS0C0(&s0); err != nil {
-		return errors.Wrap(err, "Failed to decode s0")
+		return nil, errors.Wrap(err, "Failed to decode s0")
 	}
 
-	// TODO: check s0 RTMP version
+	if s0 != c0 {
+		return nil, errors.Errorf("Unexpected RTMP version: Expected = %d, Actual = %d", c0, s0)
+	}
 
 	// Recv S1
 	var s1 S1C1
 	if err := d.DecodeS1C1(&s1); err != nil {
-		return errors.Wrap(err, "Failed to decode s1")
+		return nil, errors.Wrap(err, "Failed to decode s1")
 	}
 
-	// TODO: check s1 Server version. e.g. [9 0 124 2]
-
 	// Recv S2
 	var s2 S2C2
 	if err := d.DecodeS2C2(&s2); err != nil {
-		return errors.Wrap(err, "Failed to decode s2")
+		return nil, errors.Wrap(err, "Failed to decode s2")
 	}
 
 	// Send C2
@@ -157,17 +243,22 @@ func HandshakeWithServer(r io.Reader, w io.Writer, config *Config) error {
 	}
 	copy(c2.Random[:], s1.Random[:]) // echo s1 random
 	if err := e.EncodeS2C2(&c2); err != nil {
-		return errors.Wrap(err, "Failed to encode c2")
+		return nil, errors.Wrap(err, "Failed to encode c2")
+	}
+
+	result := &Result{
+		Version:     s0,
+		PeerVersion: s1.Version,
 	}
 
 	if config.SkipHandshakeVerification {
-		return nil
+		return result, nil
 	}
 
 	// Check random echo
 	if !bytes.Equal(s2.Random[:], c1.Random[:]) {
-		return errors.New("Random echo is not matched")
+		return nil, errors.New("Random echo is not matched")
 	}
 
-	return nil
+	return result, nil
 }
@@ -0,0 +1,199 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package handshake
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	keys := &SignatureKeys{
+		XTEA:     make([][4]uint32, signatureKeyCount),
+		Blowfish: make([][24]byte, signatureKeyCount),
+	}
+	for i := 0; i < signatureKeyCount; i++ {
+		for j := range keys.XTEA[i] {
+			keys.XTEA[i][j] = uint32(i + j)
+		}
+		for j := range keys.Blowfish[i] {
+			keys.Blowfish[i][j] = byte(i * j)
+		}
+	}
+
+	for _, version := range []S0C0{VersionPlain, VersionRTMPE, VersionRTMPEXTEA, VersionRTMPEBlowfish} {
+		version := version
+		t.Run(string(rune('0'+version)), func(t *testing.T) {
+			serverConn, clientConn := connPair(t)
+			defer serverConn.Close()
+			defer clientConn.Close()
+
+			type negotiated struct {
+				result *Result
+				err    error
+			}
+			serverCh := make(chan negotiated, 1)
+			go func() {
+				result, err := NegotiateWithClient(serverConn, serverConn, &Config{
+					AllowEncryption: true,
+					SignatureKeys:   keys,
+				})
+				serverCh <- negotiated{result: result, err: err}
+			}()
+
+			clientResult, err := NegotiateWithServer(clientConn, clientConn, &Config{
+				Version:       version,
+				SignatureKeys: keys,
+			})
+			require.Nil(t, err)
+
+			server := <-serverCh
+			require.Nil(t, server.err)
+
+			require.Equal(t, version, clientResult.Version)
+			require.Equal(t, version, server.result.Version)
+
+			if !version.IsEncrypted() {
+				require.Nil(t, clientResult.Cipher)
+				require.Nil(t, server.result.Cipher)
+				return
+			}
+
+			require.Equal(t, DigestServerVersion, clientResult.PeerVersion)
+			require.Equal(t, DigestClientVersion, server.result.PeerVersion)
+
+			// Both directions can communicate through ciphers
+			msg := []byte("encrypted payload")
+			go func() {
+				_, _ = clientResult.Cipher.NewWriter(clientConn).Write(msg)
+			}()
+			buf := make([]byte, len(msg))
+			_, err = io.ReadFull(server.result.Cipher.NewReader(serverConn), buf)
+			require.Nil(t, err)
+			require.Equal(t, msg, buf)
+
+			go func() {
+				_, _ = server.result.Cipher.NewWriter(serverConn).Write(msg)
+			}()
+			_, err = io.ReadFull(clientResult.Cipher.NewReader(clientConn), buf)
+			require.Nil(t, err)
+			require.Equal(t, msg, buf)
+		})
+	}
+}
+
+func TestNegotiateFallbackToPlain(t *testing.T) {
+	serverConn, clientConn := connPair(t)
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	go func() {
+		// Encryption is not allowed
+		_, _ = NegotiateWithClient(serverConn, serverConn, &Config{})
+	}()
+
+	_, err := NegotiateWithServer(clientConn, clientConn, &Config{
+		Version: VersionRTMPE,
+	})
+	require.EqualError(t, err, "Unexpected RTMP version: Expected = 6, Actual = 3")
+}
+
+func TestNegotiateSignedWithoutKeysFallbackToPlain(t *testing.T) {
+	serverConn, clientConn := connPair(t)
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	go func() {
+		// Signature keys are not supplied
+		_, _ = NegotiateWithClient(serverConn, serverConn, &Config{AllowEncryption: true})
+	}()
+
+	_, err := NegotiateWithServer(clientConn, clientConn, &Config{
+		Version:       VersionRTMPEXTEA,
+		SignatureKeys: &SignatureKeys{XTEA: make([][4]uint32, signatureKeyCount)},
+	})
+	require.EqualError(t, err, "Unexpected RTMP version: Expected = 8, Actual = 3")
+}
+
+func TestSignSignature(t *testing.T) {
+	// Reference vectors of XTEA and Blowfish. librtmp loads blocks as little-endian words, so the bytes of each word
+	// are reversed from the vectors.
+	xteaPlain := []byte{0x44, 0x43, 0x42, 0x41, 0x48, 0x47, 0x46, 0x45}  // 41424344 45464748
+	xteaCipher := []byte{0xd0, 0xf3, 0x7d, 0x49, 0xb5, 0x2c, 0x61, 0x72} // 497df3d0 72612cb5
+	bfPlain := make([]byte, 8)
+	bfCipher := []byte{0x45, 0x97, 0xf9, 0x4e, 0x78, 0xdd, 0x98, 0x61} // 4ef99745 6198dd78
+
+	keys := &SignatureKeys{
+		XTEA:     make([][4]uint32, signatureKeyCount),
+		Blowfish: make([][24]byte, signatureKeyCount),
+	}
+	for i := range keys.Blowfish {
+		keys.Blowfish[i][0] = 0xff
+	}
+	// Only the key at 5 is of the vectors
+	keys.XTEA[5] = [4]uint32{0x00010203, 0x04050607, 0x08090a0b, 0x0c0d0e0f}
+	keys.Blowfish[5] = [24]byte{}
+
+	// A key of each block is chosen by a byte of the digest key at the offset of the block
+	digestKey := make([]byte, digestSize)
+	digestKey[8] = 20  // 20 % 15 = 5
+	digestKey[24] = 35 // 35 % 15 = 5
+
+	for _, tc := range []struct {
+		version S0C0
+		plain   []byte
+		cipher  []byte
+	}{
+		{version: VersionRTMPEXTEA, plain: xteaPlain, cipher: xteaCipher},
+		{version: VersionRTMPEBlowfish, plain: bfPlain, cipher: bfCipher},
+	} {
+		signature := make([]byte, 0, digestSize)
+		for i := 0; i < digestSize/8; i++ {
+			signature = append(signature, tc.plain...)
+		}
+
+		err := keys.signSignature(tc.version, signature, digestKey)
+		require.Nil(t, err)
+
+		require.NotEqual(t, tc.cipher, signature[0:8])
+		require.Equal(t, tc.cipher, signature[8:16])
+		require.NotEqual(t, tc.cipher, signature[16:24])
+		require.Equal(t, tc.cipher, signature[24:32])
+	}
+}
+
+func TestNegotiateRequiresSignatureKeys(t *testing.T) {
+	_, err := NegotiateWithServer(nil, nil, &Config{
+		Version: VersionRTMPEXTEA,
+	})
+	require.EqualError(t, err, "Signature keys are required: Version = 8")
+}
+
+// connPair Makes a connected pair over TCP. net.Pipe cannot be used because peers write simultaneously.
+func connPair(t *testing.T) (net.Conn, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	require.Nil(t, err)
+	defer l.Close()
+
+	acceptedCh := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		acceptedCh <- conn
+	}()
+
+	clientConn, err := net.Dial("tcp", l.Addr().String())
+	require.Nil(t, err)
+
+	serverConn := <-acceptedCh
+	require.NotNil(t, serverConn)
+
+	return serverConn, clientConn
+}
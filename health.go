@@ -0,0 +1,649 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	flvtag "github.com/yutopp/go-flv/tag"
+)
+
+// HealthEventType Kinds of problems of published streams which are detected by HealthAnalyzer.
+type HealthEventType int
+
+const (
+	// HealthEventLowBitrate A bitrate of a track is lower than MinVideoBitrate or MinAudioBitrate.
+	HealthEventLowBitrate HealthEventType = iota + 1
+	// HealthEventLowFrameRate A frame rate of video is lower than MinFrameRate.
+	HealthEventLowFrameRate
+	// HealthEventKeyFrameInterval No key frames are received for longer than MaxKeyFrameInterval.
+	HealthEventKeyFrameInterval
+	// HealthEventTimestampGap An interval of timestamps of a track is longer than MaxTimestampGap.
+	HealthEventTimestampGap
+	// HealthEventNonMonotonicTimestamp A timestamp of a track goes backward.
+	HealthEventNonMonotonicTimestamp
+	// HealthEventTimestampJump A timestamp of a track moves forward or backward more than MaxTimestampJump.
+	HealthEventTimestampJump
+	// HealthEventAVDrift Timestamps of audio and video differ more than MaxAVDrift.
+	HealthEventAVDrift
+)
+
+func (t HealthEventType) String() string {
+	switch t {
+	case HealthEventLowBitrate:
+		return "LowBitrate"
+	case HealthEventLowFrameRate:
+		return "LowFrameRate"
+	case HealthEventKeyFrameInterval:
+		return "KeyFrameInterval"
+	case HealthEventTimestampGap:
+		return "TimestampGap"
+	case HealthEventNonMonotonicTimestamp:
+		return "NonMonotonicTimestamp"
+	case HealthEventTimestampJump:
+		return "TimestampJump"
+	case HealthEventAVDrift:
+		return "AVDrift"
+	default:
+		return fmt.Sprintf("HealthEventType(%d)", int(t))
+	}
+}
+
+// HealthTrack A track which a HealthEvent is about.
+type HealthTrack int
+
+const (
+	HealthTrackNone HealthTrack = iota // Events about both tracks. e.g. HealthEventAVDrift
+	HealthTrackAudio
+	HealthTrackVideo
+)
+
+func (t HealthTrack) String() string {
+	switch t {
+	case HealthTrackAudio:
+		return "audio"
+	case HealthTrackVideo:
+		return "video"
+	default:
+		return "none"
+	}
+}
+
+// HealthEvent An event raised by HealthAnalyzer when a threshold is crossed.
+//
+// HealthEventLowBitrate, HealthEventLowFrameRate, HealthEventKeyFrameInterval and HealthEventAVDrift are conditions.
+// They are raised once when they start, and raised again with Recovered when they are resolved.
+// Other events are raised for each message which has the problem.
+type HealthEvent struct {
+	Type      HealthEventType
+	Track     HealthTrack
+	Timestamp uint32 // A timestamp of the message which raised the event
+	Recovered bool
+
+	// Value and Threshold are in kbps for bitrates, fps for frame rates and milliseconds for others.
+	Value     float64
+	Threshold float64
+}
+
+func (e *HealthEvent) String() string {
+	state := "raised"
+	if e.Recovered {
+		state = "recovered"
+	}
+	return fmt.Sprintf("%s(%s) %s: Value = %.2f, Threshold = %.2f, Timestamp = %d",
+		e.Type, e.Track, state, e.Value, e.Threshold, e.Timestamp,
+	)
+}
+
+// HealthConfig Thresholds of HealthAnalyzer. Durations are compared with timestamps of messages, and with the wall
+// clock by HealthAnalyzer.Check.
+type HealthConfig struct {
+	// Window Bitrates and frame rates are computed from messages in the last Window. Default: 5s.
+	// Thresholds of them are checked after a track is received for Window.
+	Window time.Duration
+
+	// MinVideoBitrate and MinAudioBitrate are in kbps. 0 disables checks.
+	MinVideoBitrate float64
+	MinAudioBitrate float64
+	// MinFrameRate is in fps. 0 disables checks.
+	MinFrameRate float64
+
+	// MaxKeyFrameInterval Default: 10s. Negative values disable checks.
+	MaxKeyFrameInterval time.Duration
+	// MaxTimestampGap Default: 1s. Negative values disable checks.
+	MaxTimestampGap time.Duration
+	// MaxTimestampJump Default: 10s. Negative values disable checks.
+	MaxTimestampJump time.Duration
+	// MaxAVDrift Default: 1s. Negative values disable checks.
+	MaxAVDrift time.Duration
+
+	// OnEvent is called when a threshold is crossed. It is called from the goroutine which reads the connection,
+	// so it must not block. Snapshot can be called in it.
+	OnEvent func(e *HealthEvent)
+}
+
+func (cb *HealthConfig) normalize() *HealthConfig {
+	c := HealthConfig(*cb)
+
+	if c.Window == 0 {
+		c.Window = 5 * time.Second
+	}
+
+	if c.MaxKeyFrameInterval == 0 {
+		c.MaxKeyFrameInterval = 10 * time.Second
+	}
+
+	if c.MaxTimestampGap == 0 {
+		c.MaxTimestampGap = 1 * time.Second
+	}
+
+	if c.MaxTimestampJump == 0 {
+		c.MaxTimestampJump = 10 * time.Second
+	}
+
+	if c.MaxAVDrift == 0 {
+		c.MaxAVDrift = 1 * time.Second
+	}
+
+	return &c
+}
+
+// HealthSnapshot A snapshot of HealthAnalyzer. See HealthAnalyzer.Snapshot.
+type HealthSnapshot struct {
+	Video HealthTrackSnapshot
+	Audio HealthTrackSnapshot
+
+	// KeyFrameInterval is an interval of the last two key frames by timestamps. Zero if less than two are received.
+	KeyFrameInterval time.Duration
+	// SinceLastKeyFrame is a wall-clock duration since the last key frame is received. Zero if none are received.
+	SinceLastKeyFrame time.Duration
+
+	// AVDrift is the last timestamp of video minus the last timestamp of audio.
+	AVDrift time.Duration
+
+	// Counts of timestamp problems of both tracks.
+	TimestampGaps          int
+	NonMonotonicTimestamps int
+	TimestampJumps         int
+
+	// Values which are declared by onMetaData (videodatarate, audiodatarate and framerate). Zero if not declared.
+	DeclaredVideoBitrate float64
+	DeclaredAudioBitrate float64
+	DeclaredFrameRate    float64
+
+	// Alerts are events of conditions which are raised and not recovered yet.
+	Alerts []HealthEvent
+}
+
+// HealthTrackSnapshot Statistics of a track. Sequence headers are not counted.
+type HealthTrackSnapshot struct {
+	Frames uint64
+	Bytes  uint64
+
+	// Bitrate (kbps) and FrameRate (fps) are computed from messages in the last Window.
+	Bitrate   float64
+	FrameRate float64
+
+	LastTimestamp  uint32
+	LastReceivedAt time.Time // Zero if none are received
+}
+
+// HealthAnalyzer Analyzes media of a published stream to detect problems of publishers.
+// Attach it to a stream by StreamContext.AttachHealthAnalyzer, or pass media to WriteAudio, WriteVideo and
+// WriteMetaData directly. Call Check periodically to detect publishers which stop sending media.
+// Methods are goroutine-safe.
+type HealthAnalyzer struct {
+	config *HealthConfig
+
+	video healthTrackState
+	audio healthTrackState
+
+	hasKeyFrame      bool
+	lastKeyFrame     uint32
+	lastKeyFrameAt   time.Time
+	keyFrameInterval uint32
+
+	gaps         int
+	nonMonotonic int
+	jumps        int
+
+	declaredVideoBitrate float64
+	declaredAudioBitrate float64
+	declaredFrameRate    float64
+
+	alerts map[healthCondition]*HealthEvent
+
+	now func() time.Time
+	m   sync.Mutex
+}
+
+type healthCondition struct {
+	ty    HealthEventType
+	track HealthTrack
+}
+
+type healthTrackState struct {
+	track   HealthTrack
+	samples []healthSample // Messages in the window
+
+	isStarted bool
+	since     uint32    // A timestamp from which the window is filled
+	startedAt time.Time // A time when since is received
+	last      uint32
+	lastAt    time.Time
+
+	frames uint64
+	bytes  uint64
+}
+
+type healthSample struct {
+	timestamp uint32
+	size      int
+}
+
+func NewHealthAnalyzer(config *HealthConfig) *HealthAnalyzer {
+	if config == nil {
+		config = &HealthConfig{}
+	}
+
+	return &HealthAnalyzer{
+		config: config.normalize(),
+		video:  healthTrackState{track: HealthTrackVideo},
+		audio:  healthTrackState{track: HealthTrackAudio},
+		alerts: make(map[healthCondition]*HealthEvent),
+		now:    time.Now,
+	}
+}
+
+// WriteAudio analyzes a payload of an audio message. Payloads which cannot be decoded are ignored.
+func (a *HealthAnalyzer) WriteAudio(timestamp uint32, payload []byte) {
+	a.writeAudio(timestamp, &audioPayload{data: payload})
+}
+
+func (a *HealthAnalyzer) writeAudio(timestamp uint32, p *audioPayload) {
+	first, err := p.firstFrame()
+	if err != nil || first.IsSequenceHeader() {
+		return
+	}
+
+	a.m.Lock()
+	var events []*HealthEvent
+	a.writeMedia(&a.audio, timestamp, len(p.data), &events)
+	a.checkAVDrift(timestamp, &events)
+	a.m.Unlock()
+
+	a.raise(events)
+}
+
+// WriteVideo analyzes a payload of a video message. Payloads which cannot be decoded are ignored.
+func (a *HealthAnalyzer) WriteVideo(timestamp uint32, payload []byte) {
+	a.writeVideo(timestamp, &videoPayload{data: payload})
+}
+
+func (a *HealthAnalyzer) writeVideo(timestamp uint32, p *videoPayload) {
+	first, err := p.firstFrame()
+	if err != nil || first.IsSequenceHeader() {
+		return
+	}
+	isKeyFrame := first.IsKeyFrame()
+
+	a.m.Lock()
+	var events []*HealthEvent
+	a.writeMedia(&a.video, timestamp, len(p.data), &events)
+	a.checkKeyFrame(timestamp, isKeyFrame, &events)
+	a.checkAVDrift(timestamp, &events)
+	a.m.Unlock()
+
+	a.raise(events)
+}
+
+// WriteMetaData reads declared bitrates and a frame rate from a payload of @setDataFrame.
+func (a *HealthAnalyzer) WriteMetaData(timestamp uint32, payload []byte) {
+	var script flvtag.ScriptData
+	if err := flvtag.DecodeScriptData(bytes.NewReader(payload), &script); err != nil {
+		return
+	}
+	metaData, ok := script.Objects["onMetaData"]
+	if !ok {
+		return
+	}
+
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if v, ok := metaData["videodatarate"].(float64); ok {
+		a.declaredVideoBitrate = v
+	}
+	if v, ok := metaData["audiodatarate"].(float64); ok {
+		a.declaredAudioBitrate = v
+	}
+	if v, ok := metaData["framerate"].(float64); ok {
+		a.declaredFrameRate = v
+	}
+}
+
+// Check raises conditions by the wall clock at now. Otherwise they are checked only when messages are received, so
+// a publisher which stops sending media is not detected.
+// HealthEventKeyFrameInterval is raised if no key frames are received for MaxKeyFrameInterval, and
+// HealthEventLowBitrate and HealthEventLowFrameRate are raised if no messages of a track are received for Window.
+// They are recovered by messages.
+func (a *HealthAnalyzer) Check(now time.Time) {
+	a.m.Lock()
+	var events []*HealthEvent
+
+	if max := a.config.MaxKeyFrameInterval; max >= 0 && a.video.isStarted {
+		since := a.video.startedAt
+		if a.hasKeyFrame && a.lastKeyFrameAt.After(since) {
+			since = a.lastKeyFrameAt
+		}
+		if elapsed := now.Sub(since); elapsed > max {
+			a.setCondition(HealthEventKeyFrameInterval, HealthTrackVideo, true,
+				a.video.last, float64(durationToTimestamp(elapsed)), float64(durationToTimestamp(max)), &events,
+			)
+		}
+	}
+
+	for _, t := range []*healthTrackState{&a.video, &a.audio} {
+		if !t.isStarted || now.Sub(t.lastAt) <= a.config.Window {
+			continue
+		}
+
+		minBitrate := a.config.MinAudioBitrate
+		if t.track == HealthTrackVideo {
+			minBitrate = a.config.MinVideoBitrate
+		}
+		if minBitrate > 0 {
+			a.setCondition(HealthEventLowBitrate, t.track, true, t.last, 0, minBitrate, &events)
+		}
+		if t.track == HealthTrackVideo && a.config.MinFrameRate > 0 {
+			a.setCondition(HealthEventLowFrameRate, t.track, true, t.last, 0, a.config.MinFrameRate, &events)
+		}
+	}
+
+	a.m.Unlock()
+
+	a.raise(events)
+}
+
+// Snapshot returns current statistics and alerts.
+func (a *HealthAnalyzer) Snapshot() *HealthSnapshot {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	s := &HealthSnapshot{
+		Video:                  a.video.snapshot(),
+		Audio:                  a.audio.snapshot(),
+		KeyFrameInterval:       time.Duration(a.keyFrameInterval) * time.Millisecond,
+		TimestampGaps:          a.gaps,
+		NonMonotonicTimestamps: a.nonMonotonic,
+		TimestampJumps:         a.jumps,
+		DeclaredVideoBitrate:   a.declaredVideoBitrate,
+		DeclaredAudioBitrate:   a.declaredAudioBitrate,
+		DeclaredFrameRate:      a.declaredFrameRate,
+	}
+	if a.hasKeyFrame {
+		s.SinceLastKeyFrame = a.now().Sub(a.lastKeyFrameAt)
+	}
+	if a.video.isStarted && a.audio.isStarted {
+		s.AVDrift = time.Duration(int32(a.video.last-a.audio.last)) * time.Millisecond
+	}
+
+	for _, e := range a.alerts {
+		s.Alerts = append(s.Alerts, *e)
+	}
+	sort.Slice(s.Alerts, func(i, j int) bool {
+		if s.Alerts[i].Type != s.Alerts[j].Type {
+			return s.Alerts[i].Type < s.Alerts[j].Type
+		}
+		return s.Alerts[i].Track < s.Alerts[j].Track
+	})
+
+	return s
+}
+
+func (a *HealthAnalyzer) writeMedia(t *healthTrackState, timestamp uint32, size int, events *[]*HealthEvent) {
+	now := a.now()
+	if t.isStarted {
+		a.checkTimestamp(t, timestamp, now, events)
+	} else {
+		t.reset(timestamp, now)
+	}
+
+	t.add(timestamp, size, a.config.Window, now)
+
+	if t.last-t.since >= durationToTimestamp(a.config.Window) {
+		a.checkRates(t, timestamp, events)
+	}
+}
+
+func (a *HealthAnalyzer) checkTimestamp(t *healthTrackState, timestamp uint32, now time.Time, events *[]*HealthEvent) {
+	delta := int32(timestamp - t.last)
+	distance := int64(delta)
+	if distance < 0 {
+		distance = -distance
+	}
+
+	if jump := a.config.MaxTimestampJump; jump > 0 && distance > int64(durationToTimestamp(jump)) {
+		a.jumps++
+		*events = append(*events, &HealthEvent{
+			Type:      HealthEventTimestampJump,
+			Track:     t.track,
+			Timestamp: timestamp,
+			Value:     float64(delta),
+			Threshold: float64(durationToTimestamp(jump)),
+		})
+		t.reset(timestamp, now) // Rates are measured from the new timestamp
+		return
+	}
+
+	if delta < 0 {
+		a.nonMonotonic++
+		*events = append(*events, &HealthEvent{
+			Type:      HealthEventNonMonotonicTimestamp,
+			Track:     t.track,
+			Timestamp: timestamp,
+			Value:     float64(delta),
+		})
+		t.reset(timestamp, now)
+		return
+	}
+
+	if gap := a.config.MaxTimestampGap; gap > 0 && distance > int64(durationToTimestamp(gap)) {
+		a.gaps++
+		*events = append(*events, &HealthEvent{
+			Type:      HealthEventTimestampGap,
+			Track:     t.track,
+			Timestamp: timestamp,
+			Value:     float64(delta),
+			Threshold: float64(durationToTimestamp(gap)),
+		})
+	}
+}
+
+func (a *HealthAnalyzer) checkRates(t *healthTrackState, timestamp uint32, events *[]*HealthEvent) {
+	minBitrate := a.config.MinAudioBitrate
+	if t.track == HealthTrackVideo {
+		minBitrate = a.config.MinVideoBitrate
+	}
+	if minBitrate > 0 {
+		bitrate := t.bitrate()
+		a.setCondition(HealthEventLowBitrate, t.track, bitrate < minBitrate, timestamp, bitrate, minBitrate, events)
+	}
+
+	if t.track == HealthTrackVideo && a.config.MinFrameRate > 0 {
+		frameRate := t.frameRate()
+		a.setCondition(HealthEventLowFrameRate, t.track, frameRate < a.config.MinFrameRate,
+			timestamp, frameRate, a.config.MinFrameRate, events,
+		)
+	}
+}
+
+func (a *HealthAnalyzer) checkKeyFrame(timestamp uint32, isKeyFrame bool, events *[]*HealthEvent) {
+	if isKeyFrame {
+		if a.hasKeyFrame && int32(timestamp-a.lastKeyFrame) >= 0 {
+			a.keyFrameInterval = timestamp - a.lastKeyFrame
+		}
+		a.hasKeyFrame = true
+		a.lastKeyFrame = timestamp
+		a.lastKeyFrameAt = a.now()
+	}
+
+	max := a.config.MaxKeyFrameInterval
+	if max < 0 {
+		return
+	}
+
+	// Frames before the first key frame or after timestamps are reset are measured from the first frame
+	since := a.video.since
+	if a.hasKeyFrame && int32(a.lastKeyFrame-since) > 0 {
+		since = a.lastKeyFrame
+	}
+	elapsed := int32(timestamp - since)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	threshold := durationToTimestamp(max)
+	a.setCondition(HealthEventKeyFrameInterval, HealthTrackVideo, uint32(elapsed) > threshold,
+		timestamp, float64(elapsed), float64(threshold), events,
+	)
+}
+
+func (a *HealthAnalyzer) checkAVDrift(timestamp uint32, events *[]*HealthEvent) {
+	max := a.config.MaxAVDrift
+	if max < 0 || !a.video.isStarted || !a.audio.isStarted {
+		return
+	}
+
+	drift := int64(int32(a.video.last - a.audio.last))
+	distance := drift
+	if distance < 0 {
+		distance = -distance
+	}
+
+	threshold := durationToTimestamp(max)
+	a.setCondition(HealthEventAVDrift, HealthTrackNone, distance > int64(threshold),
+		timestamp, float64(drift), float64(threshold), events,
+	)
+}
+
+// setCondition Raises an event when a condition starts or is recovered.
+func (a *HealthAnalyzer) setCondition(
+	ty HealthEventType,
+	track HealthTrack,
+	isRaised bool,
+	timestamp uint32,
+	value, threshold float64,
+	events *[]*HealthEvent,
+) {
+	key := healthCondition{ty: ty, track: track}
+	_, wasRaised := a.alerts[key]
+	if isRaised == wasRaised {
+		return
+	}
+
+	e := &HealthEvent{
+		Type:      ty,
+		Track:     track,
+		Timestamp: timestamp,
+		Recovered: !isRaised,
+		Value:     value,
+		Threshold: threshold,
+	}
+	if isRaised {
+		a.alerts[key] = e
+	} else {
+		delete(a.alerts, key)
+	}
+
+	*events = append(*events, e)
+}
+
+func (a *HealthAnalyzer) raise(events []*HealthEvent) {
+	if a.config.OnEvent == nil {
+		return
+	}
+	for _, e := range events {
+		a.config.OnEvent(e)
+	}
+}
+
+// reset Starts the window from timestamp which is received at now.
+func (t *healthTrackState) reset(timestamp uint32, now time.Time) {
+	t.isStarted = true
+	t.since = timestamp
+	t.startedAt = now
+	t.samples = t.samples[:0]
+}
+
+func (t *healthTrackState) add(timestamp uint32, size int, window time.Duration, now time.Time) {
+	t.last = timestamp
+	t.lastAt = now
+	t.frames++
+	t.bytes += uint64(size)
+
+	t.samples = append(t.samples, healthSample{timestamp: timestamp, size: size})
+
+	// Drops samples which are out of the window
+	begin := 0
+	for begin < len(t.samples)-1 && timestamp-t.samples[begin].timestamp > durationToTimestamp(window) {
+		begin++
+	}
+	if begin > 0 {
+		t.samples = append(t.samples[:0], t.samples[begin:]...)
+	}
+}
+
+// span Milliseconds between the first and the last samples in the window.
+func (t *healthTrackState) span() uint32 {
+	if len(t.samples) < 2 {
+		return 0
+	}
+	return t.samples[len(t.samples)-1].timestamp - t.samples[0].timestamp
+}
+
+// bitrate Kbps in the window. The first sample is excluded because it is sent at the beginning of the span.
+func (t *healthTrackState) bitrate() float64 {
+	span := t.span()
+	if span == 0 {
+		return 0
+	}
+
+	var size int
+	for _, s := range t.samples[1:] {
+		size += s.size
+	}
+	return float64(size*8) / float64(span)
+}
+
+func (t *healthTrackState) frameRate() float64 {
+	span := t.span()
+	if span == 0 {
+		return 0
+	}
+	return float64(len(t.samples)-1) * 1000 / float64(span)
+}
+
+func (t *healthTrackState) snapshot() HealthTrackSnapshot {
+	return HealthTrackSnapshot{
+		Frames:         t.frames,
+		Bytes:          t.bytes,
+		Bitrate:        t.bitrate(),
+		FrameRate:      t.frameRate(),
+		LastTimestamp:  t.last,
+		LastReceivedAt: t.lastAt,
+	}
+}
+
+func durationToTimestamp(d time.Duration) uint32 {
+	return uint32(d / time.Millisecond)
+}
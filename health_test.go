@@ -0,0 +1,191 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yutopp/go-amf0"
+	flvtag "github.com/yutopp/go-flv/tag"
+)
+
+func newTestHealthAnalyzer(config *HealthConfig) (*HealthAnalyzer, *[]HealthEvent) {
+	var events []HealthEvent
+	config.OnEvent = func(e *HealthEvent) {
+		events = append(events, *e)
+	}
+	return NewHealthAnalyzer(config), &events
+}
+
+func TestHealthAnalyzerRates(t *testing.T) {
+	a, events := newTestHealthAnalyzer(&HealthConfig{
+		Window:          1 * time.Second,
+		MinVideoBitrate: 0.05,
+		MinFrameRate:    5,
+		MaxAVDrift:      -1, // Only video is written below
+	})
+
+	a.WriteVideo(0, recordAVCSeqHeader) // Not counted
+	for ts := uint32(0); ts <= 2000; ts += 100 {
+		video := recordAVCInter
+		if ts%1000 == 0 {
+			video = recordAVCKeyFrame
+		}
+		a.WriteVideo(ts, video)
+		a.WriteAudio(ts, recordAACRaw)
+	}
+	require.Empty(t, *events)
+
+	s := a.Snapshot()
+	require.Equal(t, uint64(21), s.Video.Frames)
+	require.Equal(t, uint64(21*len(recordAACRaw)), s.Audio.Bytes)
+	require.InDelta(t, 10, s.Video.FrameRate, 0.01)
+	require.InDelta(t, float64(len(recordAVCInter)*8)/100, s.Video.Bitrate, 0.01)
+	require.InDelta(t, float64(len(recordAACRaw)*8)/100, s.Audio.Bitrate, 0.01)
+	require.Equal(t, 1*time.Second, s.KeyFrameInterval)
+	require.Equal(t, time.Duration(0), s.AVDrift)
+	require.Empty(t, s.Alerts)
+
+	// Frame rate drops to 2 fps
+	for ts := uint32(2500); ts <= 3000; ts += 500 {
+		a.WriteVideo(ts, recordAVCInter)
+	}
+	require.Equal(t, []HealthEvent{
+		{Type: HealthEventLowFrameRate, Track: HealthTrackVideo, Timestamp: 3000, Value: 2, Threshold: 5},
+	}, *events)
+	require.Len(t, a.Snapshot().Alerts, 1)
+
+	*events = nil
+	for ts := uint32(3100); ts <= 4000; ts += 100 {
+		a.WriteVideo(ts, recordAVCInter)
+	}
+	require.Len(t, *events, 1)
+	require.Equal(t, HealthEventLowFrameRate, (*events)[0].Type)
+	require.True(t, (*events)[0].Recovered)
+	require.Empty(t, a.Snapshot().Alerts)
+}
+
+func TestHealthAnalyzerTimestamps(t *testing.T) {
+	a, events := newTestHealthAnalyzer(&HealthConfig{
+		MaxTimestampGap:  500 * time.Millisecond,
+		MaxTimestampJump: 5 * time.Second,
+	})
+
+	for _, ts := range []uint32{0, 100, 900, 850, 10000} {
+		a.WriteAudio(ts, recordAACRaw)
+	}
+
+	require.Equal(t, []HealthEvent{
+		{Type: HealthEventTimestampGap, Track: HealthTrackAudio, Timestamp: 900, Value: 800, Threshold: 500},
+		{Type: HealthEventNonMonotonicTimestamp, Track: HealthTrackAudio, Timestamp: 850, Value: -50},
+		{Type: HealthEventTimestampJump, Track: HealthTrackAudio, Timestamp: 10000, Value: 9150, Threshold: 5000},
+	}, *events)
+
+	s := a.Snapshot()
+	require.Equal(t, 1, s.TimestampGaps)
+	require.Equal(t, 1, s.NonMonotonicTimestamps)
+	require.Equal(t, 1, s.TimestampJumps)
+	require.Equal(t, uint32(10000), s.Audio.LastTimestamp)
+}
+
+func TestHealthAnalyzerKeyFramesAndDrift(t *testing.T) {
+	now := time.Unix(1000, 0)
+	a, events := newTestHealthAnalyzer(&HealthConfig{
+		MaxKeyFrameInterval: 2 * time.Second,
+		MaxAVDrift:          500 * time.Millisecond,
+		MaxTimestampGap:     -1,
+	})
+	a.now = func() time.Time { return now }
+
+	require.Equal(t, time.Duration(0), a.Snapshot().SinceLastKeyFrame)
+
+	a.WriteVideo(0, recordAVCKeyFrame)
+	a.WriteAudio(0, recordAACRaw)
+	now = now.Add(3 * time.Second)
+	a.WriteVideo(2500, recordAVCInter) // Video is ahead of audio and no key frames are received
+	require.Equal(t, []HealthEvent{
+		{Type: HealthEventKeyFrameInterval, Track: HealthTrackVideo, Timestamp: 2500, Value: 2500, Threshold: 2000},
+		{Type: HealthEventAVDrift, Track: HealthTrackNone, Timestamp: 2500, Value: 2500, Threshold: 500},
+	}, *events)
+
+	s := a.Snapshot()
+	require.Equal(t, 3*time.Second, s.SinceLastKeyFrame)
+	require.Equal(t, 2500*time.Millisecond, s.AVDrift)
+	require.Equal(t, []HealthEventType{HealthEventKeyFrameInterval, HealthEventAVDrift},
+		[]HealthEventType{s.Alerts[0].Type, s.Alerts[1].Type},
+	)
+
+	*events = nil
+	a.WriteAudio(2400, recordAACRaw)
+	a.WriteVideo(2600, recordAVCKeyFrame)
+	require.Equal(t, []HealthEvent{
+		{Type: HealthEventAVDrift, Track: HealthTrackNone, Timestamp: 2400, Value: 100, Threshold: 500, Recovered: true},
+		{Type: HealthEventKeyFrameInterval, Track: HealthTrackVideo, Timestamp: 2600, Value: 0, Threshold: 2000, Recovered: true},
+	}, *events)
+
+	s = a.Snapshot()
+	require.Equal(t, 2600*time.Millisecond, s.KeyFrameInterval)
+	require.Equal(t, time.Duration(0), s.SinceLastKeyFrame)
+	require.Empty(t, s.Alerts)
+}
+
+func TestHealthAnalyzerCheck(t *testing.T) {
+	now := time.Unix(1000, 0)
+	a, events := newTestHealthAnalyzer(&HealthConfig{
+		Window:              1 * time.Second,
+		MinVideoBitrate:     0.05,
+		MaxKeyFrameInterval: 2 * time.Second,
+	})
+	a.now = func() time.Time { return now }
+
+	a.Check(now.Add(10 * time.Second)) // Nothing is received yet
+	require.Empty(t, *events)
+
+	a.WriteVideo(0, recordAVCKeyFrame)
+	a.Check(now.Add(1 * time.Second))
+	require.Empty(t, *events)
+
+	// The publisher stalls without sending messages
+	a.Check(now.Add(3 * time.Second))
+	require.Equal(t, []HealthEvent{
+		{Type: HealthEventKeyFrameInterval, Track: HealthTrackVideo, Timestamp: 0, Value: 3000, Threshold: 2000},
+		{Type: HealthEventLowBitrate, Track: HealthTrackVideo, Timestamp: 0, Value: 0, Threshold: 0.05},
+	}, *events)
+
+	// Raised only once
+	a.Check(now.Add(4 * time.Second))
+	require.Equal(t, 2, len(*events))
+
+	*events = nil
+	now = now.Add(4 * time.Second)
+	a.WriteVideo(100, recordAVCKeyFrame)
+	require.Equal(t, []HealthEvent{
+		{Type: HealthEventKeyFrameInterval, Track: HealthTrackVideo, Timestamp: 100, Value: 0, Threshold: 2000, Recovered: true},
+	}, *events)
+}
+
+func TestHealthAnalyzerMetaData(t *testing.T) {
+	a := NewHealthAnalyzer(nil)
+
+	buf := new(bytes.Buffer)
+	err := flvtag.EncodeScriptData(buf, &flvtag.ScriptData{
+		Objects: map[string]amf0.ECMAArray{
+			"onMetaData": {"videodatarate": float64(2500), "audiodatarate": float64(128), "framerate": float64(30)},
+		},
+	})
+	require.Nil(t, err)
+	a.WriteMetaData(0, buf.Bytes())
+
+	s := a.Snapshot()
+	require.Equal(t, float64(2500), s.DeclaredVideoBitrate)
+	require.Equal(t, float64(128), s.DeclaredAudioBitrate)
+	require.Equal(t, float64(30), s.DeclaredFrameRate)
+}
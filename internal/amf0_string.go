@@ -0,0 +1,38 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package internal
+
+import (
+	"encoding/binary"
+
+	"github.com/yutopp/go-amf0"
+)
+
+// SplitAMF0String splits an AMF0 string at the head of b from following values. It is used to take a name of data
+// such as "onMetaData" from a body of data messages and FLV script tags. ok is false if b does not start with a string.
+func SplitAMF0String(b []byte) (s string, rest []byte, ok bool) {
+	if len(b) < 3 || amf0.Marker(b[0]) != amf0.MarkerString {
+		return "", nil, false
+	}
+
+	l := int(binary.BigEndian.Uint16(b[1:3]))
+	if len(b) < 3+l {
+		return "", nil, false
+	}
+
+	return string(b[3 : 3+l]), b[3+l:], true
+}
+
+// AppendAMF0String appends s encoded as an AMF0 string to b. s must be shorter than 64KB.
+func AppendAMF0String(b []byte, s string) []byte {
+	var head [3]byte
+	head[0] = byte(amf0.MarkerString)
+	binary.BigEndian.PutUint16(head[1:], uint16(len(s)))
+
+	return append(append(b, head[:]...), s...)
+}
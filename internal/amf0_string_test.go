@@ -0,0 +1,32 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitAMF0String(t *testing.T) {
+	b := AppendAMF0String(nil, "onMetaData")
+	require.Equal(t, append([]byte{0x02, 0x00, 0x0a}, "onMetaData"...), b)
+
+	s, rest, ok := SplitAMF0String(append(b, 0x08))
+	require.True(t, ok)
+	require.Equal(t, "onMetaData", s)
+	require.Equal(t, []byte{0x08}, rest)
+
+	// Not a string
+	_, _, ok = SplitAMF0String([]byte{0x08})
+	require.False(t, ok)
+
+	// Truncated
+	_, _, ok = SplitAMF0String(b[:5])
+	require.False(t, ok)
+}
@@ -0,0 +1,84 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package media
+
+import (
+	"github.com/pkg/errors"
+)
+
+// AAC audio object types
+const (
+	AACObjectTypeMain = 1
+	AACObjectTypeLC   = 2
+	AACObjectTypeSSR  = 3
+	AACObjectTypeLTP  = 4
+	AACObjectTypeSBR  = 5 // HE-AAC
+	AACObjectTypePS   = 29
+)
+
+var aacSampleRates = [13]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// AudioSpecificConfig A sequence header of AAC (ISO/IEC 14496-3 1.6.2.1).
+//
+// For explicitly signaled HE-AAC, ObjectType is SBR or PS and SampleRate is the extension (output) sampling rate.
+type AudioSpecificConfig struct {
+	ObjectType           uint8
+	SampleRate           int
+	ChannelConfiguration uint8
+	Channels             int // 0 if channels are defined in a program config element
+}
+
+// ParseAudioSpecificConfig parses Data of a sequence header of AAC.
+func ParseAudioSpecificConfig(b []byte) (*AudioSpecificConfig, error) {
+	r := newBitReader(b)
+
+	asc := &AudioSpecificConfig{}
+	asc.ObjectType = readAACObjectType(r)
+	asc.SampleRate = readAACSampleRate(r)
+	asc.ChannelConfiguration = uint8(r.readBits(4))
+
+	if asc.ObjectType == AACObjectTypeSBR || asc.ObjectType == AACObjectTypePS {
+		asc.SampleRate = readAACSampleRate(r) // extensionSamplingFrequency
+	}
+
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "Failed to parse AudioSpecificConfig")
+	}
+	if asc.SampleRate == 0 {
+		return nil, errors.New("Invalid sampling frequency index")
+	}
+
+	switch {
+	case asc.ChannelConfiguration >= 1 && asc.ChannelConfiguration <= 6:
+		asc.Channels = int(asc.ChannelConfiguration)
+	case asc.ChannelConfiguration == 7:
+		asc.Channels = 8
+	}
+
+	return asc, nil
+}
+
+func readAACObjectType(r *bitReader) uint8 {
+	ty := r.readBits(5)
+	if ty == 31 {
+		ty = 32 + r.readBits(6)
+	}
+	return uint8(ty)
+}
+
+// readAACSampleRate Returns 0 if the index is invalid.
+func readAACSampleRate(r *bitReader) int {
+	index := r.readBits(4)
+	if index == 0x0f {
+		return int(r.readBits(24))
+	}
+	if int(index) >= len(aacSampleRates) {
+		return 0
+	}
+	return aacSampleRates[index]
+}
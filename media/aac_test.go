@@ -0,0 +1,87 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package media
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type audioSpecificConfigTestCase struct {
+	Name   string
+	Binary []byte
+	Config AudioSpecificConfig
+}
+
+var audioSpecificConfigTestCases = []audioSpecificConfigTestCase{
+	{
+		Name:   "AAC-LC 44.1kHz stereo",
+		Binary: []byte{0x12, 0x10},
+		Config: AudioSpecificConfig{
+			ObjectType:           AACObjectTypeLC,
+			SampleRate:           44100,
+			ChannelConfiguration: 2,
+			Channels:             2,
+		},
+	},
+	{
+		Name:   "AAC-LC 48kHz 7.1",
+		Binary: []byte{0x11, 0xb8},
+		Config: AudioSpecificConfig{
+			ObjectType:           AACObjectTypeLC,
+			SampleRate:           48000,
+			ChannelConfiguration: 7,
+			Channels:             8,
+		},
+	},
+	{
+		Name: "HE-AAC with explicit SBR",
+		// 00101 (SBR) 0110 (24kHz) 0010 (stereo) 0011 (48kHz) 00010 (LC)
+		Binary: []byte{0x2b, 0x11, 0x88, 0x00},
+		Config: AudioSpecificConfig{
+			ObjectType:           AACObjectTypeSBR,
+			SampleRate:           48000,
+			ChannelConfiguration: 2,
+			Channels:             2,
+		},
+	},
+	{
+		Name: "Explicit sampling frequency",
+		// 00010 (LC) 1111 (explicit) 24 bits of 44100 (0x00ac44) 0001 (mono)
+		Binary: []byte{0x17, 0x80, 0x56, 0x22, 0x08},
+		Config: AudioSpecificConfig{
+			ObjectType:           AACObjectTypeLC,
+			SampleRate:           44100,
+			ChannelConfiguration: 1,
+			Channels:             1,
+		},
+	},
+}
+
+func TestParseAudioSpecificConfig(t *testing.T) {
+	for _, tc := range audioSpecificConfigTestCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			asc, err := ParseAudioSpecificConfig(tc.Binary)
+			require.Nil(t, err)
+			require.Equal(t, &tc.Config, asc)
+		})
+	}
+}
+
+func TestParseAudioSpecificConfigError(t *testing.T) {
+	_, err := ParseAudioSpecificConfig([]byte{0x12})
+	require.Error(t, err)
+
+	_, err = ParseAudioSpecificConfig([]byte{0x16, 0x90}) // Sampling frequency index 13 is reserved
+	require.Error(t, err)
+}
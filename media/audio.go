@@ -0,0 +1,131 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package media
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+var soundRates = [4]int{5512, 11025, 22050, 44100}
+
+// AudioFrame An audio frame in a payload of message.AudioMessage.
+//
+// Frames of Enhanced RTMP multitrack packets have IsMultitrack set, and FourCC is a codec of the track.
+type AudioFrame struct {
+	message.AudioHeader
+	TrackID uint8  // 0 if the frame is not multitrack
+	Data    []byte // Data of the codec which follows the header
+}
+
+// IsSequenceHeader returns true if Data is a codec configuration. e.g. AudioSpecificConfig of AAC.
+func (f *AudioFrame) IsSequenceHeader() bool {
+	return f.FourCC != 0 && f.PacketType == message.AudioPacketTypeSequenceStart
+}
+
+// SampleRate returns a sampling rate in Hz written in a legacy header. It returns 0 for Enhanced RTMP headers.
+// NOTE: AAC frames always have 44100, use the sequence header to get an actual rate.
+func (f *AudioFrame) SampleRate() int {
+	if f.IsExHeader {
+		return 0
+	}
+	return soundRates[f.SoundRate&0x03]
+}
+
+// SampleSize returns a size of samples in bits written in a legacy header. It returns 0 for Enhanced RTMP headers.
+func (f *AudioFrame) SampleSize() int {
+	if f.IsExHeader {
+		return 0
+	}
+	if f.SoundSize == 0 {
+		return 8
+	}
+	return 16
+}
+
+// Channels returns the number of channels written in a legacy header. It returns 0 for Enhanced RTMP headers.
+func (f *AudioFrame) Channels() int {
+	if f.IsExHeader {
+		return 0
+	}
+	if f.SoundType == 0 {
+		return 1
+	}
+	return 2
+}
+
+// DecodeAudioFrame parses a payload which is not multitrack.
+func DecodeAudioFrame(r io.Reader, f *AudioFrame) error {
+	*f = AudioFrame{}
+	if err := message.DecodeAudioHeader(r, &f.AudioHeader); err != nil {
+		return errors.Wrap(err, "Failed to decode audio header")
+	}
+	if f.IsMultitrack {
+		return errors.New("Multitrack audio must be decoded by DecodeAudioFrames")
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	f.Data = data
+
+	return nil
+}
+
+// DecodeAudioFrames parses a payload. Multitrack payloads result in a frame per track.
+func DecodeAudioFrames(r io.Reader) ([]AudioFrame, error) {
+	var header message.AudioHeader
+	if err := message.DecodeAudioHeader(r, &header); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode audio header")
+	}
+
+	tracks, err := message.DecodeAudioTracks(r, &header)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to decode audio tracks")
+	}
+
+	return NewAudioFrames(&header, tracks), nil
+}
+
+// NewAudioFrames makes frames of tracks which are decoded by message.DecodeAudioTracks. Data are not copied.
+func NewAudioFrames(header *message.AudioHeader, tracks []message.AudioTrack) []AudioFrame {
+	frames := make([]AudioFrame, len(tracks))
+	for i, track := range tracks {
+		frames[i].AudioHeader = *header
+		frames[i].FourCC = track.FourCC
+		frames[i].TrackID = track.TrackID
+		frames[i].Data = track.Payload
+	}
+
+	return frames
+}
+
+// EncodeAudioFrame writes a header and data of the frame. A frame which has IsMultitrack is written as a packet of a track.
+func EncodeAudioFrame(w io.Writer, f *AudioFrame) error {
+	if f.IsMultitrack {
+		return message.EncodeAudioTracks(w, &f.AudioHeader, []message.AudioTrack{
+			{
+				TrackID: f.TrackID,
+				FourCC:  f.FourCC,
+				Payload: f.Data,
+			},
+		})
+	}
+
+	if err := message.EncodeAudioHeader(w, &f.AudioHeader); err != nil {
+		return err
+	}
+
+	_, err := w.Write(f.Data)
+	return err
+}
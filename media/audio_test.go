@@ -0,0 +1,126 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package media
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type audioFrameTestCase struct {
+	Name             string
+	Binary           []byte
+	Frame            AudioFrame
+	SampleRate       int
+	SampleSize       int
+	Channels         int
+	IsSequenceHeader bool
+}
+
+var audioFrameTestCases = []audioFrameTestCase{
+	{
+		Name:   "Legacy AAC sequence header",
+		Binary: []byte{0xaf, 0x00, 0x12, 0x10},
+		Frame: AudioFrame{
+			AudioHeader: message.AudioHeader{
+				SoundFormat: message.AudioSoundFormatAAC,
+				SoundRate:   3,
+				SoundSize:   1,
+				SoundType:   1,
+				FourCC:      message.FourCCAAC,
+				PacketType:  message.AudioPacketTypeSequenceStart,
+			},
+			Data: []byte{0x12, 0x10},
+		},
+		SampleRate:       44100,
+		SampleSize:       16,
+		Channels:         2,
+		IsSequenceHeader: true,
+	},
+	{
+		Name:   "Legacy MP3 mono",
+		Binary: []byte{0x26, 0xff},
+		Frame: AudioFrame{
+			AudioHeader: message.AudioHeader{
+				SoundFormat: message.AudioSoundFormatMP3,
+				SoundRate:   1,
+				SoundSize:   1,
+				FourCC:      message.FourCCMP3,
+				PacketType:  message.AudioPacketTypeCodedFrames,
+			},
+			Data: []byte{0xff},
+		},
+		SampleRate: 11025,
+		SampleSize: 16,
+		Channels:   1,
+	},
+	{
+		Name:   "Opus coded frames",
+		Binary: []byte{0x91, 'O', 'p', 'u', 's', 0xff},
+		Frame: AudioFrame{
+			AudioHeader: message.AudioHeader{
+				IsExHeader:  true,
+				SoundFormat: message.AudioSoundFormatExHeader,
+				FourCC:      message.FourCCOpus,
+				PacketType:  message.AudioPacketTypeCodedFrames,
+			},
+			Data: []byte{0xff},
+		},
+	},
+}
+
+func TestDecodeAudioFrame(t *testing.T) {
+	for _, tc := range audioFrameTestCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			var f AudioFrame
+			err := DecodeAudioFrame(bytes.NewReader(tc.Binary), &f)
+			require.Nil(t, err)
+			require.Equal(t, tc.Frame, f)
+			require.Equal(t, tc.SampleRate, f.SampleRate())
+			require.Equal(t, tc.SampleSize, f.SampleSize())
+			require.Equal(t, tc.Channels, f.Channels())
+			require.Equal(t, tc.IsSequenceHeader, f.IsSequenceHeader())
+
+			buf := new(bytes.Buffer)
+			err = EncodeAudioFrame(buf, &f)
+			require.Nil(t, err)
+			require.Equal(t, tc.Binary, buf.Bytes())
+		})
+	}
+}
+
+func TestDecodeAudioFramesMultitrack(t *testing.T) {
+	frame := AudioFrame{
+		AudioHeader: message.AudioHeader{
+			IsExHeader:     true,
+			SoundFormat:    message.AudioSoundFormatExHeader,
+			FourCC:         message.FourCCAAC,
+			PacketType:     message.AudioPacketTypeCodedFrames,
+			IsMultitrack:   true,
+			MultitrackType: message.AVMultitrackTypeOneTrack,
+		},
+		TrackID: 1,
+		Data:    []byte{0xff},
+	}
+
+	buf := new(bytes.Buffer)
+	err := EncodeAudioFrame(buf, &frame)
+	require.Nil(t, err)
+
+	frames, err := DecodeAudioFrames(bytes.NewReader(buf.Bytes()))
+	require.Nil(t, err)
+	require.Equal(t, []AudioFrame{frame}, frames)
+}
@@ -0,0 +1,268 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package media
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// AVCDecoderConfigurationRecord A sequence header of AVC (ISO/IEC 14496-15 5.3.3.1).
+type AVCDecoderConfigurationRecord struct {
+	ConfigurationVersion uint8
+	ProfileIndication    uint8
+	ProfileCompatibility uint8
+	LevelIndication      uint8
+	LengthSizeMinusOne   uint8
+	SPS                  [][]byte
+	PPS                  [][]byte
+}
+
+// ParseAVCDecoderConfigurationRecord parses Data of a sequence header of AVC.
+func ParseAVCDecoderConfigurationRecord(b []byte) (*AVCDecoderConfigurationRecord, error) {
+	if len(b) < 6 {
+		return nil, errors.Errorf("AVCDecoderConfigurationRecord is too short: Len = %d", len(b))
+	}
+
+	rec := &AVCDecoderConfigurationRecord{
+		ConfigurationVersion: b[0],
+		ProfileIndication:    b[1],
+		ProfileCompatibility: b[2],
+		LevelIndication:      b[3],
+		LengthSizeMinusOne:   b[4] & 0x03,
+	}
+
+	var err error
+	numSPS := int(b[5] & 0x1f)
+	b = b[6:]
+	if rec.SPS, b, err = readParameterSets(b, numSPS); err != nil {
+		return nil, errors.Wrap(err, "Failed to read SPS")
+	}
+
+	if len(b) < 1 {
+		return nil, errors.New("numOfPictureParameterSets is missing")
+	}
+	numPPS := int(b[0])
+	b = b[1:]
+	if rec.PPS, _, err = readParameterSets(b, numPPS); err != nil {
+		return nil, errors.Wrap(err, "Failed to read PPS")
+	}
+
+	return rec, nil
+}
+
+// AVCSPS A part of a sequence parameter set of AVC (ITU-T H.264 7.3.2.1.1).
+type AVCSPS struct {
+	ProfileIdc         uint8
+	ConstraintSetFlags uint8
+	LevelIdc           uint8
+	ChromaFormatIdc    uint32
+	BitDepthLuma       uint32
+	BitDepthChroma     uint32
+	Width              int
+	Height             int
+
+	// VUI timing. FrameRate is 0 if the timing is not present
+	NumUnitsInTick uint32
+	TimeScale      uint32
+	FrameRate      float64
+}
+
+// ParseAVCSPS parses a NAL unit of SPS (including a NAL unit header).
+func ParseAVCSPS(nalu []byte) (*AVCSPS, error) {
+	if len(nalu) < 4 {
+		return nil, errors.Errorf("SPS is too short: Len = %d", len(nalu))
+	}
+	if nalu[0]&0x1f != 7 {
+		return nil, errors.Errorf("NAL unit is not SPS: Type = %d", nalu[0]&0x1f)
+	}
+
+	r := newBitReader(unescapeRBSP(nalu[1:]))
+
+	sps := &AVCSPS{
+		ChromaFormatIdc: 1,
+		BitDepthLuma:    8,
+		BitDepthChroma:  8,
+	}
+	sps.ProfileIdc = uint8(r.readBits(8))
+	sps.ConstraintSetFlags = uint8(r.readBits(8))
+	sps.LevelIdc = uint8(r.readBits(8))
+	r.readUE() // seq_parameter_set_id
+
+	separateColourPlane := false
+	switch sps.ProfileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		sps.ChromaFormatIdc = r.readUE()
+		if sps.ChromaFormatIdc == 3 {
+			separateColourPlane = r.readFlag()
+		}
+		sps.BitDepthLuma = r.readUE() + 8
+		sps.BitDepthChroma = r.readUE() + 8
+		r.readFlag() // qpprime_y_zero_transform_bypass_flag
+
+		if r.readFlag() { // seq_scaling_matrix_present_flag
+			n := 8
+			if sps.ChromaFormatIdc == 3 {
+				n = 12
+			}
+			for i := 0; i < n; i++ {
+				if !r.readFlag() { // seq_scaling_list_present_flag
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				skipAVCScalingList(r, size)
+			}
+		}
+	}
+
+	r.readUE()          // log2_max_frame_num_minus4
+	switch r.readUE() { // pic_order_cnt_type
+	case 0:
+		r.readUE() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.readFlag() // delta_pic_order_always_zero_flag
+		r.readSE()   // offset_for_non_ref_pic
+		r.readSE()   // offset_for_top_to_bottom_field
+		n := r.readUE()
+		for i := uint32(0); i < n && r.err == nil; i++ {
+			r.readSE() // offset_for_ref_frame
+		}
+	}
+
+	r.readUE()   // max_num_ref_frames
+	r.readFlag() // gaps_in_frame_num_value_allowed_flag
+	widthInMbs := int(r.readUE()) + 1
+	heightInMapUnits := int(r.readUE()) + 1
+	frameMbsOnly := r.readFlag()
+	if !frameMbsOnly {
+		r.readFlag() // mb_adaptive_frame_field_flag
+	}
+	r.readFlag() // direct_8x8_inference_flag
+
+	var cropLeft, cropRight, cropTop, cropBottom int
+	if r.readFlag() { // frame_cropping_flag
+		cropLeft = int(r.readUE())
+		cropRight = int(r.readUE())
+		cropTop = int(r.readUE())
+		cropBottom = int(r.readUE())
+	}
+
+	fieldFactor := 2
+	if frameMbsOnly {
+		fieldFactor = 1
+	}
+
+	// 7.4.2.1.1
+	cropUnitX, cropUnitY := 1, fieldFactor
+	if !separateColourPlane && sps.ChromaFormatIdc != 0 {
+		subWidthC, subHeightC := 2, 2
+		switch sps.ChromaFormatIdc {
+		case 2:
+			subHeightC = 1
+		case 3:
+			subWidthC, subHeightC = 1, 1
+		}
+		cropUnitX, cropUnitY = subWidthC, subHeightC*fieldFactor
+	}
+
+	sps.Width = widthInMbs*16 - cropUnitX*(cropLeft+cropRight)
+	sps.Height = fieldFactor*heightInMapUnits*16 - cropUnitY*(cropTop+cropBottom)
+
+	if r.readFlag() { // vui_parameters_present_flag
+		skipVUIUntilTiming(r, false)
+		if r.readFlag() { // timing_info_present_flag
+			sps.NumUnitsInTick = r.readBits(32)
+			sps.TimeScale = r.readBits(32)
+			if sps.NumUnitsInTick != 0 {
+				sps.FrameRate = float64(sps.TimeScale) / float64(2*sps.NumUnitsInTick)
+			}
+		}
+	}
+
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "Failed to parse SPS")
+	}
+
+	return sps, nil
+}
+
+func skipAVCScalingList(r *bitReader, size int) {
+	lastScale, nextScale := int32(8), int32(8)
+	for j := 0; j < size && r.err == nil; j++ {
+		if nextScale != 0 {
+			delta := r.readSE()
+			nextScale = (lastScale + delta + 256) % 256
+		}
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+}
+
+// skipVUIUntilTiming Skips fields of VUI before timing information. HEVC has some more fields than AVC.
+func skipVUIUntilTiming(r *bitReader, isHEVC bool) {
+	if r.readFlag() { // aspect_ratio_info_present_flag
+		if r.readBits(8) == 255 { // aspect_ratio_idc == Extended_SAR
+			r.readBits(16) // sar_width
+			r.readBits(16) // sar_height
+		}
+	}
+	if r.readFlag() { // overscan_info_present_flag
+		r.readFlag() // overscan_appropriate_flag
+	}
+	if r.readFlag() { // video_signal_type_present_flag
+		r.readBits(3)     // video_format
+		r.readFlag()      // video_full_range_flag
+		if r.readFlag() { // colour_description_present_flag
+			r.readBits(8) // colour_primaries
+			r.readBits(8) // transfer_characteristics
+			r.readBits(8) // matrix_coefficients
+		}
+	}
+	if r.readFlag() { // chroma_loc_info_present_flag
+		r.readUE() // chroma_sample_loc_type_top_field
+		r.readUE() // chroma_sample_loc_type_bottom_field
+	}
+
+	if !isHEVC {
+		return
+	}
+
+	r.readFlag()      // neutral_chroma_indication_flag
+	r.readFlag()      // field_seq_flag
+	r.readFlag()      // frame_field_info_present_flag
+	if r.readFlag() { // default_display_window_flag
+		r.readUE() // def_disp_win_left_offset
+		r.readUE() // def_disp_win_right_offset
+		r.readUE() // def_disp_win_top_offset
+		r.readUE() // def_disp_win_bottom_offset
+	}
+}
+
+// readParameterSets Reads n parameter sets which have 16 bits length prefixes.
+func readParameterSets(b []byte, n int) ([][]byte, []byte, error) {
+	sets := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		if len(b) < 2 {
+			return nil, nil, errors.New("Length of parameter set is missing")
+		}
+		size := int(binary.BigEndian.Uint16(b))
+		b = b[2:]
+		if len(b) < size {
+			return nil, nil, errors.Errorf("Parameter set is too short: Expected = %d, Actual = %d", size, len(b))
+		}
+		sets = append(sets, b[:size])
+		b = b[size:]
+	}
+
+	return sets, b, nil
+}
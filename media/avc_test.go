@@ -0,0 +1,140 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package media
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildAVCSPS Builds an SPS NAL unit of High profile
+func buildAVCSPS(width, height int, cropBottom uint32, numUnitsInTick, timeScale uint32) []byte {
+	w := &bitWriter{}
+	w.writeBits(100, 8) // profile_idc
+	w.writeBits(0, 8)   // constraint_set_flags
+	w.writeBits(40, 8)  // level_idc
+	w.writeUE(0)        // seq_parameter_set_id
+	w.writeUE(1)        // chroma_format_idc
+	w.writeUE(0)        // bit_depth_luma_minus8
+	w.writeUE(0)        // bit_depth_chroma_minus8
+	w.writeFlag(false)  // qpprime_y_zero_transform_bypass_flag
+	w.writeFlag(true)   // seq_scaling_matrix_present_flag
+	for i := 0; i < 8; i++ {
+		w.writeFlag(i == 0 || i == 6) // seq_scaling_list_present_flag
+		switch i {
+		case 0:
+			for j := 0; j < 16; j++ {
+				w.writeSE(1) // delta_scale
+			}
+		case 6:
+			w.writeSE(-8) // nextScale = 0, use a default list
+		}
+	}
+	w.writeUE(0)       // log2_max_frame_num_minus4
+	w.writeUE(1)       // pic_order_cnt_type
+	w.writeFlag(false) // delta_pic_order_always_zero_flag
+	w.writeSE(-2)      // offset_for_non_ref_pic
+	w.writeSE(0)       // offset_for_top_to_bottom_field
+	w.writeUE(2)       // num_ref_frames_in_pic_order_cnt_cycle
+	w.writeSE(1)
+	w.writeSE(1)
+	w.writeUE(4)                          // max_num_ref_frames
+	w.writeFlag(false)                    // gaps_in_frame_num_value_allowed_flag
+	w.writeUE(uint32(width/16 - 1))       // pic_width_in_mbs_minus1
+	w.writeUE(uint32((height+15)/16 - 1)) // pic_height_in_map_units_minus1
+	w.writeFlag(true)                     // frame_mbs_only_flag
+	w.writeFlag(true)                     // direct_8x8_inference_flag
+	w.writeFlag(cropBottom != 0)          // frame_cropping_flag
+	if cropBottom != 0 {
+		w.writeUE(0)
+		w.writeUE(0)
+		w.writeUE(0)
+		w.writeUE(cropBottom)
+	}
+	w.writeFlag(true) // vui_parameters_present_flag
+	w.writeFlag(true) // aspect_ratio_info_present_flag
+	w.writeBits(255, 8)
+	w.writeBits(1, 16)
+	w.writeBits(1, 16)
+	w.writeFlag(false) // overscan_info_present_flag
+	w.writeFlag(true)  // video_signal_type_present_flag
+	w.writeBits(5, 3)
+	w.writeFlag(false)
+	w.writeFlag(true) // colour_description_present_flag
+	w.writeBits(1, 8)
+	w.writeBits(1, 8)
+	w.writeBits(1, 8)
+	w.writeFlag(false)          // chroma_loc_info_present_flag
+	w.writeFlag(timeScale != 0) // timing_info_present_flag
+	if timeScale != 0 {
+		w.writeBits(numUnitsInTick, 32)
+		w.writeBits(timeScale, 32)
+		w.writeFlag(true) // fixed_frame_rate_flag
+	}
+
+	return append([]byte{0x67}, escapeRBSP(w.bytes())...)
+}
+
+func TestParseAVCSPS(t *testing.T) {
+	sps, err := ParseAVCSPS(buildAVCSPS(1920, 1080, 4, 1, 60))
+	require.Nil(t, err)
+	require.Equal(t, &AVCSPS{
+		ProfileIdc:      100,
+		LevelIdc:        40,
+		ChromaFormatIdc: 1,
+		BitDepthLuma:    8,
+		BitDepthChroma:  8,
+		Width:           1920,
+		Height:          1080,
+		NumUnitsInTick:  1,
+		TimeScale:       60,
+		FrameRate:       30,
+	}, sps)
+}
+
+func TestParseAVCSPSWithoutTiming(t *testing.T) {
+	sps, err := ParseAVCSPS(buildAVCSPS(1280, 720, 0, 0, 0))
+	require.Nil(t, err)
+	require.Equal(t, 1280, sps.Width)
+	require.Equal(t, 720, sps.Height)
+	require.Equal(t, float64(0), sps.FrameRate)
+}
+
+func TestParseAVCSPSError(t *testing.T) {
+	_, err := ParseAVCSPS([]byte{0x68, 0x00, 0x00, 0x00}) // PPS
+	require.Error(t, err)
+
+	sps := buildAVCSPS(1920, 1080, 4, 1, 60)
+	_, err = ParseAVCSPS(sps[:10])
+	require.Error(t, err)
+}
+
+func TestParseAVCDecoderConfigurationRecord(t *testing.T) {
+	sps := buildAVCSPS(1920, 1080, 4, 1, 60)
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+
+	b := []byte{0x01, 0x64, 0x00, 0x28, 0xff, 0xe1, byte(len(sps) >> 8), byte(len(sps))}
+	b = append(b, sps...)
+	b = append(b, 0x01, byte(len(pps)>>8), byte(len(pps)))
+	b = append(b, pps...)
+
+	rec, err := ParseAVCDecoderConfigurationRecord(b)
+	require.Nil(t, err)
+	require.Equal(t, &AVCDecoderConfigurationRecord{
+		ConfigurationVersion: 1,
+		ProfileIndication:    100,
+		LevelIndication:      40,
+		LengthSizeMinusOne:   3,
+		SPS:                  [][]byte{sps},
+		PPS:                  [][]byte{pps},
+	}, rec)
+
+	_, err = ParseAVCDecoderConfigurationRecord(b[:len(b)-1])
+	require.Error(t, err)
+}
@@ -0,0 +1,105 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package media
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+var errInvalidExpGolomb = errors.New("Invalid Exp-Golomb code")
+
+// bitReader Reads bits of RBSP in MSB first order. Once an error occurs, all following reads return 0 and err is kept.
+type bitReader struct {
+	b   []byte
+	pos int // in bits
+	err error
+}
+
+func newBitReader(b []byte) *bitReader {
+	return &bitReader{b: b}
+}
+
+func (r *bitReader) readBits(n int) uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos+n > len(r.b)*8 {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+
+	var v uint32
+	for i := 0; i < n; i++ {
+		bit := (r.b[r.pos/8] >> (7 - uint(r.pos%8))) & 0x01
+		v = v<<1 | uint32(bit)
+		r.pos++
+	}
+
+	return v
+}
+
+func (r *bitReader) readFlag() bool {
+	return r.readBits(1) == 1
+}
+
+func (r *bitReader) skipBits(n int) {
+	for n > 32 {
+		r.readBits(32)
+		n -= 32
+	}
+	r.readBits(n)
+}
+
+// readUE Reads ue(v), an unsigned Exp-Golomb code
+func (r *bitReader) readUE() uint32 {
+	zeros := 0
+	for !r.readFlag() {
+		if r.err != nil {
+			return 0
+		}
+		zeros++
+		if zeros > 31 {
+			r.err = errInvalidExpGolomb
+			return 0
+		}
+	}
+
+	return (1<<uint(zeros) - 1) + r.readBits(zeros)
+}
+
+// readSE Reads se(v), a signed Exp-Golomb code
+func (r *bitReader) readSE() int32 {
+	v := r.readUE()
+	if v&0x01 == 1 {
+		return int32((v + 1) / 2)
+	}
+	return -int32(v / 2)
+}
+
+// unescapeRBSP Removes emulation prevention bytes (0x00 0x00 0x03) from a NAL unit.
+func unescapeRBSP(b []byte) []byte {
+	result := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 0x03 {
+			zeros = 0
+			continue
+		}
+
+		if c == 0x00 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		result = append(result, c)
+	}
+
+	return result
+}
@@ -0,0 +1,121 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package media
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// bitWriter Builds RBSP for tests
+type bitWriter struct {
+	b []byte
+	n int // in bits
+}
+
+func (w *bitWriter) writeBits(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		if (v>>uint(i))&0x01 == 1 {
+			w.b[len(w.b)-1] |= 1 << (7 - uint(w.n%8))
+		}
+		w.n++
+	}
+}
+
+func (w *bitWriter) writeFlag(v bool) {
+	if v {
+		w.writeBits(1, 1)
+	} else {
+		w.writeBits(0, 1)
+	}
+}
+
+func (w *bitWriter) writeUE(v uint32) {
+	v++
+	n := 0
+	for tmp := v; tmp > 1; tmp >>= 1 {
+		n++
+	}
+	w.writeBits(0, n)
+	w.writeBits(v, n+1)
+}
+
+func (w *bitWriter) writeSE(v int32) {
+	if v > 0 {
+		w.writeUE(uint32(2*v - 1))
+	} else {
+		w.writeUE(uint32(-2 * v))
+	}
+}
+
+// bytes Returns RBSP with rbsp_trailing_bits
+func (w *bitWriter) bytes() []byte {
+	w.writeBits(1, 1)
+	for w.n%8 != 0 {
+		w.writeBits(0, 1)
+	}
+	return w.b
+}
+
+// escapeRBSP Inserts emulation prevention bytes
+func escapeRBSP(b []byte) []byte {
+	result := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c <= 0x03 {
+			result = append(result, 0x03)
+			zeros = 0
+		}
+
+		if c == 0x00 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		result = append(result, c)
+	}
+
+	return result
+}
+
+func TestBitReaderExpGolomb(t *testing.T) {
+	w := &bitWriter{}
+	for _, v := range []uint32{0, 1, 2, 7, 255, 65535} {
+		w.writeUE(v)
+	}
+	for _, v := range []int32{0, 1, -1, 100, -100} {
+		w.writeSE(v)
+	}
+
+	r := newBitReader(w.bytes())
+	for _, v := range []uint32{0, 1, 2, 7, 255, 65535} {
+		require.Equal(t, v, r.readUE())
+	}
+	for _, v := range []int32{0, 1, -1, 100, -100} {
+		require.Equal(t, v, r.readSE())
+	}
+	require.Nil(t, r.err)
+
+	r.readBits(32)
+	require.Error(t, r.err)
+	require.Equal(t, uint32(0), r.readUE())
+}
+
+func TestUnescapeRBSP(t *testing.T) {
+	b := []byte{0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x03}
+	require.Equal(t, b, unescapeRBSP(escapeRBSP(b)))
+
+	require.Equal(t,
+		[]byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x03},
+		unescapeRBSP([]byte{0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03, 0x00, 0x03}),
+	)
+}
@@ -0,0 +1,345 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package media
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// HEVC NAL unit types of parameter sets
+const (
+	HEVCNALUnitTypeVPS = 32
+	HEVCNALUnitTypeSPS = 33
+	HEVCNALUnitTypePPS = 34
+)
+
+// HEVCDecoderConfigurationRecord A sequence header of HEVC (ISO/IEC 14496-15 8.3.3.1).
+type HEVCDecoderConfigurationRecord struct {
+	ConfigurationVersion             uint8
+	GeneralProfileSpace              uint8
+	GeneralTierFlag                  bool
+	GeneralProfileIdc                uint8
+	GeneralProfileCompatibilityFlags uint32
+	GeneralConstraintIndicatorFlags  uint64 // 48 bits
+	GeneralLevelIdc                  uint8
+	MinSpatialSegmentationIdc        uint16
+	ParallelismType                  uint8
+	ChromaFormatIdc                  uint8
+	BitDepthLuma                     uint8
+	BitDepthChroma                   uint8
+	AvgFrameRate                     uint16 // in frames per 256 seconds
+	ConstantFrameRate                uint8
+	NumTemporalLayers                uint8
+	TemporalIDNested                 bool
+	LengthSizeMinusOne               uint8
+	Arrays                           []HEVCNALUnitArray
+}
+
+// HEVCNALUnitArray NAL units of a type in HEVCDecoderConfigurationRecord.
+type HEVCNALUnitArray struct {
+	ArrayCompleteness bool
+	NALUnitType       uint8
+	NALUnits          [][]byte
+}
+
+// ParseHEVCDecoderConfigurationRecord parses Data of a sequence header of HEVC.
+func ParseHEVCDecoderConfigurationRecord(b []byte) (*HEVCDecoderConfigurationRecord, error) {
+	if len(b) < 23 {
+		return nil, errors.Errorf("HEVCDecoderConfigurationRecord is too short: Len = %d", len(b))
+	}
+
+	rec := &HEVCDecoderConfigurationRecord{
+		ConfigurationVersion:             b[0],
+		GeneralProfileSpace:              b[1] >> 6,
+		GeneralTierFlag:                  b[1]&0x20 != 0,
+		GeneralProfileIdc:                b[1] & 0x1f,
+		GeneralProfileCompatibilityFlags: binary.BigEndian.Uint32(b[2:6]),
+		GeneralConstraintIndicatorFlags:  uint64(binary.BigEndian.Uint16(b[6:8]))<<32 | uint64(binary.BigEndian.Uint32(b[8:12])),
+		GeneralLevelIdc:                  b[12],
+		MinSpatialSegmentationIdc:        binary.BigEndian.Uint16(b[13:15]) & 0x0fff,
+		ParallelismType:                  b[15] & 0x03,
+		ChromaFormatIdc:                  b[16] & 0x03,
+		BitDepthLuma:                     b[17]&0x07 + 8,
+		BitDepthChroma:                   b[18]&0x07 + 8,
+		AvgFrameRate:                     binary.BigEndian.Uint16(b[19:21]),
+		ConstantFrameRate:                b[21] >> 6,
+		NumTemporalLayers:                (b[21] >> 3) & 0x07,
+		TemporalIDNested:                 b[21]&0x04 != 0,
+		LengthSizeMinusOne:               b[21] & 0x03,
+	}
+
+	numArrays := int(b[22])
+	b = b[23:]
+	for i := 0; i < numArrays; i++ {
+		if len(b) < 3 {
+			return nil, errors.Errorf("NAL unit array is too short: Index = %d", i)
+		}
+		array := HEVCNALUnitArray{
+			ArrayCompleteness: b[0]&0x80 != 0,
+			NALUnitType:       b[0] & 0x3f,
+		}
+		numNALUs := int(binary.BigEndian.Uint16(b[1:3]))
+
+		var err error
+		if array.NALUnits, b, err = readParameterSets(b[3:], numNALUs); err != nil {
+			return nil, errors.Wrapf(err, "Failed to read NAL units: Type = %d", array.NALUnitType)
+		}
+		rec.Arrays = append(rec.Arrays, array)
+	}
+
+	return rec, nil
+}
+
+// NALUnits returns NAL units of the type. e.g. HEVCNALUnitTypeSPS
+func (rec *HEVCDecoderConfigurationRecord) NALUnits(ty uint8) [][]byte {
+	var result [][]byte
+	for _, array := range rec.Arrays {
+		if array.NALUnitType == ty {
+			result = append(result, array.NALUnits...)
+		}
+	}
+	return result
+}
+
+// HEVCSPS A part of a sequence parameter set of HEVC (ITU-T H.265 7.3.2.2).
+type HEVCSPS struct {
+	GeneralProfileSpace uint8
+	GeneralTierFlag     bool
+	GeneralProfileIdc   uint8
+	GeneralLevelIdc     uint8
+	ChromaFormatIdc     uint32
+	BitDepthLuma        uint32
+	BitDepthChroma      uint32
+	Width               int
+	Height              int
+
+	// VUI timing. FrameRate is 0 if the timing is not present
+	NumUnitsInTick uint32
+	TimeScale      uint32
+	FrameRate      float64
+}
+
+// ParseHEVCSPS parses a NAL unit of SPS (including a NAL unit header).
+func ParseHEVCSPS(nalu []byte) (*HEVCSPS, error) {
+	if len(nalu) < 3 {
+		return nil, errors.Errorf("SPS is too short: Len = %d", len(nalu))
+	}
+	if ty := (nalu[0] >> 1) & 0x3f; ty != HEVCNALUnitTypeSPS {
+		return nil, errors.Errorf("NAL unit is not SPS: Type = %d", ty)
+	}
+
+	r := newBitReader(unescapeRBSP(nalu[2:]))
+	sps := &HEVCSPS{}
+
+	r.readBits(4) // sps_video_parameter_set_id
+	maxSubLayersMinus1 := int(r.readBits(3))
+	r.readFlag() // sps_temporal_id_nesting_flag
+
+	// profile_tier_level(1, sps_max_sub_layers_minus1)
+	sps.GeneralProfileSpace = uint8(r.readBits(2))
+	sps.GeneralTierFlag = r.readFlag()
+	sps.GeneralProfileIdc = uint8(r.readBits(5))
+	r.readBits(32) // general_profile_compatibility_flag[32]
+	r.skipBits(48) // general_progressive_source_flag ... general_inbld_flag/reserved
+	sps.GeneralLevelIdc = uint8(r.readBits(8))
+
+	subLayerProfilePresent := make([]bool, maxSubLayersMinus1)
+	subLayerLevelPresent := make([]bool, maxSubLayersMinus1)
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		subLayerProfilePresent[i] = r.readFlag()
+		subLayerLevelPresent[i] = r.readFlag()
+	}
+	if maxSubLayersMinus1 > 0 {
+		for i := maxSubLayersMinus1; i < 8; i++ {
+			r.readBits(2) // reserved_zero_2bits
+		}
+	}
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		if subLayerProfilePresent[i] {
+			r.skipBits(88)
+		}
+		if subLayerLevelPresent[i] {
+			r.readBits(8) // sub_layer_level_idc
+		}
+	}
+
+	r.readUE() // sps_seq_parameter_set_id
+	sps.ChromaFormatIdc = r.readUE()
+	separateColourPlane := false
+	if sps.ChromaFormatIdc == 3 {
+		separateColourPlane = r.readFlag()
+	}
+	width := int(r.readUE())  // pic_width_in_luma_samples
+	height := int(r.readUE()) // pic_height_in_luma_samples
+
+	var confLeft, confRight, confTop, confBottom int
+	if r.readFlag() { // conformance_window_flag
+		confLeft = int(r.readUE())
+		confRight = int(r.readUE())
+		confTop = int(r.readUE())
+		confBottom = int(r.readUE())
+	}
+
+	// 6.2, Table 6-1
+	subWidthC, subHeightC := 1, 1
+	if !separateColourPlane {
+		switch sps.ChromaFormatIdc {
+		case 1:
+			subWidthC, subHeightC = 2, 2
+		case 2:
+			subWidthC = 2
+		}
+	}
+	sps.Width = width - subWidthC*(confLeft+confRight)
+	sps.Height = height - subHeightC*(confTop+confBottom)
+
+	sps.BitDepthLuma = r.readUE() + 8
+	sps.BitDepthChroma = r.readUE() + 8
+	log2MaxPicOrderCntLsb := int(r.readUE()) + 4
+
+	subLayerOrderingInfoPresent := r.readFlag()
+	start := maxSubLayersMinus1
+	if subLayerOrderingInfoPresent {
+		start = 0
+	}
+	for i := start; i <= maxSubLayersMinus1; i++ {
+		r.readUE() // sps_max_dec_pic_buffering_minus1
+		r.readUE() // sps_max_num_reorder_pics
+		r.readUE() // sps_max_latency_increase_plus1
+	}
+
+	r.readUE() // log2_min_luma_coding_block_size_minus3
+	r.readUE() // log2_diff_max_min_luma_coding_block_size
+	r.readUE() // log2_min_luma_transform_block_size_minus2
+	r.readUE() // log2_diff_max_min_luma_transform_block_size
+	r.readUE() // max_transform_hierarchy_depth_inter
+	r.readUE() // max_transform_hierarchy_depth_intra
+
+	if r.readFlag() { // scaling_list_enabled_flag
+		if r.readFlag() { // sps_scaling_list_data_present_flag
+			skipHEVCScalingListData(r)
+		}
+	}
+
+	r.readFlag()      // amp_enabled_flag
+	r.readFlag()      // sample_adaptive_offset_enabled_flag
+	if r.readFlag() { // pcm_enabled_flag
+		r.readBits(4) // pcm_sample_bit_depth_luma_minus1
+		r.readBits(4) // pcm_sample_bit_depth_chroma_minus1
+		r.readUE()    // log2_min_pcm_luma_coding_block_size_minus3
+		r.readUE()    // log2_diff_max_min_pcm_luma_coding_block_size
+		r.readFlag()  // pcm_loop_filter_disabled_flag
+	}
+
+	numShortTermRefPicSets := int(r.readUE())
+	if numShortTermRefPicSets > 64 {
+		return nil, errors.Errorf("Too many short term ref pic sets: Num = %d", numShortTermRefPicSets)
+	}
+	numDeltaPocs := make([]int, numShortTermRefPicSets)
+	for i := 0; i < numShortTermRefPicSets && r.err == nil; i++ {
+		numDeltaPocs[i] = skipHEVCShortTermRefPicSet(r, i, numDeltaPocs)
+	}
+
+	if r.readFlag() { // long_term_ref_pics_present_flag
+		n := r.readUE() // num_long_term_ref_pics_sps
+		for i := uint32(0); i < n && r.err == nil; i++ {
+			r.readBits(log2MaxPicOrderCntLsb) // lt_ref_pic_poc_lsb_sps
+			r.readFlag()                      // used_by_curr_pic_lt_sps_flag
+		}
+	}
+
+	r.readFlag() // sps_temporal_mvp_enabled_flag
+	r.readFlag() // strong_intra_smoothing_enabled_flag
+
+	if r.readFlag() { // vui_parameters_present_flag
+		skipVUIUntilTiming(r, true)
+		if r.readFlag() { // vui_timing_info_present_flag
+			sps.NumUnitsInTick = r.readBits(32)
+			sps.TimeScale = r.readBits(32)
+			if sps.NumUnitsInTick != 0 {
+				sps.FrameRate = float64(sps.TimeScale) / float64(sps.NumUnitsInTick)
+			}
+		}
+	}
+
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "Failed to parse SPS")
+	}
+
+	return sps, nil
+}
+
+// skipHEVCScalingListData 7.3.4
+func skipHEVCScalingListData(r *bitReader) {
+	for sizeID := 0; sizeID < 4; sizeID++ {
+		step := 1
+		if sizeID == 3 {
+			step = 3
+		}
+		for matrixID := 0; matrixID < 6; matrixID += step {
+			if !r.readFlag() { // scaling_list_pred_mode_flag
+				r.readUE() // scaling_list_pred_matrix_id_delta
+				continue
+			}
+
+			coefNum := 1 << uint(4+(sizeID<<1))
+			if coefNum > 64 {
+				coefNum = 64
+			}
+			if sizeID > 1 {
+				r.readSE() // scaling_list_dc_coef_minus8
+			}
+			for i := 0; i < coefNum; i++ {
+				r.readSE() // scaling_list_delta_coef
+			}
+		}
+	}
+}
+
+// skipHEVCShortTermRefPicSet 7.3.7. It returns NumDeltaPocs of the set.
+func skipHEVCShortTermRefPicSet(r *bitReader, idx int, numDeltaPocs []int) int {
+	interRefPicSetPrediction := false
+	if idx != 0 {
+		interRefPicSetPrediction = r.readFlag()
+	}
+
+	if interRefPicSetPrediction {
+		// delta_idx_minus1 is present only in slice headers
+		refIdx := idx - 1
+		r.readFlag() // delta_rps_sign
+		r.readUE()   // abs_delta_rps_minus1
+
+		n := 0
+		for j := 0; j <= numDeltaPocs[refIdx]; j++ {
+			used := r.readFlag() // used_by_curr_pic_flag
+			useDelta := true
+			if !used {
+				useDelta = r.readFlag() // use_delta_flag
+			}
+			if used || useDelta {
+				n++
+			}
+		}
+		return n
+	}
+
+	numNegative := r.readUE()
+	numPositive := r.readUE()
+	if numNegative > 16 || numPositive > 16 {
+		r.err = errors.Errorf("Too many pictures in a short term ref pic set: Negative = %d, Positive = %d", numNegative, numPositive)
+		return 0
+	}
+	for i := uint32(0); i < numNegative+numPositive; i++ {
+		r.readUE()   // delta_poc_s0_minus1 / delta_poc_s1_minus1
+		r.readFlag() // used_by_curr_pic_s0_flag / used_by_curr_pic_s1_flag
+	}
+
+	return int(numNegative + numPositive)
+}
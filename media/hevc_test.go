@@ -0,0 +1,230 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package media
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildHEVCSPS Builds an SPS NAL unit of Main profile which has 2 sub layers
+func buildHEVCSPS(width, height, confBottom uint32, numUnitsInTick, timeScale uint32) []byte {
+	w := &bitWriter{}
+	w.writeBits(0, 4) // sps_video_parameter_set_id
+	w.writeBits(1, 3) // sps_max_sub_layers_minus1
+	w.writeFlag(true) // sps_temporal_id_nesting_flag
+
+	// profile_tier_level
+	w.writeBits(0, 2)           // general_profile_space
+	w.writeFlag(false)          // general_tier_flag
+	w.writeBits(1, 5)           // general_profile_idc
+	w.writeBits(0x60000000, 32) // general_profile_compatibility_flag
+	w.writeBits(0x9000, 16)     // general_progressive_source_flag ...
+	w.writeBits(0, 32)
+	w.writeBits(120, 8) // general_level_idc
+	w.writeFlag(true)   // sub_layer_profile_present_flag[0]
+	w.writeFlag(true)   // sub_layer_level_present_flag[0]
+	for i := 1; i < 8; i++ {
+		w.writeBits(0, 2) // reserved_zero_2bits
+	}
+	w.writeBits(0, 32) // sub layer profile (88 bits)
+	w.writeBits(0, 32)
+	w.writeBits(0, 24)
+	w.writeBits(90, 8) // sub_layer_level_idc
+
+	w.writeUE(0)      // sps_seq_parameter_set_id
+	w.writeUE(1)      // chroma_format_idc
+	w.writeUE(width)  // pic_width_in_luma_samples
+	w.writeUE(height) // pic_height_in_luma_samples
+	w.writeFlag(confBottom != 0)
+	if confBottom != 0 {
+		w.writeUE(0)
+		w.writeUE(0)
+		w.writeUE(0)
+		w.writeUE(confBottom)
+	}
+	w.writeUE(0)      // bit_depth_luma_minus8
+	w.writeUE(0)      // bit_depth_chroma_minus8
+	w.writeUE(4)      // log2_max_pic_order_cnt_lsb_minus4
+	w.writeFlag(true) // sps_sub_layer_ordering_info_present_flag
+	for i := 0; i < 2; i++ {
+		w.writeUE(4)
+		w.writeUE(2)
+		w.writeUE(0)
+	}
+	w.writeUE(0) // log2_min_luma_coding_block_size_minus3
+	w.writeUE(3) // log2_diff_max_min_luma_coding_block_size
+	w.writeUE(0) // log2_min_luma_transform_block_size_minus2
+	w.writeUE(3) // log2_diff_max_min_luma_transform_block_size
+	w.writeUE(1) // max_transform_hierarchy_depth_inter
+	w.writeUE(1) // max_transform_hierarchy_depth_intra
+
+	w.writeFlag(true) // scaling_list_enabled_flag
+	w.writeFlag(true) // sps_scaling_list_data_present_flag
+	for sizeID := 0; sizeID < 4; sizeID++ {
+		step := 1
+		if sizeID == 3 {
+			step = 3
+		}
+		for matrixID := 0; matrixID < 6; matrixID += step {
+			if matrixID%2 == 0 {
+				w.writeFlag(false) // scaling_list_pred_mode_flag
+				w.writeUE(0)       // scaling_list_pred_matrix_id_delta
+				continue
+			}
+			w.writeFlag(true)
+			coefNum := 1 << uint(4+(sizeID<<1))
+			if coefNum > 64 {
+				coefNum = 64
+			}
+			if sizeID > 1 {
+				w.writeSE(8) // scaling_list_dc_coef_minus8
+			}
+			for i := 0; i < coefNum; i++ {
+				w.writeSE(1)
+			}
+		}
+	}
+
+	w.writeFlag(true)  // amp_enabled_flag
+	w.writeFlag(true)  // sample_adaptive_offset_enabled_flag
+	w.writeFlag(true)  // pcm_enabled_flag
+	w.writeBits(7, 4)  // pcm_sample_bit_depth_luma_minus1
+	w.writeBits(7, 4)  // pcm_sample_bit_depth_chroma_minus1
+	w.writeUE(0)       // log2_min_pcm_luma_coding_block_size_minus3
+	w.writeUE(1)       // log2_diff_max_min_pcm_luma_coding_block_size
+	w.writeFlag(false) // pcm_loop_filter_disabled_flag
+
+	w.writeUE(2) // num_short_term_ref_pic_sets
+	// st_ref_pic_set(0)
+	w.writeUE(2) // num_negative_pics
+	w.writeUE(1) // num_positive_pics
+	for i := 0; i < 3; i++ {
+		w.writeUE(0)      // delta_poc_minus1
+		w.writeFlag(true) // used_by_curr_pic_flag
+	}
+	// st_ref_pic_set(1)
+	w.writeFlag(true)  // inter_ref_pic_set_prediction_flag
+	w.writeFlag(false) // delta_rps_sign
+	w.writeUE(0)       // abs_delta_rps_minus1
+	for j := 0; j <= 3; j++ {
+		w.writeFlag(j%2 == 0) // used_by_curr_pic_flag
+		if j%2 != 0 {
+			w.writeFlag(j == 1) // use_delta_flag
+		}
+	}
+
+	w.writeFlag(true) // long_term_ref_pics_present_flag
+	w.writeUE(1)      // num_long_term_ref_pics_sps
+	w.writeBits(3, 8) // lt_ref_pic_poc_lsb_sps
+	w.writeFlag(true) // used_by_curr_pic_lt_sps_flag
+
+	w.writeFlag(true) // sps_temporal_mvp_enabled_flag
+	w.writeFlag(true) // strong_intra_smoothing_enabled_flag
+
+	w.writeFlag(true)  // vui_parameters_present_flag
+	w.writeFlag(false) // aspect_ratio_info_present_flag
+	w.writeFlag(true)  // overscan_info_present_flag
+	w.writeFlag(false)
+	w.writeFlag(false) // video_signal_type_present_flag
+	w.writeFlag(true)  // chroma_loc_info_present_flag
+	w.writeUE(0)
+	w.writeUE(0)
+	w.writeFlag(false) // neutral_chroma_indication_flag
+	w.writeFlag(false) // field_seq_flag
+	w.writeFlag(false) // frame_field_info_present_flag
+	w.writeFlag(true)  // default_display_window_flag
+	w.writeUE(0)
+	w.writeUE(0)
+	w.writeUE(0)
+	w.writeUE(8)
+	w.writeFlag(timeScale != 0) // vui_timing_info_present_flag
+	if timeScale != 0 {
+		w.writeBits(numUnitsInTick, 32)
+		w.writeBits(timeScale, 32)
+		w.writeFlag(false) // vui_poc_proportional_to_timing_flag
+		w.writeFlag(false) // vui_hrd_parameters_present_flag
+	}
+	w.writeFlag(false) // bitstream_restriction_flag
+	w.writeFlag(false) // sps_extension_present_flag
+
+	return append([]byte{HEVCNALUnitTypeSPS << 1, 0x01}, escapeRBSP(w.bytes())...)
+}
+
+func TestParseHEVCSPS(t *testing.T) {
+	sps, err := ParseHEVCSPS(buildHEVCSPS(1920, 1088, 4, 1001, 60000))
+	require.Nil(t, err)
+	require.Equal(t, &HEVCSPS{
+		GeneralProfileIdc: 1,
+		GeneralLevelIdc:   120,
+		ChromaFormatIdc:   1,
+		BitDepthLuma:      8,
+		BitDepthChroma:    8,
+		Width:             1920,
+		Height:            1080,
+		NumUnitsInTick:    1001,
+		TimeScale:         60000,
+		FrameRate:         60000.0 / 1001.0,
+	}, sps)
+}
+
+func TestParseHEVCSPSError(t *testing.T) {
+	_, err := ParseHEVCSPS([]byte{HEVCNALUnitTypePPS << 1, 0x01, 0x00})
+	require.Error(t, err)
+
+	sps := buildHEVCSPS(1920, 1088, 4, 1001, 60000)
+	_, err = ParseHEVCSPS(sps[:20])
+	require.Error(t, err)
+}
+
+func buildHEVCDecoderConfigurationRecord(sps []byte) []byte {
+	vps := []byte{HEVCNALUnitTypeVPS << 1, 0x01, 0x0c}
+	b := []byte{
+		0x01,                   // configurationVersion
+		0x01,                   // general_profile_space, general_tier_flag, general_profile_idc
+		0x60, 0x00, 0x00, 0x00, // general_profile_compatibility_flags
+		0x90, 0x00, 0x00, 0x00, 0x00, 0x00, // general_constraint_indicator_flags
+		120,        // general_level_idc
+		0xf0, 0x00, // min_spatial_segmentation_idc
+		0xfc,       // parallelismType
+		0xfd,       // chromaFormat
+		0xf8,       // bitDepthLumaMinus8
+		0xf8,       // bitDepthChromaMinus8
+		0x1d, 0xf7, // avgFrameRate (29.97 * 256)
+		0x0f, // constantFrameRate, numTemporalLayers, temporalIdNested, lengthSizeMinusOne
+		0x02, // numOfArrays
+	}
+	b = append(b, 0x80|HEVCNALUnitTypeVPS, 0x00, 0x01, 0x00, byte(len(vps)))
+	b = append(b, vps...)
+	b = append(b, 0x80|HEVCNALUnitTypeSPS, 0x00, 0x01, byte(len(sps)>>8), byte(len(sps)))
+	b = append(b, sps...)
+
+	return b
+}
+
+func TestParseHEVCDecoderConfigurationRecord(t *testing.T) {
+	sps := buildHEVCSPS(1920, 1088, 4, 1001, 60000)
+
+	rec, err := ParseHEVCDecoderConfigurationRecord(buildHEVCDecoderConfigurationRecord(sps))
+	require.Nil(t, err)
+	require.Equal(t, uint8(1), rec.GeneralProfileIdc)
+	require.Equal(t, uint8(120), rec.GeneralLevelIdc)
+	require.Equal(t, uint64(0x900000000000), rec.GeneralConstraintIndicatorFlags)
+	require.Equal(t, uint8(1), rec.ChromaFormatIdc)
+	require.Equal(t, uint8(8), rec.BitDepthLuma)
+	require.Equal(t, uint16(0x1df7), rec.AvgFrameRate)
+	require.Equal(t, uint8(1), rec.NumTemporalLayers)
+	require.True(t, rec.TemporalIDNested)
+	require.Equal(t, uint8(3), rec.LengthSizeMinusOne)
+	require.Len(t, rec.Arrays, 2)
+	require.Equal(t, [][]byte{sps}, rec.NALUnits(HEVCNALUnitTypeSPS))
+
+	_, err = ParseHEVCDecoderConfigurationRecord(buildHEVCDecoderConfigurationRecord(sps)[:30])
+	require.Error(t, err)
+}
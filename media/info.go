@@ -0,0 +1,117 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package media
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+// VideoInfo Properties of video. Fields which are unknown are zero.
+type VideoInfo struct {
+	Codec     message.FourCC
+	CodecID   message.VideoCodecID // Legacy headers only
+	Profile   uint8                // profile_idc
+	Level     uint8                // level_idc
+	Width     int
+	Height    int
+	FrameRate float64
+}
+
+// AudioInfo Properties of audio. Fields which are unknown are zero.
+type AudioInfo struct {
+	Codec       message.FourCC
+	SoundFormat message.AudioSoundFormat // Legacy headers only
+	ObjectType  uint8                    // AAC only
+	SampleRate  int
+	SampleSize  int // in bits
+	Channels    int
+}
+
+// ParseVideoInfo parses a sequence header. Decoder configurations of AVC and HEVC are parsed, and
+// only a codec is filled for other codecs.
+func ParseVideoInfo(f *VideoFrame) (*VideoInfo, error) {
+	if !f.IsSequenceHeader() {
+		return nil, errors.New("Frame is not a sequence header")
+	}
+
+	info := &VideoInfo{
+		Codec:   f.FourCC,
+		CodecID: f.CodecID,
+	}
+
+	switch f.FourCC {
+	case message.FourCCAVC:
+		rec, err := ParseAVCDecoderConfigurationRecord(f.Data)
+		if err != nil {
+			return nil, err
+		}
+		info.Profile = rec.ProfileIndication
+		info.Level = rec.LevelIndication
+
+		if len(rec.SPS) == 0 {
+			return info, nil
+		}
+		sps, err := ParseAVCSPS(rec.SPS[0])
+		if err != nil {
+			return nil, err
+		}
+		info.Width, info.Height, info.FrameRate = sps.Width, sps.Height, sps.FrameRate
+
+	case message.FourCCHEVC:
+		rec, err := ParseHEVCDecoderConfigurationRecord(f.Data)
+		if err != nil {
+			return nil, err
+		}
+		info.Profile = rec.GeneralProfileIdc
+		info.Level = rec.GeneralLevelIdc
+		info.FrameRate = float64(rec.AvgFrameRate) / 256
+
+		spss := rec.NALUnits(HEVCNALUnitTypeSPS)
+		if len(spss) == 0 {
+			return info, nil
+		}
+		sps, err := ParseHEVCSPS(spss[0])
+		if err != nil {
+			return nil, err
+		}
+		info.Width, info.Height = sps.Width, sps.Height
+		if sps.FrameRate != 0 {
+			info.FrameRate = sps.FrameRate
+		}
+	}
+
+	return info, nil
+}
+
+// ParseAudioInfo returns properties written in a header, and an AudioSpecificConfig is parsed if the frame is
+// a sequence header of AAC.
+func ParseAudioInfo(f *AudioFrame) (*AudioInfo, error) {
+	info := &AudioInfo{
+		Codec:      f.FourCC,
+		SampleRate: f.SampleRate(),
+		SampleSize: f.SampleSize(),
+		Channels:   f.Channels(),
+	}
+	if !f.IsExHeader {
+		info.SoundFormat = f.SoundFormat
+	}
+
+	if f.FourCC == message.FourCCAAC && f.IsSequenceHeader() {
+		asc, err := ParseAudioSpecificConfig(f.Data)
+		if err != nil {
+			return nil, err
+		}
+		info.ObjectType = asc.ObjectType
+		info.SampleRate = asc.SampleRate
+		info.Channels = asc.Channels
+	}
+
+	return info, nil
+}
@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package media
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+func TestParseVideoInfoAVC(t *testing.T) {
+	sps := buildAVCSPS(1280, 720, 0, 1, 50)
+	data := []byte{0x01, 0x64, 0x00, 0x1f, 0xff, 0xe1, byte(len(sps) >> 8), byte(len(sps))}
+	data = append(data, sps...)
+	data = append(data, 0x00) // No PPS
+
+	info, err := ParseVideoInfo(&VideoFrame{
+		VideoHeader: message.VideoHeader{
+			FrameType:  message.VideoFrameTypeKeyFrame,
+			CodecID:    message.VideoCodecIDAVC,
+			FourCC:     message.FourCCAVC,
+			PacketType: message.VideoPacketTypeSequenceStart,
+		},
+		Data: data,
+	})
+	require.Nil(t, err)
+	require.Equal(t, &VideoInfo{
+		Codec:     message.FourCCAVC,
+		CodecID:   message.VideoCodecIDAVC,
+		Profile:   100,
+		Level:     31,
+		Width:     1280,
+		Height:    720,
+		FrameRate: 25,
+	}, info)
+}
+
+func TestParseVideoInfoHEVC(t *testing.T) {
+	info, err := ParseVideoInfo(&VideoFrame{
+		VideoHeader: message.VideoHeader{
+			FrameType:  message.VideoFrameTypeKeyFrame,
+			IsExHeader: true,
+			FourCC:     message.FourCCHEVC,
+			PacketType: message.VideoPacketTypeSequenceStart,
+		},
+		Data: buildHEVCDecoderConfigurationRecord(buildHEVCSPS(3840, 2160, 0, 1, 60)),
+	})
+	require.Nil(t, err)
+	require.Equal(t, &VideoInfo{
+		Codec:     message.FourCCHEVC,
+		Profile:   1,
+		Level:     120,
+		Width:     3840,
+		Height:    2160,
+		FrameRate: 60,
+	}, info)
+}
+
+func TestParseVideoInfoNotSequenceHeader(t *testing.T) {
+	_, err := ParseVideoInfo(&VideoFrame{
+		VideoHeader: message.VideoHeader{
+			FrameType:  message.VideoFrameTypeKeyFrame,
+			CodecID:    message.VideoCodecIDAVC,
+			FourCC:     message.FourCCAVC,
+			PacketType: message.VideoPacketTypeCodedFrames,
+		},
+	})
+	require.Error(t, err)
+}
+
+func TestParseAudioInfo(t *testing.T) {
+	info, err := ParseAudioInfo(&AudioFrame{
+		AudioHeader: message.AudioHeader{
+			SoundFormat: message.AudioSoundFormatAAC,
+			SoundRate:   3,
+			SoundSize:   1,
+			SoundType:   1,
+			FourCC:      message.FourCCAAC,
+			PacketType:  message.AudioPacketTypeSequenceStart,
+		},
+		Data: []byte{0x11, 0x88}, // AAC-LC 48kHz mono
+	})
+	require.Nil(t, err)
+	require.Equal(t, &AudioInfo{
+		Codec:       message.FourCCAAC,
+		SoundFormat: message.AudioSoundFormatAAC,
+		ObjectType:  AACObjectTypeLC,
+		SampleRate:  48000,
+		SampleSize:  16,
+		Channels:    1,
+	}, info)
+}
@@ -0,0 +1,10 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package media provides typed audio and video frames which are parsed from payloads of
+// message.AudioMessage and message.VideoMessage (FLV tag headers, including Enhanced RTMP).
+package media
@@ -0,0 +1,109 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package media
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+// VideoFrame A video frame in a payload of message.VideoMessage.
+//
+// Frames of Enhanced RTMP multitrack packets have IsMultitrack set, and FourCC and CompositionTime are values of the track.
+type VideoFrame struct {
+	message.VideoHeader
+	TrackID uint8  // 0 if the frame is not multitrack
+	Data    []byte // Data of the codec which follows the header. e.g. NAL units of AVC
+}
+
+// IsKeyFrame returns true if the frame is a key frame (including generated key frames).
+// Sequence headers are not key frames even if they have the frame type of key frames.
+func (f *VideoFrame) IsKeyFrame() bool {
+	isKeyFrameType := f.FrameType == message.VideoFrameTypeKeyFrame || f.FrameType == message.VideoFrameTypeGeneratedKeyFrame
+	return isKeyFrameType && !f.IsSequenceHeader()
+}
+
+// IsSequenceHeader returns true if Data is a codec configuration. e.g. AVCDecoderConfigurationRecord.
+func (f *VideoFrame) IsSequenceHeader() bool {
+	return f.FrameType != message.VideoFrameTypeCommand &&
+		f.FourCC != 0 &&
+		f.PacketType == message.VideoPacketTypeSequenceStart
+}
+
+// DecodeVideoFrame parses a payload which is not multitrack.
+func DecodeVideoFrame(r io.Reader, f *VideoFrame) error {
+	*f = VideoFrame{}
+	if err := message.DecodeVideoHeader(r, &f.VideoHeader); err != nil {
+		return errors.Wrap(err, "Failed to decode video header")
+	}
+	if f.IsMultitrack {
+		return errors.New("Multitrack video must be decoded by DecodeVideoFrames")
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	f.Data = data
+
+	return nil
+}
+
+// DecodeVideoFrames parses a payload. Multitrack payloads result in a frame per track.
+func DecodeVideoFrames(r io.Reader) ([]VideoFrame, error) {
+	var header message.VideoHeader
+	if err := message.DecodeVideoHeader(r, &header); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode video header")
+	}
+
+	tracks, err := message.DecodeVideoTracks(r, &header)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to decode video tracks")
+	}
+
+	return NewVideoFrames(&header, tracks), nil
+}
+
+// NewVideoFrames makes frames of tracks which are decoded by message.DecodeVideoTracks. Data are not copied.
+func NewVideoFrames(header *message.VideoHeader, tracks []message.VideoTrack) []VideoFrame {
+	frames := make([]VideoFrame, len(tracks))
+	for i, track := range tracks {
+		frames[i].VideoHeader = *header
+		frames[i].FourCC = track.FourCC
+		frames[i].CompositionTime = track.CompositionTime
+		frames[i].TrackID = track.TrackID
+		frames[i].Data = track.Payload
+	}
+
+	return frames
+}
+
+// EncodeVideoFrame writes a header and data of the frame. A frame which has IsMultitrack is written as a packet of a track.
+func EncodeVideoFrame(w io.Writer, f *VideoFrame) error {
+	if f.IsMultitrack {
+		return message.EncodeVideoTracks(w, &f.VideoHeader, []message.VideoTrack{
+			{
+				TrackID:         f.TrackID,
+				FourCC:          f.FourCC,
+				CompositionTime: f.CompositionTime,
+				Payload:         f.Data,
+			},
+		})
+	}
+
+	if err := message.EncodeVideoHeader(w, &f.VideoHeader); err != nil {
+		return err
+	}
+
+	_, err := w.Write(f.Data)
+	return err
+}
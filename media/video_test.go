@@ -0,0 +1,134 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package media
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type videoFrameTestCase struct {
+	Name             string
+	Binary           []byte
+	Frame            VideoFrame
+	IsKeyFrame       bool
+	IsSequenceHeader bool
+}
+
+var videoFrameTestCases = []videoFrameTestCase{
+	{
+		Name:   "Legacy AVC sequence header",
+		Binary: []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01, 0x64},
+		Frame: VideoFrame{
+			VideoHeader: message.VideoHeader{
+				FrameType:  message.VideoFrameTypeKeyFrame,
+				CodecID:    message.VideoCodecIDAVC,
+				FourCC:     message.FourCCAVC,
+				PacketType: message.VideoPacketTypeSequenceStart,
+			},
+			Data: []byte{0x01, 0x64},
+		},
+		IsKeyFrame:       false, // Not a key frame even if FrameType is KeyFrame
+		IsSequenceHeader: true,
+	},
+	{
+		Name:   "Legacy AVC inter frame",
+		Binary: []byte{0x27, 0x01, 0x00, 0x00, 0x21, 0xff},
+		Frame: VideoFrame{
+			VideoHeader: message.VideoHeader{
+				FrameType:       message.VideoFrameTypeInterFrame,
+				CodecID:         message.VideoCodecIDAVC,
+				FourCC:          message.FourCCAVC,
+				PacketType:      message.VideoPacketTypeCodedFrames,
+				CompositionTime: 33,
+			},
+			Data: []byte{0xff},
+		},
+	},
+	{
+		Name:   "Legacy Sorenson H.263",
+		Binary: []byte{0x12, 0xff},
+		Frame: VideoFrame{
+			VideoHeader: message.VideoHeader{
+				FrameType: message.VideoFrameTypeKeyFrame,
+				CodecID:   message.VideoCodecIDSorensonH263,
+			},
+			Data: []byte{0xff},
+		},
+		IsKeyFrame: true,
+	},
+	{
+		Name:   "HEVC sequence start",
+		Binary: []byte{0x90, 'h', 'v', 'c', '1', 0x01},
+		Frame: VideoFrame{
+			VideoHeader: message.VideoHeader{
+				FrameType:  message.VideoFrameTypeKeyFrame,
+				IsExHeader: true,
+				FourCC:     message.FourCCHEVC,
+				PacketType: message.VideoPacketTypeSequenceStart,
+			},
+			Data: []byte{0x01},
+		},
+		IsKeyFrame:       false, // Not a key frame even if FrameType is KeyFrame
+		IsSequenceHeader: true,
+	},
+}
+
+func TestDecodeVideoFrame(t *testing.T) {
+	for _, tc := range videoFrameTestCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			var f VideoFrame
+			err := DecodeVideoFrame(bytes.NewReader(tc.Binary), &f)
+			require.Nil(t, err)
+			require.Equal(t, tc.Frame, f)
+			require.Equal(t, tc.IsKeyFrame, f.IsKeyFrame())
+			require.Equal(t, tc.IsSequenceHeader, f.IsSequenceHeader())
+
+			buf := new(bytes.Buffer)
+			err = EncodeVideoFrame(buf, &f)
+			require.Nil(t, err)
+			require.Equal(t, tc.Binary, buf.Bytes())
+		})
+	}
+}
+
+func TestDecodeVideoFramesMultitrack(t *testing.T) {
+	frame := VideoFrame{
+		VideoHeader: message.VideoHeader{
+			FrameType:       message.VideoFrameTypeKeyFrame,
+			IsExHeader:      true,
+			FourCC:          message.FourCCAVC,
+			PacketType:      message.VideoPacketTypeCodedFrames,
+			CompositionTime: 10,
+			IsMultitrack:    true,
+			MultitrackType:  message.AVMultitrackTypeOneTrack,
+		},
+		TrackID: 2,
+		Data:    []byte{0xff},
+	}
+
+	buf := new(bytes.Buffer)
+	err := EncodeVideoFrame(buf, &frame)
+	require.Nil(t, err)
+
+	var single VideoFrame
+	err = DecodeVideoFrame(bytes.NewReader(buf.Bytes()), &single)
+	require.Error(t, err)
+
+	frames, err := DecodeVideoFrames(bytes.NewReader(buf.Bytes()))
+	require.Nil(t, err)
+	require.Equal(t, []VideoFrame{frame}, frames)
+}
@@ -0,0 +1,231 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+
+	"github.com/yutopp/go-rtmp/media"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+// readPayload Reads a whole payload. It allocates only once if the reader knows the size.
+func readPayload(r io.Reader) ([]byte, error) {
+	if l, ok := r.(interface{ Len() int }); ok {
+		b := make([]byte, l.Len())
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	return ioutil.ReadAll(r)
+}
+
+type payloadState int
+
+const (
+	payloadStateRaw payloadState = iota
+	payloadStateHeaderDecoded
+	payloadStateTracksDecoded
+)
+
+// videoPayload A payload of a video message which is decoded lazily at most once, and shared by consumers such as
+// StreamInfo, HealthAnalyzer and handlers. Data of tracks and frames refer to data without copying.
+type videoPayload struct {
+	data []byte
+
+	header    message.VideoHeader
+	headerLen int
+	tracks    []message.VideoTrack
+	frames    []media.VideoFrame
+	state     payloadState
+	err       error
+}
+
+func (p *videoPayload) decodeHeader() (*message.VideoHeader, error) {
+	if p.state == payloadStateRaw && p.err == nil {
+		r := bytes.NewReader(p.data)
+		if err := message.DecodeVideoHeader(r, &p.header); err != nil {
+			p.err = errors.Wrap(err, "Failed to decode video header")
+		} else {
+			p.headerLen = len(p.data) - r.Len()
+			p.state = payloadStateHeaderDecoded
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return &p.header, nil
+}
+
+func (p *videoPayload) decodeTracks() (*message.VideoHeader, []message.VideoTrack, error) {
+	header, err := p.decodeHeader()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.state == payloadStateHeaderDecoded {
+		body := p.data[p.headerLen:]
+		if header.IsMultitrack {
+			tracks, err := message.DecodeVideoTracks(bytes.NewReader(body), header)
+			if err != nil {
+				p.err = errors.Wrap(err, "Failed to decode video tracks")
+				return nil, nil, p.err
+			}
+			p.tracks = tracks
+		} else {
+			p.tracks = []message.VideoTrack{
+				{
+					FourCC:          header.FourCC,
+					CompositionTime: header.CompositionTime,
+					Payload:         body,
+				},
+			}
+		}
+		p.state = payloadStateTracksDecoded
+	}
+
+	return header, p.tracks, nil
+}
+
+func (p *videoPayload) decodeFrames() ([]media.VideoFrame, error) {
+	header, tracks, err := p.decodeTracks()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.frames == nil {
+		p.frames = media.NewVideoFrames(header, tracks)
+	}
+
+	return p.frames, nil
+}
+
+// firstFrame Returns the first frame to know a type of the payload. Only headers are decoded if possible, so Data
+// may be empty.
+func (p *videoPayload) firstFrame() (media.VideoFrame, error) {
+	header, err := p.decodeHeader()
+	if err != nil {
+		return media.VideoFrame{}, err
+	}
+
+	if header.IsMultitrack && header.MultitrackType == message.AVMultitrackTypeManyTracksManyCodecs {
+		// Each track has a codec
+		frames, err := p.decodeFrames()
+		if err != nil {
+			return media.VideoFrame{}, err
+		}
+		if len(frames) == 0 {
+			return media.VideoFrame{}, errors.New("No video tracks")
+		}
+		return frames[0], nil
+	}
+
+	return media.VideoFrame{VideoHeader: *header}, nil
+}
+
+// audioPayload A payload of an audio message which is decoded lazily at most once, and shared by consumers such as
+// StreamInfo, HealthAnalyzer and handlers. Data of tracks and frames refer to data without copying.
+type audioPayload struct {
+	data []byte
+
+	header    message.AudioHeader
+	headerLen int
+	tracks    []message.AudioTrack
+	frames    []media.AudioFrame
+	state     payloadState
+	err       error
+}
+
+func (p *audioPayload) decodeHeader() (*message.AudioHeader, error) {
+	if p.state == payloadStateRaw && p.err == nil {
+		r := bytes.NewReader(p.data)
+		if err := message.DecodeAudioHeader(r, &p.header); err != nil {
+			p.err = errors.Wrap(err, "Failed to decode audio header")
+		} else {
+			p.headerLen = len(p.data) - r.Len()
+			p.state = payloadStateHeaderDecoded
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return &p.header, nil
+}
+
+func (p *audioPayload) decodeTracks() (*message.AudioHeader, []message.AudioTrack, error) {
+	header, err := p.decodeHeader()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.state == payloadStateHeaderDecoded {
+		body := p.data[p.headerLen:]
+		if header.IsMultitrack {
+			tracks, err := message.DecodeAudioTracks(bytes.NewReader(body), header)
+			if err != nil {
+				p.err = errors.Wrap(err, "Failed to decode audio tracks")
+				return nil, nil, p.err
+			}
+			p.tracks = tracks
+		} else {
+			p.tracks = []message.AudioTrack{
+				{
+					FourCC:  header.FourCC,
+					Payload: body,
+				},
+			}
+		}
+		p.state = payloadStateTracksDecoded
+	}
+
+	return header, p.tracks, nil
+}
+
+func (p *audioPayload) decodeFrames() ([]media.AudioFrame, error) {
+	header, tracks, err := p.decodeTracks()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.frames == nil {
+		p.frames = media.NewAudioFrames(header, tracks)
+	}
+
+	return p.frames, nil
+}
+
+// firstFrame Returns the first frame to know a type of the payload. Only headers are decoded if possible, so Data
+// may be empty.
+func (p *audioPayload) firstFrame() (media.AudioFrame, error) {
+	header, err := p.decodeHeader()
+	if err != nil {
+		return media.AudioFrame{}, err
+	}
+
+	if header.IsMultitrack && header.MultitrackType == message.AVMultitrackTypeManyTracksManyCodecs {
+		// Each track has a codec
+		frames, err := p.decodeFrames()
+		if err != nil {
+			return media.AudioFrame{}, err
+		}
+		if len(frames) == 0 {
+			return media.AudioFrame{}, errors.New("No audio tracks")
+		}
+		return frames[0], nil
+	}
+
+	return media.AudioFrame{AudioHeader: *header}, nil
+}
@@ -0,0 +1,211 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package message
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// AudioSoundFormat Sound formats of legacy FLV audio tags
+type AudioSoundFormat uint8
+
+const (
+	AudioSoundFormatLinearPCM           AudioSoundFormat = 0
+	AudioSoundFormatADPCM               AudioSoundFormat = 1
+	AudioSoundFormatMP3                 AudioSoundFormat = 2
+	AudioSoundFormatLinearPCMLE         AudioSoundFormat = 3
+	AudioSoundFormatNellymoser16kHz     AudioSoundFormat = 4
+	AudioSoundFormatNellymoser8kHz      AudioSoundFormat = 5
+	AudioSoundFormatNellymoser          AudioSoundFormat = 6
+	AudioSoundFormatG711ALaw            AudioSoundFormat = 7
+	AudioSoundFormatG711MuLaw           AudioSoundFormat = 8
+	AudioSoundFormatExHeader            AudioSoundFormat = 9 // Enhanced RTMP
+	AudioSoundFormatAAC                 AudioSoundFormat = 10
+	AudioSoundFormatSpeex               AudioSoundFormat = 11
+	AudioSoundFormatMP38kHz             AudioSoundFormat = 14
+	AudioSoundFormatDeviceSpecificSound AudioSoundFormat = 15
+)
+
+// FourCC returns a FourCC of the format. It returns 0 if the format has no corresponding FourCC.
+func (f AudioSoundFormat) FourCC() FourCC {
+	switch f {
+	case AudioSoundFormatAAC:
+		return FourCCAAC
+	case AudioSoundFormatMP3, AudioSoundFormatMP38kHz:
+		return FourCCMP3
+	default:
+		return 0
+	}
+}
+
+type AudioPacketType uint8
+
+const (
+	AudioPacketTypeSequenceStart      AudioPacketType = 0
+	AudioPacketTypeCodedFrames        AudioPacketType = 1
+	AudioPacketTypeSequenceEnd        AudioPacketType = 2
+	AudioPacketTypeMultichannelConfig AudioPacketType = 4
+	AudioPacketTypeMultitrack         AudioPacketType = 5
+	AudioPacketTypeModEx              AudioPacketType = 7
+)
+
+// AudioHeader A header of a payload of AudioMessage. Both of legacy FLV headers and Enhanced RTMP headers are handled.
+//
+// For legacy AAC headers, FourCC and PacketType are filled from SoundFormat and AACPacketType.
+type AudioHeader struct {
+	IsExHeader bool
+
+	// Legacy headers only
+	SoundFormat AudioSoundFormat
+	SoundRate   uint8
+	SoundSize   uint8
+	SoundType   uint8
+
+	FourCC              FourCC
+	PacketType          AudioPacketType
+	TimestampNanoOffset uint32 // Enhanced RTMP ModEx
+
+	// Enhanced RTMP multitrack. PacketType is a type for all tracks, and FourCC is empty for ManyTracksManyCodecs.
+	// Tracks follow the header. See DecodeAudioTracks.
+	IsMultitrack   bool
+	MultitrackType AVMultitrackType
+}
+
+// DecodeAudioHeader reads a header from r. A payload of the codec follows it in r.
+func DecodeAudioHeader(r io.Reader, h *AudioHeader) error {
+	var buf [4]byte
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return err
+	}
+
+	*h = AudioHeader{}
+
+	format := AudioSoundFormat(buf[0] >> 4)
+	if format != AudioSoundFormatExHeader {
+		return decodeLegacyAudioHeader(r, buf[0], h)
+	}
+
+	h.IsExHeader = true
+	h.SoundFormat = format
+
+	packetType := buf[0] & 0x0f
+	if packetType == packetTypeModEx {
+		pt, err := decodeModEx(r, &h.TimestampNanoOffset)
+		if err != nil {
+			return err
+		}
+		packetType = pt
+	}
+	h.PacketType = AudioPacketType(packetType)
+
+	if h.PacketType == AudioPacketTypeMultitrack {
+		if _, err := io.ReadFull(r, buf[:1]); err != nil {
+			return err
+		}
+		h.IsMultitrack = true
+		h.MultitrackType = AVMultitrackType(buf[0] >> 4)
+		h.PacketType = AudioPacketType(buf[0] & 0x0f)
+
+		if h.PacketType == AudioPacketTypeMultitrack {
+			return errors.New("Nested multitrack audio packets are not allowed")
+		}
+		if h.MultitrackType == AVMultitrackTypeManyTracksManyCodecs {
+			return nil // Each track has a FourCC
+		}
+	}
+
+	if _, err := io.ReadFull(r, buf[:4]); err != nil {
+		return err
+	}
+	h.FourCC = FourCC(binary.BigEndian.Uint32(buf[:4]))
+
+	return nil
+}
+
+func decodeLegacyAudioHeader(r io.Reader, b byte, h *AudioHeader) error {
+	h.SoundFormat = AudioSoundFormat(b >> 4)
+	h.SoundRate = (b >> 2) & 0x03
+	h.SoundSize = (b >> 1) & 0x01
+	h.SoundType = b & 0x01
+	h.FourCC = h.SoundFormat.FourCC()
+	h.PacketType = AudioPacketTypeCodedFrames
+
+	if h.SoundFormat != AudioSoundFormatAAC {
+		return nil
+	}
+
+	// AACPacketType (0: sequence header, 1: raw)
+	var buf [1]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return err
+	}
+	h.PacketType = AudioPacketType(buf[0])
+
+	return nil
+}
+
+// EncodeAudioHeader writes a header to w. A legacy header is written if IsExHeader is false.
+func EncodeAudioHeader(w io.Writer, h *AudioHeader) error {
+	if !h.IsExHeader {
+		return encodeLegacyAudioHeader(w, h)
+	}
+
+	if h.PacketType == AudioPacketTypeMultitrack {
+		return errors.New("Set IsMultitrack to write multitrack audio packets")
+	}
+
+	packetType := h.PacketType
+	if h.IsMultitrack {
+		packetType = AudioPacketTypeMultitrack
+	}
+
+	head := byte(AudioSoundFormatExHeader) << 4
+	if h.TimestampNanoOffset != 0 {
+		if _, err := w.Write([]byte{head | packetTypeModEx}); err != nil {
+			return err
+		}
+		if err := encodeModEx(w, h.TimestampNanoOffset, uint8(packetType)); err != nil {
+			return err
+		}
+	} else {
+		if _, err := w.Write([]byte{head | byte(packetType&0x0f)}); err != nil {
+			return err
+		}
+	}
+
+	if h.IsMultitrack {
+		if _, err := w.Write([]byte{byte(h.MultitrackType)<<4 | byte(h.PacketType&0x0f)}); err != nil {
+			return err
+		}
+		if h.MultitrackType == AVMultitrackTypeManyTracksManyCodecs {
+			return nil
+		}
+	}
+
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(h.FourCC))
+	_, err := w.Write(buf[:])
+	return err
+}
+
+func encodeLegacyAudioHeader(w io.Writer, h *AudioHeader) error {
+	b := byte(h.SoundFormat)<<4 | (h.SoundRate&0x03)<<2 | (h.SoundSize&0x01)<<1 | h.SoundType&0x01
+	if _, err := w.Write([]byte{b}); err != nil {
+		return err
+	}
+
+	if h.SoundFormat != AudioSoundFormatAAC {
+		return nil
+	}
+
+	_, err := w.Write([]byte{byte(h.PacketType)})
+	return err
+}
@@ -0,0 +1,112 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package message
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type audioHeaderTestCase struct {
+	Name   string
+	Binary []byte
+	Header AudioHeader
+}
+
+var audioHeaderTestCases = []audioHeaderTestCase{
+	{
+		Name:   "Legacy AAC sequence header",
+		Binary: []byte{0xaf, 0x00},
+		Header: AudioHeader{
+			SoundFormat: AudioSoundFormatAAC,
+			SoundRate:   3,
+			SoundSize:   1,
+			SoundType:   1,
+			FourCC:      FourCCAAC,
+			PacketType:  AudioPacketTypeSequenceStart,
+		},
+	},
+	{
+		Name:   "Legacy MP3",
+		Binary: []byte{0x2e},
+		Header: AudioHeader{
+			SoundFormat: AudioSoundFormatMP3,
+			SoundRate:   3,
+			SoundSize:   1,
+			FourCC:      FourCCMP3,
+			PacketType:  AudioPacketTypeCodedFrames,
+		},
+	},
+	{
+		Name:   "Opus sequence start",
+		Binary: []byte{0x90, 'O', 'p', 'u', 's'},
+		Header: AudioHeader{
+			IsExHeader:  true,
+			SoundFormat: AudioSoundFormatExHeader,
+			FourCC:      FourCCOpus,
+			PacketType:  AudioPacketTypeSequenceStart,
+		},
+	},
+	{
+		Name:   "FLAC coded frames",
+		Binary: []byte{0x91, 'f', 'L', 'a', 'C'},
+		Header: AudioHeader{
+			IsExHeader:  true,
+			SoundFormat: AudioSoundFormatExHeader,
+			FourCC:      FourCCFLAC,
+			PacketType:  AudioPacketTypeCodedFrames,
+		},
+	},
+	{
+		Name:   "AC-3 with timestamp offset",
+		Binary: []byte{0x97, 0x02, 0x00, 0x01, 0x00, 0x01, 'a', 'c', '-', '3'},
+		Header: AudioHeader{
+			IsExHeader:          true,
+			SoundFormat:         AudioSoundFormatExHeader,
+			FourCC:              FourCCAC3,
+			PacketType:          AudioPacketTypeCodedFrames,
+			TimestampNanoOffset: 256,
+		},
+	},
+}
+
+func TestAudioHeader(t *testing.T) {
+	for _, tc := range audioHeaderTestCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			payload := append(append([]byte{}, tc.Binary...), 0xde, 0xad)
+			r := bytes.NewReader(payload)
+
+			var h AudioHeader
+			err := DecodeAudioHeader(r, &h)
+			require.Nil(t, err)
+			require.Equal(t, tc.Header, h)
+			require.Equal(t, 2, r.Len()) // Only a payload remains
+
+			buf := new(bytes.Buffer)
+			err = EncodeAudioHeader(buf, &tc.Header)
+			require.Nil(t, err)
+			require.Equal(t, tc.Binary, buf.Bytes())
+		})
+	}
+}
+
+func TestParseFourCC(t *testing.T) {
+	f, err := ParseFourCC("hvc1")
+	require.Nil(t, err)
+	require.Equal(t, FourCCHEVC, f)
+	require.Equal(t, "hvc1", f.String())
+
+	_, err = ParseFourCC("*")
+	require.Error(t, err)
+}
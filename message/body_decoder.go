@@ -18,6 +18,7 @@ type BodyDecoderFunc func(r io.Reader, e AMFDecoder, v *AMFConvertible) error
 
 var DataBodyDecoders = map[string]BodyDecoderFunc{
 	"@setDataFrame": DecodeBodyAtSetDataFrame,
+	"onPlayStatus":  DecodeBodyOnPlayStatus,
 }
 
 func DataBodyDecoderFor(name string) BodyDecoderFunc {
@@ -59,18 +60,42 @@ func DecodeBodyAtSetDataFrame(r io.Reader, _ AMFDecoder, v *AMFConvertible) erro
 	return nil
 }
 
+func DecodeBodyOnPlayStatus(_ io.Reader, d AMFDecoder, v *AMFConvertible) error {
+	var infoObject interface{}
+	if err := d.Decode(&infoObject); err != nil {
+		return errors.Wrap(err, "Failed to decode 'onPlayStatus' args[0]")
+	}
+
+	var data NetStreamOnPlayStatus
+	if err := data.FromArgs(infoObject); err != nil {
+		return errors.Wrap(err, "Failed to reconstruct 'onPlayStatus'")
+	}
+
+	*v = &data
+	return nil
+}
+
 var CmdBodyDecoders = map[string]BodyDecoderFunc{
 	"connect":         DecodeBodyConnect,
 	"createStream":    DecodeBodyCreateStream,
 	"deleteStream":    DecodeBodyDeleteStream,
 	"publish":         DecodeBodyPublish,
 	"play":            DecodeBodyPlay,
+	"seek":            DecodeBodySeek,
+	"pause":           DecodeBodyPause,
 	"releaseStream":   DecodeBodyReleaseStream,
 	"FCPublish":       DecodeBodyFCPublish,
 	"FCUnpublish":     DecodeBodyFCUnpublish,
 	"getStreamLength": DecodeBodyGetStreamLength,
 	"ping":            DecodeBodyPing,
 	"closeStream":     DecodeBodyCloseStream,
+	"onStatus":        DecodeBodyOnStatus,
+	"checkBandwidth":  DecodeBodyCheckBandwidth,
+	"_checkbw":        DecodeBodyCheckBandwidth,
+	"onBWCheck":       DecodeBodyOnBWCheck,
+	"_onbwcheck":      DecodeBodyOnBWCheck,
+	"onBWDone":        DecodeBodyOnBWDone,
+	"_onbwdone":       DecodeBodyOnBWDone,
 }
 
 func CmdBodyDecoderFor(name string, transactionID int64) BodyDecoderFunc {
@@ -239,8 +264,16 @@ func DecodeBodyPlay(_ io.Reader, d AMFDecoder, v *AMFConvertible) error {
 		start = 0
 	}
 
+	args := []interface{}{commandObject, streamName, start}
+	var duration int64
+	if err := d.Decode(&duration); err == nil {
+		args = append(args, duration)
+	} else if err != io.EOF {
+		return errors.Wrap(err, "Failed to decode 'play' args[3]")
+	}
+
 	var cmd NetStreamPlay
-	if err := cmd.FromArgs(commandObject, streamName, start); err != nil {
+	if err := cmd.FromArgs(args...); err != nil {
 		return errors.Wrap(err, "Failed to reconstruct 'play'")
 	}
 
@@ -248,6 +281,52 @@ func DecodeBodyPlay(_ io.Reader, d AMFDecoder, v *AMFConvertible) error {
 	return nil
 }
 
+func DecodeBodySeek(_ io.Reader, d AMFDecoder, v *AMFConvertible) error {
+	var commandObject interface{}
+	if err := d.Decode(&commandObject); err != nil {
+		return errors.Wrap(err, "Failed to decode 'seek' args[0]")
+	}
+	var milliseconds int64
+	if err := d.Decode(&milliseconds); err != nil {
+		return errors.Wrap(err, "Failed to decode 'seek' args[1]")
+	}
+
+	var cmd NetStreamSeek
+	if err := cmd.FromArgs(commandObject, milliseconds); err != nil {
+		return errors.Wrap(err, "Failed to reconstruct 'seek'")
+	}
+
+	*v = &cmd
+	return nil
+}
+
+func DecodeBodyPause(_ io.Reader, d AMFDecoder, v *AMFConvertible) error {
+	var commandObject interface{}
+	if err := d.Decode(&commandObject); err != nil {
+		return errors.Wrap(err, "Failed to decode 'pause' args[0]")
+	}
+	var pause bool
+	if err := d.Decode(&pause); err != nil {
+		return errors.Wrap(err, "Failed to decode 'pause' args[1]")
+	}
+	var milliseconds int64
+	if err := d.Decode(&milliseconds); err != nil {
+		// io.EOF occurs when the position is not specified. e.g. 'NetStream.pause()'
+		if err != io.EOF {
+			return errors.Wrap(err, "Failed to decode 'pause' args[2]")
+		}
+		milliseconds = 0
+	}
+
+	var cmd NetStreamPause
+	if err := cmd.FromArgs(commandObject, pause, milliseconds); err != nil {
+		return errors.Wrap(err, "Failed to reconstruct 'pause'")
+	}
+
+	*v = &cmd
+	return nil
+}
+
 func DecodeBodyReleaseStream(_ io.Reader, d AMFDecoder, v *AMFConvertible) error {
 	var commandObject interface{} // maybe nil
 	if err := d.Decode(&commandObject); err != nil {
@@ -324,6 +403,25 @@ func DecodeBodyGetStreamLength(_ io.Reader, d AMFDecoder, v *AMFConvertible) err
 	return nil
 }
 
+func DecodeBodyGetStreamLengthResult(_ io.Reader, d AMFDecoder, v *AMFConvertible) error {
+	var commandObject interface{} // maybe nil
+	if err := d.Decode(&commandObject); err != nil {
+		return errors.Wrap(err, "Failed to decode 'getStreamLength.result' args[0]")
+	}
+	var duration float64
+	if err := d.Decode(&duration); err != nil {
+		return errors.Wrap(err, "Failed to decode 'getStreamLength.result' args[1]")
+	}
+
+	var data NetStreamGetStreamLengthResult
+	if err := data.FromArgs(commandObject, duration); err != nil {
+		return errors.Wrap(err, "Failed to reconstruct 'getStreamLength.result'")
+	}
+
+	*v = &data
+	return nil
+}
+
 func DecodeBodyPing(_ io.Reader, d AMFDecoder, v *AMFConvertible) error { // NLE
 	var commandObject interface{} // maybe nil
 	if err := d.Decode(&commandObject); err != nil {
@@ -354,3 +452,85 @@ func DecodeBodyCloseStream(_ io.Reader, d AMFDecoder, v *AMFConvertible) error {
 
 	return nil
 }
+
+func DecodeBodyOnStatus(_ io.Reader, d AMFDecoder, v *AMFConvertible) error {
+	var commandObject interface{} // maybe nil
+	if err := d.Decode(&commandObject); err != nil {
+		return errors.Wrap(err, "Failed to decode 'onStatus' args[0]")
+	}
+	var infoObject interface{}
+	if err := d.Decode(&infoObject); err != nil {
+		return errors.Wrap(err, "Failed to decode 'onStatus' args[1]")
+	}
+
+	var cmd NetStreamOnStatus
+	if err := cmd.FromArgs(commandObject, infoObject); err != nil {
+		return errors.Wrap(err, "Failed to reconstruct 'onStatus'")
+	}
+
+	*v = &cmd
+
+	return nil
+}
+
+func DecodeBodyCheckBandwidth(_ io.Reader, d AMFDecoder, v *AMFConvertible) error {
+	args := decodeBodyArgs(d) // The command object may be omitted
+
+	var cmd NetConnectionCheckBandwidth
+	if err := cmd.FromArgs(args...); err != nil {
+		return errors.Wrap(err, "Failed to reconstruct 'checkBandwidth'")
+	}
+
+	*v = &cmd
+	return nil
+}
+
+func DecodeBodyOnBWCheck(_ io.Reader, d AMFDecoder, v *AMFConvertible) error {
+	args := decodeBodyArgs(d)
+
+	var cmd NetConnectionOnBWCheck
+	if err := cmd.FromArgs(args...); err != nil {
+		return errors.Wrap(err, "Failed to reconstruct 'onBWCheck'")
+	}
+
+	*v = &cmd
+	return nil
+}
+
+func DecodeBodyOnBWCheckResult(_ io.Reader, d AMFDecoder, v *AMFConvertible) error {
+	args := decodeBodyArgs(d)
+
+	var data NetConnectionOnBWCheckResult
+	if err := data.FromArgs(args...); err != nil {
+		return errors.Wrap(err, "Failed to reconstruct 'onBWCheck.result'")
+	}
+
+	*v = &data
+	return nil
+}
+
+func DecodeBodyOnBWDone(_ io.Reader, d AMFDecoder, v *AMFConvertible) error {
+	args := decodeBodyArgs(d)
+
+	var cmd NetConnectionOnBWDone
+	if err := cmd.FromArgs(args...); err != nil {
+		return errors.Wrap(err, "Failed to reconstruct 'onBWDone'")
+	}
+
+	*v = &cmd
+	return nil
+}
+
+// decodeBodyArgs Decodes all values of a body. It is used for commands whose arguments differ among implementations.
+func decodeBodyArgs(d AMFDecoder) []interface{} {
+	args := make([]interface{}, 0)
+	for {
+		var tmp interface{}
+		if err := d.Decode(&tmp); err != nil {
+			break
+		}
+		args = append(args, tmp)
+	}
+
+	return args
+}
@@ -149,6 +149,89 @@ func TestDecodeCmdMessagePlay(t *testing.T) {
 	require.Equal(t, &NetStreamPlay{
 		StreamName: "abc",
 		Start:      42,
+		Duration:   -1,
+	}, v)
+}
+
+func TestDecodeCmdMessagePlayWithDuration(t *testing.T) {
+	bin := []byte{
+		// nil
+		0x05,
+		// string: abc
+		0x02, 0x00, 0x03, 0x61, 0x62, 0x63,
+		// number: 42
+		0x00, 0x40, 0x45, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// number: 1000
+		0x00, 0x40, 0x8f, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	r := bytes.NewReader(bin)
+	d := amf0.NewDecoder(r)
+
+	var v AMFConvertible
+	err := CmdBodyDecoderFor("play", 42)(r, d, &v)
+	require.Nil(t, err)
+	require.Equal(t, &NetStreamPlay{
+		StreamName: "abc",
+		Start:      42,
+		Duration:   1000,
+	}, v)
+}
+
+func TestDecodeCmdMessageSeek(t *testing.T) {
+	bin := []byte{
+		// nil
+		0x05,
+		// number: 1000
+		0x00, 0x40, 0x8f, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	r := bytes.NewReader(bin)
+	d := amf0.NewDecoder(r)
+
+	var v AMFConvertible
+	err := CmdBodyDecoderFor("seek", 42)(r, d, &v)
+	require.Nil(t, err)
+	require.Equal(t, &NetStreamSeek{
+		Milliseconds: 1000,
+	}, v)
+}
+
+func TestDecodeCmdMessagePause(t *testing.T) {
+	bin := []byte{
+		// nil
+		0x05,
+		// boolean: true
+		0x01, 0x01,
+		// number: 1000
+		0x00, 0x40, 0x8f, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	r := bytes.NewReader(bin)
+	d := amf0.NewDecoder(r)
+
+	var v AMFConvertible
+	err := CmdBodyDecoderFor("pause", 42)(r, d, &v)
+	require.Nil(t, err)
+	require.Equal(t, &NetStreamPause{
+		Pause:        true,
+		Milliseconds: 1000,
+	}, v)
+}
+
+func TestDecodeCmdMessagePauseWithoutMilliseconds(t *testing.T) {
+	bin := []byte{
+		// nil
+		0x05,
+		// boolean: false
+		0x01, 0x00,
+	}
+	r := bytes.NewReader(bin)
+	d := amf0.NewDecoder(r)
+
+	var v AMFConvertible
+	err := CmdBodyDecoderFor("pause", 42)(r, d, &v)
+	require.Nil(t, err)
+	require.Equal(t, &NetStreamPause{
+		Pause:        false,
+		Milliseconds: 0,
 	}, v)
 }
 
@@ -269,3 +352,65 @@ func TestDecodeCmdMessageUnknown(t *testing.T) {
 	}, err)
 	require.Nil(t, v)
 }
+
+func TestDecodeCmdMessageOnStatus(t *testing.T) {
+	buf := new(bytes.Buffer)
+	e := amf0.NewEncoder(buf)
+	require.Nil(t, e.Encode(nil))
+	require.Nil(t, e.Encode(map[string]interface{}{
+		"level":       "status",
+		"code":        "NetConnection.Connect.ReconnectRequest",
+		"description": "Reconnect",
+		"tcUrl":       "rtmp://example.com/app",
+	}))
+
+	r := bytes.NewReader(buf.Bytes())
+	d := amf0.NewDecoder(r)
+
+	var v AMFConvertible
+	err := CmdBodyDecoderFor("onStatus", 0)(r, d, &v)
+	require.Nil(t, err)
+	require.Equal(t, &NetStreamOnStatus{
+		InfoObject: NetStreamOnStatusInfoObject{
+			Level:       NetStreamOnStatusLevelStatus,
+			Code:        NetStreamOnStatusCode(NetConnectionConnectCodeReconnectRequest),
+			Description: "Reconnect",
+			TCURL:       "rtmp://example.com/app",
+		},
+	}, v)
+}
+
+func TestDecodeCmdMessageOnBWDone(t *testing.T) {
+	buf := new(bytes.Buffer)
+	e := amf0.NewEncoder(buf)
+	require.Nil(t, e.Encode(nil))
+	require.Nil(t, e.Encode(float64(8192))) // Only kbitDown is sent by some servers
+
+	r := bytes.NewReader(buf.Bytes())
+	d := amf0.NewDecoder(r)
+
+	var v AMFConvertible
+	err := CmdBodyDecoderFor("onBWDone", 0)(r, d, &v)
+	require.Nil(t, err)
+	require.Equal(t, &NetConnectionOnBWDone{
+		KbitDown: 8192,
+	}, v)
+}
+
+func TestDecodeCmdMessageOnBWCheck(t *testing.T) {
+	cmd := &NetConnectionOnBWCheck{
+		Payload: "xxxx",
+	}
+
+	buf := new(bytes.Buffer)
+	err := EncodeBodyAnyValues(amf0.NewEncoder(buf), cmd)
+	require.Nil(t, err)
+
+	r := bytes.NewReader(buf.Bytes())
+	d := amf0.NewDecoder(r)
+
+	var v AMFConvertible
+	err = CmdBodyDecoderFor("_onbwcheck", 42)(r, d, &v)
+	require.Nil(t, err)
+	require.Equal(t, cmd, v)
+}
@@ -0,0 +1,146 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package message
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// FourCC A codec identifier of Enhanced RTMP.
+type FourCC uint32
+
+const (
+	// Video
+	FourCCAVC  FourCC = 'a'<<24 | 'v'<<16 | 'c'<<8 | '1'
+	FourCCHEVC FourCC = 'h'<<24 | 'v'<<16 | 'c'<<8 | '1'
+	FourCCAV1  FourCC = 'a'<<24 | 'v'<<16 | '0'<<8 | '1'
+	FourCCVP8  FourCC = 'v'<<24 | 'p'<<16 | '0'<<8 | '8'
+	FourCCVP9  FourCC = 'v'<<24 | 'p'<<16 | '0'<<8 | '9'
+
+	// Audio
+	FourCCAAC  FourCC = 'm'<<24 | 'p'<<16 | '4'<<8 | 'a'
+	FourCCMP3  FourCC = '.'<<24 | 'm'<<16 | 'p'<<8 | '3'
+	FourCCOpus FourCC = 'O'<<24 | 'p'<<16 | 'u'<<8 | 's'
+	FourCCFLAC FourCC = 'f'<<24 | 'L'<<16 | 'a'<<8 | 'C'
+	FourCCAC3  FourCC = 'a'<<24 | 'c'<<16 | '-'<<8 | '3'
+	FourCCEAC3 FourCC = 'e'<<24 | 'c'<<16 | '-'<<8 | '3'
+)
+
+// FourCCWildcard can be used in fourCcList to represent any codecs. e.g. servers which forward media as it is.
+const FourCCWildcard = "*"
+
+// ParseFourCC converts a string such as "hvc1" into FourCC.
+func ParseFourCC(s string) (FourCC, error) {
+	if len(s) != 4 {
+		return 0, errors.Errorf("Invalid FourCC: Value = %s", s)
+	}
+
+	return FourCC(binary.BigEndian.Uint32([]byte(s))), nil
+}
+
+func (f FourCC) String() string {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(f))
+	return string(b[:])
+}
+
+// FourCcInfo Flags of videoFourCcInfoMap/audioFourCcInfoMap in connect
+const (
+	FourCcInfoCanDecode  = 0x01
+	FourCcInfoCanEncode  = 0x02
+	FourCcInfoCanForward = 0x04
+)
+
+// CapsEx Extended capabilities in connect
+const (
+	CapsExReconnect           = 0x01
+	CapsExMultitrack          = 0x02
+	CapsExModEx               = 0x04
+	CapsExTimestampNanoOffset = 0x08
+)
+
+const (
+	packetTypeModEx = 7 // Same value in both of video and audio
+
+	packetModExTypeTimestampOffsetNano = 0
+)
+
+// decodeModEx Reads ModEx data until a packet type other than ModEx is found.
+func decodeModEx(r io.Reader, timestampNanoOffset *uint32) (uint8, error) {
+	var buf [3]byte
+	for {
+		if _, err := io.ReadFull(r, buf[:1]); err != nil {
+			return 0, err
+		}
+		size := int(buf[0]) + 1
+		if size == 256 {
+			if _, err := io.ReadFull(r, buf[:2]); err != nil {
+				return 0, err
+			}
+			size = int(binary.BigEndian.Uint16(buf[:2])) + 1
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return 0, err
+		}
+
+		if _, err := io.ReadFull(r, buf[:1]); err != nil {
+			return 0, err
+		}
+		modExType, packetType := buf[0]>>4, buf[0]&0x0f
+
+		if modExType == packetModExTypeTimestampOffsetNano && len(data) >= 3 {
+			*timestampNanoOffset = uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2])
+		}
+
+		if packetType != packetTypeModEx {
+			return packetType, nil
+		}
+	}
+}
+
+// encodeModEx Writes a timestamp offset as ModEx data. The following packet type is packetType.
+func encodeModEx(w io.Writer, timestampNanoOffset uint32, packetType uint8) error {
+	buf := []byte{
+		3 - 1, // size - 1
+		byte(timestampNanoOffset >> 16), byte(timestampNanoOffset >> 8), byte(timestampNanoOffset),
+		packetModExTypeTimestampOffsetNano<<4 | packetType&0x0f,
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func readSI24(r io.Reader) (int32, error) {
+	var buf [3]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+
+	return parseSI24(buf[:]), nil
+}
+
+func parseSI24(b []byte) int32 {
+	v := int32(b[0])<<16 | int32(b[1])<<8 | int32(b[2])
+	if v&0x800000 != 0 {
+		v -= 1 << 24
+	}
+	return v
+}
+
+func writeSI24(w io.Writer, v int32) error {
+	_, err := w.Write(si24Bytes(v))
+	return err
+}
+
+func si24Bytes(v int32) []byte {
+	return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+}
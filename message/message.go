@@ -8,6 +8,7 @@
 package message
 
 import (
+	"fmt"
 	"io"
 )
 
@@ -31,6 +32,44 @@ const (
 	TypeIDAggregateMessage        TypeID = 22
 )
 
+// String returns a name of the type in snake_case. e.g. "command_amf0"
+func (id TypeID) String() string {
+	switch id {
+	case TypeIDSetChunkSize:
+		return "set_chunk_size"
+	case TypeIDAbortMessage:
+		return "abort"
+	case TypeIDAck:
+		return "ack"
+	case TypeIDUserCtrl:
+		return "user_control"
+	case TypeIDWinAckSize:
+		return "win_ack_size"
+	case TypeIDSetPeerBandwidth:
+		return "set_peer_bandwidth"
+	case TypeIDAudioMessage:
+		return "audio"
+	case TypeIDVideoMessage:
+		return "video"
+	case TypeIDDataMessageAMF3:
+		return "data_amf3"
+	case TypeIDSharedObjectMessageAMF3:
+		return "shared_object_amf3"
+	case TypeIDCommandMessageAMF3:
+		return "command_amf3"
+	case TypeIDDataMessageAMF0:
+		return "data_amf0"
+	case TypeIDSharedObjectMessageAMF0:
+		return "shared_object_amf0"
+	case TypeIDCommandMessageAMF0:
+		return "command_amf0"
+	case TypeIDAggregateMessage:
+		return "aggregate"
+	default:
+		return fmt.Sprintf("unknown_%d", byte(id))
+	}
+}
+
 // Message
 type Message interface {
 	TypeID() TypeID
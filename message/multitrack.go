@@ -0,0 +1,270 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package message
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// AVMultitrackType Types of Enhanced RTMP multitrack packets
+type AVMultitrackType uint8
+
+const (
+	AVMultitrackTypeOneTrack             AVMultitrackType = 0 // A track with a track ID
+	AVMultitrackTypeManyTracks           AVMultitrackType = 1 // Tracks of the same codec
+	AVMultitrackTypeManyTracksManyCodecs AVMultitrackType = 2 // Tracks of different codecs
+)
+
+// VideoTrack A video track in a packet. Packets which are not multitrack have a track whose ID is 0.
+type VideoTrack struct {
+	TrackID         uint8
+	FourCC          FourCC
+	CompositionTime int32 // AVC and HEVC only
+	Payload         []byte
+}
+
+// AudioTrack An audio track in a packet. Packets which are not multitrack have a track whose ID is 0.
+type AudioTrack struct {
+	TrackID uint8
+	FourCC  FourCC
+	Payload []byte
+}
+
+// DecodeVideoTracks reads tracks which follow a header decoded by DecodeVideoHeader.
+func DecodeVideoTracks(r io.Reader, h *VideoHeader) ([]VideoTrack, error) {
+	if !h.IsMultitrack {
+		payload, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return []VideoTrack{
+			{
+				FourCC:          h.FourCC,
+				CompositionTime: h.CompositionTime,
+				Payload:         payload,
+			},
+		}, nil
+	}
+
+	var tracks []VideoTrack
+	for {
+		track := VideoTrack{
+			FourCC: h.FourCC,
+		}
+
+		data, ok, err := decodeTrack(r, h.MultitrackType, &track.FourCC, &track.TrackID, len(tracks) == 0)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		if h.PacketType == VideoPacketTypeCodedFrames && hasCompositionTime(track.FourCC) {
+			if len(data) < 3 {
+				return nil, errors.Errorf("Composition time is missing: TrackID = %d", track.TrackID)
+			}
+			track.CompositionTime = parseSI24(data)
+			data = data[3:]
+		}
+		track.Payload = data
+
+		tracks = append(tracks, track)
+		if h.MultitrackType == AVMultitrackTypeOneTrack {
+			break
+		}
+	}
+
+	return tracks, nil
+}
+
+// EncodeVideoTracks writes a multitrack header and tracks. h.IsMultitrack must be true.
+func EncodeVideoTracks(w io.Writer, h *VideoHeader, tracks []VideoTrack) error {
+	if err := validateTracks(h.IsMultitrack, h.MultitrackType, len(tracks)); err != nil {
+		return err
+	}
+
+	if err := EncodeVideoHeader(w, h); err != nil {
+		return err
+	}
+
+	for _, track := range tracks {
+		data := track.Payload
+		if h.PacketType == VideoPacketTypeCodedFrames && hasCompositionTime(codecOfTrack(h.MultitrackType, h.FourCC, track.FourCC)) {
+			data = append(si24Bytes(track.CompositionTime), data...)
+		}
+
+		if err := encodeTrack(w, h.MultitrackType, track.FourCC, track.TrackID, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DecodeAudioTracks reads tracks which follow a header decoded by DecodeAudioHeader.
+func DecodeAudioTracks(r io.Reader, h *AudioHeader) ([]AudioTrack, error) {
+	if !h.IsMultitrack {
+		payload, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return []AudioTrack{
+			{
+				FourCC:  h.FourCC,
+				Payload: payload,
+			},
+		}, nil
+	}
+
+	var tracks []AudioTrack
+	for {
+		track := AudioTrack{
+			FourCC: h.FourCC,
+		}
+
+		data, ok, err := decodeTrack(r, h.MultitrackType, &track.FourCC, &track.TrackID, len(tracks) == 0)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		track.Payload = data
+
+		tracks = append(tracks, track)
+		if h.MultitrackType == AVMultitrackTypeOneTrack {
+			break
+		}
+	}
+
+	return tracks, nil
+}
+
+// EncodeAudioTracks writes a multitrack header and tracks. h.IsMultitrack must be true.
+func EncodeAudioTracks(w io.Writer, h *AudioHeader, tracks []AudioTrack) error {
+	if err := validateTracks(h.IsMultitrack, h.MultitrackType, len(tracks)); err != nil {
+		return err
+	}
+
+	if err := EncodeAudioHeader(w, h); err != nil {
+		return err
+	}
+
+	for _, track := range tracks {
+		if err := encodeTrack(w, h.MultitrackType, track.FourCC, track.TrackID, track.Payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateTracks(isMultitrack bool, ty AVMultitrackType, n int) error {
+	if !isMultitrack {
+		return errors.New("Header is not multitrack")
+	}
+	if n == 0 {
+		return errors.New("No tracks")
+	}
+	if ty == AVMultitrackTypeOneTrack && n != 1 {
+		return errors.Errorf("OneTrack must have only one track: Len = %d", n)
+	}
+	return nil
+}
+
+// decodeTrack Reads a FourCC (ManyTracksManyCodecs only), a track ID, a size (except OneTrack) and data.
+// ok is false if there are no more tracks.
+func decodeTrack(r io.Reader, ty AVMultitrackType, fourCC *FourCC, trackID *uint8, first bool) ([]byte, bool, error) {
+	var buf [4]byte
+
+	// Returns ok = false if reached to the end between tracks
+	readHead := func(b []byte) (bool, error) {
+		n, err := io.ReadFull(r, b)
+		if err == io.EOF && n == 0 && !first {
+			return false, nil
+		}
+		first = false
+		return true, err
+	}
+
+	if ty == AVMultitrackTypeManyTracksManyCodecs {
+		ok, err := readHead(buf[:4])
+		if !ok || err != nil {
+			return nil, ok, err
+		}
+		*fourCC = FourCC(binary.BigEndian.Uint32(buf[:4]))
+	}
+
+	ok, err := readHead(buf[:1])
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	*trackID = buf[0]
+
+	if ty == AVMultitrackTypeOneTrack {
+		data, err := ioutil.ReadAll(r)
+		return data, true, err
+	}
+
+	if _, err := io.ReadFull(r, buf[:3]); err != nil {
+		return nil, false, err
+	}
+	size := int(buf[0])<<16 | int(buf[1])<<8 | int(buf[2])
+
+	// Not to allocate a declared size in advance, which may be larger than the message
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(size)))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) != size {
+		return nil, false, io.ErrUnexpectedEOF
+	}
+
+	return data, true, nil
+}
+
+func encodeTrack(w io.Writer, ty AVMultitrackType, fourCC FourCC, trackID uint8, data []byte) error {
+	var buf [4]byte
+	if ty == AVMultitrackTypeManyTracksManyCodecs {
+		binary.BigEndian.PutUint32(buf[:], uint32(fourCC))
+		if _, err := w.Write(buf[:4]); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.Write([]byte{trackID}); err != nil {
+		return err
+	}
+
+	if ty != AVMultitrackTypeOneTrack {
+		if len(data) > 0xffffff {
+			return errors.Errorf("Track is too large: Size = %d", len(data))
+		}
+		size := []byte{byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data))}
+		if _, err := w.Write(size); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(data)
+	return err
+}
+
+func codecOfTrack(ty AVMultitrackType, shared, own FourCC) FourCC {
+	if ty == AVMultitrackTypeManyTracksManyCodecs {
+		return own
+	}
+	return shared
+}
@@ -0,0 +1,159 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package message
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVideoTracks(t *testing.T) {
+	type testCase struct {
+		Name   string
+		Header VideoHeader
+		Tracks []VideoTrack
+	}
+
+	testCases := []testCase{
+		{
+			Name: "OneTrack",
+			Header: VideoHeader{
+				FrameType:      VideoFrameTypeKeyFrame,
+				IsExHeader:     true,
+				FourCC:         FourCCHEVC,
+				PacketType:     VideoPacketTypeCodedFrames,
+				IsMultitrack:   true,
+				MultitrackType: AVMultitrackTypeOneTrack,
+			},
+			Tracks: []VideoTrack{
+				{TrackID: 2, FourCC: FourCCHEVC, CompositionTime: 40, Payload: []byte{0x01, 0x02}},
+			},
+		},
+		{
+			Name: "ManyTracks",
+			Header: VideoHeader{
+				FrameType:      VideoFrameTypeInterFrame,
+				IsExHeader:     true,
+				FourCC:         FourCCAV1,
+				PacketType:     VideoPacketTypeCodedFrames,
+				IsMultitrack:   true,
+				MultitrackType: AVMultitrackTypeManyTracks,
+			},
+			Tracks: []VideoTrack{
+				{TrackID: 0, FourCC: FourCCAV1, Payload: []byte{0x01}},
+				{TrackID: 1, FourCC: FourCCAV1, Payload: []byte{0x02, 0x03}},
+			},
+		},
+		{
+			Name: "ManyTracksManyCodecs",
+			Header: VideoHeader{
+				FrameType:           VideoFrameTypeKeyFrame,
+				IsExHeader:          true,
+				PacketType:          VideoPacketTypeCodedFrames,
+				TimestampNanoOffset: 100,
+				IsMultitrack:        true,
+				MultitrackType:      AVMultitrackTypeManyTracksManyCodecs,
+			},
+			Tracks: []VideoTrack{
+				{TrackID: 0, FourCC: FourCCAVC, CompositionTime: -1, Payload: []byte{0x01}},
+				{TrackID: 1, FourCC: FourCCVP9, Payload: []byte{}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := new(bytes.Buffer)
+			err := EncodeVideoTracks(buf, &tc.Header, tc.Tracks)
+			require.Nil(t, err)
+
+			var h VideoHeader
+			err = DecodeVideoHeader(buf, &h)
+			require.Nil(t, err)
+			require.Equal(t, tc.Header, h)
+
+			tracks, err := DecodeVideoTracks(buf, &h)
+			require.Nil(t, err)
+			require.Equal(t, tc.Tracks, tracks)
+		})
+	}
+}
+
+func TestAudioTracks(t *testing.T) {
+	header := AudioHeader{
+		IsExHeader:     true,
+		SoundFormat:    AudioSoundFormatExHeader,
+		PacketType:     AudioPacketTypeCodedFrames,
+		IsMultitrack:   true,
+		MultitrackType: AVMultitrackTypeManyTracksManyCodecs,
+	}
+	tracks := []AudioTrack{
+		{TrackID: 0, FourCC: FourCCAAC, Payload: []byte{0x01, 0x02}},
+		{TrackID: 1, FourCC: FourCCOpus, Payload: []byte{0x03}},
+	}
+
+	buf := new(bytes.Buffer)
+	err := EncodeAudioTracks(buf, &header, tracks)
+	require.Nil(t, err)
+
+	var h AudioHeader
+	err = DecodeAudioHeader(buf, &h)
+	require.Nil(t, err)
+	require.Equal(t, header, h)
+
+	decoded, err := DecodeAudioTracks(buf, &h)
+	require.Nil(t, err)
+	require.Equal(t, tracks, decoded)
+}
+
+func TestNonMultitrackIsATrack(t *testing.T) {
+	r := bytes.NewReader([]byte{0xaf, 0x01, 0x21, 0x10})
+
+	var h AudioHeader
+	err := DecodeAudioHeader(r, &h)
+	require.Nil(t, err)
+
+	tracks, err := DecodeAudioTracks(r, &h)
+	require.Nil(t, err)
+	require.Equal(t, []AudioTrack{
+		{TrackID: 0, FourCC: FourCCAAC, Payload: []byte{0x21, 0x10}},
+	}, tracks)
+}
+
+func TestDecodeTracksTruncated(t *testing.T) {
+	h := AudioHeader{
+		IsExHeader:     true,
+		PacketType:     AudioPacketTypeCodedFrames,
+		IsMultitrack:   true,
+		MultitrackType: AVMultitrackTypeManyTracks,
+	}
+
+	// A track declares the maximum size, but the message is short
+	r := bytes.NewReader([]byte{0x00, 0xff, 0xff, 0xff, 0x01, 0x02})
+	_, err := DecodeAudioTracks(r, &h)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestEncodeTracksRequiresMultitrack(t *testing.T) {
+	err := EncodeAudioTracks(new(bytes.Buffer), &AudioHeader{IsExHeader: true}, []AudioTrack{{}})
+	require.EqualError(t, err, "Header is not multitrack")
+
+	err = EncodeVideoTracks(new(bytes.Buffer), &VideoHeader{
+		IsExHeader:     true,
+		IsMultitrack:   true,
+		MultitrackType: AVMultitrackTypeOneTrack,
+	}, []VideoTrack{{}, {}})
+	require.EqualError(t, err, "OneTrack must have only one track: Len = 2")
+}
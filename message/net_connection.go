@@ -16,9 +16,14 @@ import (
 type NetConnectionConnectCode string
 
 const (
-	NetConnectionConnectCodeSuccess NetConnectionConnectCode = "NetConnection.Connect.Success"
-	NetConnectionConnectCodeFailed  NetConnectionConnectCode = "NetConnection.Connect.Failed"
-	NetConnectionConnectCodeClosed  NetConnectionConnectCode = "NetConnection.Connect.Closed"
+	NetConnectionConnectCodeSuccess    NetConnectionConnectCode = "NetConnection.Connect.Success"
+	NetConnectionConnectCodeFailed     NetConnectionConnectCode = "NetConnection.Connect.Failed"
+	NetConnectionConnectCodeClosed     NetConnectionConnectCode = "NetConnection.Connect.Closed"
+	NetConnectionConnectCodeRejected   NetConnectionConnectCode = "NetConnection.Connect.Rejected"
+	NetConnectionConnectCodeInvalidApp NetConnectionConnectCode = "NetConnection.Connect.InvalidApp"
+
+	// Enhanced RTMP. Sent by servers as onStatus to ask clients to reconnect (see CapsExReconnect)
+	NetConnectionConnectCodeReconnectRequest NetConnectionConnectCode = "NetConnection.Connect.ReconnectRequest"
 )
 
 type NetConnectionConnect struct {
@@ -36,6 +41,32 @@ type NetConnectionConnectCommand struct {
 	VideoCodecs    int          `mapstructure:"videoCodecs" amf0:"videoCodecs"`
 	VideoFunction  int          `mapstructure:"videoFunction" amf0:"videoFunction"`
 	ObjectEncoding EncodingType `mapstructure:"objectEncoding" amf0:"objectEncoding"`
+
+	// Enhanced RTMP
+	FourCcList         []string       `mapstructure:"fourCcList" amf0:"fourCcList"`
+	VideoFourCcInfoMap map[string]int `mapstructure:"videoFourCcInfoMap" amf0:"videoFourCcInfoMap"` // FourCC -> FourCcInfo*
+	AudioFourCcInfoMap map[string]int `mapstructure:"audioFourCcInfoMap" amf0:"audioFourCcInfoMap"` // FourCC -> FourCcInfo*
+	CapsEx             int            `mapstructure:"capsEx" amf0:"capsEx"`
+}
+
+// IsEnhanced returns true if a client requests Enhanced RTMP.
+func (c *NetConnectionConnectCommand) IsEnhanced() bool {
+	return len(c.FourCcList) > 0 || len(c.VideoFourCcInfoMap) > 0 || len(c.AudioFourCcInfoMap) > 0 || c.CapsEx != 0
+}
+
+// netConnectionConnectLegacyCommand A connect command object without Enhanced RTMP properties.
+// It is sent to keep compatibility with legacy servers if no E-RTMP properties are specified.
+type netConnectionConnectLegacyCommand struct {
+	App            string       `amf0:"app"`
+	Type           string       `amf0:"type"`
+	FlashVer       string       `amf0:"flashVer"`
+	TCURL          string       `amf0:"tcUrl"`
+	Fpad           bool         `amf0:"fpad"`
+	Capabilities   int          `amf0:"capabilities"`
+	AudioCodecs    int          `amf0:"audioCodecs"`
+	VideoCodecs    int          `amf0:"videoCodecs"`
+	VideoFunction  int          `amf0:"videoFunction"`
+	ObjectEncoding EncodingType `amf0:"objectEncoding"`
 }
 
 func (t *NetConnectionConnect) FromArgs(args ...interface{}) error {
@@ -48,8 +79,26 @@ func (t *NetConnectionConnect) FromArgs(args ...interface{}) error {
 }
 
 func (t *NetConnectionConnect) ToArgs(ty EncodingType) ([]interface{}, error) {
+	if t.Command.IsEnhanced() {
+		return []interface{}{
+			t.Command,
+		}, nil
+	}
+
+	c := &t.Command
 	return []interface{}{
-		t.Command,
+		netConnectionConnectLegacyCommand{
+			App:            c.App,
+			Type:           c.Type,
+			FlashVer:       c.FlashVer,
+			TCURL:          c.TCURL,
+			Fpad:           c.Fpad,
+			Capabilities:   c.Capabilities,
+			AudioCodecs:    c.AudioCodecs,
+			VideoCodecs:    c.VideoCodecs,
+			VideoFunction:  c.VideoFunction,
+			ObjectEncoding: c.ObjectEncoding,
+		},
 	}, nil
 }
 
@@ -62,6 +111,23 @@ type NetConnectionConnectResultProperties struct {
 	FMSVer       string `mapstructure:"fmsVer" amf0:"fmsVer"`             // TODO: fix
 	Capabilities int    `mapstructure:"capabilities" amf0:"capabilities"` // TODO: fix
 	Mode         int    `mapstructure:"mode" amf0:"mode"`                 // TODO: fix
+
+	// Enhanced RTMP
+	FourCcList         []string       `mapstructure:"fourCcList" amf0:"fourCcList"`
+	VideoFourCcInfoMap map[string]int `mapstructure:"videoFourCcInfoMap" amf0:"videoFourCcInfoMap"`
+	AudioFourCcInfoMap map[string]int `mapstructure:"audioFourCcInfoMap" amf0:"audioFourCcInfoMap"`
+	CapsEx             int            `mapstructure:"capsEx" amf0:"capsEx"`
+}
+
+// IsEnhanced returns true if a server replies Enhanced RTMP capabilities.
+func (p *NetConnectionConnectResultProperties) IsEnhanced() bool {
+	return len(p.FourCcList) > 0 || len(p.VideoFourCcInfoMap) > 0 || len(p.AudioFourCcInfoMap) > 0 || p.CapsEx != 0
+}
+
+type netConnectionConnectResultLegacyProperties struct {
+	FMSVer       string `amf0:"fmsVer"`
+	Capabilities int    `amf0:"capabilities"`
+	Mode         int    `amf0:"mode"`
 }
 
 type NetConnectionConnectResultInformation struct {
@@ -69,6 +135,26 @@ type NetConnectionConnectResultInformation struct {
 	Code        NetConnectionConnectCode `mapstructure:"code" amf0:"code"`
 	Description string                   `mapstructure:"description" amf0:"description"`
 	Data        amf0.ECMAArray           `mapstructure:"data" amf0:"data"`
+
+	// Sent with rejections only if they are not nil
+	Application interface{}                   `mapstructure:"application" amf0:"application"` // e.g. An object of application.rejectConnection
+	Ex          *NetConnectionConnectResultEx `mapstructure:"ex" amf0:"ex"`
+}
+
+// NetConnectionConnectResultEx Extended information of rejections. Code is 302 and Redirect is a tcUrl for redirections.
+type NetConnectionConnectResultEx struct {
+	Code     int    `mapstructure:"code" amf0:"code"`
+	Redirect string `mapstructure:"redirect" amf0:"redirect"`
+}
+
+// NetConnectionConnectResultExCodeRedirect A code of NetConnectionConnectResultEx to redirect clients.
+const NetConnectionConnectResultExCodeRedirect = 302
+
+type netConnectionConnectResultLegacyInformation struct {
+	Level       string                   `amf0:"level"`
+	Code        NetConnectionConnectCode `amf0:"code"`
+	Description string                   `amf0:"description"`
+	Data        amf0.ECMAArray           `amf0:"data"`
 }
 
 func (t *NetConnectionConnectResult) FromArgs(args ...interface{}) error {
@@ -86,9 +172,28 @@ func (t *NetConnectionConnectResult) FromArgs(args ...interface{}) error {
 }
 
 func (t *NetConnectionConnectResult) ToArgs(ty EncodingType) ([]interface{}, error) {
+	var properties interface{} = t.Properties
+	if !t.Properties.IsEnhanced() {
+		properties = netConnectionConnectResultLegacyProperties{
+			FMSVer:       t.Properties.FMSVer,
+			Capabilities: t.Properties.Capabilities,
+			Mode:         t.Properties.Mode,
+		}
+	}
+
+	var information interface{} = t.Information
+	if t.Information.Application == nil && t.Information.Ex == nil {
+		information = netConnectionConnectResultLegacyInformation{
+			Level:       t.Information.Level,
+			Code:        t.Information.Code,
+			Description: t.Information.Description,
+			Data:        t.Information.Data,
+		}
+	}
+
 	return []interface{}{
-		t.Properties,
-		t.Information,
+		properties,
+		information,
 	}, nil
 }
 
@@ -142,3 +247,101 @@ func (t *NetConnectionReleaseStream) ToArgs(ty EncodingType) ([]interface{}, err
 		t.StreamName,
 	}, nil
 }
+
+// NetConnectionCheckBandwidth checkBandwidth (or _checkbw) requests a server to measure bandwidth to a client.
+// The server calls onBWCheck several times and reports a result by onBWDone.
+type NetConnectionCheckBandwidth struct {
+}
+
+func (t *NetConnectionCheckBandwidth) FromArgs(args ...interface{}) error {
+	// args[0] is unknown, ignore
+	return nil
+}
+
+func (t *NetConnectionCheckBandwidth) ToArgs(ty EncodingType) ([]interface{}, error) {
+	return []interface{}{
+		nil, // no command object
+	}, nil
+}
+
+// NetConnectionOnBWCheck onBWCheck (or _onbwcheck) is called by a peer which measures bandwidth.
+// Payload is filler data to be sent. Peers reply _result with NetConnectionOnBWCheckResult.
+type NetConnectionOnBWCheck struct {
+	Payload string
+}
+
+func (t *NetConnectionOnBWCheck) FromArgs(args ...interface{}) error {
+	// args[0] is unknown, ignore
+	if len(args) > 1 {
+		// Payloads of other types (e.g. arrays of numbers sent by FMS) are just ignored
+		t.Payload, _ = args[1].(string)
+	}
+
+	return nil
+}
+
+func (t *NetConnectionOnBWCheck) ToArgs(ty EncodingType) ([]interface{}, error) {
+	if t.Payload == "" {
+		return []interface{}{
+			nil, // no command object
+		}, nil
+	}
+
+	return []interface{}{
+		nil, // no command object
+		t.Payload,
+	}, nil
+}
+
+// NetConnectionOnBWCheckResult A result of onBWCheck. Count is the number of onBWCheck calls which are received.
+type NetConnectionOnBWCheckResult struct {
+	Count float64
+}
+
+func (t *NetConnectionOnBWCheckResult) FromArgs(args ...interface{}) error {
+	// args[0] is unknown, ignore
+	if len(args) > 1 {
+		t.Count, _ = args[1].(float64)
+	}
+
+	return nil
+}
+
+func (t *NetConnectionOnBWCheckResult) ToArgs(ty EncodingType) ([]interface{}, error) {
+	return []interface{}{
+		nil, // no command object
+		t.Count,
+	}, nil
+}
+
+// NetConnectionOnBWDone onBWDone (or _onbwdone) reports a result of measuring bandwidth.
+// Some servers send it with fewer values or without values, then the rest are zero.
+type NetConnectionOnBWDone struct {
+	KbitDown  float64 // Estimated bandwidth in kbps
+	DeltaDown float64 // Kilobytes which are sent to measure
+	DeltaTime float64 // Milliseconds to send DeltaDown
+	Latency   float64 // Milliseconds
+}
+
+func (t *NetConnectionOnBWDone) FromArgs(args ...interface{}) error {
+	// args[0] is unknown, ignore
+	values := []*float64{&t.KbitDown, &t.DeltaDown, &t.DeltaTime, &t.Latency}
+	for i, v := range values {
+		if i+1 >= len(args) {
+			break
+		}
+		*v, _ = args[i+1].(float64)
+	}
+
+	return nil
+}
+
+func (t *NetConnectionOnBWDone) ToArgs(ty EncodingType) ([]interface{}, error) {
+	return []interface{}{
+		nil, // no command object
+		t.KbitDown,
+		t.DeltaDown,
+		t.DeltaTime,
+		t.Latency,
+	}, nil
+}
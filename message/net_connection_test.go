@@ -0,0 +1,83 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package message
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yutopp/go-amf0"
+)
+
+func TestNetConnectionConnectEnhancedRoundTrip(t *testing.T) {
+	cmd := &NetConnectionConnect{
+		Command: NetConnectionConnectCommand{
+			App:                "live",
+			FourCcList:         []string{"hvc1", "av01"},
+			VideoFourCcInfoMap: map[string]int{"hvc1": FourCcInfoCanDecode | FourCcInfoCanForward},
+			AudioFourCcInfoMap: map[string]int{"Opus": FourCcInfoCanForward},
+			CapsEx:             CapsExReconnect | CapsExMultitrack,
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	err := EncodeBodyAnyValues(amf0.NewEncoder(buf), cmd)
+	require.Nil(t, err)
+
+	var v AMFConvertible
+	err = DecodeBodyConnect(buf, amf0.NewDecoder(buf), &v)
+	require.Nil(t, err)
+	require.Equal(t, cmd, v)
+}
+
+func TestNetConnectionConnectLegacyDoesNotSendEnhancedProperties(t *testing.T) {
+	args, err := (&NetConnectionConnect{
+		Command: NetConnectionConnectCommand{
+			App: "live",
+		},
+	}).ToArgs(EncodingTypeAMF0)
+	require.Nil(t, err)
+	require.IsType(t, netConnectionConnectLegacyCommand{}, args[0])
+
+	args, err = (&NetConnectionConnectResult{}).ToArgs(EncodingTypeAMF0)
+	require.Nil(t, err)
+	require.IsType(t, netConnectionConnectResultLegacyProperties{}, args[0])
+}
+
+func TestNetConnectionConnectResultRedirectRoundTrip(t *testing.T) {
+	result := &NetConnectionConnectResult{
+		Properties: NetConnectionConnectResultProperties{
+			FMSVer: "FMS/3,0,1,123",
+		},
+		Information: NetConnectionConnectResultInformation{
+			Level:       "error",
+			Code:        NetConnectionConnectCodeRejected,
+			Description: "Redirected",
+			Data:        amf0.ECMAArray{},
+			Application: map[string]interface{}{"reason": "nearest"},
+			Ex: &NetConnectionConnectResultEx{
+				Code:     NetConnectionConnectResultExCodeRedirect,
+				Redirect: "rtmp://edge.example.com/app",
+			},
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	err := EncodeBodyAnyValues(amf0.NewEncoder(buf), result)
+	require.Nil(t, err)
+
+	var v AMFConvertible
+	err = DecodeBodyConnectResult(buf, amf0.NewDecoder(buf), &v)
+	require.Nil(t, err)
+	require.Equal(t, result, v)
+
+	args, err := (&NetConnectionConnectResult{}).ToArgs(EncodingTypeAMF0)
+	require.Nil(t, err)
+	require.IsType(t, netConnectionConnectResultLegacyInformation{}, args[1])
+}
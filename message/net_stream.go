@@ -7,6 +7,11 @@
 
 package message
 
+import (
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
 type NetStreamPublish struct {
 	CommandObject  interface{}
 	PublishingName string
@@ -32,19 +37,68 @@ func (t *NetStreamPublish) ToArgs(ty EncodingType) ([]interface{}, error) {
 type NetStreamPlay struct {
 	CommandObject interface{}
 	StreamName    string
-	Start         int64
+	Start         int64 // Milliseconds. -2: live or recorded, -1: live only
+	Duration      int64 // Milliseconds. -1: until the end
 }
 
 func (t *NetStreamPlay) FromArgs(args ...interface{}) error {
 	//command := args[0] // will be nil
 	t.StreamName = args[1].(string)
 	t.Start = args[2].(int64)
+	t.Duration = -1
+	if len(args) > 3 {
+		t.Duration = args[3].(int64)
+	}
 
 	return nil
 }
 
 func (t *NetStreamPlay) ToArgs(ty EncodingType) ([]interface{}, error) {
-	panic("Not implemented")
+	return []interface{}{
+		nil, // Always nil
+		t.StreamName,
+		t.Start,
+		t.Duration,
+	}, nil
+}
+
+type NetStreamSeek struct {
+	Milliseconds int64
+}
+
+func (t *NetStreamSeek) FromArgs(args ...interface{}) error {
+	//command := args[0] // will be nil
+	t.Milliseconds = args[1].(int64)
+
+	return nil
+}
+
+func (t *NetStreamSeek) ToArgs(ty EncodingType) ([]interface{}, error) {
+	return []interface{}{
+		nil, // Always nil
+		t.Milliseconds,
+	}, nil
+}
+
+type NetStreamPause struct {
+	Pause        bool  // true: pause, false: unpause
+	Milliseconds int64 // A position where the stream is paused or resumed
+}
+
+func (t *NetStreamPause) FromArgs(args ...interface{}) error {
+	//command := args[0] // will be nil
+	t.Pause = args[1].(bool)
+	t.Milliseconds = args[2].(int64)
+
+	return nil
+}
+
+func (t *NetStreamPause) ToArgs(ty EncodingType) ([]interface{}, error) {
+	return []interface{}{
+		nil, // Always nil
+		t.Pause,
+		t.Milliseconds,
+	}, nil
 }
 
 type NetStreamOnStatusLevel string
@@ -63,8 +117,20 @@ const (
 	NetStreamOnStatusCodePlayStart           NetStreamOnStatusCode = "NetStream.Play.Start"
 	NetStreamOnStatusCodePlayFailed          NetStreamOnStatusCode = "NetStream.Play.Failed"
 	NetStreamOnStatusCodePlayComplete        NetStreamOnStatusCode = "NetStream.Play.Complete"
+	NetStreamOnStatusCodePlayStop            NetStreamOnStatusCode = "NetStream.Play.Stop"
+	NetStreamOnStatusCodePlayReset           NetStreamOnStatusCode = "NetStream.Play.Reset"
+	NetStreamOnStatusCodePlayStreamNotFound  NetStreamOnStatusCode = "NetStream.Play.StreamNotFound"
+	NetStreamOnStatusCodePlayInsufficientBW  NetStreamOnStatusCode = "NetStream.Play.InsufficientBW"
+	NetStreamOnStatusCodePlayPublishNotify   NetStreamOnStatusCode = "NetStream.Play.PublishNotify"
+	NetStreamOnStatusCodePlayUnpublishNotify NetStreamOnStatusCode = "NetStream.Play.UnpublishNotify"
+	NetStreamOnStatusCodeSeekNotify          NetStreamOnStatusCode = "NetStream.Seek.Notify"
+	NetStreamOnStatusCodeSeekFailed          NetStreamOnStatusCode = "NetStream.Seek.Failed"
+	NetStreamOnStatusCodePauseNotify         NetStreamOnStatusCode = "NetStream.Pause.Notify"
+	NetStreamOnStatusCodeUnpauseNotify       NetStreamOnStatusCode = "NetStream.Unpause.Notify"
 	NetStreamOnStatusCodePublishBadName      NetStreamOnStatusCode = "NetStream.Publish.BadName"
 	NetStreamOnStatusCodePublishFailed       NetStreamOnStatusCode = "NetStream.Publish.Failed"
+	NetStreamOnStatusCodePublishDenied       NetStreamOnStatusCode = "NetStream.Publish.Denied"
+	NetStreamOnStatusCodePublishIdle         NetStreamOnStatusCode = "NetStream.Publish.Idle"
 	NetStreamOnStatusCodePublishStart        NetStreamOnStatusCode = "NetStream.Publish.Start"
 	NetStreamOnStatusCodeUnpublishSuccess    NetStreamOnStatusCode = "NetStream.Unpublish.Success"
 )
@@ -74,13 +140,24 @@ type NetStreamOnStatus struct {
 }
 
 type NetStreamOnStatusInfoObject struct {
-	Level       NetStreamOnStatusLevel
-	Code        NetStreamOnStatusCode
-	Description string
+	Level       NetStreamOnStatusLevel `mapstructure:"level"`
+	Code        NetStreamOnStatusCode  `mapstructure:"code"`
+	Description string                 `mapstructure:"description"`
+	TCURL       string                 `mapstructure:"tcUrl"`   // Optional. Enhanced RTMP NetConnection.Connect.ReconnectRequest only
+	Details     string                 `mapstructure:"details"` // Optional. e.g. A stream name
 }
 
 func (t *NetStreamOnStatus) FromArgs(args ...interface{}) error {
-	panic("Not implemented")
+	// args[0] is nil, ignore
+	info, ok := args[1].(map[string]interface{})
+	if !ok {
+		return errors.Errorf("Info object is not an object: Value = %+v", args[1])
+	}
+	if err := mapstructure.Decode(info, &t.InfoObject); err != nil {
+		return errors.Wrapf(err, "Failed to mapping NetStreamOnStatusInfoObject")
+	}
+
+	return nil
 }
 
 func (t *NetStreamOnStatus) ToArgs(ty EncodingType) ([]interface{}, error) {
@@ -88,6 +165,12 @@ func (t *NetStreamOnStatus) ToArgs(ty EncodingType) ([]interface{}, error) {
 	info["level"] = t.InfoObject.Level
 	info["code"] = t.InfoObject.Code
 	info["description"] = t.InfoObject.Description
+	if t.InfoObject.TCURL != "" {
+		info["tcUrl"] = t.InfoObject.TCURL
+	}
+	if t.InfoObject.Details != "" {
+		info["details"] = t.InfoObject.Details
+	}
 
 	return []interface{}{
 		nil, // Always nil
@@ -95,6 +178,34 @@ func (t *NetStreamOnStatus) ToArgs(ty EncodingType) ([]interface{}, error) {
 	}, nil
 }
 
+// NetStreamOnPlayStatus A data message which notifies players of the end of streams (NetStream.Play.Complete).
+type NetStreamOnPlayStatus struct {
+	InfoObject NetStreamOnStatusInfoObject
+}
+
+func (t *NetStreamOnPlayStatus) FromArgs(args ...interface{}) error {
+	info, ok := args[0].(map[string]interface{})
+	if !ok {
+		return errors.Errorf("Info object is not an object: Value = %+v", args[0])
+	}
+	if err := mapstructure.Decode(info, &t.InfoObject); err != nil {
+		return errors.Wrapf(err, "Failed to mapping NetStreamOnStatusInfoObject")
+	}
+
+	return nil
+}
+
+func (t *NetStreamOnPlayStatus) ToArgs(ty EncodingType) ([]interface{}, error) {
+	info := make(map[string]interface{})
+	info["level"] = t.InfoObject.Level
+	info["code"] = t.InfoObject.Code
+	info["description"] = t.InfoObject.Description
+
+	return []interface{}{
+		info,
+	}, nil
+}
+
 type NetStreamDeleteStream struct {
 	StreamID uint32
 }
@@ -203,6 +314,24 @@ func (t *NetStreamGetStreamLength) ToArgs(ty EncodingType) ([]interface{}, error
 	}, nil
 }
 
+type NetStreamGetStreamLengthResult struct {
+	Duration float64 // Seconds
+}
+
+func (t *NetStreamGetStreamLengthResult) FromArgs(args ...interface{}) error {
+	// args[0] is unknown, ignore
+	t.Duration = args[1].(float64)
+
+	return nil
+}
+
+func (t *NetStreamGetStreamLengthResult) ToArgs(ty EncodingType) ([]interface{}, error) {
+	return []interface{}{
+		nil, // no command object
+		t.Duration,
+	}, nil
+}
+
 type NetStreamPing struct {
 }
 
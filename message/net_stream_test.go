@@ -35,6 +35,41 @@ var netStreamTestCases = []netStreamTestCase{
 			PublishingType: "bbb",
 		},
 	},
+	{
+		Name: "NetStreamPlay OK",
+		Box:  &NetStreamPlay{},
+		Args: []interface{}{nil, "aaa", int64(1000), int64(-1)},
+		ExpectedMsg: &NetStreamPlay{
+			StreamName: "aaa",
+			Start:      1000,
+			Duration:   -1,
+		},
+	},
+	{
+		Name: "NetStreamSeek OK",
+		Box:  &NetStreamSeek{},
+		Args: []interface{}{nil, int64(1500)},
+		ExpectedMsg: &NetStreamSeek{
+			Milliseconds: 1500,
+		},
+	},
+	{
+		Name: "NetStreamPause OK",
+		Box:  &NetStreamPause{},
+		Args: []interface{}{nil, true, int64(2000)},
+		ExpectedMsg: &NetStreamPause{
+			Pause:        true,
+			Milliseconds: 2000,
+		},
+	},
+	{
+		Name: "NetStreamGetStreamLengthResult OK",
+		Box:  &NetStreamGetStreamLengthResult{},
+		Args: []interface{}{nil, float64(12.5)},
+		ExpectedMsg: &NetStreamGetStreamLengthResult{
+			Duration: 12.5,
+		},
+	},
 	{
 		Name: "NetStreamReleaseStream OK",
 		Box:  &NetStreamReleaseStream{},
@@ -51,6 +86,54 @@ var netStreamTestCases = []netStreamTestCase{
 			StreamName: "theStream",
 		},
 	},
+	{
+		Name: "NetStreamOnStatus OK",
+		Box:  &NetStreamOnStatus{},
+		Args: []interface{}{nil, map[string]interface{}{
+			"level":       NetStreamOnStatusLevelStatus,
+			"code":        NetStreamOnStatusCodePublishStart,
+			"description": "Publish succeeded.",
+		}},
+		ExpectedMsg: &NetStreamOnStatus{
+			InfoObject: NetStreamOnStatusInfoObject{
+				Level:       NetStreamOnStatusLevelStatus,
+				Code:        NetStreamOnStatusCodePublishStart,
+				Description: "Publish succeeded.",
+			},
+		},
+	},
+	{
+		Name: "NetStreamOnStatus with tcUrl OK",
+		Box:  &NetStreamOnStatus{},
+		Args: []interface{}{nil, map[string]interface{}{
+			"level":       NetStreamOnStatusLevelStatus,
+			"code":        NetStreamOnStatusCode(NetConnectionConnectCodeReconnectRequest),
+			"description": "",
+			"tcUrl":       "rtmp://example.com/app",
+		}},
+		ExpectedMsg: &NetStreamOnStatus{
+			InfoObject: NetStreamOnStatusInfoObject{
+				Level: NetStreamOnStatusLevelStatus,
+				Code:  NetStreamOnStatusCode(NetConnectionConnectCodeReconnectRequest),
+				TCURL: "rtmp://example.com/app",
+			},
+		},
+	},
+	{
+		Name: "NetStreamOnPlayStatus OK",
+		Box:  &NetStreamOnPlayStatus{},
+		Args: []interface{}{map[string]interface{}{
+			"level":       NetStreamOnStatusLevelStatus,
+			"code":        NetStreamOnStatusCodePlayComplete,
+			"description": "",
+		}},
+		ExpectedMsg: &NetStreamOnPlayStatus{
+			InfoObject: NetStreamOnStatusInfoObject{
+				Level: NetStreamOnStatusLevelStatus,
+				Code:  NetStreamOnStatusCodePlayComplete,
+			},
+		},
+	},
 }
 
 func TestConvertNetStreamMessages(t *testing.T) {
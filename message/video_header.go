@@ -0,0 +1,248 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package message
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+type VideoFrameType uint8
+
+const (
+	VideoFrameTypeKeyFrame             VideoFrameType = 1
+	VideoFrameTypeInterFrame           VideoFrameType = 2
+	VideoFrameTypeDisposableInterFrame VideoFrameType = 3
+	VideoFrameTypeGeneratedKeyFrame    VideoFrameType = 4
+	VideoFrameTypeCommand              VideoFrameType = 5 // Video info or command frame
+)
+
+// VideoCodecID Codec IDs of legacy FLV video tags
+type VideoCodecID uint8
+
+const (
+	VideoCodecIDSorensonH263 VideoCodecID = 2
+	VideoCodecIDScreenVideo  VideoCodecID = 3
+	VideoCodecIDOn2VP6       VideoCodecID = 4
+	VideoCodecIDOn2VP6Alpha  VideoCodecID = 5
+	VideoCodecIDScreenVideo2 VideoCodecID = 6
+	VideoCodecIDAVC          VideoCodecID = 7
+	VideoCodecIDHEVC         VideoCodecID = 12 // Not standardized, but used widely before E-RTMP
+)
+
+// FourCC returns a FourCC of the codec. It returns 0 if the codec has no corresponding FourCC.
+func (id VideoCodecID) FourCC() FourCC {
+	switch id {
+	case VideoCodecIDAVC:
+		return FourCCAVC
+	case VideoCodecIDHEVC:
+		return FourCCHEVC
+	default:
+		return 0
+	}
+}
+
+type VideoPacketType uint8
+
+const (
+	VideoPacketTypeSequenceStart        VideoPacketType = 0
+	VideoPacketTypeCodedFrames          VideoPacketType = 1
+	VideoPacketTypeSequenceEnd          VideoPacketType = 2
+	VideoPacketTypeCodedFramesX         VideoPacketType = 3 // CompositionTime is implicitly 0
+	VideoPacketTypeMetadata             VideoPacketType = 4
+	VideoPacketTypeMPEG2TSSequenceStart VideoPacketType = 5
+	VideoPacketTypeMultitrack           VideoPacketType = 6
+	VideoPacketTypeModEx                VideoPacketType = 7
+)
+
+// VideoHeader A header of a payload of VideoMessage. Both of legacy FLV headers and Enhanced RTMP headers are handled.
+//
+// For legacy headers, FourCC and PacketType are filled from CodecID and AVCPacketType if the codec is AVC or HEVC.
+type VideoHeader struct {
+	FrameType  VideoFrameType
+	IsExHeader bool
+
+	CodecID VideoCodecID // Legacy headers only
+	FourCC  FourCC
+
+	PacketType          VideoPacketType
+	CompositionTime     int32  // AVC and HEVC only
+	TimestampNanoOffset uint32 // Enhanced RTMP ModEx
+
+	// Enhanced RTMP multitrack. PacketType is a type for all tracks, and FourCC is empty for ManyTracksManyCodecs.
+	// Tracks follow the header. See DecodeVideoTracks.
+	IsMultitrack   bool
+	MultitrackType AVMultitrackType
+}
+
+// DecodeVideoHeader reads a header from r. A payload of the codec follows it in r.
+func DecodeVideoHeader(r io.Reader, h *VideoHeader) error {
+	var buf [4]byte
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return err
+	}
+
+	*h = VideoHeader{}
+
+	if buf[0]&0x80 == 0 {
+		return decodeLegacyVideoHeader(r, buf[0], h)
+	}
+
+	h.IsExHeader = true
+	h.FrameType = VideoFrameType((buf[0] >> 4) & 0x07)
+
+	packetType := buf[0] & 0x0f
+	if packetType == packetTypeModEx {
+		pt, err := decodeModEx(r, &h.TimestampNanoOffset)
+		if err != nil {
+			return err
+		}
+		packetType = pt
+	}
+	h.PacketType = VideoPacketType(packetType)
+
+	if h.PacketType == VideoPacketTypeMultitrack {
+		if _, err := io.ReadFull(r, buf[:1]); err != nil {
+			return err
+		}
+		h.IsMultitrack = true
+		h.MultitrackType = AVMultitrackType(buf[0] >> 4)
+		h.PacketType = VideoPacketType(buf[0] & 0x0f)
+
+		if h.PacketType == VideoPacketTypeMultitrack {
+			return errors.New("Nested multitrack video packets are not allowed")
+		}
+		if h.MultitrackType == AVMultitrackTypeManyTracksManyCodecs {
+			return nil // Each track has a FourCC
+		}
+
+		if _, err := io.ReadFull(r, buf[:4]); err != nil {
+			return err
+		}
+		h.FourCC = FourCC(binary.BigEndian.Uint32(buf[:4]))
+
+		return nil // Each track has a composition time
+	}
+
+	if _, err := io.ReadFull(r, buf[:4]); err != nil {
+		return err
+	}
+	h.FourCC = FourCC(binary.BigEndian.Uint32(buf[:4]))
+
+	if h.PacketType == VideoPacketTypeCodedFrames && hasCompositionTime(h.FourCC) {
+		ct, err := readSI24(r)
+		if err != nil {
+			return err
+		}
+		h.CompositionTime = ct
+	}
+
+	return nil
+}
+
+func decodeLegacyVideoHeader(r io.Reader, b byte, h *VideoHeader) error {
+	h.FrameType = VideoFrameType(b >> 4)
+	h.CodecID = VideoCodecID(b & 0x0f)
+
+	if h.FrameType == VideoFrameTypeCommand {
+		return nil // A command byte follows
+	}
+
+	h.FourCC = h.CodecID.FourCC()
+	if h.FourCC == 0 {
+		return nil
+	}
+
+	// AVCPacketType has the same values as VideoPacketType (0: sequence header, 1: NALU, 2: end of sequence)
+	var buf [1]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return err
+	}
+	h.PacketType = VideoPacketType(buf[0])
+
+	ct, err := readSI24(r)
+	if err != nil {
+		return err
+	}
+	h.CompositionTime = ct
+
+	return nil
+}
+
+// EncodeVideoHeader writes a header to w. A legacy header is written if IsExHeader is false.
+func EncodeVideoHeader(w io.Writer, h *VideoHeader) error {
+	if !h.IsExHeader {
+		return encodeLegacyVideoHeader(w, h)
+	}
+
+	if h.PacketType == VideoPacketTypeMultitrack {
+		return errors.New("Set IsMultitrack to write multitrack video packets")
+	}
+
+	packetType := h.PacketType
+	if h.IsMultitrack {
+		packetType = VideoPacketTypeMultitrack
+	}
+
+	head := byte(0x80) | byte(h.FrameType&0x07)<<4
+	if h.TimestampNanoOffset != 0 {
+		if _, err := w.Write([]byte{head | packetTypeModEx}); err != nil {
+			return err
+		}
+		if err := encodeModEx(w, h.TimestampNanoOffset, uint8(packetType)); err != nil {
+			return err
+		}
+	} else {
+		if _, err := w.Write([]byte{head | byte(packetType&0x0f)}); err != nil {
+			return err
+		}
+	}
+
+	if h.IsMultitrack {
+		if _, err := w.Write([]byte{byte(h.MultitrackType)<<4 | byte(h.PacketType&0x0f)}); err != nil {
+			return err
+		}
+		if h.MultitrackType == AVMultitrackTypeManyTracksManyCodecs {
+			return nil
+		}
+	}
+
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(h.FourCC))
+	if _, err := w.Write(buf[:]); err != nil {
+		return err
+	}
+
+	if !h.IsMultitrack && h.PacketType == VideoPacketTypeCodedFrames && hasCompositionTime(h.FourCC) {
+		return writeSI24(w, h.CompositionTime)
+	}
+
+	return nil
+}
+
+func encodeLegacyVideoHeader(w io.Writer, h *VideoHeader) error {
+	if _, err := w.Write([]byte{byte(h.FrameType)<<4 | byte(h.CodecID&0x0f)}); err != nil {
+		return err
+	}
+
+	if h.FrameType == VideoFrameTypeCommand || h.CodecID.FourCC() == 0 {
+		return nil
+	}
+
+	if _, err := w.Write([]byte{byte(h.PacketType)}); err != nil {
+		return err
+	}
+
+	return writeSI24(w, h.CompositionTime)
+}
+
+func hasCompositionTime(f FourCC) bool {
+	return f == FourCCAVC || f == FourCCHEVC
+}
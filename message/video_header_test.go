@@ -0,0 +1,109 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package message
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type videoHeaderTestCase struct {
+	Name   string
+	Binary []byte
+	Header VideoHeader
+}
+
+var videoHeaderTestCases = []videoHeaderTestCase{
+	{
+		Name:   "Legacy AVC NALU",
+		Binary: []byte{0x17, 0x01, 0x00, 0x00, 0x21},
+		Header: VideoHeader{
+			FrameType:       VideoFrameTypeKeyFrame,
+			CodecID:         VideoCodecIDAVC,
+			FourCC:          FourCCAVC,
+			PacketType:      VideoPacketTypeCodedFrames,
+			CompositionTime: 33,
+		},
+	},
+	{
+		Name:   "Legacy Sorenson H.263",
+		Binary: []byte{0x22},
+		Header: VideoHeader{
+			FrameType: VideoFrameTypeInterFrame,
+			CodecID:   VideoCodecIDSorensonH263,
+		},
+	},
+	{
+		Name:   "HEVC sequence start",
+		Binary: []byte{0x90, 'h', 'v', 'c', '1'},
+		Header: VideoHeader{
+			FrameType:  VideoFrameTypeKeyFrame,
+			IsExHeader: true,
+			FourCC:     FourCCHEVC,
+			PacketType: VideoPacketTypeSequenceStart,
+		},
+	},
+	{
+		Name:   "HEVC coded frames with negative composition time",
+		Binary: []byte{0xa1, 'h', 'v', 'c', '1', 0xff, 0xff, 0xfe},
+		Header: VideoHeader{
+			FrameType:       VideoFrameTypeInterFrame,
+			IsExHeader:      true,
+			FourCC:          FourCCHEVC,
+			PacketType:      VideoPacketTypeCodedFrames,
+			CompositionTime: -2,
+		},
+	},
+	{
+		Name:   "AV1 coded frames",
+		Binary: []byte{0x91, 'a', 'v', '0', '1'},
+		Header: VideoHeader{
+			FrameType:  VideoFrameTypeKeyFrame,
+			IsExHeader: true,
+			FourCC:     FourCCAV1,
+			PacketType: VideoPacketTypeCodedFrames,
+		},
+	},
+	{
+		Name:   "VP9 with timestamp offset",
+		Binary: []byte{0x97, 0x02, 0x01, 0x02, 0x03, 0x03, 'v', 'p', '0', '9'},
+		Header: VideoHeader{
+			FrameType:           VideoFrameTypeKeyFrame,
+			IsExHeader:          true,
+			FourCC:              FourCCVP9,
+			PacketType:          VideoPacketTypeCodedFramesX,
+			TimestampNanoOffset: 0x010203,
+		},
+	},
+}
+
+func TestVideoHeader(t *testing.T) {
+	for _, tc := range videoHeaderTestCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			payload := append(append([]byte{}, tc.Binary...), 0xde, 0xad)
+			r := bytes.NewReader(payload)
+
+			var h VideoHeader
+			err := DecodeVideoHeader(r, &h)
+			require.Nil(t, err)
+			require.Equal(t, tc.Header, h)
+			require.Equal(t, 2, r.Len()) // Only a payload remains
+
+			buf := new(bytes.Buffer)
+			err = EncodeVideoHeader(buf, &tc.Header)
+			require.Nil(t, err)
+			require.Equal(t, tc.Binary, buf.Bytes())
+		})
+	}
+}
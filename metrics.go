@@ -0,0 +1,544 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+// MetricsConfig Configurations of Metrics.
+type MetricsConfig struct {
+	// PerConnection enables rtmp_conn_* and rtmp_stream_* series which are labeled with connections and streams.
+	// It is disabled by default, because the number of series grows with connections. Series of a connection are
+	// removed when it is closed, so their counters are not monotonic over time.
+	PerConnection bool
+}
+
+// Metrics An Observer which aggregates counters of connections, streams and message types in memory.
+// Totals are kept forever, and counters of connections and streams are kept while they are alive if
+// MetricsConfig.PerConnection is enabled.
+type Metrics struct {
+	// Totals are shared by all connections and updated atomically. Keep them at the top to be 64-bit aligned
+	connsTotal       uint64
+	connsActive      uint64
+	streamsTotal     uint64
+	chunkStreamsRead uint64
+	chunkStreamsWrit uint64
+	bytesRead        uint64
+	bytesWritten     uint64
+	messagesRead     [256]uint64 // Indexed by message.TypeID
+	messagesWritten  [256]uint64
+
+	config *MetricsConfig
+
+	nextConnID uint64
+	conns      map[uint64]*connMetrics
+	m          sync.Mutex
+
+	now func() time.Time
+}
+
+var _ Observer = (*Metrics)(nil)
+
+func NewMetrics(config *MetricsConfig) *Metrics {
+	if config == nil {
+		config = &MetricsConfig{}
+	}
+
+	return &Metrics{
+		config: config,
+		conns:  make(map[uint64]*connMetrics),
+		now:    time.Now,
+	}
+}
+
+func (ms *Metrics) NewConnObserver(_ *Conn) ConnObserver {
+	atomic.AddUint64(&ms.connsTotal, 1)
+	atomic.AddUint64(&ms.connsActive, 1)
+
+	cm := &connMetrics{
+		metrics:   ms,
+		isTracked: ms.config.PerConnection,
+	}
+	if !cm.isTracked {
+		return cm
+	}
+	cm.openedAt = ms.now()
+	cm.streams = make(map[uint32]*streamMetrics)
+
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	ms.nextConnID++
+	cm.id = ms.nextConnID
+	ms.conns[cm.id] = cm
+
+	return cm
+}
+
+// WritePrometheus writes metrics in the Prometheus text exposition format.
+// Bitrates are averages of the last few seconds in bits per second.
+func (ms *Metrics) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	p := &promWriter{w: bw}
+
+	p.header("rtmp_connections_total", "counter", "Total number of connections.")
+	p.sample("rtmp_connections_total", nil, float64(atomic.LoadUint64(&ms.connsTotal)))
+
+	p.header("rtmp_connections_active", "gauge", "Number of open connections.")
+	p.sample("rtmp_connections_active", nil, float64(atomic.LoadUint64(&ms.connsActive)))
+
+	p.header("rtmp_streams_total", "counter", "Total number of message streams.")
+	p.sample("rtmp_streams_total", nil, float64(atomic.LoadUint64(&ms.streamsTotal)))
+
+	p.header("rtmp_chunk_streams_total", "counter", "Total number of chunk streams.")
+	p.sample("rtmp_chunk_streams_total", []string{"direction", "read"}, float64(atomic.LoadUint64(&ms.chunkStreamsRead)))
+	p.sample("rtmp_chunk_streams_total", []string{"direction", "write"}, float64(atomic.LoadUint64(&ms.chunkStreamsWrit)))
+
+	p.header("rtmp_bytes_total", "counter", "Total bytes of chunks.")
+	p.sample("rtmp_bytes_total", []string{"direction", "read"}, float64(atomic.LoadUint64(&ms.bytesRead)))
+	p.sample("rtmp_bytes_total", []string{"direction", "write"}, float64(atomic.LoadUint64(&ms.bytesWritten)))
+
+	p.header("rtmp_messages_total", "counter", "Total number of messages by type.")
+	for typeID := range ms.messagesRead {
+		if n := atomic.LoadUint64(&ms.messagesRead[typeID]); n > 0 {
+			p.sample("rtmp_messages_total", []string{"direction", "read", "type", message.TypeID(typeID).String()}, float64(n))
+		}
+	}
+	for typeID := range ms.messagesWritten {
+		if n := atomic.LoadUint64(&ms.messagesWritten[typeID]); n > 0 {
+			p.sample("rtmp_messages_total", []string{"direction", "write", "type", message.TypeID(typeID).String()}, float64(n))
+		}
+	}
+
+	if ms.config.PerConnection {
+		ms.writeConnsPrometheus(p)
+	}
+
+	if p.err != nil {
+		return p.err
+	}
+	return bw.Flush()
+}
+
+// writeConnsPrometheus Writes series of each connection and stream.
+func (ms *Metrics) writeConnsPrometheus(p *promWriter) {
+	ms.m.Lock()
+	cms := make([]*connMetrics, 0, len(ms.conns))
+	for _, cm := range ms.conns {
+		cms = append(cms, cm)
+	}
+	ms.m.Unlock()
+	sort.Slice(cms, func(i, j int) bool { return cms[i].id < cms[j].id })
+
+	now := ms.now()
+	conns := make([]connSnapshot, len(cms))
+	for i, cm := range cms {
+		conns[i] = cm.snapshot(now)
+	}
+
+	p.header("rtmp_conn_age_seconds", "gauge", "Age of an open connection.")
+	for _, c := range conns {
+		p.sample("rtmp_conn_age_seconds", c.labels(), c.age.Seconds())
+	}
+
+	p.header("rtmp_conn_bytes_total", "counter", "Bytes of chunks of an open connection.")
+	for _, c := range conns {
+		p.sample("rtmp_conn_bytes_total", c.labels("direction", "read"), float64(c.bytesRead))
+		p.sample("rtmp_conn_bytes_total", c.labels("direction", "write"), float64(c.bytesWritten))
+	}
+
+	p.header("rtmp_conn_bitrate", "gauge", "Bitrate of an open connection in bits per second.")
+	for _, c := range conns {
+		p.sample("rtmp_conn_bitrate", c.labels("direction", "read"), c.readBitrate)
+		p.sample("rtmp_conn_bitrate", c.labels("direction", "write"), c.writeBitrate)
+	}
+
+	p.header("rtmp_conn_messages_total", "counter", "Number of messages of an open connection by type.")
+	for _, c := range conns {
+		for _, typeID := range sortedTypeIDs(c.messagesRead) {
+			p.sample("rtmp_conn_messages_total", c.labels("direction", "read", "type", typeID.String()), float64(c.messagesRead[typeID]))
+		}
+		for _, typeID := range sortedTypeIDs(c.messagesWritten) {
+			p.sample("rtmp_conn_messages_total", c.labels("direction", "write", "type", typeID.String()), float64(c.messagesWritten[typeID]))
+		}
+	}
+
+	p.header("rtmp_conn_chunk_streams", "gauge", "Number of chunk streams of an open connection.")
+	for _, c := range conns {
+		p.sample("rtmp_conn_chunk_streams", c.labels(), float64(c.chunkStreams))
+	}
+
+	p.header("rtmp_conn_write_queue_depth", "gauge", "Number of chunk streams waiting to be written.")
+	for _, c := range conns {
+		p.sample("rtmp_conn_write_queue_depth", c.labels(), float64(c.queueDepth))
+	}
+
+	p.header("rtmp_stream_bytes_total", "counter", "Bytes of message payloads of a message stream.")
+	for _, c := range conns {
+		for _, s := range c.streams {
+			p.sample("rtmp_stream_bytes_total", s.labels(c, "direction", "read"), float64(s.bytesRead))
+			p.sample("rtmp_stream_bytes_total", s.labels(c, "direction", "write"), float64(s.bytesWritten))
+		}
+	}
+
+	p.header("rtmp_stream_messages_total", "counter", "Number of messages of a message stream.")
+	for _, c := range conns {
+		for _, s := range c.streams {
+			p.sample("rtmp_stream_messages_total", s.labels(c, "direction", "read"), float64(s.messagesRead))
+			p.sample("rtmp_stream_messages_total", s.labels(c, "direction", "write"), float64(s.messagesWritten))
+		}
+	}
+
+	p.header("rtmp_stream_bitrate", "gauge", "Bitrate of message payloads of a message stream in bits per second.")
+	for _, c := range conns {
+		for _, s := range c.streams {
+			p.sample("rtmp_stream_bitrate", s.labels(c, "direction", "read"), s.readBitrate)
+			p.sample("rtmp_stream_bitrate", s.labels(c, "direction", "write"), s.writeBitrate)
+		}
+	}
+}
+
+func (ms *Metrics) removeConn(id uint64) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	delete(ms.conns, id)
+}
+
+// connMetrics Counts totals of a connection. Counters of the connection itself are guarded by m, and kept only if
+// isTracked is true not to lock per chunk.
+type connMetrics struct {
+	metrics   *Metrics
+	isTracked bool
+
+	id              uint64
+	openedAt        time.Time
+	bytesRead       uint64
+	bytesWritten    uint64
+	readRate        rateCounter
+	writeRate       rateCounter
+	messagesRead    map[message.TypeID]uint64
+	messagesWritten map[message.TypeID]uint64
+	chunkStreams    int
+	queueDepth      int
+	streams         map[uint32]*streamMetrics
+	m               sync.Mutex
+}
+
+var _ ConnObserver = (*connMetrics)(nil)
+
+func (cm *connMetrics) OnBytesRead(n int) {
+	atomic.AddUint64(&cm.metrics.bytesRead, uint64(n))
+	if !cm.isTracked {
+		return
+	}
+	now := cm.metrics.now()
+
+	cm.m.Lock()
+	defer cm.m.Unlock()
+
+	cm.bytesRead += uint64(n)
+	cm.readRate.add(now, uint64(n))
+}
+
+func (cm *connMetrics) OnBytesWritten(n int) {
+	atomic.AddUint64(&cm.metrics.bytesWritten, uint64(n))
+	if !cm.isTracked {
+		return
+	}
+	now := cm.metrics.now()
+
+	cm.m.Lock()
+	defer cm.m.Unlock()
+
+	cm.bytesWritten += uint64(n)
+	cm.writeRate.add(now, uint64(n))
+}
+
+func (cm *connMetrics) OnMessageRead(streamID uint32, typeID message.TypeID, length uint32) {
+	atomic.AddUint64(&cm.metrics.messagesRead[typeID], 1)
+	if !cm.isTracked {
+		return
+	}
+	now := cm.metrics.now()
+
+	cm.m.Lock()
+	defer cm.m.Unlock()
+
+	if cm.messagesRead == nil {
+		cm.messagesRead = make(map[message.TypeID]uint64)
+	}
+	cm.messagesRead[typeID]++
+	s := cm.stream(streamID)
+	s.messagesRead++
+	s.bytesRead += uint64(length)
+	s.readRate.add(now, uint64(length))
+}
+
+func (cm *connMetrics) OnMessageWritten(streamID uint32, typeID message.TypeID, length uint32) {
+	atomic.AddUint64(&cm.metrics.messagesWritten[typeID], 1)
+	if !cm.isTracked {
+		return
+	}
+	now := cm.metrics.now()
+
+	cm.m.Lock()
+	defer cm.m.Unlock()
+
+	if cm.messagesWritten == nil {
+		cm.messagesWritten = make(map[message.TypeID]uint64)
+	}
+	cm.messagesWritten[typeID]++
+	s := cm.stream(streamID)
+	s.messagesWritten++
+	s.bytesWritten += uint64(length)
+	s.writeRate.add(now, uint64(length))
+}
+
+func (cm *connMetrics) OnChunkStreamCreated(_ int, isWriter bool) {
+	if isWriter {
+		atomic.AddUint64(&cm.metrics.chunkStreamsWrit, 1)
+	} else {
+		atomic.AddUint64(&cm.metrics.chunkStreamsRead, 1)
+	}
+	if !cm.isTracked {
+		return
+	}
+
+	cm.m.Lock()
+	defer cm.m.Unlock()
+
+	cm.chunkStreams++
+}
+
+func (cm *connMetrics) OnWriteQueueDepth(depth int) {
+	if !cm.isTracked {
+		return
+	}
+
+	cm.m.Lock()
+	defer cm.m.Unlock()
+
+	cm.queueDepth = depth
+}
+
+func (cm *connMetrics) OnStreamCreated(streamID uint32) {
+	atomic.AddUint64(&cm.metrics.streamsTotal, 1)
+	if !cm.isTracked {
+		return
+	}
+
+	cm.m.Lock()
+	defer cm.m.Unlock()
+
+	cm.stream(streamID)
+}
+
+func (cm *connMetrics) OnStreamDeleted(streamID uint32) {
+	if !cm.isTracked {
+		return
+	}
+
+	cm.m.Lock()
+	defer cm.m.Unlock()
+
+	delete(cm.streams, streamID)
+}
+
+func (cm *connMetrics) OnClose() {
+	atomic.AddUint64(&cm.metrics.connsActive, ^uint64(0))
+	if cm.isTracked {
+		cm.metrics.removeConn(cm.id)
+	}
+}
+
+// stream Returns counters of a stream. Messages may arrive before the stream is created. Call with cm.m locked.
+func (cm *connMetrics) stream(streamID uint32) *streamMetrics {
+	s, ok := cm.streams[streamID]
+	if !ok {
+		s = &streamMetrics{id: streamID}
+		cm.streams[streamID] = s
+	}
+	return s
+}
+
+type connSnapshot struct {
+	id              uint64
+	age             time.Duration
+	bytesRead       uint64
+	bytesWritten    uint64
+	readBitrate     float64
+	writeBitrate    float64
+	messagesRead    map[message.TypeID]uint64
+	messagesWritten map[message.TypeID]uint64
+	chunkStreams    int
+	queueDepth      int
+	streams         []streamSnapshot
+}
+
+func (c *connSnapshot) labels(kvs ...string) []string {
+	return append([]string{"conn", fmt.Sprint(c.id)}, kvs...)
+}
+
+type streamSnapshot struct {
+	id              uint32
+	bytesRead       uint64
+	bytesWritten    uint64
+	messagesRead    uint64
+	messagesWritten uint64
+	readBitrate     float64
+	writeBitrate    float64
+}
+
+func (s *streamSnapshot) labels(c connSnapshot, kvs ...string) []string {
+	return append([]string{"conn", fmt.Sprint(c.id), "stream", fmt.Sprint(s.id)}, kvs...)
+}
+
+func (cm *connMetrics) snapshot(now time.Time) connSnapshot {
+	cm.m.Lock()
+	defer cm.m.Unlock()
+
+	c := connSnapshot{
+		id:              cm.id,
+		age:             now.Sub(cm.openedAt),
+		bytesRead:       cm.bytesRead,
+		bytesWritten:    cm.bytesWritten,
+		readBitrate:     cm.readRate.bitrate(now),
+		writeBitrate:    cm.writeRate.bitrate(now),
+		messagesRead:    make(map[message.TypeID]uint64),
+		messagesWritten: make(map[message.TypeID]uint64),
+		chunkStreams:    cm.chunkStreams,
+		queueDepth:      cm.queueDepth,
+	}
+	for k, v := range cm.messagesRead {
+		c.messagesRead[k] = v
+	}
+	for k, v := range cm.messagesWritten {
+		c.messagesWritten[k] = v
+	}
+
+	for _, s := range cm.streams {
+		c.streams = append(c.streams, streamSnapshot{
+			id:              s.id,
+			bytesRead:       s.bytesRead,
+			bytesWritten:    s.bytesWritten,
+			messagesRead:    s.messagesRead,
+			messagesWritten: s.messagesWritten,
+			readBitrate:     s.readRate.bitrate(now),
+			writeBitrate:    s.writeRate.bitrate(now),
+		})
+	}
+	sort.Slice(c.streams, func(i, j int) bool { return c.streams[i].id < c.streams[j].id })
+
+	return c
+}
+
+type streamMetrics struct {
+	id              uint32
+	bytesRead       uint64
+	bytesWritten    uint64
+	messagesRead    uint64
+	messagesWritten uint64
+	readRate        rateCounter
+	writeRate       rateCounter
+}
+
+// rateWindow The number of seconds of buckets. The current bucket is not used to calculate rates.
+const rateWindow = 6
+
+// rateCounter Counts bytes per second in a sliding window.
+type rateCounter struct {
+	buckets [rateWindow]uint64
+	last    int64 // Unix time of the latest bucket
+}
+
+func (r *rateCounter) add(now time.Time, n uint64) {
+	sec := now.Unix()
+	r.advance(sec)
+	r.buckets[sec%rateWindow] += n
+}
+
+// bitrate Returns an average of completed buckets in bits per second.
+func (r *rateCounter) bitrate(now time.Time) float64 {
+	sec := now.Unix()
+	r.advance(sec)
+
+	var sum uint64
+	for i, n := range r.buckets {
+		if int64(i) == sec%rateWindow {
+			continue
+		}
+		sum += n
+	}
+	return float64(sum*8) / float64(rateWindow-1)
+}
+
+func (r *rateCounter) advance(sec int64) {
+	if sec <= r.last {
+		return
+	}
+	if sec-r.last >= rateWindow {
+		r.buckets = [rateWindow]uint64{}
+	} else {
+		for s := r.last + 1; s <= sec; s++ {
+			r.buckets[s%rateWindow] = 0
+		}
+	}
+	r.last = sec
+}
+
+func sortedTypeIDs(m map[message.TypeID]uint64) []message.TypeID {
+	ids := make([]message.TypeID, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// promWriter Writes samples in the Prometheus text exposition format. The first error is kept.
+type promWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *promWriter) header(name, ty, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, ty)
+}
+
+// sample Writes a sample. labels are pairs of names and values.
+func (p *promWriter) sample(name string, labels []string, value float64) {
+	s := name
+	if len(labels) > 0 {
+		s += "{"
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				s += ","
+			}
+			s += fmt.Sprintf("%s=%q", labels[i], labels[i+1])
+		}
+		s += "}"
+	}
+	p.printf("%s %v\n", s, value)
+}
+
+func (p *promWriter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
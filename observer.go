@@ -0,0 +1,69 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"github.com/yutopp/go-rtmp/message"
+)
+
+// Observer Observes connections to collect metrics. Set it to ConnConfig.Observer or ServerConfig.Observer.
+// Metrics is an implementation which aggregates counters in memory.
+type Observer interface {
+	// NewConnObserver is called when a connection is created. It may return nil not to observe the connection.
+	NewConnObserver(conn *Conn) ConnObserver
+}
+
+// ConnObserver Receives events of a connection. Methods are called from goroutines which read or write
+// the connection concurrently, so they must be goroutine-safe and must not block.
+type ConnObserver interface {
+	// OnBytesRead and OnBytesWritten are called with sizes of chunks (headers and payloads).
+	// Handshakes are not included.
+	OnBytesRead(n int)
+	OnBytesWritten(n int)
+
+	// OnMessageRead is called when a message is reassembled from chunks.
+	OnMessageRead(streamID uint32, typeID message.TypeID, length uint32)
+	// OnMessageWritten is called when a message is queued to be written.
+	OnMessageWritten(streamID uint32, typeID message.TypeID, length uint32)
+
+	// OnChunkStreamCreated is called when a chunk stream is used first. isWriter is false for chunk streams of a peer.
+	OnChunkStreamCreated(chunkStreamID int, isWriter bool)
+
+	// OnWriteQueueDepth is called with the number of chunk streams waiting to be written when a message is queued.
+	OnWriteQueueDepth(depth int)
+
+	OnStreamCreated(streamID uint32)
+	OnStreamDeleted(streamID uint32)
+
+	// OnClose is called once when the connection is closed.
+	OnClose()
+}
+
+func newConnObserver(o Observer, conn *Conn) ConnObserver {
+	if o == nil {
+		return nopConnObserver{}
+	}
+
+	co := o.NewConnObserver(conn)
+	if co == nil {
+		return nopConnObserver{}
+	}
+	return co
+}
+
+type nopConnObserver struct{}
+
+func (nopConnObserver) OnBytesRead(int)                                 {}
+func (nopConnObserver) OnBytesWritten(int)                              {}
+func (nopConnObserver) OnMessageRead(uint32, message.TypeID, uint32)    {}
+func (nopConnObserver) OnMessageWritten(uint32, message.TypeID, uint32) {}
+func (nopConnObserver) OnChunkStreamCreated(int, bool)                  {}
+func (nopConnObserver) OnWriteQueueDepth(int)                           {}
+func (nopConnObserver) OnStreamCreated(uint32)                          {}
+func (nopConnObserver) OnStreamDeleted(uint32)                          {}
+func (nopConnObserver) OnClose()                                        {}
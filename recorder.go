@@ -0,0 +1,562 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yutopp/go-amf0"
+	"github.com/yutopp/go-flv"
+	flvtag "github.com/yutopp/go-flv/tag"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+const (
+	flvTagHeaderLength  = 11
+	flvPrevTagSizeBytes = 4
+)
+
+// RecordStorage A storage of files written by Recorder.
+type RecordStorage interface {
+	// Open opens a file named name. The file is created if it does not exist, and truncated unless appending is true.
+	Open(name string, appending bool) (RecordFile, error)
+}
+
+// RecordFile A file opened by RecordStorage. Recorder writes files by WriteAt to patch onMetaData on closing.
+type RecordFile interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+	Size() (int64, error)
+}
+
+// DirRecordStorage A RecordStorage which stores files under Dir in a local file system.
+type DirRecordStorage struct {
+	Dir string
+}
+
+func (s *DirRecordStorage) Open(name string, appending bool) (RecordFile, error) {
+	flag := os.O_RDWR | os.O_CREATE
+	if !appending {
+		flag |= os.O_TRUNC
+	}
+
+	p := filepath.Join(s.Dir, filepath.Clean(filepath.Join("/", name)))
+	f, err := os.OpenFile(p, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	return &osRecordFile{File: f}, nil
+}
+
+type osRecordFile struct {
+	*os.File
+}
+
+func (f *osRecordFile) Size() (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// RecorderConfig Configurations of Recorder.
+type RecorderConfig struct {
+	Storage RecordStorage
+
+	// MaxSize A file is rotated at the next key frame after its size exceeds MaxSize bytes. 0 means unlimited.
+	MaxSize int64
+	// MaxDuration A file is rotated at the next key frame after its duration exceeds MaxDuration. 0 means unlimited.
+	MaxDuration time.Duration
+
+	// FileName returns a name of the index-th file of the stream. "<name>.flv", "<name>-1.flv", ... are used if nil.
+	FileName func(name string, index int) string
+}
+
+func defaultRecordFileName(name string, index int) string {
+	if index == 0 {
+		return fmt.Sprintf("%s.flv", name)
+	}
+	return fmt.Sprintf("%s-%d.flv", name, index)
+}
+
+// Recorder writes a published stream to FLV files.
+//
+// Timestamps are rebased so that each file starts with 0, and continue from the last tag when appending.
+// onMetaData is written at the head of files, and its duration and filesize are patched when files are closed.
+type Recorder struct {
+	name      string
+	appending bool
+	config    RecorderConfig
+
+	file        RecordFile
+	index       int
+	size        int64
+	durationPos int64 // A position of the value of onMetaData.duration. 0 if it is not found
+	fileSizePos int64 // A position of the value of onMetaData.filesize. 0 if it is not found
+
+	hasBase        bool
+	baseTimestamp  uint32 // A timestamp of the stream which corresponds to startTimestamp
+	startTimestamp uint32
+	lastTimestamp  uint32
+	fileTimestamp  uint32 // A timestamp when the current file is opened
+
+	hasVideo       bool
+	metaData       amf0.ECMAArray // Kept to write it to rotated files
+	audioSeqHeader []byte
+	videoSeqHeader []byte
+
+	isClosed bool
+	m        sync.Mutex
+}
+
+// NewRecorder creates a recorder of a stream published by cmd.
+// A file is truncated if PublishingType is "record" or "live", and media are appended to it if "append".
+// Files are not opened until the first message is written.
+func NewRecorder(cmd *message.NetStreamPublish, config *RecorderConfig) (*Recorder, error) {
+	if config == nil || config.Storage == nil {
+		return nil, errors.New("Storage is not specified")
+	}
+	if cmd.PublishingName == "" {
+		return nil, errors.New("PublishingName is empty")
+	}
+
+	c := *config
+	if c.FileName == nil {
+		c.FileName = defaultRecordFileName
+	}
+
+	return &Recorder{
+		name:      cmd.PublishingName,
+		appending: cmd.PublishingType == "append",
+		config:    c,
+	}, nil
+}
+
+// WriteAudio writes a payload of an audio message as an FLV tag.
+func (r *Recorder) WriteAudio(timestamp uint32, payload []byte) error {
+	var h message.AudioHeader
+	if err := message.DecodeAudioHeader(bytes.NewReader(payload), &h); err != nil {
+		return errors.Wrap(err, "Failed to decode audio header")
+	}
+	isSeqHeader := (h.FourCC != 0 || h.IsMultitrack) && h.PacketType == message.AudioPacketTypeSequenceStart
+
+	return r.writeMedia(flvtag.TagTypeAudio, timestamp, payload, isSeqHeader, false)
+}
+
+// WriteVideo writes a payload of a video message as an FLV tag.
+func (r *Recorder) WriteVideo(timestamp uint32, payload []byte) error {
+	var h message.VideoHeader
+	if err := message.DecodeVideoHeader(bytes.NewReader(payload), &h); err != nil {
+		return errors.Wrap(err, "Failed to decode video header")
+	}
+	if h.FrameType == message.VideoFrameTypeCommand {
+		return r.writeMedia(flvtag.TagTypeVideo, timestamp, payload, false, false)
+	}
+	isSeqHeader := (h.FourCC != 0 || h.IsMultitrack) && h.PacketType == message.VideoPacketTypeSequenceStart
+	isKeyFrame := !isSeqHeader && h.FrameType == message.VideoFrameTypeKeyFrame
+
+	return r.writeMedia(flvtag.TagTypeVideo, timestamp, payload, isSeqHeader, isKeyFrame)
+}
+
+// WriteMetaData writes a payload of @setDataFrame. onMetaData is merged into the metadata at the head of files
+// if no media are written yet, otherwise it is written as a script data tag.
+func (r *Recorder) WriteMetaData(timestamp uint32, payload []byte) error {
+	var script flvtag.ScriptData
+	if err := flvtag.DecodeScriptData(bytes.NewReader(payload), &script); err != nil {
+		return errors.Wrap(err, "Failed to decode script data")
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.isClosed {
+		return errors.New("Recorder is closed")
+	}
+
+	if metaData, ok := script.Objects["onMetaData"]; ok {
+		r.metaData = metaData
+	}
+
+	if r.file == nil {
+		return r.open()
+	}
+
+	return r.writeTag(flvtag.TagTypeScriptData, r.rebase(timestamp), payload)
+}
+
+// Close patches onMetaData and closes the current file.
+func (r *Recorder) Close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.isClosed {
+		return nil
+	}
+	r.isClosed = true
+
+	return r.closeFile()
+}
+
+func (r *Recorder) writeMedia(ty flvtag.TagType, timestamp uint32, payload []byte, isSeqHeader, isKeyFrame bool) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.isClosed {
+		return errors.New("Recorder is closed")
+	}
+
+	if ty == flvtag.TagTypeVideo {
+		r.hasVideo = true
+	}
+	if isSeqHeader {
+		// Sequence headers are written again to rotated files
+		h := append([]byte{}, payload...)
+		if ty == flvtag.TagTypeAudio {
+			r.audioSeqHeader = h
+		} else {
+			r.videoSeqHeader = h
+		}
+	}
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	} else if !isSeqHeader && r.shouldRotate(ty, timestamp, isKeyFrame) {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+
+	return r.writeTag(ty, r.rebase(timestamp), payload)
+}
+
+func (r *Recorder) shouldRotate(ty flvtag.TagType, timestamp uint32, isKeyFrame bool) bool {
+	// Files are split at key frames. Audio only streams can be split at any frames
+	if ty == flvtag.TagTypeVideo && !isKeyFrame {
+		return false
+	}
+	if ty == flvtag.TagTypeAudio && r.hasVideo {
+		return false
+	}
+
+	if r.config.MaxSize > 0 && r.size >= r.config.MaxSize {
+		return true
+	}
+	if r.config.MaxDuration > 0 {
+		ts := r.lastTimestamp
+		if r.hasBase && timestamp >= r.baseTimestamp {
+			ts = r.startTimestamp + (timestamp - r.baseTimestamp)
+		}
+		if time.Duration(ts-r.fileTimestamp)*time.Millisecond >= r.config.MaxDuration {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Recorder) rotate() error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+
+	r.index++
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	for _, h := range []struct {
+		ty      flvtag.TagType
+		payload []byte
+	}{
+		{flvtag.TagTypeVideo, r.videoSeqHeader},
+		{flvtag.TagTypeAudio, r.audioSeqHeader},
+	} {
+		if h.payload == nil {
+			continue
+		}
+		if err := r.writeTag(h.ty, r.lastTimestamp, h.payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rebase Converts a timestamp of the stream into a timestamp in the current file.
+func (r *Recorder) rebase(timestamp uint32) uint32 {
+	if !r.hasBase || timestamp < r.baseTimestamp {
+		// The first message of the file, or timestamps are reset by a publisher
+		r.hasBase = true
+		r.baseTimestamp = timestamp
+		r.startTimestamp = r.lastTimestamp
+	}
+
+	ts := r.startTimestamp + (timestamp - r.baseTimestamp)
+	if ts > r.lastTimestamp {
+		r.lastTimestamp = ts
+	}
+
+	return ts
+}
+
+func (r *Recorder) open() error {
+	name := r.config.FileName(r.name, r.index)
+	appending := r.appending && r.index == 0 // Rotated files are always created
+
+	f, err := r.config.Storage.Open(name, appending)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open a file: Name = %s", name)
+	}
+
+	size, err := f.Size()
+	if err != nil {
+		_ = f.Close()
+		return errors.Wrapf(err, "Failed to get a size of a file: Name = %s", name)
+	}
+
+	r.file = f
+	r.size = 0
+	r.durationPos = 0
+	r.fileSizePos = 0
+	r.hasBase = false
+	r.lastTimestamp = 0
+
+	if size > 0 {
+		if err := r.loadFile(size); err != nil {
+			_ = f.Close()
+			r.file = nil
+			return errors.Wrapf(err, "Failed to append to a file: Name = %s", name)
+		}
+		r.fileTimestamp = r.lastTimestamp
+
+		return nil
+	}
+	r.fileTimestamp = 0
+
+	buf := new(bytes.Buffer)
+	if err := flv.EncodeFlvHeader(buf, &flv.Header{
+		Version:    1,
+		Flags:      flv.FlagsAudio | flv.FlagsVideo,
+		DataOffset: flv.HeaderLength,
+	}); err != nil {
+		return err
+	}
+	buf.Write(make([]byte, flvPrevTagSizeBytes)) // PreviousTagSize0 is always 0
+	if err := r.writeAt(buf.Bytes()); err != nil {
+		return err
+	}
+
+	body, durationOffset, fileSizeOffset, err := encodeRecordMetaData(r.metaData)
+	if err != nil {
+		return errors.Wrap(err, "Failed to encode onMetaData")
+	}
+	bodyPos := r.size + flvTagHeaderLength
+	if err := r.writeTag(flvtag.TagTypeScriptData, 0, body); err != nil {
+		return err
+	}
+	r.durationPos = bodyPos + int64(durationOffset)
+	r.fileSizePos = bodyPos + int64(fileSizeOffset)
+
+	return nil
+}
+
+// loadFile Reads the last timestamp and positions of onMetaData values from the existing file to append tags.
+func (r *Recorder) loadFile(size int64) error {
+	headerLength := int64(flv.HeaderLength) + flvPrevTagSizeBytes
+	if size < headerLength {
+		return errors.Errorf("File is too small: Size = %d", size)
+	}
+
+	header := make([]byte, headerLength)
+	if _, err := r.file.ReadAt(header, 0); err != nil {
+		return err
+	}
+	if !bytes.Equal(header[:3], flv.HeaderSignature) {
+		return errors.New("File is not FLV")
+	}
+
+	var buf [flvTagHeaderLength]byte
+	if _, err := r.file.ReadAt(buf[:flvPrevTagSizeBytes], size-flvPrevTagSizeBytes); err != nil {
+		return err
+	}
+	lastTagSize := int64(binary.BigEndian.Uint32(buf[:flvPrevTagSizeBytes]))
+	if lastTagSize > 0 {
+		pos := size - flvPrevTagSizeBytes - lastTagSize
+		if pos < headerLength {
+			return errors.Errorf("Invalid last tag size: Size = %d", lastTagSize)
+		}
+		if _, err := r.file.ReadAt(buf[:], pos); err != nil {
+			return err
+		}
+		r.lastTimestamp = uint32(buf[7])<<24 | uint32(buf[4])<<16 | uint32(buf[5])<<8 | uint32(buf[6])
+	}
+
+	r.size = size
+
+	// onMetaData is the first tag if it exists
+	if size < headerLength+flvTagHeaderLength {
+		return nil
+	}
+	if _, err := r.file.ReadAt(buf[:], headerLength); err != nil {
+		return err
+	}
+	if flvtag.TagType(buf[0]) != flvtag.TagTypeScriptData {
+		return nil
+	}
+	bodyLength := int64(buf[1])<<16 | int64(buf[2])<<8 | int64(buf[3])
+	bodyPos := headerLength + flvTagHeaderLength
+	if bodyPos+bodyLength > size {
+		return nil
+	}
+	body := make([]byte, bodyLength)
+	if _, err := r.file.ReadAt(body, bodyPos); err != nil {
+		return err
+	}
+	if offset := findAMFNumberProperty(body, "duration"); offset > 0 {
+		r.durationPos = bodyPos + int64(offset)
+	}
+	if offset := findAMFNumberProperty(body, "filesize"); offset > 0 {
+		r.fileSizePos = bodyPos + int64(offset)
+	}
+
+	return nil
+}
+
+func (r *Recorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+
+	if err := r.patchNumber(r.durationPos, float64(r.lastTimestamp)/1000); err != nil {
+		return err
+	}
+	if err := r.patchNumber(r.fileSizePos, float64(r.size)); err != nil {
+		return err
+	}
+
+	err := r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+func (r *Recorder) patchNumber(pos int64, v float64) error {
+	if pos == 0 {
+		return nil
+	}
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+	_, err := r.file.WriteAt(buf[:], pos)
+
+	return err
+}
+
+func (r *Recorder) writeTag(ty flvtag.TagType, timestamp uint32, body []byte) error {
+	if len(body) > 0xffffff {
+		return errors.Errorf("Tag is too large: Size = %d", len(body))
+	}
+
+	tagSize := flvTagHeaderLength + len(body)
+	buf := make([]byte, tagSize+flvPrevTagSizeBytes)
+
+	buf[0] = byte(ty)
+	buf[1], buf[2], buf[3] = byte(len(body)>>16), byte(len(body)>>8), byte(len(body))
+	buf[4], buf[5], buf[6] = byte(timestamp>>16), byte(timestamp>>8), byte(timestamp)
+	buf[7] = byte(timestamp >> 24) // TimestampExtended
+	// StreamID is always 0
+	copy(buf[flvTagHeaderLength:], body)
+	binary.BigEndian.PutUint32(buf[tagSize:], uint32(tagSize))
+
+	return r.writeAt(buf)
+}
+
+func (r *Recorder) writeAt(b []byte) error {
+	n, err := r.file.WriteAt(b, r.size)
+	r.size += int64(n)
+
+	return err
+}
+
+// encodeRecordMetaData Encodes onMetaData. duration and filesize are placed at first to be patched later.
+func encodeRecordMetaData(props amf0.ECMAArray) ([]byte, int, int, error) {
+	buf := new(bytes.Buffer)
+	enc := amf0.NewEncoder(buf)
+
+	if err := enc.Encode("onMetaData"); err != nil {
+		return nil, 0, 0, err
+	}
+
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		if k == "duration" || k == "filesize" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf.WriteByte(byte(amf0.MarkerEcmaArray))
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(keys)+2))
+
+	writeKey := func(k string) {
+		_ = binary.Write(buf, binary.BigEndian, uint16(len(k)))
+		buf.WriteString(k)
+	}
+
+	writeKey("duration")
+	buf.WriteByte(byte(amf0.MarkerNumber))
+	durationOffset := buf.Len()
+	buf.Write(make([]byte, 8))
+
+	writeKey("filesize")
+	buf.WriteByte(byte(amf0.MarkerNumber))
+	fileSizeOffset := buf.Len()
+	buf.Write(make([]byte, 8))
+
+	for _, k := range keys {
+		writeKey(k)
+		if err := enc.Encode(props[k]); err != nil {
+			return nil, 0, 0, errors.Wrapf(err, "Failed to encode a property: Key = %s", k)
+		}
+	}
+	buf.Write([]byte{0x00, 0x00, byte(amf0.MarkerObjectEnd)})
+
+	return buf.Bytes(), durationOffset, fileSizeOffset, nil
+}
+
+// findAMFNumberProperty returns an offset of a number value of the property named key in body. It returns 0 if not found.
+func findAMFNumberProperty(body []byte, key string) int {
+	pattern := make([]byte, 0, 2+len(key)+1)
+	pattern = append(pattern, byte(len(key)>>8), byte(len(key)))
+	pattern = append(pattern, key...)
+	pattern = append(pattern, byte(amf0.MarkerNumber))
+
+	i := bytes.Index(body, pattern)
+	if i < 0 || i+len(pattern)+8 > len(body) {
+		return 0
+	}
+
+	return i + len(pattern)
+}
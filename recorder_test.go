@@ -0,0 +1,303 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yutopp/go-amf0"
+	"github.com/yutopp/go-flv"
+	flvtag "github.com/yutopp/go-flv/tag"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type memRecordStorage struct {
+	files map[string]*memRecordFile
+	m     sync.Mutex
+}
+
+func newMemRecordStorage() *memRecordStorage {
+	return &memRecordStorage{
+		files: make(map[string]*memRecordFile),
+	}
+}
+
+func (s *memRecordStorage) Open(name string, appending bool) (RecordFile, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	f, ok := s.files[name]
+	if !ok || !appending {
+		f = &memRecordFile{}
+		s.files[name] = f
+	}
+
+	return f, nil
+}
+
+func (s *memRecordStorage) bytes(name string) []byte {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	f, ok := s.files[name]
+	if !ok {
+		return nil
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	return append([]byte{}, f.buf...)
+}
+
+type memRecordFile struct {
+	buf []byte
+	m   sync.Mutex
+}
+
+func (f *memRecordFile) ReadAt(p []byte, off int64) (int, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if off >= int64(len(f.buf)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.buf[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memRecordFile) WriteAt(p []byte, off int64) (int, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if end := off + int64(len(p)); end > int64(len(f.buf)) {
+		f.buf = append(f.buf, make([]byte, end-int64(len(f.buf)))...)
+	}
+	return copy(f.buf[off:], p), nil
+}
+
+func (f *memRecordFile) Close() error {
+	return nil
+}
+
+func (f *memRecordFile) Size() (int64, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	return int64(len(f.buf)), nil
+}
+
+type recordedTag struct {
+	tagType   flvtag.TagType
+	timestamp uint32
+}
+
+func readRecordedFile(t *testing.T, b []byte) (amf0.ECMAArray, []recordedTag) {
+	dec, err := flv.NewDecoder(bytes.NewReader(b))
+	require.Nil(t, err)
+
+	var metaData amf0.ECMAArray
+	var tags []recordedTag
+	for {
+		var tag flvtag.FlvTag
+		if err := dec.Decode(&tag); err != nil {
+			require.Equal(t, io.EOF, err)
+			break
+		}
+		if sd, ok := tag.Data.(*flvtag.ScriptData); ok && metaData == nil {
+			metaData = sd.Objects["onMetaData"]
+		}
+		tags = append(tags, recordedTag{tag.TagType, tag.Timestamp})
+		tag.Close()
+	}
+
+	return metaData, tags
+}
+
+var (
+	recordAVCSeqHeader = []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01, 0x64, 0x00, 0x1f, 0xff, 0xe0, 0x00}
+	recordAVCKeyFrame  = []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0xaa}
+	recordAVCInter     = []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0xbb}
+	recordAACSeqHeader = []byte{0xaf, 0x00, 0x12, 0x10}
+	recordAACRaw       = []byte{0xaf, 0x01, 0xcc}
+)
+
+func newRecordSetDataFrame(t *testing.T) []byte {
+	buf := new(bytes.Buffer)
+	err := flvtag.EncodeScriptData(buf, &flvtag.ScriptData{
+		Objects: map[string]amf0.ECMAArray{
+			"onMetaData": {"width": float64(1280), "duration": float64(0)},
+		},
+	})
+	require.Nil(t, err)
+
+	return buf.Bytes()
+}
+
+func TestRecorderRecord(t *testing.T) {
+	storage := newMemRecordStorage()
+	rec, err := NewRecorder(&message.NetStreamPublish{
+		PublishingName: "stream",
+		PublishingType: "record",
+	}, &RecorderConfig{
+		Storage: storage,
+	})
+	require.Nil(t, err)
+
+	require.Nil(t, rec.WriteMetaData(1000, newRecordSetDataFrame(t)))
+	require.Nil(t, rec.WriteVideo(1000, recordAVCSeqHeader))
+	require.Nil(t, rec.WriteAudio(1000, recordAACSeqHeader))
+	require.Nil(t, rec.WriteVideo(1000, recordAVCKeyFrame))
+	require.Nil(t, rec.WriteAudio(1023, recordAACRaw))
+	require.Nil(t, rec.WriteVideo(3500, recordAVCInter))
+	require.Nil(t, rec.Close())
+
+	b := storage.bytes("stream.flv")
+	metaData, tags := readRecordedFile(t, b)
+	require.Equal(t, amf0.ECMAArray{
+		"duration": float64(2.5),
+		"filesize": float64(len(b)),
+		"width":    float64(1280),
+	}, metaData)
+	require.Equal(t, []recordedTag{
+		{flvtag.TagTypeScriptData, 0},
+		{flvtag.TagTypeVideo, 0},
+		{flvtag.TagTypeAudio, 0},
+		{flvtag.TagTypeVideo, 0},
+		{flvtag.TagTypeAudio, 23},
+		{flvtag.TagTypeVideo, 2500},
+	}, tags)
+
+	err = rec.WriteVideo(4000, recordAVCInter)
+	require.Error(t, err)
+}
+
+func TestRecorderAppend(t *testing.T) {
+	storage := newMemRecordStorage()
+	cmd := &message.NetStreamPublish{
+		PublishingName: "stream",
+		PublishingType: "append",
+	}
+
+	for _, base := range []uint32{500, 0} {
+		rec, err := NewRecorder(cmd, &RecorderConfig{
+			Storage: storage,
+		})
+		require.Nil(t, err)
+
+		require.Nil(t, rec.WriteVideo(base, recordAVCKeyFrame))
+		require.Nil(t, rec.WriteVideo(base+1000, recordAVCInter))
+		require.Nil(t, rec.Close())
+	}
+
+	b := storage.bytes("stream.flv")
+	metaData, tags := readRecordedFile(t, b)
+	require.Equal(t, amf0.ECMAArray{
+		"duration": float64(2),
+		"filesize": float64(len(b)),
+	}, metaData)
+	require.Equal(t, []recordedTag{
+		{flvtag.TagTypeScriptData, 0},
+		{flvtag.TagTypeVideo, 0},
+		{flvtag.TagTypeVideo, 1000},
+		{flvtag.TagTypeVideo, 1000},
+		{flvtag.TagTypeVideo, 2000},
+	}, tags)
+}
+
+func TestRecorderRotate(t *testing.T) {
+	storage := newMemRecordStorage()
+	rec, err := NewRecorder(&message.NetStreamPublish{
+		PublishingName: "stream",
+		PublishingType: "live",
+	}, &RecorderConfig{
+		Storage:     storage,
+		MaxDuration: 2 * time.Second,
+	})
+	require.Nil(t, err)
+
+	require.Nil(t, rec.WriteVideo(0, recordAVCSeqHeader))
+	require.Nil(t, rec.WriteAudio(0, recordAACSeqHeader))
+	for ts := uint32(0); ts <= 5000; ts += 1000 {
+		require.Nil(t, rec.WriteVideo(ts, recordAVCKeyFrame))
+		require.Nil(t, rec.WriteVideo(ts+500, recordAVCInter))
+	}
+	require.Nil(t, rec.Close())
+
+	for i, expected := range [][]recordedTag{
+		{
+			{flvtag.TagTypeScriptData, 0},
+			{flvtag.TagTypeVideo, 0},
+			{flvtag.TagTypeAudio, 0},
+			{flvtag.TagTypeVideo, 0},
+			{flvtag.TagTypeVideo, 500},
+			{flvtag.TagTypeVideo, 1000},
+			{flvtag.TagTypeVideo, 1500},
+		},
+		{
+			{flvtag.TagTypeScriptData, 0},
+			{flvtag.TagTypeVideo, 0}, // Sequence headers are copied
+			{flvtag.TagTypeAudio, 0},
+			{flvtag.TagTypeVideo, 0},
+			{flvtag.TagTypeVideo, 500},
+			{flvtag.TagTypeVideo, 1000},
+			{flvtag.TagTypeVideo, 1500},
+		},
+		{
+			{flvtag.TagTypeScriptData, 0},
+			{flvtag.TagTypeVideo, 0},
+			{flvtag.TagTypeAudio, 0},
+			{flvtag.TagTypeVideo, 0},
+			{flvtag.TagTypeVideo, 500},
+			{flvtag.TagTypeVideo, 1000},
+			{flvtag.TagTypeVideo, 1500},
+		},
+	} {
+		name := defaultRecordFileName("stream", i)
+		metaData, tags := readRecordedFile(t, storage.bytes(name))
+		require.Equal(t, expected, tags, name)
+		require.Equal(t, float64(1.5), metaData["duration"], name)
+	}
+	require.Nil(t, storage.bytes(defaultRecordFileName("stream", 3)))
+}
+
+func TestDirRecordStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-rtmp-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	storage := &DirRecordStorage{Dir: dir}
+
+	f, err := storage.Open("../escaped.flv", false)
+	require.Nil(t, err)
+	_, err = f.WriteAt([]byte("abc"), 0)
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	f, err = storage.Open("../escaped.flv", true)
+	require.Nil(t, err)
+	size, err := f.Size()
+	require.Nil(t, err)
+	require.Equal(t, int64(3), size)
+	require.Nil(t, f.Close())
+
+	_, err = os.Stat(filepath.Join(dir, "escaped.flv"))
+	require.Nil(t, err)
+}
@@ -0,0 +1,78 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package relay
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/yutopp/go-rtmp"
+	"github.com/yutopp/go-rtmp/internal"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+const (
+	forwardChunkStreamIDAudio = 4
+	forwardChunkStreamIDData  = 5
+	forwardChunkStreamIDVideo = 6
+)
+
+// Forward writes packets of sub to a stream of conn until sub is closed or ctx is done.
+// It returns the reason why sub is closed. Timestamps are written as they are.
+func Forward(ctx context.Context, sub *Subscriber, conn *rtmp.Conn, streamID uint32) error {
+	for {
+		p, err := sub.Read(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := WritePacket(ctx, conn, streamID, p); err != nil {
+			return err
+		}
+	}
+}
+
+// WritePacket writes p to a stream of conn. Metadata are written as onMetaData data messages for players.
+func WritePacket(ctx context.Context, conn *rtmp.Conn, streamID uint32, p *Packet) error {
+	switch p.Type {
+	case PacketTypeAudio:
+		return conn.Write(ctx, forwardChunkStreamIDAudio, p.Timestamp, &rtmp.ChunkMessage{
+			StreamID: streamID,
+			Message: &message.AudioMessage{
+				Payload: bytes.NewReader(p.Payload),
+			},
+		})
+
+	case PacketTypeVideo:
+		return conn.Write(ctx, forwardChunkStreamIDVideo, p.Timestamp, &rtmp.ChunkMessage{
+			StreamID: streamID,
+			Message: &message.VideoMessage{
+				Payload: bytes.NewReader(p.Payload),
+			},
+		})
+
+	case PacketTypeMetaData:
+		name, body, ok := internal.SplitAMF0String(p.Payload)
+		if !ok {
+			name, body = "onMetaData", p.Payload
+		}
+		return conn.Write(ctx, forwardChunkStreamIDData, p.Timestamp, &rtmp.ChunkMessage{
+			StreamID: streamID,
+			Message: &message.DataMessage{
+				Name:     name,
+				Encoding: message.EncodingTypeAMF0,
+				Body:     bytes.NewReader(body),
+			},
+		})
+
+	default:
+		return errors.Errorf("Unknown packet type: %v", p.Type)
+	}
+}
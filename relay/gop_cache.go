@@ -0,0 +1,100 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package relay
+
+import (
+	"sort"
+)
+
+// gopCache Keeps packets which new subscribers need to start decoding.
+// Audio packets are cached only after a key frame, so audio only streams have no GOP.
+type gopCache struct {
+	maxSize int
+
+	metaData        *Packet
+	audioSeqHeaders map[uint8]*Packet // Per track
+	videoSeqHeaders map[uint8]*Packet // Per track
+	gop             []*Packet         // Starts from a key frame
+}
+
+func newGOPCache(maxSize int) *gopCache {
+	return &gopCache{
+		maxSize:         maxSize,
+		audioSeqHeaders: make(map[uint8]*Packet),
+		videoSeqHeaders: make(map[uint8]*Packet),
+	}
+}
+
+func (c *gopCache) add(p *Packet) {
+	switch {
+	case p.Type == PacketTypeMetaData:
+		c.metaData = p
+		return
+
+	case p.IsSequenceHeader && p.Type == PacketTypeAudio:
+		c.audioSeqHeaders[p.TrackID] = p
+		return
+
+	case p.IsSequenceHeader && p.Type == PacketTypeVideo:
+		c.videoSeqHeaders[p.TrackID] = p
+		return
+
+	case p.IsKeyFrame:
+		c.gop = c.gop[:0]
+	}
+
+	if len(c.gop) == 0 && !p.IsKeyFrame {
+		return // Waiting for a key frame
+	}
+
+	if len(c.gop) >= c.maxSize {
+		// Too long GOP. Wait for a next key frame not to keep unlimited packets
+		c.gop = c.gop[:0]
+		return
+	}
+
+	c.gop = append(c.gop, p)
+}
+
+func (c *gopCache) reset() {
+	c.metaData = nil
+	c.audioSeqHeaders = make(map[uint8]*Packet)
+	c.videoSeqHeaders = make(map[uint8]*Packet)
+	c.gop = nil
+}
+
+// headers Returns metadata and sequence headers. Video comes first as players expect.
+func (c *gopCache) headers() []*Packet {
+	var packets []*Packet
+	if c.metaData != nil {
+		packets = append(packets, c.metaData)
+	}
+	packets = appendSeqHeaders(packets, c.videoSeqHeaders)
+	packets = appendSeqHeaders(packets, c.audioSeqHeaders)
+
+	return packets
+}
+
+// packets Returns a copy of headers and the GOP.
+func (c *gopCache) packets() []*Packet {
+	return append(c.headers(), c.gop...)
+}
+
+func appendSeqHeaders(packets []*Packet, headers map[uint8]*Packet) []*Packet {
+	trackIDs := make([]int, 0, len(headers))
+	for id := range headers {
+		trackIDs = append(trackIDs, int(id))
+	}
+	sort.Ints(trackIDs)
+
+	for _, id := range trackIDs {
+		packets = append(packets, headers[uint8(id)])
+	}
+
+	return packets
+}
@@ -0,0 +1,40 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package relay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGOPCacheLimitsSize(t *testing.T) {
+	c := newGOPCache(3)
+
+	key := &Packet{Type: PacketTypeVideo, IsKeyFrame: true}
+	inter := &Packet{Type: PacketTypeVideo}
+	audioSeqHeader1 := &Packet{Type: PacketTypeAudio, IsSequenceHeader: true, TrackID: 1}
+	audioSeqHeader0 := &Packet{Type: PacketTypeAudio, IsSequenceHeader: true}
+
+	c.add(inter) // Not cached before a key frame
+	c.add(audioSeqHeader1)
+	c.add(audioSeqHeader0)
+	c.add(key)
+	c.add(inter)
+	c.add(inter)
+	require.Equal(t, []*Packet{audioSeqHeader0, audioSeqHeader1, key, inter, inter}, c.packets())
+
+	c.add(inter) // Exceeds the limit
+	require.Equal(t, []*Packet{audioSeqHeader0, audioSeqHeader1}, c.packets())
+
+	c.add(inter)
+	require.Equal(t, []*Packet{audioSeqHeader0, audioSeqHeader1}, c.packets())
+
+	c.add(key)
+	require.Equal(t, []*Packet{audioSeqHeader0, audioSeqHeader1, key}, c.packets())
+}
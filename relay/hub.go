@@ -0,0 +1,234 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package relay
+
+import (
+	"sync"
+)
+
+// SlowConsumerPolicy Decides what happens when a queue of a subscriber is full.
+type SlowConsumerPolicy int
+
+const (
+	// SlowConsumerDropFrames drops packets which do not fit. After a video frame is dropped, video frames are
+	// dropped until a next key frame, and dropped sequence headers are sent again before the key frame.
+	SlowConsumerDropFrames SlowConsumerPolicy = iota
+	// SlowConsumerDisconnect closes the subscriber with ErrSlowConsumer.
+	SlowConsumerDisconnect
+)
+
+// DuplicatePublisherPolicy Decides what happens when a stream which has a publisher is published again.
+type DuplicatePublisherPolicy int
+
+const (
+	// DuplicatePublisherReject makes Hub.Publish return ErrAlreadyPublished.
+	DuplicatePublisherReject DuplicatePublisherPolicy = iota
+	// DuplicatePublisherReplace closes the current publisher with ErrPublisherReplaced and keeps subscribers.
+	// Caches are cleared and subscribers resume from a next key frame of the new publisher.
+	DuplicatePublisherReplace
+)
+
+// HubConfig Configurations of Hub.
+type HubConfig struct {
+	// QueueSize is the number of packets which each subscriber can buffer. Default is 512.
+	QueueSize int
+
+	// MaxGOPSize is the number of packets which a GOP cache can keep. Longer GOPs are not cached. Default is 512.
+	MaxGOPSize int
+
+	SlowConsumerPolicy       SlowConsumerPolicy
+	DuplicatePublisherPolicy DuplicatePublisherPolicy
+}
+
+func (cb *HubConfig) normalize() *HubConfig {
+	c := HubConfig(*cb)
+
+	if c.QueueSize == 0 {
+		c.QueueSize = 512
+	}
+
+	if c.MaxGOPSize == 0 {
+		c.MaxGOPSize = 512
+	}
+
+	return &c
+}
+
+// Hub Streams which are relayed from publishers to subscribers by names.
+type Hub struct {
+	config *HubConfig
+
+	streams  map[string]*stream
+	isClosed bool
+	m        sync.Mutex
+}
+
+func NewHub(config *HubConfig) *Hub {
+	if config == nil {
+		config = &HubConfig{}
+	}
+	config = config.normalize()
+
+	return &Hub{
+		config:  config,
+		streams: make(map[string]*stream),
+	}
+}
+
+// Publish starts a stream named name. The stream is removed when the publisher is closed.
+func (h *Hub) Publish(name string) (*Publisher, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.isClosed {
+		return nil, ErrClosed
+	}
+
+	st, ok := h.streams[name]
+	if !ok {
+		st = newStream(h, name)
+		h.streams[name] = st
+	}
+
+	return st.publish()
+}
+
+// Subscribe starts receiving packets of a stream named name. Cached packets are queued first.
+func (h *Hub) Subscribe(name string) (*Subscriber, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.isClosed {
+		return nil, ErrClosed
+	}
+
+	st, ok := h.streams[name]
+	if !ok {
+		return nil, ErrNotPublished
+	}
+
+	return st.subscribe(), nil
+}
+
+// Close closes all publishers and subscribers with ErrClosed.
+func (h *Hub) Close() error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.isClosed {
+		return nil
+	}
+	h.isClosed = true
+
+	for name, st := range h.streams {
+		st.teardown(ErrClosed)
+		delete(h.streams, name)
+	}
+
+	return nil
+}
+
+func (h *Hub) remove(st *stream) {
+	if h.streams[st.name] == st {
+		delete(h.streams, st.name)
+	}
+}
+
+// stream A stream of a hub. Fields are guarded by m, which is locked after Hub.m.
+type stream struct {
+	hub  *Hub
+	name string
+
+	publisher   *Publisher
+	subscribers map[*Subscriber]struct{}
+	cache       *gopCache
+	m           sync.Mutex
+}
+
+func newStream(hub *Hub, name string) *stream {
+	return &stream{
+		hub:         hub,
+		name:        name,
+		subscribers: make(map[*Subscriber]struct{}),
+		cache:       newGOPCache(hub.config.MaxGOPSize),
+	}
+}
+
+func (st *stream) publish() (*Publisher, error) {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	if st.publisher != nil {
+		if st.hub.config.DuplicatePublisherPolicy != DuplicatePublisherReplace {
+			return nil, ErrAlreadyPublished
+		}
+
+		st.publisher.err = ErrPublisherReplaced
+		st.cache.reset()
+		for sub := range st.subscribers {
+			sub.waitKeyFrame = true
+			sub.needHeaders = false
+		}
+	}
+
+	st.publisher = &Publisher{stream: st}
+
+	return st.publisher, nil
+}
+
+func (st *stream) subscribe() *Subscriber {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	sub := &Subscriber{
+		stream: st,
+		queue:  make(chan *Packet, st.hub.config.QueueSize),
+		policy: st.hub.config.SlowConsumerPolicy,
+	}
+
+	if len(st.cache.gop) > 0 && sub.enqueue(st.cache.packets()) {
+		// Starts from the cached key frame
+	} else {
+		// The GOP does not fit. Video starts from a next key frame
+		sub.needHeaders = !sub.enqueue(st.cache.headers())
+		sub.waitKeyFrame = true
+	}
+	st.subscribers[sub] = struct{}{}
+
+	return sub
+}
+
+func (st *stream) write(pub *Publisher, p *Packet) error {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	if pub.err != nil {
+		return pub.err
+	}
+
+	st.cache.add(p)
+	for sub := range st.subscribers {
+		sub.push(p, st.cache)
+	}
+
+	return nil
+}
+
+// teardown Closes the publisher and subscribers. Subscribers can read packets which are already queued.
+func (st *stream) teardown(reason error) {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	if st.publisher != nil && st.publisher.err == nil {
+		st.publisher.err = ErrClosed
+	}
+	for sub := range st.subscribers {
+		sub.close(reason)
+		delete(st.subscribers, sub)
+	}
+}
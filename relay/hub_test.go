@@ -0,0 +1,271 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package relay
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testAVCSeqHeader = []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01, 0x64, 0x00, 0x1f, 0xff, 0xe0, 0x00}
+	testAVCKeyFrame  = []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0xaa}
+	testAVCInter     = []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0xbb}
+	testAACSeqHeader = []byte{0xaf, 0x00, 0x12, 0x10}
+	testAACRaw       = []byte{0xaf, 0x01, 0xcc}
+	testMetaData     = []byte{0x02, 0x00, 0x0a, 'o', 'n', 'M', 'e', 't', 'a', 'D', 'a', 't', 'a', 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x09}
+)
+
+type testPacket struct {
+	ty        PacketType
+	timestamp uint32
+}
+
+func writeTestVideo(t *testing.T, pub *Publisher, timestamp uint32, payload []byte) {
+	err := pub.WriteVideo(timestamp, bytes.NewReader(payload))
+	require.Nil(t, err)
+}
+
+func writeTestAudio(t *testing.T, pub *Publisher, timestamp uint32, payload []byte) {
+	err := pub.WriteAudio(timestamp, bytes.NewReader(payload))
+	require.Nil(t, err)
+}
+
+// readTestPackets Reads packets until the queue becomes empty or the subscriber is closed.
+func readTestPackets(t *testing.T, sub *Subscriber) ([]testPacket, error) {
+	var packets []testPacket
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		p, err := sub.Read(ctx)
+		cancel()
+		if err == context.DeadlineExceeded {
+			return packets, nil
+		}
+		if err != nil {
+			return packets, err
+		}
+		packets = append(packets, testPacket{p.Type, p.Timestamp})
+	}
+}
+
+func TestHubSubscriberStartsFromGOPCache(t *testing.T) {
+	hub := NewHub(nil)
+	defer hub.Close()
+
+	pub, err := hub.Publish("stream")
+	require.Nil(t, err)
+
+	require.Nil(t, pub.WriteMetaData(0, testMetaData))
+	writeTestVideo(t, pub, 0, testAVCSeqHeader)
+	writeTestAudio(t, pub, 0, testAACSeqHeader)
+	writeTestVideo(t, pub, 0, testAVCKeyFrame)
+	writeTestAudio(t, pub, 20, testAACRaw)
+	writeTestVideo(t, pub, 100, testAVCInter)
+	writeTestVideo(t, pub, 200, testAVCKeyFrame)
+	writeTestAudio(t, pub, 220, testAACRaw)
+
+	sub, err := hub.Subscribe("stream")
+	require.Nil(t, err)
+
+	writeTestVideo(t, pub, 300, testAVCInter)
+
+	packets, err := readTestPackets(t, sub)
+	require.Nil(t, err)
+	require.Equal(t, []testPacket{
+		{PacketTypeMetaData, 0},
+		{PacketTypeVideo, 0}, // Sequence headers
+		{PacketTypeAudio, 0},
+		{PacketTypeVideo, 200}, // The last GOP
+		{PacketTypeAudio, 220},
+		{PacketTypeVideo, 300},
+	}, packets)
+
+	_, err = hub.Subscribe("not-published")
+	require.Equal(t, ErrNotPublished, err)
+}
+
+func TestHubRejectsDuplicatePublisher(t *testing.T) {
+	hub := NewHub(nil)
+	defer hub.Close()
+
+	pub, err := hub.Publish("stream")
+	require.Nil(t, err)
+
+	_, err = hub.Publish("stream")
+	require.Equal(t, ErrAlreadyPublished, err)
+
+	require.Nil(t, pub.Close())
+
+	_, err = hub.Publish("stream")
+	require.Nil(t, err)
+}
+
+func TestHubReplacesDuplicatePublisher(t *testing.T) {
+	hub := NewHub(&HubConfig{
+		DuplicatePublisherPolicy: DuplicatePublisherReplace,
+	})
+	defer hub.Close()
+
+	pub1, err := hub.Publish("stream")
+	require.Nil(t, err)
+	writeTestVideo(t, pub1, 0, testAVCSeqHeader)
+	writeTestVideo(t, pub1, 0, testAVCKeyFrame)
+
+	sub, err := hub.Subscribe("stream")
+	require.Nil(t, err)
+
+	pub2, err := hub.Publish("stream")
+	require.Nil(t, err)
+
+	err = pub1.WriteVideo(100, bytes.NewReader(testAVCInter))
+	require.Equal(t, ErrPublisherReplaced, err)
+	require.Nil(t, pub1.Close()) // Does not remove the stream
+
+	writeTestVideo(t, pub2, 5000, testAVCInter) // Dropped until a key frame
+	writeTestVideo(t, pub2, 5000, testAVCSeqHeader)
+	writeTestVideo(t, pub2, 5100, testAVCKeyFrame)
+
+	packets, err := readTestPackets(t, sub)
+	require.Nil(t, err)
+	require.Equal(t, []testPacket{
+		{PacketTypeVideo, 0},
+		{PacketTypeVideo, 0},
+		{PacketTypeVideo, 5000},
+		{PacketTypeVideo, 5100},
+	}, packets)
+
+	// A new subscriber does not receive caches of the replaced publisher
+	sub2, err := hub.Subscribe("stream")
+	require.Nil(t, err)
+	packets, err = readTestPackets(t, sub2)
+	require.Nil(t, err)
+	require.Equal(t, []testPacket{
+		{PacketTypeVideo, 5000},
+		{PacketTypeVideo, 5100},
+	}, packets)
+}
+
+func TestHubDropsFramesOfSlowConsumer(t *testing.T) {
+	hub := NewHub(&HubConfig{
+		QueueSize: 4,
+	})
+	defer hub.Close()
+
+	pub, err := hub.Publish("stream")
+	require.Nil(t, err)
+
+	sub, err := hub.Subscribe("stream")
+	require.Nil(t, err)
+
+	writeTestVideo(t, pub, 0, testAVCSeqHeader)
+	writeTestVideo(t, pub, 0, testAVCKeyFrame)
+	writeTestVideo(t, pub, 100, testAVCInter)
+	writeTestVideo(t, pub, 200, testAVCInter)
+	writeTestVideo(t, pub, 300, testAVCInter) // Dropped
+	writeTestVideo(t, pub, 400, testAVCSeqHeader)
+
+	packets, err := readTestPackets(t, sub)
+	require.Nil(t, err)
+	require.Equal(t, []testPacket{
+		{PacketTypeVideo, 0},
+		{PacketTypeVideo, 0},
+		{PacketTypeVideo, 100},
+		{PacketTypeVideo, 200},
+	}, packets)
+
+	writeTestVideo(t, pub, 500, testAVCInter) // Dropped until a key frame
+	writeTestAudio(t, pub, 520, testAACRaw)
+	writeTestVideo(t, pub, 600, testAVCKeyFrame)
+
+	packets, err = readTestPackets(t, sub)
+	require.Nil(t, err)
+	require.Equal(t, []testPacket{
+		{PacketTypeAudio, 520},
+		{PacketTypeVideo, 400}, // The dropped sequence header is sent again
+		{PacketTypeVideo, 600},
+	}, packets)
+	require.Equal(t, uint64(3), sub.Dropped())
+}
+
+func TestHubDisconnectsSlowConsumer(t *testing.T) {
+	hub := NewHub(&HubConfig{
+		QueueSize:          2,
+		SlowConsumerPolicy: SlowConsumerDisconnect,
+	})
+	defer hub.Close()
+
+	pub, err := hub.Publish("stream")
+	require.Nil(t, err)
+
+	sub, err := hub.Subscribe("stream")
+	require.Nil(t, err)
+
+	writeTestVideo(t, pub, 0, testAVCKeyFrame)
+	writeTestVideo(t, pub, 100, testAVCInter)
+	writeTestVideo(t, pub, 200, testAVCInter) // Disconnects
+
+	packets, err := readTestPackets(t, sub)
+	require.Equal(t, ErrSlowConsumer, err)
+	require.Equal(t, []testPacket{
+		{PacketTypeVideo, 0},
+		{PacketTypeVideo, 100},
+	}, packets)
+
+	// The publisher is not affected
+	writeTestVideo(t, pub, 300, testAVCInter)
+}
+
+func TestHubTeardown(t *testing.T) {
+	hub := NewHub(nil)
+
+	pub, err := hub.Publish("stream")
+	require.Nil(t, err)
+
+	sub1, err := hub.Subscribe("stream")
+	require.Nil(t, err)
+	sub2, err := hub.Subscribe("stream")
+	require.Nil(t, err)
+
+	writeTestVideo(t, pub, 0, testAVCKeyFrame)
+
+	require.Nil(t, sub2.Close())
+	writeTestVideo(t, pub, 100, testAVCInter)
+	packets, err := readTestPackets(t, sub2)
+	require.Equal(t, ErrClosed, err)
+	require.Equal(t, []testPacket{{PacketTypeVideo, 0}}, packets)
+
+	require.Nil(t, pub.Close())
+	packets, err = readTestPackets(t, sub1)
+	require.Equal(t, ErrUnpublished, err)
+	require.Equal(t, []testPacket{{PacketTypeVideo, 0}, {PacketTypeVideo, 100}}, packets)
+
+	err = pub.WriteVideo(200, bytes.NewReader(testAVCInter))
+	require.Equal(t, ErrClosed, err)
+
+	_, err = hub.Subscribe("stream")
+	require.Equal(t, ErrNotPublished, err)
+
+	pub, err = hub.Publish("stream")
+	require.Nil(t, err)
+	sub3, err := hub.Subscribe("stream")
+	require.Nil(t, err)
+
+	require.Nil(t, hub.Close())
+	_, err = readTestPackets(t, sub3)
+	require.Equal(t, ErrClosed, err)
+
+	err = pub.WriteVideo(0, bytes.NewReader(testAVCKeyFrame))
+	require.Equal(t, ErrClosed, err)
+
+	_, err = hub.Publish("stream")
+	require.Equal(t, ErrClosed, err)
+}
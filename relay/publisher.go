@@ -0,0 +1,76 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package relay
+
+import (
+	"io"
+)
+
+// Publisher Writes packets to a stream. Writes never block on subscribers.
+type Publisher struct {
+	stream *stream
+	err    error // Guarded by stream.m. Set when the publisher is closed
+}
+
+// Name returns a name of the stream.
+func (p *Publisher) Name() string {
+	return p.stream.name
+}
+
+// Write relays p to subscribers. p must not be modified after calling it.
+func (p *Publisher) Write(pkt *Packet) error {
+	return p.stream.write(p, pkt)
+}
+
+// WriteAudio relays a payload of message.AudioMessage.
+func (p *Publisher) WriteAudio(timestamp uint32, payload io.Reader) error {
+	pkt, err := NewAudioPacket(timestamp, payload)
+	if err != nil {
+		return err
+	}
+	return p.Write(pkt)
+}
+
+// WriteVideo relays a payload of message.VideoMessage.
+func (p *Publisher) WriteVideo(timestamp uint32, payload io.Reader) error {
+	pkt, err := NewVideoPacket(timestamp, payload)
+	if err != nil {
+		return err
+	}
+	return p.Write(pkt)
+}
+
+// WriteMetaData relays a payload of @setDataFrame. payload is copied.
+func (p *Publisher) WriteMetaData(timestamp uint32, payload []byte) error {
+	return p.Write(NewMetaDataPacket(timestamp, payload))
+}
+
+// Close removes the stream from the hub and closes subscribers with ErrUnpublished.
+// It does nothing if the publisher is already replaced or closed.
+func (p *Publisher) Close() error {
+	st := p.stream
+
+	st.hub.m.Lock()
+	defer st.hub.m.Unlock()
+
+	st.m.Lock()
+	isCurrent := st.publisher == p && p.err == nil
+	if p.err == nil {
+		p.err = ErrClosed
+	}
+	st.m.Unlock()
+
+	if !isCurrent {
+		return nil
+	}
+
+	st.hub.remove(st)
+	st.teardown(ErrUnpublished)
+
+	return nil
+}
@@ -0,0 +1,425 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package relay
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/yutopp/go-rtmp"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+// PushState A state of a push destination.
+type PushState int
+
+const (
+	PushStateConnecting PushState = iota
+	PushStatePublishing
+	PushStateWaiting // Waiting to reconnect
+	PushStateStopped
+)
+
+func (s PushState) String() string {
+	switch s {
+	case PushStateConnecting:
+		return "Connecting"
+	case PushStatePublishing:
+		return "Publishing"
+	case PushStateWaiting:
+		return "Waiting"
+	case PushStateStopped:
+		return "Stopped"
+	default:
+		return "<Unknown>"
+	}
+}
+
+// PushStatus A status of a push destination.
+type PushStatus struct {
+	URL         string
+	State       PushState
+	LastError   error     // A reason of the last failure
+	Retries     int       // The number of reconnections
+	PublishedAt time.Time // When the current publishing is started
+}
+
+// PushConfig Configurations of Pusher.
+type PushConfig struct {
+	// URLs are destinations to publish. The last element of each path is a publishing name. e.g. rtmp://host/app/key
+	URLs []string
+
+	// Timeout limits dialing, connecting, creating a stream and waiting for NetStream.Publish.Start. Default is 10s.
+	Timeout time.Duration
+
+	// MinBackoff is a first interval to reconnect. It is doubled on each failure up to MaxBackoff.
+	// Default is 1s and 30s. The interval is reset after publishing longer than MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// ChunkSize is sent to destinations. Default is 4096.
+	ChunkSize uint32
+
+	// OnStatusChange is called when a status of a destination is changed. It must not block.
+	OnStatusChange func(status PushStatus)
+
+	Logger logrus.FieldLogger
+}
+
+func (cb *PushConfig) normalize() *PushConfig {
+	c := PushConfig(*cb)
+
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+
+	if c.MinBackoff == 0 {
+		c.MinBackoff = 1 * time.Second
+	}
+
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = 30 * time.Second
+	}
+
+	if c.ChunkSize == 0 {
+		c.ChunkSize = 4096
+	}
+
+	if c.Logger == nil {
+		l := logrus.New()
+		l.Out = ioutil.Discard
+
+		c.Logger = l
+	}
+
+	return &c
+}
+
+// Pusher Publishes a stream of a hub to destinations. Each destination has its own subscriber and
+// connection, so a failure of a destination does not affect others.
+type Pusher struct {
+	dests  []*pushDestination
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPusher starts pushing a stream named name. Pushing to all destinations is stopped when the stream is unpublished.
+func NewPusher(hub *Hub, name string, config *PushConfig) (*Pusher, error) {
+	if config == nil {
+		config = &PushConfig{}
+	}
+	config = config.normalize()
+
+	for _, rawurl := range config.URLs {
+		u, err := rtmp.ParseURL(rawurl)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid URL: URL = %s", rawurl)
+		}
+		if u.PlayPath() == "" {
+			return nil, errors.Errorf("Publishing name is empty: URL = %s", rawurl)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pusher{
+		cancel: cancel,
+	}
+	for _, rawurl := range config.URLs {
+		d := &pushDestination{
+			hub:    hub,
+			name:   name,
+			url:    rawurl,
+			config: config,
+			status: PushStatus{
+				URL:   rawurl,
+				State: PushStateConnecting,
+			},
+		}
+		p.dests = append(p.dests, d)
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			d.run(ctx)
+		}()
+	}
+
+	return p, nil
+}
+
+// Status returns statuses of destinations in order of PushConfig.URLs.
+func (p *Pusher) Status() []PushStatus {
+	statuses := make([]PushStatus, len(p.dests))
+	for i, d := range p.dests {
+		statuses[i] = d.currentStatus()
+	}
+	return statuses
+}
+
+// Close stops pushing and waits for connections to be closed.
+func (p *Pusher) Close() error {
+	p.cancel()
+	p.wg.Wait()
+
+	return nil
+}
+
+type pushDestination struct {
+	hub    *Hub
+	name   string
+	url    string
+	config *PushConfig
+
+	status PushStatus
+	m      sync.Mutex
+}
+
+func (d *pushDestination) run(ctx context.Context) {
+	l := d.config.Logger.WithField("url", d.url)
+
+	backoff := d.config.MinBackoff
+	for {
+		startedAt := time.Now()
+		err := d.push(ctx)
+		if ctx.Err() != nil {
+			d.updateStatus(PushStateStopped, nil)
+			return
+		}
+		if err == ErrUnpublished || err == ErrNotPublished || err == ErrClosed {
+			l.Infof("Source stream is finished: Err = %+v", err)
+			d.updateStatus(PushStateStopped, err)
+			return
+		}
+
+		if time.Since(startedAt) > d.config.MaxBackoff {
+			backoff = d.config.MinBackoff
+		}
+		l.Warnf("Failed to push. Reconnecting...: Backoff = %s, Err = %+v", backoff, err)
+		d.updateStatus(PushStateWaiting, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			d.updateStatus(PushStateStopped, nil)
+			return
+		}
+
+		backoff *= 2
+		if backoff > d.config.MaxBackoff {
+			backoff = d.config.MaxBackoff
+		}
+
+		d.m.Lock()
+		d.status.Retries++
+		d.m.Unlock()
+		d.updateStatus(PushStateConnecting, nil)
+	}
+}
+
+// push Publishes a stream until an error occurs. A new subscriber starts from cached headers and the GOP.
+func (d *pushDestination) push(ctx context.Context) error {
+	sub, err := d.hub.Subscribe(d.name)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	statusCh := make(chan *message.NetStreamOnStatus, 1)
+	s, cc, err := d.publish(ctx, statusCh)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	d.updateStatus(PushStatePublishing, nil)
+
+	// Stop reading packets when the connection is closed
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-cc.Done():
+			cancel()
+		case <-connCtx.Done():
+		}
+	}()
+
+	var base uint32
+	isBaseSet := false
+	for {
+		p, err := sub.Read(connCtx)
+		if err != nil {
+			if connCtx.Err() != nil && ctx.Err() == nil {
+				if err := cc.LastError(); err != nil {
+					return errors.Wrap(err, "Connection is closed")
+				}
+				return rtmp.ErrConnectionClosed
+			}
+			return err
+		}
+
+		select {
+		case status := <-statusCh:
+			if status.InfoObject.Level == message.NetStreamOnStatusLevelError {
+				return errors.Errorf("Publishing is stopped: Code = %s", status.InfoObject.Code)
+			}
+		default:
+		}
+
+		// Cached headers come first with timestamps which are not related to media. They are sent at the start, and
+		// timestamps are rebased from the first media.
+		isHeader := p.Type == PacketTypeMetaData || p.IsSequenceHeader
+		if !isBaseSet && !isHeader {
+			base = p.Timestamp
+			isBaseSet = true
+		}
+		timestamp := uint32(0)
+		if isBaseSet && int32(p.Timestamp-base) > 0 {
+			timestamp = p.Timestamp - base
+		}
+
+		if err := writePushPacket(s, timestamp, p); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *pushDestination) publish(
+	ctx context.Context,
+	statusCh chan *message.NetStreamOnStatus,
+) (*rtmp.Stream, *rtmp.ClientConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.config.Timeout)
+	defer cancel()
+
+	cc, err := rtmp.DialURL(ctx, d.url, &rtmp.ConnConfig{
+		Handler: &pushHandler{statusCh: statusCh},
+		Logger:  d.config.Logger,
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to dial")
+	}
+
+	// Abort waiting for responses by closing the connection
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = cc.Close()
+		case <-doneCh:
+		}
+	}()
+
+	s, err := cc.CreateStream(nil, d.config.ChunkSize)
+	if err != nil {
+		_ = cc.Close()
+		return nil, nil, errors.Wrap(err, "Failed to create stream")
+	}
+
+	if err := s.Publish(&message.NetStreamPublish{
+		PublishingName: cc.URL().PlayPath(),
+		PublishingType: "live",
+	}); err != nil {
+		_ = cc.Close()
+		return nil, nil, errors.Wrap(err, "Failed to publish")
+	}
+
+	for {
+		select {
+		case status := <-statusCh:
+			switch {
+			case status.InfoObject.Code == message.NetStreamOnStatusCodePublishStart:
+				return s, cc, nil
+			case status.InfoObject.Level == message.NetStreamOnStatusLevelError:
+				_ = cc.Close()
+				return nil, nil, errors.Errorf("Publishing is rejected: Code = %s", status.InfoObject.Code)
+			}
+
+		case <-ctx.Done():
+			_ = cc.Close()
+			return nil, nil, errors.Wrap(ctx.Err(), "Failed to wait for NetStream.Publish.Start")
+		}
+	}
+}
+
+func (d *pushDestination) currentStatus() PushStatus {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	return d.status
+}
+
+func (d *pushDestination) updateStatus(state PushState, err error) {
+	d.m.Lock()
+	d.status.State = state
+	if err != nil {
+		d.status.LastError = err
+	}
+	if state == PushStatePublishing {
+		d.status.PublishedAt = time.Now()
+	}
+	status := d.status
+	d.m.Unlock()
+
+	if d.config.OnStatusChange != nil {
+		d.config.OnStatusChange(status)
+	}
+}
+
+func writePushPacket(s *rtmp.Stream, timestamp uint32, p *Packet) error {
+	switch p.Type {
+	case PacketTypeAudio:
+		return s.Write(forwardChunkStreamIDAudio, timestamp, &message.AudioMessage{
+			Payload: bytes.NewReader(p.Payload),
+		})
+
+	case PacketTypeVideo:
+		return s.Write(forwardChunkStreamIDVideo, timestamp, &message.VideoMessage{
+			Payload: bytes.NewReader(p.Payload),
+		})
+
+	case PacketTypeMetaData:
+		return s.Write(forwardChunkStreamIDData, timestamp, &message.DataMessage{
+			Name:     "@setDataFrame",
+			Encoding: message.EncodingTypeAMF0,
+			Body:     bytes.NewReader(p.Payload),
+		})
+
+	default:
+		return errors.Errorf("Unknown packet type: %v", p.Type)
+	}
+}
+
+// pushHandler Receives statuses from a destination.
+type pushHandler struct {
+	rtmp.DefaultHandler
+	statusCh chan *message.NetStreamOnStatus
+}
+
+var _ rtmp.StatusHandler = (*pushHandler)(nil)
+
+func (h *pushHandler) OnStatus(_ uint32, status *message.NetStreamOnStatus) error {
+	select {
+	case h.statusCh <- status:
+	default:
+		// Keep only the first status not to block the connection
+	}
+	return nil
+}
+
+func (h *pushHandler) OnPlayStatus(_ uint32, _ *message.NetStreamOnPlayStatus) error {
+	return nil
+}
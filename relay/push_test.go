@@ -0,0 +1,187 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package relay
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type upstreamEvent struct {
+	name      string // "publish:<name>", "metadata", "audio" or "video"
+	timestamp uint32
+}
+
+type upstreamHandler struct {
+	rtmp.DefaultHandler
+	rejects *int32
+	eventCh chan upstreamEvent
+}
+
+func (h *upstreamHandler) OnPublish(_ *rtmp.StreamContext, timestamp uint32, cmd *message.NetStreamPublish) error {
+	h.eventCh <- upstreamEvent{"publish:" + cmd.PublishingName, timestamp}
+	if atomic.AddInt32(h.rejects, -1) >= 0 {
+		return errors.New("Rejected")
+	}
+	return nil
+}
+
+func (h *upstreamHandler) OnSetDataFrame(timestamp uint32, _ *message.NetStreamSetDataFrame) error {
+	h.eventCh <- upstreamEvent{"metadata", timestamp}
+	return nil
+}
+
+func (h *upstreamHandler) OnAudio(timestamp uint32, payload io.Reader) error {
+	_, _ = io.Copy(ioutil.Discard, payload)
+	h.eventCh <- upstreamEvent{"audio", timestamp}
+	return nil
+}
+
+func (h *upstreamHandler) OnVideo(timestamp uint32, payload io.Reader) error {
+	_, _ = io.Copy(ioutil.Discard, payload)
+	h.eventCh <- upstreamEvent{"video", timestamp}
+	return nil
+}
+
+// startUpstream Starts a server which rejects first publishes as many as rejects.
+func startUpstream(t *testing.T, rejects int32) (string, <-chan upstreamEvent, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	require.Nil(t, err)
+
+	eventCh := make(chan upstreamEvent, 64)
+	srv := rtmp.NewServer(&rtmp.ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *rtmp.ConnConfig) {
+			return conn, &rtmp.ConnConfig{
+				Handler: &upstreamHandler{rejects: &rejects, eventCh: eventCh},
+			}
+		},
+	})
+	go func() {
+		_ = srv.Serve(l)
+	}()
+
+	return fmt.Sprintf("rtmp://%s/app", l.Addr().String()), eventCh, func() {
+		_ = srv.Close()
+	}
+}
+
+func waitUpstreamEvents(t *testing.T, eventCh <-chan upstreamEvent, n int) []upstreamEvent {
+	events := make([]upstreamEvent, 0, n)
+	for len(events) < n {
+		select {
+		case ev := <-eventCh:
+			events = append(events, ev)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, fmt.Sprintf("Timeout: Events = %v", events))
+		}
+	}
+	return events
+}
+
+func waitPushStatus(t *testing.T, pusher *Pusher, f func(statuses []PushStatus) bool) []PushStatus {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		statuses := pusher.Status()
+		if f(statuses) {
+			return statuses
+		}
+		if time.Now().After(deadline) {
+			require.FailNow(t, fmt.Sprintf("Timeout: Statuses = %+v", statuses))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPusherPushesToDestinations(t *testing.T) {
+	hub := NewHub(nil)
+	defer hub.Close()
+
+	pub, err := hub.Publish("src")
+	require.Nil(t, err)
+
+	// Headers are often sent at 0 before media
+	require.Nil(t, pub.WriteMetaData(0, testMetaData))
+	writeTestVideo(t, pub, 0, testAVCSeqHeader)
+	writeTestAudio(t, pub, 0, testAACSeqHeader)
+	writeTestVideo(t, pub, 10000, testAVCKeyFrame)
+	writeTestVideo(t, pub, 10100, testAVCInter)
+
+	upstreamURL, eventCh, stop := startUpstream(t, 1) // Rejects the first publish
+	defer stop()
+
+	// A destination which is not listened
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	require.Nil(t, err)
+	deadURL := fmt.Sprintf("rtmp://%s/app/dead", l.Addr().String())
+	require.Nil(t, l.Close())
+
+	var changes int32
+	pusher, err := NewPusher(hub, "src", &PushConfig{
+		URLs:       []string{upstreamURL + "/key", deadURL},
+		Timeout:    2 * time.Second,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+		OnStatusChange: func(status PushStatus) {
+			atomic.AddInt32(&changes, 1)
+		},
+	})
+	require.Nil(t, err)
+	defer pusher.Close()
+
+	events := waitUpstreamEvents(t, eventCh, 7)
+	require.Equal(t, []upstreamEvent{
+		{"publish:key", 0}, // Rejected
+		{"publish:key", 0},
+		{"metadata", 0}, // Timestamps are rebased from the first media
+		{"video", 0},
+		{"audio", 0},
+		{"video", 0},
+		{"video", 100},
+	}, events)
+
+	writeTestVideo(t, pub, 10200, testAVCInter)
+	events = waitUpstreamEvents(t, eventCh, 1)
+	require.Equal(t, []upstreamEvent{{"video", 200}}, events)
+
+	statuses := waitPushStatus(t, pusher, func(statuses []PushStatus) bool {
+		return statuses[1].Retries >= 2
+	})
+	require.Equal(t, PushStatePublishing, statuses[0].State)
+	require.Equal(t, 1, statuses[0].Retries)
+	require.NotNil(t, statuses[0].LastError)
+	require.NotNil(t, statuses[1].LastError)
+	require.True(t, atomic.LoadInt32(&changes) > 0)
+
+	// Pushing is stopped when the source is unpublished
+	require.Nil(t, pub.Close())
+	statuses = waitPushStatus(t, pusher, func(statuses []PushStatus) bool {
+		return statuses[0].State == PushStateStopped && statuses[1].State == PushStateStopped
+	})
+	require.Equal(t, ErrUnpublished, statuses[0].LastError)
+}
+
+func TestPusherRejectsInvalidURL(t *testing.T) {
+	hub := NewHub(nil)
+	defer hub.Close()
+
+	_, err := NewPusher(hub, "src", &PushConfig{
+		URLs: []string{"rtmp://127.0.0.1/app"},
+	})
+	require.Error(t, err)
+}
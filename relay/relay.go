@@ -0,0 +1,136 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package relay fans out live media from a publisher to subscribers.
+//
+// A Hub keeps streams by names. Each stream has a publisher and subscribers which have their own bounded queues,
+// so a slow subscriber never blocks the publisher and other subscribers. Streams cache metadata, sequence headers
+// and the latest GOP, and new subscribers start from them.
+//
+// Pusher publishes a stream of a Hub to upstream servers, and reconnects to each of them independently.
+package relay
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+
+	"github.com/yutopp/go-rtmp/media"
+)
+
+var (
+	// ErrAlreadyPublished is returned by Hub.Publish when the stream has a publisher.
+	ErrAlreadyPublished = errors.New("Already published")
+
+	// ErrNotPublished is returned by Hub.Subscribe when the stream has no publisher.
+	ErrNotPublished = errors.New("Not published")
+
+	// ErrUnpublished is returned by Subscriber.Read after the publisher is closed.
+	ErrUnpublished = errors.New("Publisher is closed")
+
+	// ErrPublisherReplaced is returned by writes of a publisher which is replaced by a new publisher.
+	ErrPublisherReplaced = errors.New("Publisher is replaced")
+
+	// ErrSlowConsumer is returned by Subscriber.Read after the subscriber is disconnected because its queue is full.
+	ErrSlowConsumer = errors.New("Subscriber is too slow")
+
+	// ErrClosed is returned after the publisher, the subscriber or the hub is closed.
+	ErrClosed = errors.New("Closed")
+)
+
+// PacketType A type of packets.
+type PacketType int
+
+const (
+	PacketTypeAudio PacketType = iota + 1
+	PacketTypeVideo
+	PacketTypeMetaData
+)
+
+func (t PacketType) String() string {
+	switch t {
+	case PacketTypeAudio:
+		return "Audio"
+	case PacketTypeVideo:
+		return "Video"
+	case PacketTypeMetaData:
+		return "MetaData"
+	default:
+		return "<Unknown>"
+	}
+}
+
+// Packet A relayed message. Packets are shared by subscribers, so Payload must not be modified.
+type Packet struct {
+	Type      PacketType
+	Timestamp uint32
+
+	// Payload of message.AudioMessage or message.VideoMessage.
+	// For PacketTypeMetaData, it is a payload of @setDataFrame (message.NetStreamSetDataFrame.Payload).
+	Payload []byte
+
+	IsKeyFrame       bool  // Video only
+	IsSequenceHeader bool  // Codec configurations of audio or video
+	TrackID          uint8 // A track of the first frame in Enhanced RTMP multitrack packets
+}
+
+// NewAudioPacket reads payload and classifies it. Payloads which cannot be parsed are relayed as they are.
+func NewAudioPacket(timestamp uint32, payload io.Reader) (*Packet, error) {
+	b, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read audio payload")
+	}
+
+	p := &Packet{
+		Type:      PacketTypeAudio,
+		Timestamp: timestamp,
+		Payload:   b,
+	}
+	if frames, err := media.DecodeAudioFrames(bytes.NewReader(b)); err == nil && len(frames) > 0 {
+		p.IsSequenceHeader = frames[0].IsSequenceHeader()
+		p.TrackID = frames[0].TrackID
+	}
+
+	return p, nil
+}
+
+// NewVideoPacket reads payload and classifies it. Payloads which cannot be parsed are relayed as they are.
+func NewVideoPacket(timestamp uint32, payload io.Reader) (*Packet, error) {
+	b, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read video payload")
+	}
+
+	p := &Packet{
+		Type:      PacketTypeVideo,
+		Timestamp: timestamp,
+		Payload:   b,
+	}
+	if frames, err := media.DecodeVideoFrames(bytes.NewReader(b)); err == nil && len(frames) > 0 {
+		p.IsSequenceHeader = frames[0].IsSequenceHeader()
+		p.IsKeyFrame = frames[0].IsKeyFrame()
+		p.TrackID = frames[0].TrackID
+	}
+
+	return p, nil
+}
+
+// NewMetaDataPacket copies payload of @setDataFrame.
+func NewMetaDataPacket(timestamp uint32, payload []byte) *Packet {
+	return &Packet{
+		Type:      PacketTypeMetaData,
+		Timestamp: timestamp,
+		Payload:   append([]byte{}, payload...),
+	}
+}
+
+// isHeader Packets which are needed to decode following frames.
+func (p *Packet) isHeader() bool {
+	return p.Type == PacketTypeMetaData || p.IsSequenceHeader
+}
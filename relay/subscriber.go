@@ -0,0 +1,121 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package relay
+
+import (
+	"context"
+)
+
+// Subscriber Receives packets of a stream through a bounded queue.
+type Subscriber struct {
+	stream *stream
+	queue  chan *Packet
+	policy SlowConsumerPolicy
+
+	// Fields below are guarded by stream.m
+	isClosed     bool
+	closeReason  error // Written before closing queue
+	waitKeyFrame bool  // Drops video until a key frame
+	needHeaders  bool  // Sends headers before a next key frame
+	dropped      uint64
+}
+
+// Read returns a next packet. After the subscriber is closed, it returns queued packets and then the reason.
+// The reason is ErrUnpublished, ErrSlowConsumer or ErrClosed.
+func (s *Subscriber) Read(ctx context.Context) (*Packet, error) {
+	select {
+	case p, ok := <-s.queue:
+		if !ok {
+			return nil, s.closeReason
+		}
+		return p, nil
+
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Dropped returns the number of packets which are dropped because the queue was full.
+func (s *Subscriber) Dropped() uint64 {
+	s.stream.m.Lock()
+	defer s.stream.m.Unlock()
+
+	return s.dropped
+}
+
+// Close stops receiving packets.
+func (s *Subscriber) Close() error {
+	s.stream.m.Lock()
+	defer s.stream.m.Unlock()
+
+	if s.isClosed {
+		return nil
+	}
+	delete(s.stream.subscribers, s)
+	s.close(ErrClosed)
+
+	return nil
+}
+
+func (s *Subscriber) close(reason error) {
+	if s.isClosed {
+		return
+	}
+	s.isClosed = true
+	s.closeReason = reason
+	close(s.queue)
+}
+
+func (s *Subscriber) push(p *Packet, cache *gopCache) {
+	if s.isClosed {
+		return
+	}
+
+	if p.Type == PacketTypeVideo && s.waitKeyFrame && !p.IsKeyFrame && !p.isHeader() {
+		s.dropped++
+		return
+	}
+
+	packets := []*Packet{p}
+	if p.IsKeyFrame && s.needHeaders {
+		packets = append(cache.headers(), p)
+	}
+
+	if !s.enqueue(packets) {
+		if s.policy == SlowConsumerDisconnect {
+			delete(s.stream.subscribers, s)
+			s.close(ErrSlowConsumer)
+			return
+		}
+
+		s.dropped++
+		if p.isHeader() {
+			s.needHeaders = true
+		}
+		if p.Type == PacketTypeVideo {
+			s.waitKeyFrame = true
+		}
+		return
+	}
+
+	if p.IsKeyFrame {
+		s.waitKeyFrame = false
+		s.needHeaders = false
+	}
+}
+
+// enqueue Queues all packets or nothing. Only a stream which holds stream.m writes to the queue.
+func (s *Subscriber) enqueue(packets []*Packet) bool {
+	if cap(s.queue)-len(s.queue) < len(packets) {
+		return false
+	}
+	for _, p := range packets {
+		s.queue <- p
+	}
+	return true
+}
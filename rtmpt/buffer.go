@@ -0,0 +1,177 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmpt
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// buffer A blocking byte buffer. Read waits until data arrives, the buffer is closed or the read deadline exceeds.
+// If the buffer has a limit, Write waits until there is a space, the buffer is closed or the write deadline exceeds.
+type buffer struct {
+	buf      bytes.Buffer
+	limit    int // Unlimited if it is zero
+	closed   bool
+	notifyCh chan struct{} // Signaled when data is written
+
+	readDeadline  deadline
+	writeDeadline deadline
+
+	m    sync.Mutex
+	cond *sync.Cond
+}
+
+func newBuffer(limit int) *buffer {
+	b := &buffer{
+		limit:    limit,
+		notifyCh: make(chan struct{}, 1),
+	}
+	b.cond = sync.NewCond(&b.m)
+
+	return b
+}
+
+func (b *buffer) Read(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	for b.buf.Len() == 0 {
+		if b.closed {
+			return 0, io.EOF
+		}
+		if b.readDeadline.exceeded() {
+			return 0, os.ErrDeadlineExceeded
+		}
+		b.cond.Wait()
+	}
+
+	n, err := b.buf.Read(p)
+	b.cond.Broadcast() // Writers may wait for a space
+
+	return n, err
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	written := 0
+	for {
+		if b.closed {
+			return written, io.ErrClosedPipe
+		}
+
+		n := len(p) - written
+		if b.limit > 0 && n > b.limit-b.buf.Len() {
+			n = b.limit - b.buf.Len()
+		}
+		if n > 0 {
+			_, _ = b.buf.Write(p[written : written+n])
+			written += n
+			b.cond.Broadcast()
+
+			select {
+			case b.notifyCh <- struct{}{}:
+			default:
+			}
+		}
+		if written == len(p) {
+			return written, nil
+		}
+
+		if b.writeDeadline.exceeded() {
+			return written, os.ErrDeadlineExceeded
+		}
+		b.cond.Wait()
+	}
+}
+
+// Drain takes all buffered data without blocking.
+func (b *buffer) Drain() []byte {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.buf.Len() == 0 {
+		return nil
+	}
+
+	data := make([]byte, b.buf.Len())
+	copy(data, b.buf.Bytes())
+	b.buf.Reset()
+	b.cond.Broadcast() // Writers may wait for a space
+
+	return data
+}
+
+func (b *buffer) Len() int {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return b.buf.Len()
+}
+
+func (b *buffer) SetReadDeadline(t time.Time) {
+	b.setDeadline(&b.readDeadline, t)
+}
+
+func (b *buffer) SetWriteDeadline(t time.Time) {
+	b.setDeadline(&b.writeDeadline, t)
+}
+
+func (b *buffer) setDeadline(d *deadline, t time.Time) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	d.set(t, func() {
+		b.m.Lock()
+		defer b.m.Unlock()
+
+		b.cond.Broadcast()
+	})
+	b.cond.Broadcast()
+}
+
+func (b *buffer) Close() {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.closed = true
+	b.readDeadline.stop()
+	b.writeDeadline.stop()
+	b.cond.Broadcast()
+}
+
+// deadline A deadline which wakes waiters by a timer when it exceeds.
+type deadline struct {
+	t     time.Time
+	timer *time.Timer
+}
+
+func (d *deadline) set(t time.Time, wake func()) {
+	d.stop()
+
+	d.t = t
+	if !t.IsZero() {
+		d.timer = time.AfterFunc(time.Until(t), wake)
+	}
+}
+
+func (d *deadline) exceeded() bool {
+	return !d.t.IsZero() && !time.Now().Before(d.t)
+}
+
+func (d *deadline) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+}
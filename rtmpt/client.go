@@ -0,0 +1,262 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmpt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ClientConfig Configurations of client sessions.
+type ClientConfig struct {
+	// HTTPClient is used to send requests. http.DefaultClient is used if nil.
+	HTTPClient *http.Client
+
+	// CloseIdleConnections closes idle connections of HTTPClient after a session is closed. Set it if HTTPClient is
+	// dedicated to the session, otherwise connections are kept open by the transport.
+	CloseIdleConnections bool
+
+	// PollingUnit is multiplied by polling interval hints from servers. Default is DefaultPollingUnit.
+	PollingUnit time.Duration
+
+	// MaxBufferSize limits bytes which are buffered in each direction of a session. Writes wait until bytes are
+	// sent by polling, or fail by a write deadline. Default is 4MB.
+	MaxBufferSize int
+}
+
+func (cb *ClientConfig) normalize() *ClientConfig {
+	c := ClientConfig(*cb)
+
+	if c.HTTPClient == nil {
+		c.HTTPClient = http.DefaultClient
+	}
+
+	if c.PollingUnit == 0 {
+		c.PollingUnit = DefaultPollingUnit
+	}
+
+	if c.MaxBufferSize == 0 {
+		c.MaxBufferSize = 4 * 1024 * 1024 // 4MB
+	}
+
+	return &c
+}
+
+// Dial opens an RTMPT session. baseURL is a URL of a server such as "http://example.com:80".
+// The returned net.Conn can be used as a transport of RTMP connections.
+func Dial(ctx context.Context, baseURL string, config *ClientConfig) (net.Conn, error) {
+	if config == nil {
+		config = &ClientConfig{}
+	}
+	config = config.normalize()
+
+	c := &clientConn{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		config:  config,
+		in:      newBuffer(config.MaxBufferSize),
+		out:     newBuffer(config.MaxBufferSize),
+		doneCh:  make(chan struct{}),
+	}
+
+	// Ignore results of ident2 (servers usually respond 404) as Flash Player does
+	_, _ = c.post(ctx, "/fcs/ident2", []byte{0x00})
+
+	body, err := c.post(ctx, "/open/1", []byte{0x00})
+	if err != nil {
+		c.closeIdleConnections()
+		return nil, errors.Wrap(err, "Failed to open a session")
+	}
+	c.sessionID = strings.TrimSpace(string(body))
+	if c.sessionID == "" {
+		c.closeIdleConnections()
+		return nil, errors.New("Session ID is empty")
+	}
+
+	go c.pollLoop()
+
+	return c, nil
+}
+
+// clientConn A client side RTMPT session. Written bytes are sent by "send" requests and bytes in responses
+// can be read.
+type clientConn struct {
+	baseURL   string
+	sessionID string
+	seq       uint64
+	config    *ClientConfig
+
+	in  *buffer
+	out *buffer
+
+	lastErr   error
+	doneCh    chan struct{}
+	closeOnce sync.Once
+	m         sync.Mutex
+}
+
+var _ net.Conn = (*clientConn)(nil)
+
+func (c *clientConn) Read(b []byte) (int, error) {
+	n, err := c.in.Read(b)
+	if err == io.EOF {
+		if lastErr := c.getLastError(); lastErr != nil {
+			return n, lastErr
+		}
+	}
+	return n, err
+}
+
+func (c *clientConn) Write(b []byte) (int, error) {
+	return c.out.Write(b)
+}
+
+func (c *clientConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.doneCh)
+		c.out.Close()
+	})
+
+	return nil
+}
+
+func (c *clientConn) LocalAddr() net.Addr {
+	return &Addr{addr: "rtmpt"}
+}
+
+func (c *clientConn) RemoteAddr() net.Addr {
+	return &Addr{addr: c.baseURL}
+}
+
+func (c *clientConn) SetDeadline(t time.Time) error {
+	c.in.SetReadDeadline(t)
+	c.out.SetWriteDeadline(t)
+	return nil
+}
+
+func (c *clientConn) SetReadDeadline(t time.Time) error {
+	c.in.SetReadDeadline(t)
+	return nil
+}
+
+func (c *clientConn) SetWriteDeadline(t time.Time) error {
+	c.out.SetWriteDeadline(t)
+	return nil
+}
+
+func (c *clientConn) pollLoop() {
+	defer c.closeIdleConnections()
+	defer c.in.Close()
+	defer c.out.Close() // Unblock writers if polling failed
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interval := time.Duration(pollingIntervals[0]) * c.config.PollingUnit
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-c.out.notifyCh:
+		case <-timer.C:
+		case <-c.doneCh:
+			timer.Stop()
+			if data := c.out.Drain(); len(data) > 0 {
+				_, _ = c.post(ctx, c.commandPath("send"), data)
+			}
+			_, _ = c.post(ctx, c.commandPath("close"), []byte{0x00})
+			return
+		}
+		timer.Stop()
+
+		command, body := "idle", []byte{0x00}
+		if data := c.out.Drain(); len(data) > 0 {
+			command, body = "send", data
+		}
+
+		resp, err := c.post(ctx, c.commandPath(command), body)
+		if err != nil {
+			c.setLastError(err)
+			return
+		}
+		if len(resp) == 0 {
+			c.setLastError(errors.New("Response is empty"))
+			return
+		}
+
+		interval = time.Duration(resp[0]) * c.config.PollingUnit
+		if len(resp) > 1 {
+			if _, err := c.in.Write(resp[1:]); err != nil {
+				return
+			}
+			interval = 0 // Poll again immediately because a server is active
+		}
+	}
+}
+
+func (c *clientConn) closeIdleConnections() {
+	if c.config.CloseIdleConnections {
+		c.config.HTTPClient.CloseIdleConnections()
+	}
+}
+
+func (c *clientConn) commandPath(command string) string {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.seq++
+	return fmt.Sprintf("/%s/%s/%d", command, c.sessionID, c.seq)
+}
+
+func (c *clientConn) post(ctx context.Context, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", ContentType)
+
+	resp, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return respBody, errors.Errorf("Unexpected status: Path = %s, Status = %s", path, resp.Status)
+	}
+
+	return respBody, nil
+}
+
+func (c *clientConn) setLastError(err error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.lastErr = err
+}
+
+func (c *clientConn) getLastError() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.lastErr
+}
@@ -0,0 +1,39 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package rtmpt implements RTMPT, RTMP tunneled over HTTP.
+//
+// A client opens a session by "/open/1" and exchanges RTMP bytes by polling "/send/<id>/<seq>" and
+// "/idle/<id>/<seq>". Each response starts with a 1 byte polling interval hint followed by RTMP bytes
+// from the server. "/close/<id>/<seq>" terminates the session.
+package rtmpt
+
+import (
+	"time"
+)
+
+// ContentType is a MIME type of RTMPT requests and responses.
+const ContentType = "application/x-fcs"
+
+// Polling interval hints sent by servers. A server increases the interval while a session is idle.
+var pollingIntervals = []byte{0x01, 0x03, 0x05, 0x09, 0x11, 0x21}
+
+// DefaultPollingUnit is a duration which a polling interval hint is multiplied by at client side.
+const DefaultPollingUnit = 10 * time.Millisecond
+
+// Addr A net.Addr for RTMPT sessions.
+type Addr struct {
+	addr string
+}
+
+func (a *Addr) Network() string {
+	return "rtmpt"
+}
+
+func (a *Addr) String() string {
+	return a.addr
+}
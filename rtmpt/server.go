@@ -0,0 +1,403 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmpt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrClosed is returned by Accept after the handler is closed.
+var ErrClosed = errors.New("RTMPT handler is closed")
+
+// ServerConfig Configurations of Handler.
+type ServerConfig struct {
+	// SessionTimeout closes sessions which do not receive any requests for the duration. Default is 30s.
+	SessionTimeout time.Duration
+
+	// MaxRequestBodySize limits a size of each request body. Default is 1MB.
+	MaxRequestBodySize int64
+
+	// MaxBufferSize limits bytes which are buffered in each direction of a session. Writes to a session wait until
+	// a client polls them, or fail by a write deadline. Default is 4MB.
+	MaxBufferSize int
+
+	// Addr is returned by Handler.Addr.
+	Addr net.Addr
+}
+
+func (cb *ServerConfig) normalize() *ServerConfig {
+	c := ServerConfig(*cb)
+
+	if c.SessionTimeout == 0 {
+		c.SessionTimeout = 30 * time.Second
+	}
+
+	if c.MaxRequestBodySize == 0 {
+		c.MaxRequestBodySize = 1 * 1024 * 1024 // 1MB
+	}
+
+	if c.MaxBufferSize == 0 {
+		c.MaxBufferSize = 4 * 1024 * 1024 // 4MB
+	}
+
+	if c.Addr == nil {
+		c.Addr = &Addr{addr: "rtmpt"}
+	}
+
+	return &c
+}
+
+// Handler An http.Handler which serves RTMPT sessions.
+// Handler is also a net.Listener which accepts each session as a net.Conn, so it can be passed to
+// rtmp.Server.Serve to handle sessions by the RTMP stack.
+type Handler struct {
+	config *ServerConfig
+
+	sessions map[string]*serverSession
+	acceptCh chan *serverSession
+	doneCh   chan struct{}
+	m        sync.Mutex
+}
+
+var _ http.Handler = (*Handler)(nil)
+var _ net.Listener = (*Handler)(nil)
+
+func NewHandler(config *ServerConfig) *Handler {
+	if config == nil {
+		config = &ServerConfig{}
+	}
+	config = config.normalize()
+
+	h := &Handler{
+		config: config,
+
+		sessions: make(map[string]*serverSession),
+		acceptCh: make(chan *serverSession),
+		doneCh:   make(chan struct{}),
+	}
+	go h.reapLoop()
+
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// /<command>/<session id>/<sequence>
+	elems := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch elems[0] {
+	case "fcs":
+		// Flash Player sends "/fcs/ident2" first. Responding 404 makes clients use the same server.
+		http.NotFound(w, r)
+
+	case "open":
+		h.handleOpen(w, r)
+
+	case "send", "idle", "close":
+		if len(elems) < 3 {
+			http.NotFound(w, r)
+			return
+		}
+		sess := h.session(elems[1])
+		if sess == nil {
+			http.NotFound(w, r)
+			return
+		}
+		seq, err := strconv.ParseUint(elems[2], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid sequence", http.StatusBadRequest)
+			return
+		}
+		if ok, skipped := sess.advanceSeq(seq); !ok {
+			// Requests must be sent in order. Replayed or reordered requests would corrupt RTMP streams.
+			if skipped {
+				// Bytes of skipped requests are lost, so the session cannot be continued
+				h.removeSession(sess.id)
+				sess.closeBuffers()
+			}
+			http.Error(w, "Unexpected sequence", http.StatusBadRequest)
+			return
+		}
+		h.handleSession(w, r, elems[0], sess)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Accept waits for a new RTMPT session.
+func (h *Handler) Accept() (net.Conn, error) {
+	select {
+	case sess := <-h.acceptCh:
+		return sess, nil
+	case <-h.doneCh:
+		return nil, ErrClosed
+	}
+}
+
+// Close stops accepting sessions and closes all sessions.
+func (h *Handler) Close() error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	select {
+	case <-h.doneCh:
+		return nil // already closed
+	default:
+		close(h.doneCh)
+	}
+
+	for id, sess := range h.sessions {
+		sess.closeBuffers()
+		delete(h.sessions, id)
+	}
+
+	return nil
+}
+
+func (h *Handler) Addr() net.Addr {
+	return h.config.Addr
+}
+
+func (h *Handler) handleOpen(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(r.Body, h.config.MaxRequestBodySize))
+
+	sess, err := h.newSession(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	select {
+	case h.acceptCh <- sess:
+	case <-h.doneCh:
+		h.removeSession(sess.id)
+		http.Error(w, "Closed", http.StatusServiceUnavailable)
+		return
+	case <-r.Context().Done():
+		h.removeSession(sess.id)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write([]byte(sess.id + "\n"))
+}
+
+func (h *Handler) handleSession(w http.ResponseWriter, r *http.Request, command string, sess *serverSession) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, h.config.MaxRequestBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess.touch()
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	switch command {
+	case "send":
+		if _, err := sess.in.Write(body); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+	case "close":
+		h.removeSession(sess.id)
+		sess.closeBuffers()
+
+		_, _ = w.Write([]byte{0x00})
+		return
+	}
+
+	data := sess.out.Drain()
+	_, _ = w.Write(append([]byte{sess.nextInterval(len(data) > 0 || len(body) > 1)}, data...))
+}
+
+func (h *Handler) newSession(r *http.Request) (*serverSession, error) {
+	var idBytes [8]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return nil, err
+	}
+
+	sess := &serverSession{
+		id:         hex.EncodeToString(idBytes[:]),
+		in:         newBuffer(h.config.MaxBufferSize),
+		out:        newBuffer(h.config.MaxBufferSize),
+		localAddr:  h.config.Addr,
+		remoteAddr: &Addr{addr: r.RemoteAddr},
+		lastActive: time.Now(),
+		handler:    h,
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.sessions[sess.id] = sess
+
+	return sess, nil
+}
+
+func (h *Handler) session(id string) *serverSession {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.sessions[id]
+}
+
+func (h *Handler) removeSession(id string) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	delete(h.sessions, id)
+}
+
+func (h *Handler) reapLoop() {
+	ticker := time.NewTicker(h.config.SessionTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.reapSessions()
+		case <-h.doneCh:
+			return
+		}
+	}
+}
+
+func (h *Handler) reapSessions() {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	for id, sess := range h.sessions {
+		if sess.idleDuration() > h.config.SessionTimeout {
+			sess.closeBuffers()
+			delete(h.sessions, id)
+		}
+	}
+}
+
+// serverSession A server side RTMPT session. Bytes posted by a client can be read and written bytes are
+// returned to the client by subsequent polling requests.
+type serverSession struct {
+	id         string
+	in         *buffer
+	out        *buffer
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	handler    *Handler
+
+	lastSeq       uint64
+	intervalIndex int
+	lastActive    time.Time
+	m             sync.Mutex
+}
+
+var _ net.Conn = (*serverSession)(nil)
+
+func (s *serverSession) Read(b []byte) (int, error) {
+	return s.in.Read(b)
+}
+
+func (s *serverSession) Write(b []byte) (int, error) {
+	return s.out.Write(b)
+}
+
+func (s *serverSession) Close() error {
+	s.handler.removeSession(s.id)
+	s.closeBuffers()
+
+	return nil
+}
+
+func (s *serverSession) LocalAddr() net.Addr {
+	return s.localAddr
+}
+
+func (s *serverSession) RemoteAddr() net.Addr {
+	return s.remoteAddr
+}
+
+func (s *serverSession) SetDeadline(t time.Time) error {
+	s.in.SetReadDeadline(t)
+	s.out.SetWriteDeadline(t)
+	return nil
+}
+
+func (s *serverSession) SetReadDeadline(t time.Time) error {
+	s.in.SetReadDeadline(t)
+	return nil
+}
+
+func (s *serverSession) SetWriteDeadline(t time.Time) error {
+	s.out.SetWriteDeadline(t)
+	return nil
+}
+
+func (s *serverSession) closeBuffers() {
+	s.in.Close()
+	s.out.Close()
+}
+
+// advanceSeq Accepts a sequence number of a request only if it follows the last one. skipped is true if the number
+// is ahead of the next one.
+func (s *serverSession) advanceSeq(seq uint64) (ok bool, skipped bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if seq != s.lastSeq+1 {
+		return false, seq > s.lastSeq+1
+	}
+	s.lastSeq = seq
+
+	return true, false
+}
+
+func (s *serverSession) touch() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.lastActive = time.Now()
+}
+
+func (s *serverSession) idleDuration() time.Duration {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return time.Since(s.lastActive)
+}
+
+// nextInterval Returns a polling interval hint. It is reset while data is exchanged and grows while idle.
+func (s *serverSession) nextInterval(active bool) byte {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if active {
+		s.intervalIndex = 0
+	} else if s.intervalIndex < len(pollingIntervals)-1 {
+		s.intervalIndex++
+	}
+
+	return pollingIntervals[s.intervalIndex]
+}
@@ -0,0 +1,182 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmpt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerSession(t *testing.T) {
+	h := NewHandler(nil)
+	defer h.Close()
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	post := func(path string, body []byte) (int, []byte) {
+		resp, err := http.Post(srv.URL+path, ContentType, bytes.NewReader(body))
+		require.Nil(t, err)
+		defer resp.Body.Close()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		require.Nil(t, err)
+
+		return resp.StatusCode, b
+	}
+
+	status, _ := post("/fcs/ident2", []byte{0x00})
+	require.Equal(t, http.StatusNotFound, status)
+
+	connCh := make(chan net.Conn, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		conn, err := h.Accept()
+		errCh <- err
+		connCh <- conn
+	}()
+
+	status, body := post("/open/1", []byte{0x00})
+	require.Equal(t, http.StatusOK, status)
+	id := strings.TrimSpace(string(body))
+	require.Nil(t, <-errCh)
+	conn := (<-connCh).(*serverSession)
+	require.Equal(t, id, conn.id)
+
+	// Bytes posted by send can be read from the session
+	status, body = post("/send/"+id+"/1", []byte("hello"))
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, []byte{0x01}, body)
+
+	buf := make([]byte, 5)
+	_, err := conn.Read(buf)
+	require.Nil(t, err)
+	require.Equal(t, []byte("hello"), buf)
+
+	// Polling intervals grow while idle
+	for i, expected := range []byte{0x03, 0x05, 0x09, 0x11, 0x21, 0x21} {
+		_, body = post(fmt.Sprintf("/idle/%s/%d", id, 2+i), []byte{0x00})
+		require.Equal(t, []byte{expected}, body)
+	}
+
+	// Replayed, reordered and malformed sequences are rejected
+	for _, seq := range []string{"7", "3", "x"} {
+		status, _ = post("/idle/"+id+"/"+seq, []byte{0x00})
+		require.Equal(t, http.StatusBadRequest, status)
+	}
+
+	// Bytes written to the session are returned by polling, and the interval is reset
+	_, err = conn.Write([]byte("world"))
+	require.Nil(t, err)
+	_, body = post("/idle/"+id+"/8", []byte{0x00})
+	require.Equal(t, append([]byte{0x01}, []byte("world")...), body)
+
+	_, body = post("/close/"+id+"/9", []byte{0x00})
+	require.Equal(t, []byte{0x00}, body)
+
+	status, _ = post("/idle/"+id+"/10", []byte{0x00})
+	require.Equal(t, http.StatusNotFound, status)
+}
+
+func TestHandlerClosesSessionsOnSkippedSequence(t *testing.T) {
+	h := NewHandler(nil)
+	defer h.Close()
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	post := func(path string, body []byte) (int, []byte) {
+		resp, err := http.Post(srv.URL+path, ContentType, bytes.NewReader(body))
+		require.Nil(t, err)
+		defer resp.Body.Close()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		require.Nil(t, err)
+
+		return resp.StatusCode, b
+	}
+
+	connCh := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := h.Accept()
+		connCh <- conn
+	}()
+
+	status, body := post("/open/1", []byte{0x00})
+	require.Equal(t, http.StatusOK, status)
+	id := strings.TrimSpace(string(body))
+	conn := <-connCh
+
+	status, _ = post("/send/"+id+"/1", []byte("hello"))
+	require.Equal(t, http.StatusOK, status)
+
+	// Bytes of the second request are lost
+	status, _ = post("/send/"+id+"/3", []byte("world"))
+	require.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = post("/idle/"+id+"/2", []byte{0x00})
+	require.Equal(t, http.StatusNotFound, status)
+
+	buf := make([]byte, 5)
+	_, err := io.ReadFull(conn, buf)
+	require.Nil(t, err)
+	require.Equal(t, []byte("hello"), buf)
+
+	_, err = conn.Read(buf)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestBufferLimit(t *testing.T) {
+	b := newBuffer(4)
+
+	// Writes exceeding the limit fail by the deadline after filling the buffer
+	b.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+	n, err := b.Write([]byte("hello"))
+	require.Equal(t, os.ErrDeadlineExceeded, err)
+	require.Equal(t, 4, n)
+	require.Equal(t, []byte("hell"), b.Drain())
+
+	// Writes wait until a reader makes a space
+	b.SetWriteDeadline(time.Time{})
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := b.Write([]byte("world!"))
+		errCh <- err
+	}()
+
+	var actual []byte
+	buf := make([]byte, 3)
+	for len(actual) < 6 {
+		n, err := b.Read(buf)
+		require.Nil(t, err)
+		actual = append(actual, buf[:n]...)
+	}
+	require.Nil(t, <-errCh)
+	require.Equal(t, []byte("world!"), actual)
+
+	// Closing unblocks writers
+	_, err = b.Write([]byte("1234"))
+	require.Nil(t, err)
+	go func() {
+		_, err := b.Write([]byte("5"))
+		errCh <- err
+	}()
+	b.Close()
+	require.Equal(t, io.ErrClosedPipe, <-errCh)
+}
@@ -0,0 +1,383 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmptest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/yutopp/go-amf0"
+
+	"github.com/yutopp/go-rtmp"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+const (
+	chunkStreamIDAudio = 4
+	chunkStreamIDData  = 5
+	chunkStreamIDVideo = 6
+)
+
+var aacSampleRates = [13]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// AVCSequenceHeader returns a payload of a video message which has an AVCDecoderConfigurationRecord of
+// Constrained Baseline profile. width, height and frameRate (if it is positive) are written in the SPS, so
+// media.ParseVideoInfo returns them. width and height must be even.
+func AVCSequenceHeader(width, height int, frameRate float64) []byte {
+	sps := avcSPS(width, height, frameRate)
+	pps := []byte{0x68, 0xce, 0x3c, 0x80}
+
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{0x17, 0x00, 0x00, 0x00, 0x00}) // Key frame, AVC, sequence header, composition time
+
+	// AVCDecoderConfigurationRecord
+	buf.Write([]byte{0x01, sps[1], sps[2], sps[3], 0xff, 0xe1}) // 4 bytes NALU length, 1 SPS
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(sps)))
+	buf.Write(sps)
+	buf.WriteByte(0x01) // 1 PPS
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(pps)))
+	buf.Write(pps)
+
+	return buf.Bytes()
+}
+
+func avcSPS(width, height int, frameRate float64) []byte {
+	widthInMbs := (width + 15) / 16
+	heightInMbs := (height + 15) / 16
+
+	w := &bitWriter{}
+	w.writeBits(66, 8)   // profile_idc: Baseline
+	w.writeBits(0xc0, 8) // constraint_set0_flag and constraint_set1_flag
+	w.writeBits(31, 8)   // level_idc
+	w.writeUE(0)         // seq_parameter_set_id
+	w.writeUE(0)         // log2_max_frame_num_minus4
+	w.writeUE(2)         // pic_order_cnt_type
+	w.writeUE(1)         // max_num_ref_frames
+	w.writeBits(0, 1)    // gaps_in_frame_num_value_allowed_flag
+	w.writeUE(uint32(widthInMbs - 1))
+	w.writeUE(uint32(heightInMbs - 1))
+	w.writeBits(1, 1) // frame_mbs_only_flag
+	w.writeBits(1, 1) // direct_8x8_inference_flag
+
+	cropRight, cropBottom := widthInMbs*16-width, heightInMbs*16-height
+	if cropRight != 0 || cropBottom != 0 {
+		w.writeBits(1, 1) // frame_cropping_flag. Units are 2 pixels for 4:2:0
+		w.writeUE(0)
+		w.writeUE(uint32(cropRight / 2))
+		w.writeUE(0)
+		w.writeUE(uint32(cropBottom / 2))
+	} else {
+		w.writeBits(0, 1)
+	}
+
+	if frameRate > 0 {
+		w.writeBits(1, 1) // vui_parameters_present_flag
+		w.writeBits(0, 4) // aspect_ratio_info, overscan_info, video_signal_type and chroma_loc_info are not present
+		w.writeBits(1, 1) // timing_info_present_flag
+		w.writeBits(1000, 32)
+		w.writeBits(uint32(math.Round(frameRate*2000)), 32)
+		w.writeBits(1, 1) // fixed_frame_rate_flag
+		w.writeBits(0, 5) // nal_hrd, vcl_hrd, pic_struct, bitstream_restriction are not present
+	} else {
+		w.writeBits(0, 1)
+	}
+
+	w.writeBits(1, 1) // rbsp_stop_one_bit
+
+	return append([]byte{0x67}, escapeRBSP(w.buf)...)
+}
+
+// AVCFrame returns a payload of a video message which has a NAL unit of size bytes. A key frame has an IDR slice.
+func AVCFrame(isKeyFrame bool, size int) []byte {
+	if size < 1 {
+		size = 1
+	}
+
+	buf := new(bytes.Buffer)
+	header, nalHeader := byte(0x27), byte(0x41) // Inter frame, AVC / Non-IDR slice
+	if isKeyFrame {
+		header, nalHeader = 0x17, 0x65 // Key frame, AVC / IDR slice
+	}
+	buf.Write([]byte{header, 0x01, 0x00, 0x00, 0x00}) // NALU, composition time
+
+	_ = binary.Write(buf, binary.BigEndian, uint32(size))
+	buf.WriteByte(nalHeader)
+	for i := 1; i < size; i++ {
+		buf.WriteByte(byte(i))
+	}
+
+	return buf.Bytes()
+}
+
+// AACSequenceHeader returns a payload of an audio message which has an AudioSpecificConfig of AAC-LC.
+func AACSequenceHeader(sampleRate, channels int) []byte {
+	w := &bitWriter{}
+	w.writeBits(2, 5) // AAC-LC
+
+	index := -1
+	for i, rate := range aacSampleRates {
+		if rate == sampleRate {
+			index = i
+		}
+	}
+	if index >= 0 {
+		w.writeBits(uint32(index), 4)
+	} else {
+		w.writeBits(0x0f, 4)
+		w.writeBits(uint32(sampleRate), 24)
+	}
+
+	w.writeBits(uint32(channels), 4)
+	w.writeBits(0, 3) // GASpecificConfig
+
+	return append([]byte{0xaf, 0x00}, w.buf...)
+}
+
+// AACFrame returns a payload of an audio message which has a raw AAC frame of size bytes.
+func AACFrame(size int) []byte {
+	b := make([]byte, 2+size)
+	b[0], b[1] = 0xaf, 0x01
+	for i := 2; i < len(b); i++ {
+		b[i] = byte(i)
+	}
+
+	return b
+}
+
+// SyntheticConfig Configures a synthetic H.264/AAC stream.
+type SyntheticConfig struct {
+	// StartTimestamp A timestamp of the first frames.
+	StartTimestamp uint32
+	// Duration Frames are generated while timestamps are less than StartTimestamp+Duration. Default is 1s.
+	Duration time.Duration
+
+	// Width Default is 1280.
+	Width int
+	// Height Default is 720.
+	Height int
+	// FrameRate Default is 30. Video is not generated if it is negative.
+	FrameRate float64
+	// KeyFrameInterval Default is 2s.
+	KeyFrameInterval time.Duration
+	// VideoFrameSize A size of NAL units of video frames. Default is 512.
+	VideoFrameSize int
+
+	// SampleRate Default is 44100. Audio is not generated if it is negative.
+	SampleRate int
+	// Channels Default is 2.
+	Channels int
+	// AudioFrameSize A size of raw AAC frames, which have 1024 samples. Default is 64.
+	AudioFrameSize int
+}
+
+func (cb *SyntheticConfig) normalize() *SyntheticConfig {
+	c := SyntheticConfig(*cb)
+
+	if c.Duration == 0 {
+		c.Duration = 1 * time.Second
+	}
+
+	if c.Width == 0 {
+		c.Width = 1280
+	}
+	if c.Height == 0 {
+		c.Height = 720
+	}
+	if c.FrameRate == 0 {
+		c.FrameRate = 30
+	}
+	if c.KeyFrameInterval == 0 {
+		c.KeyFrameInterval = 2 * time.Second
+	}
+	if c.VideoFrameSize == 0 {
+		c.VideoFrameSize = 512
+	}
+
+	if c.SampleRate == 0 {
+		c.SampleRate = 44100
+	}
+	if c.Channels == 0 {
+		c.Channels = 2
+	}
+	if c.AudioFrameSize == 0 {
+		c.AudioFrameSize = 64
+	}
+
+	return &c
+}
+
+// SyntheticMetaData returns a body of @setDataFrame which describes a synthetic stream of config.
+func SyntheticMetaData(config *SyntheticConfig) *message.NetStreamSetDataFrame {
+	c := config.normalize()
+
+	data := amf0.ECMAArray{
+		"duration": c.Duration.Seconds(),
+	}
+	if c.FrameRate > 0 {
+		data["width"] = float64(c.Width)
+		data["height"] = float64(c.Height)
+		data["framerate"] = c.FrameRate
+		data["videocodecid"] = float64(message.VideoCodecIDAVC)
+	}
+	if c.SampleRate > 0 {
+		data["audiosamplerate"] = float64(c.SampleRate)
+		data["stereo"] = c.Channels == 2
+		data["audiocodecid"] = float64(message.AudioSoundFormatAAC)
+	}
+
+	return &message.NetStreamSetDataFrame{
+		AmfData: data,
+	}
+}
+
+// SyntheticFrames generates sequence headers and frames of a synthetic stream of config in order of timestamps.
+// Timestamps are rounded down to milliseconds. Video precedes audio which has the same timestamp.
+func SyntheticFrames(config *SyntheticConfig) []*Media {
+	c := config.normalize()
+
+	start := int64(c.StartTimestamp)
+	end := start + int64(c.Duration/time.Millisecond)
+	hasVideo, hasAudio := c.FrameRate > 0, c.SampleRate > 0
+
+	var frames []*Media
+	if hasVideo {
+		frames = append(frames, &Media{
+			TypeID:    message.TypeIDVideoMessage,
+			Timestamp: uint32(start),
+			Payload:   AVCSequenceHeader(c.Width, c.Height, c.FrameRate),
+		})
+	}
+	if hasAudio {
+		frames = append(frames, &Media{
+			TypeID:    message.TypeIDAudioMessage,
+			Timestamp: uint32(start),
+			Payload:   AACSequenceHeader(c.SampleRate, c.Channels),
+		})
+	}
+
+	videoTimestamp := func(i int64) int64 {
+		return start + int64(float64(i)*1000/c.FrameRate)
+	}
+	audioTimestamp := func(i int64) int64 {
+		return start + i*1024*1000/int64(c.SampleRate)
+	}
+
+	keyFrameInterval := int64(c.KeyFrameInterval / time.Millisecond)
+	lastKeyFrame := int64(-1)
+	var videoIndex, audioIndex int64
+	for {
+		vts, ats := int64(math.MaxInt64), int64(math.MaxInt64)
+		if hasVideo {
+			vts = videoTimestamp(videoIndex)
+		}
+		if hasAudio {
+			ats = audioTimestamp(audioIndex)
+		}
+		if vts >= end && ats >= end {
+			break
+		}
+
+		if vts <= ats {
+			isKeyFrame := lastKeyFrame < 0 || vts-lastKeyFrame >= keyFrameInterval
+			if isKeyFrame {
+				lastKeyFrame = vts
+			}
+			frames = append(frames, &Media{
+				TypeID:    message.TypeIDVideoMessage,
+				Timestamp: uint32(vts),
+				Payload:   AVCFrame(isKeyFrame, c.VideoFrameSize),
+			})
+			videoIndex++
+		} else {
+			frames = append(frames, &Media{
+				TypeID:    message.TypeIDAudioMessage,
+				Timestamp: uint32(ats),
+				Payload:   AACFrame(c.AudioFrameSize),
+			})
+			audioIndex++
+		}
+	}
+
+	return frames
+}
+
+// Publish writes @setDataFrame and frames of a synthetic stream of config to a publishing stream s, without waiting
+// for timestamps.
+func Publish(s *rtmp.Stream, config *SyntheticConfig) error {
+	c := config.normalize()
+
+	if err := s.WriteDataMessage(chunkStreamIDData, c.StartTimestamp, "@setDataFrame", SyntheticMetaData(c)); err != nil {
+		return err
+	}
+
+	for _, f := range SyntheticFrames(c) {
+		var err error
+		switch f.TypeID {
+		case message.TypeIDAudioMessage:
+			err = s.Write(chunkStreamIDAudio, f.Timestamp, &message.AudioMessage{Payload: bytes.NewReader(f.Payload)})
+		case message.TypeIDVideoMessage:
+			err = s.Write(chunkStreamIDVideo, f.Timestamp, &message.VideoMessage{Payload: bytes.NewReader(f.Payload)})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bitWriter Writes bits in MSB first order.
+type bitWriter struct {
+	buf []byte
+	n   uint // The number of written bits
+}
+
+func (w *bitWriter) writeBits(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if (v>>uint(i))&1 != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> (w.n % 8)
+		}
+		w.n++
+	}
+}
+
+// writeUE Writes an Exp-Golomb code.
+func (w *bitWriter) writeUE(v uint32) {
+	x := uint64(v) + 1
+	n := 0
+	for t := x; t > 1; t >>= 1 {
+		n++
+	}
+	w.writeBits(0, n)
+	w.writeBits(uint32(x), n+1)
+}
+
+// escapeRBSP Inserts emulation prevention bytes.
+func escapeRBSP(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c <= 3 {
+			out = append(out, 0x03)
+			zeros = 0
+		}
+		out = append(out, c)
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+
+	return out
+}
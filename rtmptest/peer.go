@@ -0,0 +1,472 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmptest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/yutopp/go-rtmp"
+	"github.com/yutopp/go-rtmp/handshake"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+const defaultChunkSize = 128
+
+// Message A message which is read by a Peer. Bodies and payloads are buffered, so they can be read at any time.
+type Message struct {
+	ChunkStreamID int
+	StreamID      uint32
+	Timestamp     uint32
+	Message       message.Message
+}
+
+// Chunk A chunk which is written by Peer.WriteChunk as it is. Fields which are not used by Fmt are ignored,
+// and Payload is not checked against MessageLength, so malformed chunks can be written.
+type Chunk struct {
+	Fmt           byte // 0 to 3
+	ChunkStreamID int  // 2 to 65599
+
+	// Timestamp is an absolute timestamp if Fmt is 0, or a delta if Fmt is 1 or 2.
+	// Chunks of Fmt 3 have no extended timestamps as chunk streams of this package.
+	Timestamp       uint32
+	MessageLength   uint32
+	MessageTypeID   message.TypeID
+	MessageStreamID uint32
+
+	Payload []byte
+}
+
+func (c *Chunk) encode(buf *bytes.Buffer) {
+	switch {
+	case c.ChunkStreamID < 64:
+		buf.WriteByte(c.Fmt<<6 | byte(c.ChunkStreamID))
+	case c.ChunkStreamID < 320:
+		buf.WriteByte(c.Fmt << 6)
+		buf.WriteByte(byte(c.ChunkStreamID - 64))
+	default:
+		id := c.ChunkStreamID - 64
+		buf.WriteByte(c.Fmt<<6 | 1)
+		buf.WriteByte(byte(id))
+		buf.WriteByte(byte(id >> 8))
+	}
+
+	var b [4]byte
+	putUint24 := func(v uint32) {
+		buf.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+	}
+
+	ts := c.Timestamp
+	if ts >= 0xffffff {
+		ts = 0xffffff
+	}
+	if c.Fmt <= 2 {
+		putUint24(ts)
+	}
+	if c.Fmt <= 1 {
+		putUint24(c.MessageLength)
+		buf.WriteByte(byte(c.MessageTypeID))
+	}
+	if c.Fmt == 0 {
+		binary.LittleEndian.PutUint32(b[:], c.MessageStreamID)
+		buf.Write(b[:])
+	}
+	if c.Fmt <= 2 && ts == 0xffffff {
+		binary.BigEndian.PutUint32(b[:], c.Timestamp)
+		buf.Write(b[:])
+	}
+
+	buf.Write(c.Payload)
+}
+
+// Peer A fake peer which speaks raw RTMP over a connection. It writes messages and chunks exactly as scripted,
+// and reads messages from the other side in background so that the other side never blocks on writing.
+//
+// Protocol control messages are not sent automatically (e.g. acknowledgements), but SetChunkSize which is read or
+// written is applied.
+type Peer struct {
+	// Timeout A limit to wait for a message or to write. DefaultTimeout is used if it is zero.
+	Timeout time.Duration
+
+	conn      net.Conn
+	streamer  *rtmp.ChunkStreamer
+	chunkSize uint32
+	wm        sync.Mutex
+
+	messages recordQueue
+	readErr  error
+	doneCh   chan struct{}
+}
+
+// NewClientPeer does a handshake as a client on conn and returns a peer. conn is closed if it fails.
+func NewClientPeer(conn net.Conn) (*Peer, error) {
+	if err := handshake.HandshakeWithServer(conn, conn, &handshake.Config{}); err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "Failed to handshake")
+	}
+
+	return newPeer(conn), nil
+}
+
+// NewServerPeer does a handshake as a server on conn and returns a peer. conn is closed if it fails.
+func NewServerPeer(conn net.Conn) (*Peer, error) {
+	if err := handshake.HandshakeWithClient(conn, conn, &handshake.Config{}); err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "Failed to handshake")
+	}
+
+	return newPeer(conn), nil
+}
+
+// DialFakeServer creates a client which is connected to a fake server. connect is not sent yet.
+func DialFakeServer(config *rtmp.ConnConfig) (*rtmp.ClientConn, *Peer, error) {
+	clientConn, serverConn := Pipe()
+
+	type result struct {
+		client *rtmp.ClientConn
+		err    error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		client, err := rtmp.NewClientConn(clientConn, config)
+		resultCh <- result{client: client, err: err}
+	}()
+
+	peer, err := NewServerPeer(serverConn)
+	if err != nil {
+		_ = clientConn.Close()
+		<-resultCh
+		return nil, nil, err
+	}
+
+	r := <-resultCh
+	if r.err != nil {
+		_ = peer.Close()
+		return nil, nil, r.err
+	}
+
+	return r.client, peer, nil
+}
+
+func newPeer(conn net.Conn) *Peer {
+	p := &Peer{
+		conn:      conn,
+		streamer:  rtmp.NewChunkStreamer(bufio.NewReader(conn), ioutil.Discard, nil),
+		chunkSize: defaultChunkSize,
+		doneCh:    make(chan struct{}),
+	}
+	go p.readLoop()
+
+	return p
+}
+
+func (p *Peer) readLoop() {
+	defer close(p.doneCh)
+
+	for {
+		var cmsg rtmp.ChunkMessage
+		chunkStreamID, timestamp, err := p.streamer.Read(&cmsg)
+		if err != nil {
+			p.messages.push(err)
+			return
+		}
+
+		if err := bufferMessage(cmsg.Message); err != nil {
+			p.messages.push(err)
+			return
+		}
+
+		if m, ok := cmsg.Message.(*message.SetChunkSize); ok {
+			if err := p.streamer.PeerState().SetChunkSize(m.ChunkSize); err != nil {
+				p.messages.push(err)
+				return
+			}
+		}
+
+		p.messages.push(&Message{
+			ChunkStreamID: chunkStreamID,
+			StreamID:      cmsg.StreamID,
+			Timestamp:     timestamp,
+			Message:       cmsg.Message,
+		})
+	}
+}
+
+// bufferMessage Copies a body or a payload of msg, because it refers a buffer of a chunk stream.
+func bufferMessage(msg message.Message) error {
+	var r *io.Reader
+	switch msg := msg.(type) {
+	case *message.CommandMessage:
+		r = &msg.Body
+	case *message.DataMessage:
+		r = &msg.Body
+	case *message.AudioMessage:
+		r = &msg.Payload
+	case *message.VideoMessage:
+		r = &msg.Payload
+	default:
+		return nil
+	}
+
+	b, err := ioutil.ReadAll(*r)
+	if err != nil {
+		return err
+	}
+	*r = bytes.NewReader(b)
+
+	return nil
+}
+
+func (p *Peer) timeout() time.Duration {
+	if p.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return p.Timeout
+}
+
+// ReadMessage returns the oldest message which is not taken yet. It returns an error if no messages arrive in
+// Timeout or the connection is closed.
+func (p *Peer) ReadMessage() (*Message, error) {
+	if p.readErr != nil {
+		return nil, p.readErr
+	}
+
+	v, ok := p.messages.pop(p.timeout())
+	if !ok {
+		return nil, errors.Errorf("No messages are received in %s", p.timeout())
+	}
+
+	if err, ok := v.(error); ok {
+		p.readErr = err
+		return nil, err
+	}
+
+	return v.(*Message), nil
+}
+
+// ReadCommand reads messages until a command which has one of names, and returns it. Other messages are discarded.
+func (p *Peer) ReadCommand(names ...string) (*Message, *message.CommandMessage, error) {
+	for {
+		m, err := p.ReadMessage()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		cmd, ok := m.Message.(*message.CommandMessage)
+		if !ok {
+			continue
+		}
+		for _, name := range names {
+			if cmd.CommandName == name {
+				return m, cmd, nil
+			}
+		}
+	}
+}
+
+// DecodeCommandBody decodes a body of cmd by decode. If decode is nil, it is chosen by the command name.
+// Decoders of results must be specified. e.g. message.DecodeBodyConnectResult for _result of connect.
+// The body is consumed.
+func DecodeCommandBody(cmd *message.CommandMessage, decode message.BodyDecoderFunc) (message.AMFConvertible, error) {
+	if decode == nil {
+		decode = message.CmdBodyDecoderFor(cmd.CommandName, cmd.TransactionID)
+	}
+
+	var v message.AMFConvertible
+	amfDec := message.NewAMFDecoder(cmd.Body, cmd.Encoding)
+	if err := decode(cmd.Body, amfDec, &v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// WriteChunk writes a chunk as it is.
+func (p *Peer) WriteChunk(c *Chunk) error {
+	buf := new(bytes.Buffer)
+	c.encode(buf)
+
+	return p.WriteRaw(buf.Bytes())
+}
+
+// WriteRaw writes bytes as they are. e.g. Broken chunks.
+func (p *Peer) WriteRaw(b []byte) error {
+	p.wm.Lock()
+	defer p.wm.Unlock()
+
+	return p.writeRawLocked(b)
+}
+
+func (p *Peer) writeRawLocked(b []byte) error {
+	_ = p.conn.SetWriteDeadline(time.Now().Add(p.timeout()))
+	_, err := p.conn.Write(b)
+
+	return err
+}
+
+// WriteMessage writes msg as chunks which have a full header (Fmt 0) and continuations (Fmt 3).
+// A chunk size is updated after SetChunkSize is written.
+func (p *Peer) WriteMessage(chunkStreamID int, streamID uint32, timestamp uint32, msg message.Message) error {
+	payload := new(bytes.Buffer)
+	if err := message.NewEncoder(payload).Encode(msg); err != nil {
+		return errors.Wrap(err, "Failed to encode a message")
+	}
+
+	p.wm.Lock()
+	defer p.wm.Unlock()
+
+	buf := new(bytes.Buffer)
+	b := payload.Bytes()
+	for i := 0; i == 0 || len(b) > 0; i++ {
+		n := len(b)
+		if n > int(p.chunkSize) {
+			n = int(p.chunkSize)
+		}
+
+		c := &Chunk{
+			Fmt:             3,
+			ChunkStreamID:   chunkStreamID,
+			Timestamp:       timestamp,
+			MessageLength:   uint32(payload.Len()),
+			MessageTypeID:   msg.TypeID(),
+			MessageStreamID: streamID,
+			Payload:         b[:n],
+		}
+		if i == 0 {
+			c.Fmt = 0
+		}
+		c.encode(buf)
+
+		b = b[n:]
+	}
+
+	if err := p.writeRawLocked(buf.Bytes()); err != nil {
+		return err
+	}
+
+	if m, ok := msg.(*message.SetChunkSize); ok {
+		p.chunkSize = m.ChunkSize
+	}
+
+	return nil
+}
+
+// WriteCommand writes a command which is encoded by AMF0.
+func (p *Peer) WriteCommand(
+	chunkStreamID int,
+	streamID uint32,
+	name string,
+	transactionID int64,
+	body message.AMFConvertible,
+) error {
+	buf := new(bytes.Buffer)
+	amfEnc := message.NewAMFEncoder(buf, message.EncodingTypeAMF0)
+	if err := message.EncodeBodyAnyValues(amfEnc, body); err != nil {
+		return err
+	}
+
+	return p.WriteMessage(chunkStreamID, streamID, 0, &message.CommandMessage{
+		CommandName:   name,
+		TransactionID: transactionID,
+		Encoding:      message.EncodingTypeAMF0,
+		Body:          buf,
+	})
+}
+
+// WriteData writes a data message which is encoded by AMF0. e.g. onMetaData and onPlayStatus.
+func (p *Peer) WriteData(
+	chunkStreamID int,
+	streamID uint32,
+	timestamp uint32,
+	name string,
+	body message.AMFConvertible,
+) error {
+	buf := new(bytes.Buffer)
+	amfEnc := message.NewAMFEncoder(buf, message.EncodingTypeAMF0)
+	if err := message.EncodeBodyAnyValues(amfEnc, body); err != nil {
+		return err
+	}
+
+	return p.WriteMessage(chunkStreamID, streamID, timestamp, &message.DataMessage{
+		Name:     name,
+		Encoding: message.EncodingTypeAMF0,
+		Body:     buf,
+	})
+}
+
+// Connect sends connect as a client and waits for the result. An error is returned if it is rejected.
+func (p *Peer) Connect(body *message.NetConnectionConnect) (*message.NetConnectionConnectResult, error) {
+	if body == nil {
+		body = &message.NetConnectionConnect{}
+	}
+	if err := p.WriteCommand(3, 0, "connect", 1, body); err != nil {
+		return nil, err
+	}
+
+	_, cmd, err := p.ReadCommand("_result", "_error")
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := DecodeCommandBody(cmd, message.DecodeBodyConnectResult)
+	if err != nil {
+		return nil, err
+	}
+	result := v.(*message.NetConnectionConnectResult)
+
+	if cmd.CommandName == "_error" {
+		return result, errors.Errorf("Failed to connect: Code = %s", result.Information.Code)
+	}
+
+	return result, nil
+}
+
+// AcceptConnect waits for connect as a server and accepts it.
+func (p *Peer) AcceptConnect() (*message.NetConnectionConnect, error) {
+	_, cmd, err := p.ReadCommand("connect")
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := DecodeCommandBody(cmd, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	preset := rtmp.NewDefaultResponsePreset()
+	if err := p.WriteCommand(3, 0, "_result", cmd.TransactionID, &message.NetConnectionConnectResult{
+		Properties: preset.GetServerConnectResultProperties(),
+		Information: message.NetConnectionConnectResultInformation{
+			Level:       "status",
+			Code:        message.NetConnectionConnectCodeSuccess,
+			Description: "Connection succeeded.",
+			Data:        preset.GetServerConnectResultData(),
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	return v.(*message.NetConnectionConnect), nil
+}
+
+// Close closes the connection and waits for reading to stop.
+func (p *Peer) Close() error {
+	err := p.conn.Close()
+	_ = p.streamer.Close()
+	<-p.doneCh
+
+	return err
+}
@@ -0,0 +1,150 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmptest
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Pipe creates a pair of in-memory connections as net.Pipe, but writes do not wait for reads of the other end as
+// TCP connections. Handshakes of RTMP deadlock on net.Pipe, because both ends write before reading.
+func Pipe() (net.Conn, net.Conn) {
+	a, b := net.Pipe()
+	return newBufferedConn(a), newBufferedConn(b)
+}
+
+// bufferedConn Reads an end of net.Pipe into an unbounded buffer in background.
+type bufferedConn struct {
+	net.Conn
+
+	buf          bytes.Buffer
+	err          error
+	readDeadline time.Time
+	notifyCh     chan struct{} // Closed when a state is changed
+	m            sync.Mutex
+}
+
+func newBufferedConn(conn net.Conn) *bufferedConn {
+	c := &bufferedConn{
+		Conn:     conn,
+		notifyCh: make(chan struct{}),
+	}
+	go c.readLoop()
+
+	return c
+}
+
+func (c *bufferedConn) readLoop() {
+	b := make([]byte, 32*1024)
+	for {
+		n, err := c.Conn.Read(b)
+
+		c.m.Lock()
+		c.buf.Write(b[:n])
+		if err != nil {
+			c.err = err
+		}
+		c.notifyLocked()
+		c.m.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *bufferedConn) notifyLocked() {
+	close(c.notifyCh)
+	c.notifyCh = make(chan struct{})
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	for {
+		c.m.Lock()
+		if c.buf.Len() > 0 {
+			n, _ := c.buf.Read(b)
+			c.m.Unlock()
+			return n, nil
+		}
+		if c.err != nil {
+			err := c.err
+			c.m.Unlock()
+			return 0, err
+		}
+
+		var timer *time.Timer
+		var timeoutCh <-chan time.Time
+		if !c.readDeadline.IsZero() {
+			d := time.Until(c.readDeadline)
+			if d <= 0 {
+				c.m.Unlock()
+				return 0, timeoutError{}
+			}
+			timer = time.NewTimer(d)
+			timeoutCh = timer.C
+		}
+		notifyCh := c.notifyCh
+		c.m.Unlock()
+
+		select {
+		case <-notifyCh:
+		case <-timeoutCh:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (c *bufferedConn) Close() error {
+	err := c.Conn.Close()
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.err = io.ErrClosedPipe // Buffered bytes are not read after closing
+	c.buf.Reset()
+	c.notifyLocked()
+
+	return err
+}
+
+func (c *bufferedConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *bufferedConn) SetReadDeadline(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.readDeadline = t
+	c.notifyLocked()
+
+	return nil
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string {
+	return "i/o timeout"
+}
+
+func (timeoutError) Timeout() bool {
+	return true
+}
+
+func (timeoutError) Temporary() bool {
+	return true
+}
@@ -0,0 +1,229 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmptest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yutopp/go-rtmp"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+var _ rtmp.Handler = (*Recorder)(nil)
+var _ rtmp.StatusHandler = (*Recorder)(nil)
+
+// Media A payload of an audio or a video message which is recorded.
+type Media struct {
+	TypeID    message.TypeID // message.TypeIDAudioMessage or message.TypeIDVideoMessage
+	Timestamp uint32
+	Payload   []byte
+}
+
+// Recorder A Handler of clients which records onStatus, onPlayStatus, user control events and media.
+// Each kind of messages is queued in order of arrival, and Next* and Expect* methods take them from the head.
+// Other messages are handled by rtmp.DefaultHandler.
+//
+// Next* and Expect* methods fail t if no messages arrive in Timeout. They must be called from the goroutine which
+// runs the test.
+type Recorder struct {
+	rtmp.DefaultHandler
+
+	// Timeout A limit to wait for a message. DefaultTimeout is used if it is zero.
+	Timeout time.Duration
+
+	statuses     recordQueue
+	playStatuses recordQueue
+	userCtrls    recordQueue
+	media        recordQueue
+}
+
+// NewRecorder creates a recorder. It is used as ConnConfig.Handler of a client.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) OnStatus(timestamp uint32, status *message.NetStreamOnStatus) error {
+	r.statuses.push(status)
+	return nil
+}
+
+func (r *Recorder) OnPlayStatus(timestamp uint32, status *message.NetStreamOnPlayStatus) error {
+	r.playStatuses.push(status)
+	return nil
+}
+
+func (r *Recorder) OnUnknownMessage(timestamp uint32, msg message.Message) error {
+	switch msg := msg.(type) {
+	case *message.UserCtrl:
+		r.userCtrls.push(msg.Event)
+
+	case *message.AudioMessage:
+		payload, err := ioutil.ReadAll(msg.Payload)
+		if err != nil {
+			return err
+		}
+		r.media.push(&Media{TypeID: message.TypeIDAudioMessage, Timestamp: timestamp, Payload: payload})
+
+	case *message.VideoMessage:
+		payload, err := ioutil.ReadAll(msg.Payload)
+		if err != nil {
+			return err
+		}
+		r.media.push(&Media{TypeID: message.TypeIDVideoMessage, Timestamp: timestamp, Payload: payload})
+	}
+
+	return nil
+}
+
+// NextStatus returns the oldest onStatus which is not taken yet.
+func (r *Recorder) NextStatus(t testing.TB) *message.NetStreamOnStatus {
+	t.Helper()
+	return r.next(t, &r.statuses, "onStatus").(*message.NetStreamOnStatus)
+}
+
+// ExpectStatus fails t unless a code of the next onStatus is code.
+func (r *Recorder) ExpectStatus(t testing.TB, code message.NetStreamOnStatusCode) *message.NetStreamOnStatus {
+	t.Helper()
+
+	status := r.NextStatus(t)
+	if status.InfoObject.Code != code {
+		t.Fatalf("Unexpected onStatus: Expected = %s, Actual = %s", code, status.InfoObject.Code)
+	}
+
+	return status
+}
+
+// NextPlayStatus returns the oldest onPlayStatus which is not taken yet.
+func (r *Recorder) NextPlayStatus(t testing.TB) *message.NetStreamOnPlayStatus {
+	t.Helper()
+	return r.next(t, &r.playStatuses, "onPlayStatus").(*message.NetStreamOnPlayStatus)
+}
+
+// ExpectPlayStatus fails t unless a code of the next onPlayStatus is code.
+func (r *Recorder) ExpectPlayStatus(t testing.TB, code message.NetStreamOnStatusCode) *message.NetStreamOnPlayStatus {
+	t.Helper()
+
+	status := r.NextPlayStatus(t)
+	if status.InfoObject.Code != code {
+		t.Fatalf("Unexpected onPlayStatus: Expected = %s, Actual = %s", code, status.InfoObject.Code)
+	}
+
+	return status
+}
+
+// NextUserCtrl returns the oldest user control event which is not taken yet.
+// e.g. *message.UserCtrlEventStreamBegin
+func (r *Recorder) NextUserCtrl(t testing.TB) message.UserCtrlEvent {
+	t.Helper()
+	return r.next(t, &r.userCtrls, "a user control event").(message.UserCtrlEvent)
+}
+
+// ExpectUserCtrl fails t unless the next user control event equals to event.
+func (r *Recorder) ExpectUserCtrl(t testing.TB, event message.UserCtrlEvent) {
+	t.Helper()
+
+	actual := r.NextUserCtrl(t)
+	if !reflect.DeepEqual(actual, event) {
+		t.Fatalf("Unexpected user control event: Expected = %#v, Actual = %#v", event, actual)
+	}
+}
+
+// NextMedia returns the oldest audio or video message which is not taken yet.
+func (r *Recorder) NextMedia(t testing.TB) *Media {
+	t.Helper()
+	return r.next(t, &r.media, "media").(*Media)
+}
+
+// ExpectAudio fails t unless the next media is audio which has timestamp and payload.
+func (r *Recorder) ExpectAudio(t testing.TB, timestamp uint32, payload []byte) {
+	t.Helper()
+	r.expectMedia(t, message.TypeIDAudioMessage, timestamp, payload)
+}
+
+// ExpectVideo fails t unless the next media is video which has timestamp and payload.
+func (r *Recorder) ExpectVideo(t testing.TB, timestamp uint32, payload []byte) {
+	t.Helper()
+	r.expectMedia(t, message.TypeIDVideoMessage, timestamp, payload)
+}
+
+func (r *Recorder) expectMedia(t testing.TB, typeID message.TypeID, timestamp uint32, payload []byte) {
+	t.Helper()
+
+	m := r.NextMedia(t)
+	if m.TypeID != typeID || m.Timestamp != timestamp {
+		t.Fatalf("Unexpected media: Expected = (%d, %d), Actual = (%d, %d)", typeID, timestamp, m.TypeID, m.Timestamp)
+	}
+	if !bytes.Equal(m.Payload, payload) {
+		t.Fatalf("Unexpected payload of media: Expected = %x, Actual = %x", payload, m.Payload)
+	}
+}
+
+func (r *Recorder) next(t testing.TB, q *recordQueue, name string) interface{} {
+	t.Helper()
+
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	v, ok := q.pop(timeout)
+	if !ok {
+		t.Fatalf("No %s is received in %s", name, timeout)
+	}
+
+	return v
+}
+
+// recordQueue An unbounded queue, not to block reading messages of connections.
+type recordQueue struct {
+	items    []interface{}
+	notifyCh chan struct{} // Closed when an item is pushed
+	m        sync.Mutex
+}
+
+func (q *recordQueue) push(v interface{}) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	q.items = append(q.items, v)
+	if q.notifyCh != nil {
+		close(q.notifyCh)
+		q.notifyCh = nil
+	}
+}
+
+func (q *recordQueue) pop(timeout time.Duration) (interface{}, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		q.m.Lock()
+		if len(q.items) > 0 {
+			v := q.items[0]
+			q.items = q.items[1:]
+			q.m.Unlock()
+			return v, true
+		}
+		if q.notifyCh == nil {
+			q.notifyCh = make(chan struct{})
+		}
+		notifyCh := q.notifyCh
+		q.m.Unlock()
+
+		select {
+		case <-notifyCh:
+		case <-timer.C:
+			return nil, false
+		}
+	}
+}
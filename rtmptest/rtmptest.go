@@ -0,0 +1,92 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+// Package rtmptest provides utilities to test RTMP servers and clients in process without ports.
+//
+// Server serves in-memory connections which are created by Pipe, and Pair connects a ClientConn to it. Peer is a fake
+// peer which speaks raw RTMP, so tests can script messages and chunks which ClientConn or Server never produce.
+// Recorder is a client handler which records statuses, user control events and media, and asserts them in order.
+// AVCSequenceHeader, AACSequenceHeader and Publish generate synthetic H.264/AAC streams.
+//
+// Waits of Recorder and reads of Peer fail after timeouts instead of blocking forever, but no sleeps are used.
+package rtmptest
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultTimeout A timeout which is used to wait for messages if no timeouts are specified.
+const DefaultTimeout = 5 * time.Second
+
+// ErrListenerClosed is returned by Listener.Accept and Listener.Dial after the listener is closed.
+var ErrListenerClosed = errors.New("Listener is closed")
+
+// Listener A net.Listener which accepts in-memory connections created by Dial.
+type Listener struct {
+	connCh  chan net.Conn
+	closeCh chan struct{}
+	once    sync.Once
+}
+
+// NewListener creates a listener. It must be closed.
+func NewListener() *Listener {
+	return &Listener{
+		connCh:  make(chan net.Conn),
+		closeCh: make(chan struct{}),
+	}
+}
+
+// Accept waits for a connection which is created by Dial.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.connCh:
+		return conn, nil
+	case <-l.closeCh:
+		return nil, ErrListenerClosed
+	}
+}
+
+// Close closes the listener. Connections which are accepted already are not closed.
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		close(l.closeCh)
+	})
+	return nil
+}
+
+// Addr returns a dummy address.
+func (l *Listener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// Dial creates a Pipe and returns an end of it after the other end is accepted.
+func (l *Listener) Dial() (net.Conn, error) {
+	clientConn, serverConn := Pipe()
+
+	select {
+	case l.connCh <- serverConn:
+		return clientConn, nil
+	case <-l.closeCh:
+		_ = clientConn.Close()
+		_ = serverConn.Close()
+		return nil, ErrListenerClosed
+	}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string {
+	return "pipe"
+}
+
+func (pipeAddr) String() string {
+	return "pipe"
+}
@@ -0,0 +1,230 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmptest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp"
+	"github.com/yutopp/go-rtmp/media"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+func TestSyntheticMedia(t *testing.T) {
+	var v media.VideoFrame
+	err := media.DecodeVideoFrame(bytes.NewReader(AVCSequenceHeader(1920, 1080, 29.97)), &v)
+	require.Nil(t, err)
+	vi, err := media.ParseVideoInfo(&v)
+	require.Nil(t, err)
+	require.Equal(t, 1920, vi.Width)
+	require.Equal(t, 1080, vi.Height)
+	require.InDelta(t, 29.97, vi.FrameRate, 0.001)
+
+	var a media.AudioFrame
+	err = media.DecodeAudioFrame(bytes.NewReader(AACSequenceHeader(48000, 2)), &a)
+	require.Nil(t, err)
+	ai, err := media.ParseAudioInfo(&a)
+	require.Nil(t, err)
+	require.Equal(t, 48000, ai.SampleRate)
+	require.Equal(t, 2, ai.Channels)
+
+	err = media.DecodeVideoFrame(bytes.NewReader(AVCFrame(true, 100)), &v)
+	require.Nil(t, err)
+	require.True(t, v.IsKeyFrame())
+	require.Len(t, v.Data, 4+100)
+
+	frames := SyntheticFrames(&SyntheticConfig{
+		Duration:         3 * time.Second,
+		KeyFrameInterval: 1 * time.Second,
+	})
+	var videos, audios, keyFrames int
+	var last uint32
+	for _, f := range frames {
+		require.True(t, f.Timestamp >= last)
+		last = f.Timestamp
+
+		if f.TypeID == message.TypeIDAudioMessage {
+			audios++
+			continue
+		}
+		videos++
+		if err := media.DecodeVideoFrame(bytes.NewReader(f.Payload), &v); err == nil && v.IsKeyFrame() {
+			keyFrames++
+		}
+	}
+	require.Equal(t, 1+90, videos)
+	require.Equal(t, 1+130, audios) // 44100 * 3 / 1024
+	require.Equal(t, 3, keyFrames)
+}
+
+type publishedHandler struct {
+	rtmp.DefaultHandler
+	mediaCh chan *Media
+}
+
+func (h *publishedHandler) OnAudio(timestamp uint32, payload io.Reader) error {
+	b, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return err
+	}
+	h.mediaCh <- &Media{TypeID: message.TypeIDAudioMessage, Timestamp: timestamp, Payload: b}
+	return nil
+}
+
+func (h *publishedHandler) OnVideo(timestamp uint32, payload io.Reader) error {
+	b, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return err
+	}
+	h.mediaCh <- &Media{TypeID: message.TypeIDVideoMessage, Timestamp: timestamp, Payload: b}
+	return nil
+}
+
+func TestPairPublish(t *testing.T) {
+	h := &publishedHandler{mediaCh: make(chan *Media, 1024)}
+	p := NewPair(t, &rtmp.ConnConfig{Handler: h}, nil)
+	defer p.Close()
+
+	err := p.Client.Connect(nil)
+	require.Nil(t, err)
+	p.Recorder.ExpectUserCtrl(t, &message.UserCtrlEventStreamBegin{StreamID: 0})
+
+	s, err := p.Client.CreateStream(nil, 128)
+	require.Nil(t, err)
+	defer s.Close()
+
+	err = s.Publish(&message.NetStreamPublish{PublishingName: "stream", PublishingType: "live"})
+	require.Nil(t, err)
+	p.Recorder.ExpectStatus(t, message.NetStreamOnStatusCodePublishStart)
+
+	config := &SyntheticConfig{Duration: 200 * time.Millisecond}
+	err = Publish(s, config)
+	require.Nil(t, err)
+
+	// Audio and video are ordered in each chunk stream
+	expected := make(map[message.TypeID][]*Media)
+	frames := SyntheticFrames(config)
+	for _, f := range frames {
+		expected[f.TypeID] = append(expected[f.TypeID], f)
+	}
+	actual := make(map[message.TypeID][]*Media)
+	for range frames {
+		select {
+		case m := <-h.mediaCh:
+			actual[m.TypeID] = append(actual[m.TypeID], m)
+		case <-time.After(DefaultTimeout):
+			require.FailNow(t, "Media is not received")
+		}
+	}
+	require.Equal(t, expected, actual)
+}
+
+func TestFakeServer(t *testing.T) {
+	recorder := NewRecorder()
+	c, peer, err := DialFakeServer(&rtmp.ConnConfig{Handler: recorder})
+	require.Nil(t, err)
+	defer peer.Close()
+	defer c.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Connect(nil)
+	}()
+	_, err = peer.AcceptConnect()
+	require.Nil(t, err)
+	require.Nil(t, <-errCh)
+
+	streamCh := make(chan *rtmp.Stream, 1)
+	go func() {
+		s, err := c.CreateStream(nil, 128)
+		errCh <- err
+		streamCh <- s
+	}()
+	_, cmd, err := peer.ReadCommand("createStream")
+	require.Nil(t, err)
+	err = peer.WriteCommand(3, 0, "_result", cmd.TransactionID, &message.NetConnectionCreateStreamResult{StreamID: 1})
+	require.Nil(t, err)
+	require.Nil(t, <-errCh)
+	s := <-streamCh
+
+	err = s.Play(&message.NetStreamPlay{StreamName: "stream", Start: -2})
+	require.Nil(t, err)
+	m, cmd, err := peer.ReadCommand("play")
+	require.Nil(t, err)
+	require.Equal(t, uint32(1), m.StreamID)
+	body, err := DecodeCommandBody(cmd, nil)
+	require.Nil(t, err)
+	require.Equal(t, "stream", body.(*message.NetStreamPlay).StreamName)
+
+	// Script a server which starts playing
+	err = peer.WriteMessage(2, 0, 0, &message.UserCtrl{Event: &message.UserCtrlEventStreamBegin{StreamID: 1}})
+	require.Nil(t, err)
+	err = peer.WriteCommand(5, 1, "onStatus", 0, &message.NetStreamOnStatus{
+		InfoObject: message.NetStreamOnStatusInfoObject{
+			Level: message.NetStreamOnStatusLevelStatus,
+			Code:  message.NetStreamOnStatusCodePlayStart,
+		},
+	})
+	require.Nil(t, err)
+	seqHeader := AVCSequenceHeader(640, 360, 30)
+	err = peer.WriteMessage(6, 1, 0, &message.VideoMessage{Payload: bytes.NewReader(seqHeader)})
+	require.Nil(t, err)
+	frame := AACFrame(300) // Over the chunk size
+	err = peer.WriteMessage(4, 1, 0xffffff+1, &message.AudioMessage{Payload: bytes.NewReader(frame)})
+	require.Nil(t, err)
+	err = peer.WriteData(5, 1, 0, "onPlayStatus", &message.NetStreamOnPlayStatus{
+		InfoObject: message.NetStreamOnStatusInfoObject{
+			Level: message.NetStreamOnStatusLevelStatus,
+			Code:  message.NetStreamOnStatusCodePlayComplete,
+		},
+	})
+	require.Nil(t, err)
+
+	recorder.ExpectUserCtrl(t, &message.UserCtrlEventStreamBegin{StreamID: 1})
+	recorder.ExpectStatus(t, message.NetStreamOnStatusCodePlayStart)
+	recorder.ExpectVideo(t, 0, seqHeader)
+	recorder.ExpectAudio(t, 0xffffff+1, frame)
+	recorder.ExpectPlayStatus(t, message.NetStreamOnStatusCodePlayComplete)
+}
+
+func TestPeerAgainstServer(t *testing.T) {
+	srv := NewServerWithConnConfig(&rtmp.ConnConfig{})
+	defer srv.Close()
+
+	peer, err := srv.DialPeer()
+	require.Nil(t, err)
+	defer peer.Close()
+
+	result, err := peer.Connect(nil)
+	require.Nil(t, err)
+	require.Equal(t, message.NetConnectionConnectCodeSuccess, result.Information.Code)
+
+	// A command which cannot be decoded closes the connection
+	err = peer.WriteChunk(&Chunk{
+		Fmt:           0,
+		ChunkStreamID: 3,
+		MessageLength: 4,
+		MessageTypeID: message.TypeIDCommandMessageAMF0,
+		Payload:       []byte{0xff, 0xff, 0xff, 0xff},
+	})
+	require.Nil(t, err)
+
+	for {
+		if _, err := peer.ReadMessage(); err != nil {
+			require.Equal(t, io.EOF, errors.Cause(err))
+			break
+		}
+	}
+}
@@ -0,0 +1,118 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmptest
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/yutopp/go-rtmp"
+)
+
+// Server An rtmp.Server which serves in-memory connections.
+type Server struct {
+	srv      *rtmp.Server
+	listener *Listener
+	doneCh   chan struct{}
+}
+
+// NewServer starts an rtmp.Server with config. config.OnConnect is called for each connection as usual.
+func NewServer(config *rtmp.ServerConfig) *Server {
+	s := &Server{
+		srv:      rtmp.NewServer(config),
+		listener: NewListener(),
+		doneCh:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.doneCh)
+		_ = s.srv.Serve(s.listener)
+	}()
+
+	return s
+}
+
+// NewServerWithConnConfig starts an rtmp.Server which uses config for every connection.
+// A Handler of config is shared by connections, so use NewServer to create a handler per connection.
+func NewServerWithConnConfig(config *rtmp.ConnConfig) *Server {
+	return NewServer(&rtmp.ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *rtmp.ConnConfig) {
+			return conn, config
+		},
+	})
+}
+
+// Dial creates a client which is connected to the server. connect is not sent yet.
+func (s *Server) Dial(config *rtmp.ConnConfig) (*rtmp.ClientConn, error) {
+	conn, err := s.listener.Dial()
+	if err != nil {
+		return nil, err
+	}
+
+	return rtmp.NewClientConn(conn, config)
+}
+
+// DialPeer creates a fake client which is connected to the server. The handshake is done.
+func (s *Server) DialPeer() (*Peer, error) {
+	conn, err := s.listener.Dial()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClientPeer(conn)
+}
+
+// Close stops accepting connections. Connections which are served already are closed when their clients are closed.
+func (s *Server) Close() error {
+	err := s.srv.Close()
+	_ = s.listener.Close() // Serve may not register the listener yet
+	<-s.doneCh
+
+	return err
+}
+
+// Pair A Server and a ClientConn which is connected to it.
+type Pair struct {
+	Server   *Server
+	Client   *rtmp.ClientConn
+	Recorder *Recorder // A handler of Client
+}
+
+// NewPair starts a server which uses serverConfig for the connection, and connects a client to it. A Handler of
+// clientConfig is replaced with Recorder, and clientConfig can be nil. connect is not sent yet.
+// It fails t if the client cannot be created. Close must be called.
+func NewPair(t testing.TB, serverConfig, clientConfig *rtmp.ConnConfig) *Pair {
+	t.Helper()
+
+	c := rtmp.ConnConfig{}
+	if clientConfig != nil {
+		c = *clientConfig
+	}
+	recorder := NewRecorder()
+	c.Handler = recorder
+
+	srv := NewServerWithConnConfig(serverConfig)
+	client, err := srv.Dial(&c)
+	if err != nil {
+		_ = srv.Close()
+		t.Fatalf("Failed to dial: Err = %+v", err)
+	}
+
+	return &Pair{
+		Server:   srv,
+		Client:   client,
+		Recorder: recorder,
+	}
+}
+
+// Close closes the client and the server.
+func (p *Pair) Close() error {
+	_ = p.Client.Close()
+	return p.Server.Close()
+}
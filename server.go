@@ -8,13 +8,22 @@
 package rtmp
 
 import (
+	"crypto/tls"
 	"io"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+const (
+	defaultListenAddr    = ":1935"
+	defaultTLSListenAddr = ":443"
+
+	defaultTLSHandshakeTimeout = 10 * time.Second
+)
+
 type Server struct {
 	config *ServerConfig
 
@@ -25,6 +34,16 @@ type Server struct {
 
 type ServerConfig struct {
 	OnConnect func(net.Conn) (io.ReadWriteCloser, *ConnConfig)
+
+	// TLSConfig is used by ServeTLS and ListenAndServeTLS. Set GetCertificate (e.g. CertificateReloader or
+	// SNICertificates) to select certificates dynamically, and ClientAuth/ClientCAs to authenticate clients.
+	TLSConfig *tls.Config
+
+	// TLSHandshakeTimeout bounds TLS handshakes of accepted connections. Default is 10s. Negative values disable it.
+	TLSHandshakeTimeout time.Duration
+
+	// Observer observes connections which do not have ConnConfig.Observer.
+	Observer Observer
 }
 
 func NewServer(config *ServerConfig) *Server {
@@ -57,6 +76,62 @@ func (srv *Server) Serve(l net.Listener) error {
 	}
 }
 
+// ServeTLS accepts RTMPS connections on the listener.
+// certFile and keyFile can be empty if TLSConfig of ServerConfig already provides certificates.
+func (srv *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
+	config := &tls.Config{}
+	if srv.config.TLSConfig != nil {
+		config = srv.config.TLSConfig.Clone()
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return errors.Wrap(err, "Failed to load a certificate")
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return errors.New("No certificates are configured")
+	}
+
+	return srv.Serve(tls.NewListener(l, config))
+}
+
+// ListenAndServe listens on the TCP address and serves RTMP. ":1935" is used if addr is empty.
+func (srv *Server) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = defaultListenAddr
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return srv.Serve(l)
+}
+
+// ListenAndServeTLS listens on the TCP address and serves RTMPS. ":443" is used if addr is empty.
+func (srv *Server) ListenAndServeTLS(addr, certFile, keyFile string) error {
+	if addr == "" {
+		addr = defaultTLSListenAddr
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	if err := srv.ServeTLS(l, certFile, keyFile); err != nil {
+		_ = l.Close()
+		return err
+	}
+
+	return nil
+}
+
 func (srv *Server) Close() error {
 	srv.mu.Lock()
 	defer srv.mu.Unlock()
@@ -104,10 +179,46 @@ func (srv *Server) getDoneChLocked() chan struct{} {
 	return srv.doneCh
 }
 
+// handshakeTLS Completes a TLS handshake within TLSHandshakeTimeout, so that clients which stall cannot hold connections.
+func (srv *Server) handshakeTLS(conn *tls.Conn) error {
+	timeout := srv.config.TLSHandshakeTimeout
+	if timeout == 0 {
+		timeout = defaultTLSHandshakeTimeout
+	}
+	if timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+	}
+
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+
+	return conn.SetDeadline(time.Time{})
+}
+
 func (srv *Server) handleConn(conn net.Conn) {
+	// Complete a TLS handshake in advance to expose the negotiated state to OnConnect and handlers
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := srv.handshakeTLS(tlsConn); err != nil {
+			_ = conn.Close()
+			return
+		}
+	}
+
 	userConn, connConfig := srv.config.OnConnect(conn)
+	if srv.config.Observer != nil && (connConfig == nil || connConfig.Observer == nil) {
+		c := ConnConfig{}
+		if connConfig != nil {
+			c = *connConfig
+		}
+		c.Observer = srv.config.Observer
+		connConfig = &c
+	}
 
 	c := newConn(userConn, connConfig)
+	c.netConn = conn
 	sc := &serverConn{
 		conn: c,
 	}
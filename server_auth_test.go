@@ -0,0 +1,169 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type serverCanAuthenticateHandler struct {
+	DefaultHandler
+	connectCh chan *message.NetConnectionConnect
+}
+
+func (h *serverCanAuthenticateHandler) OnConnect(_ uint32, cmd *message.NetConnectionConnect) error {
+	h.connectCh <- cmd
+	return nil
+}
+
+func newAuthServerConfig(mod AuthMod) (*ServerConfig, <-chan *message.NetConnectionConnect) {
+	auth := NewAuthenticator(&AuthenticatorConfig{
+		Mod: mod,
+		Credentials: StaticCredentialStore{
+			"alice": "secret",
+		},
+	})
+
+	connectCh := make(chan *message.NetConnectionConnect, 1)
+	return &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			return conn, &ConnConfig{
+				Handler:       &serverCanAuthenticateHandler{connectCh: connectCh},
+				Authenticator: auth,
+			}
+		},
+	}, connectCh
+}
+
+func TestServerCanAuthenticate(t *testing.T) {
+	for _, mod := range []AuthMod{AuthModAdobe, AuthModLLNW} {
+		t.Run(string(mod), func(t *testing.T) {
+			config, connectCh := newAuthServerConfig(mod)
+			prepareServer(t, config, func(addr string) {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				c, err := DialURL(ctx, fmt.Sprintf("rtmp://alice:secret@%s/app/key", addr), nil)
+				require.Nil(t, err)
+				defer c.Close()
+
+				// Authentication parameters are removed
+				cmd := <-connectCh
+				require.Equal(t, "app", cmd.Command.App)
+				require.Equal(t, fmt.Sprintf("rtmp://%s/app", addr), cmd.Command.TCURL)
+
+				// The stored authmod is used when reconnecting
+				require.Nil(t, c.reconnect(""))
+				<-connectCh
+			})
+		})
+	}
+}
+
+func TestServerRejectsUnauthenticatedClients(t *testing.T) {
+	config, _ := newAuthServerConfig(AuthModAdobe)
+	prepareServer(t, config, func(addr string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		for _, userInfo := range []string{"", "alice:wrong@", "bob:secret@"} {
+			_, err := DialURL(ctx, fmt.Sprintf("rtmp://%s%s/app/key", userInfo, addr), nil)
+			require.Error(t, err, userInfo)
+
+			rejected, ok := errors.Cause(err).(*ConnectRejectedError)
+			require.True(t, ok, userInfo)
+			require.Equal(t, message.NetConnectionConnectCodeRejected, rejected.Result.Information.Code)
+		}
+	})
+}
+
+func TestAuthenticatorRejectsReusedChallenges(t *testing.T) {
+	auth := NewAuthenticator(&AuthenticatorConfig{
+		Credentials: StaticCredentialStore{
+			"alice": "secret",
+		},
+	})
+
+	connect := func(app string) error {
+		return auth.authenticate(&message.NetConnectionConnect{
+			Command: message.NetConnectionConnectCommand{App: app},
+		})
+	}
+
+	err := connect("app?authmod=adobe&user=alice")
+	require.IsType(t, &ConnectRejection{}, err)
+
+	desc := err.(*ConnectRejection).Description
+	_, query := splitAuthQuery(desc)
+	params := parseAuthParams(query)
+	require.Equal(t, "needauth", params["reason"])
+
+	response := adobeAuthResponse("alice", "secret", params["salt"], params["opaque"], "cafe")
+	app := fmt.Sprintf("app?authmod=adobe&user=alice&challenge=cafe&response=%s&opaque=%s", response, params["opaque"])
+	require.Nil(t, connect(app))
+	require.IsType(t, &ConnectRejection{}, connect(app))
+}
+
+func TestAuthenticatorRejectsUserNamesBreakingParams(t *testing.T) {
+	auth := NewAuthenticator(&AuthenticatorConfig{
+		Credentials: StaticCredentialStore{
+			"alice": "secret",
+			"a=b":   "secret",
+		},
+	})
+
+	err := auth.authenticate(&message.NetConnectionConnect{
+		Command: message.NetConnectionConnectCommand{App: "app?authmod=adobe&user=a=b"},
+	})
+	require.IsType(t, &ConnectRejection{}, err)
+
+	desc := err.(*ConnectRejection).Description
+	_, query := splitAuthQuery(desc)
+	require.Equal(t, map[string]string{"reason": "authfailed"}, parseAuthParams(query))
+	require.Equal(t, 0, len(auth.challenges))
+}
+
+func TestAuthenticatorLimitsChallenges(t *testing.T) {
+	auth := NewAuthenticator(&AuthenticatorConfig{MaxChallenges: 2})
+
+	put := func(key string, expiresAt time.Time) {
+		auth.putChallenge(key, &authChallenge{user: "alice", expiresAt: expiresAt})
+	}
+
+	expiresAt := time.Now().Add(time.Minute)
+	put("a", expiresAt)
+	put("b", expiresAt)
+	put("c", expiresAt) // Discards the oldest one
+	require.Equal(t, 2, len(auth.challenges))
+	require.Nil(t, auth.takeChallenge("a", "alice"))
+	require.NotNil(t, auth.takeChallenge("b", "alice"))
+	require.NotNil(t, auth.takeChallenge("c", "alice"))
+
+	put("d", time.Now().Add(-time.Second))
+	put("e", expiresAt) // Removes the expired one
+	require.Equal(t, 1, len(auth.challenges))
+	require.Nil(t, auth.takeChallenge("d", "alice"))
+	require.NotNil(t, auth.takeChallenge("e", "alice"))
+	require.Equal(t, 0, auth.order.Len())
+}
+
+func TestStripAuthParams(t *testing.T) {
+	require.Equal(t, "app", stripAuthParams("app?authmod=adobe&user=alice"))
+	require.Equal(t, "app?token=x", stripAuthParams("app?authmod=llnw&token=x&nonce=n"))
+	require.Equal(t, "app", stripAuthParams("app"))
+}
@@ -0,0 +1,141 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type bandwidthCheckedHandler struct {
+	DefaultHandler
+	resultCh chan *BandwidthResult
+}
+
+func (h *bandwidthCheckedHandler) OnBandwidthChecked(result *BandwidthResult) {
+	h.resultCh <- result
+}
+
+func testBandwidthCheckConfig() BandwidthCheckConfig {
+	return BandwidthCheckConfig{
+		Duration:    50 * time.Millisecond,
+		PayloadSize: 1024,
+		MaxBytes:    64 * 1024,
+	}
+}
+
+func TestServerCanCheckBandwidth(t *testing.T) {
+	resultCh := make(chan *BandwidthResult, 1)
+	config := &ConnConfig{
+		Handler:        &bandwidthCheckedHandler{resultCh: resultCh},
+		BandwidthCheck: testBandwidthCheckConfig(),
+		Logger:         logrus.StandardLogger(),
+	}
+
+	prepareConnection(t, config, func(c *ClientConn) {
+		err := c.Connect(nil)
+		require.Nil(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		result, err := c.CheckBandwidth(ctx)
+		require.Nil(t, err)
+		require.True(t, result.Bytes > 0)
+		require.True(t, result.Kbps > 0)
+
+		serverResult := <-resultCh
+		require.InDelta(t, float64(serverResult.Bytes), float64(result.Bytes), 1)
+		require.Equal(t, serverResult.Kbps, result.Kbps)
+
+		// Legacy names used by librtmp
+		conn := c.currentConn()
+		ctrlStream, err := conn.streams.At(ControlStreamID)
+		require.Nil(t, err)
+
+		ch := conn.bandwidth.wait()
+		err = ctrlStream.writeCommandMessage(3, 0, "_checkbw", 0, &message.NetConnectionCheckBandwidth{})
+		require.Nil(t, err)
+		require.True(t, (<-ch).Bytes > 0)
+		<-resultCh
+	})
+}
+
+func TestServerCanAnswerUplinkBandwidthCheck(t *testing.T) {
+	config := &ConnConfig{
+		Logger: logrus.StandardLogger(),
+	}
+
+	prepareConnection(t, config, func(c *ClientConn) {
+		err := c.Connect(nil)
+		require.Nil(t, err)
+
+		result, err := c.CheckUplinkBandwidth(context.Background())
+		require.Nil(t, err)
+		require.True(t, result.Bytes > 0)
+		require.True(t, result.Kbps > 0)
+
+		// The connection is still usable
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+	})
+}
+
+func TestServerChecksBandwidthOnConnect(t *testing.T) {
+	serverConfig := testBandwidthCheckConfig()
+	serverConfig.OnConnect = true
+	config := &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			return conn, &ConnConfig{
+				BandwidthCheck: serverConfig,
+				Logger:         logrus.StandardLogger(),
+			}
+		},
+	}
+	prepareServer(t, config, func(addr string) {
+		resultCh := make(chan *BandwidthResult, 1)
+		c, err := Dial("rtmp", addr, &ConnConfig{
+			Handler: &bandwidthCheckedHandler{resultCh: resultCh},
+			Logger:  logrus.StandardLogger(),
+		})
+		require.Nil(t, err)
+		defer c.Close()
+
+		err = c.Connect(nil)
+		require.Nil(t, err)
+
+		select {
+		case result := <-resultCh:
+			require.True(t, result.Bytes > 0)
+			require.True(t, result.Latency > 0)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "onBWDone is not received")
+		}
+	})
+}
+
+func TestCallOnBWCheckDeletesTransactionsWhenCanceled(t *testing.T) {
+	c := newConn(&rwcMock{}, nil)
+	s := newStream(0, c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := s.callOnBWCheck(ctx, "onBWCheck", "", 2)
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, 0, len(s.transactions.transactions))
+}
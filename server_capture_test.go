@@ -0,0 +1,122 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/capture"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type captureReplayHandler struct {
+	DefaultHandler
+	eventCh chan string
+}
+
+func (h *captureReplayHandler) OnPublish(_ *StreamContext, _ uint32, cmd *message.NetStreamPublish) error {
+	h.eventCh <- "publish:" + cmd.PublishingName
+	return nil
+}
+
+func (h *captureReplayHandler) OnAudio(_ uint32, payload io.Reader) error {
+	b, _ := ioutil.ReadAll(payload)
+	h.eventCh <- fmt.Sprintf("audio:%x", b)
+	return nil
+}
+
+func TestClientCaptureCanBeReplayedAgainstServer(t *testing.T) {
+	eventCh := make(chan string, 4)
+	config := &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			return conn, &ConnConfig{
+				Handler: &captureReplayHandler{eventCh: eventCh},
+			}
+		},
+	}
+	prepareServer(t, config, func(addr string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Capture a client session
+		var buf bytes.Buffer
+		c, err := Dial("rtmp", addr, &ConnConfig{
+			Capture: &buf,
+		})
+		require.Nil(t, err)
+
+		err = c.Connect(nil)
+		require.Nil(t, err)
+
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+
+		err = s.Publish(&message.NetStreamPublish{
+			PublishingName: "key",
+			PublishingType: "live",
+		})
+		require.Nil(t, err)
+
+		err = s.Write(4, 0, &message.AudioMessage{Payload: bytes.NewReader(recordAACRaw)})
+		require.Nil(t, err)
+
+		expected := []string{"publish:key", fmt.Sprintf("audio:%x", recordAACRaw)}
+		waitEvents := func() []string {
+			var events []string
+			for len(events) < len(expected) {
+				select {
+				case ev := <-eventCh:
+					events = append(events, ev)
+				case <-ctx.Done():
+					require.FailNow(t, fmt.Sprintf("Timeout: Events = %v", events))
+				}
+			}
+			return events
+		}
+		require.Equal(t, expected, waitEvents())
+		require.Nil(t, c.Close())
+
+		records, err := capture.ReadAll(&buf)
+		require.Nil(t, err)
+
+		// The client side chunks can be decoded offline
+		cs := NewChunkStreamer(capture.Chunks(records, capture.RecordTypeWrite), ioutil.Discard, nil)
+		defer cs.Close()
+		var cmsg ChunkMessage
+		_, _, err = cs.Read(&cmsg)
+		require.Nil(t, err)
+		require.Equal(t, message.TypeIDCommandMessageAMF0, cmsg.Message.TypeID()) // connect
+
+		// Replay the client against a new server
+		serverSide, peerSide := net.Pipe()
+		defer peerSide.Close()
+
+		conn := newConn(serverSide, &ConnConfig{
+			Handler:                   &captureReplayHandler{eventCh: eventCh},
+			SkipHandshakeVerification: true,
+		})
+		sc := newServerConn(conn)
+		defer sc.Close()
+		go func() {
+			_ = sc.Serve()
+		}()
+
+		err = capture.Replay(ctx, peerSide, records, capture.SideSelf)
+		require.Nil(t, err)
+		require.Equal(t, expected, waitEvents())
+	})
+}
@@ -8,10 +8,12 @@
 package rtmp
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
@@ -75,6 +77,144 @@ func TestServerCanRejectConnect(t *testing.T) {
 	})
 }
 
+type serverCanRejectConnectWithResultHandler struct {
+	DefaultHandler
+	err error
+}
+
+func (h *serverCanRejectConnectWithResultHandler) OnConnect(_ uint32, _ *message.NetConnectionConnect) error {
+	return h.err
+}
+
+func TestServerCanRejectConnectWithResult(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected message.NetConnectionConnectResultInformation
+	}{
+		{
+			name: "Rejected",
+			err:  NewConnectRejection("Banned", map[string]interface{}{"reason": "ban"}),
+			expected: message.NetConnectionConnectResultInformation{
+				Level:       "error",
+				Code:        message.NetConnectionConnectCodeRejected,
+				Description: "Banned",
+				Data:        amf0.ECMAArray{"type": "go-rtmp", "version": "master"},
+				Application: map[string]interface{}{"reason": "ban"},
+			},
+		},
+		{
+			name: "InvalidApp",
+			err:  NewConnectInvalidApp("No such app"),
+			expected: message.NetConnectionConnectResultInformation{
+				Level:       "error",
+				Code:        message.NetConnectionConnectCodeInvalidApp,
+				Description: "No such app",
+				Data:        amf0.ECMAArray{"type": "go-rtmp", "version": "master"},
+			},
+		},
+		{
+			name: "Redirect",
+			err:  NewConnectRedirect("rtmp://edge.example.com/app", "Redirected"),
+			expected: message.NetConnectionConnectResultInformation{
+				Level:       "error",
+				Code:        message.NetConnectionConnectCodeRejected,
+				Description: "Redirected",
+				Data:        amf0.ECMAArray{"type": "go-rtmp", "version": "master"},
+				Ex: &message.NetConnectionConnectResultEx{
+					Code:     302,
+					Redirect: "rtmp://edge.example.com/app",
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			config := &ConnConfig{
+				Handler: &serverCanRejectConnectWithResultHandler{err: tc.err},
+				Logger:  logrus.StandardLogger(),
+			}
+
+			prepareConnection(t, config, func(c *ClientConn) {
+				err := c.Connect(nil)
+				rejected, ok := err.(*ConnectRejectedError)
+				require.True(t, ok)
+				require.Equal(t, tc.expected, rejected.Result.Information)
+
+				tcURL, ok := rejected.Redirect()
+				require.Equal(t, tc.expected.Ex != nil, ok)
+				if ok {
+					require.Equal(t, "rtmp://edge.example.com/app", tcURL)
+				}
+			})
+		})
+	}
+}
+
+type clientCanFollowRedirectHandler struct {
+	DefaultHandler
+	redirectTo string
+}
+
+func (h *clientCanFollowRedirectHandler) OnConnect(_ uint32, _ *message.NetConnectionConnect) error {
+	if h.redirectTo != "" {
+		return NewConnectRedirect(h.redirectTo, "Redirected")
+	}
+	return nil
+}
+
+func TestClientCanFollowRedirect(t *testing.T) {
+	var servers []*Server
+	defer func() {
+		for _, srv := range servers {
+			_ = srv.Close()
+		}
+	}()
+
+	startServer := func(redirectTo string) string {
+		l, err := net.Listen("tcp", "127.0.0.1:")
+		require.Nil(t, err)
+
+		srv := NewServer(&ServerConfig{
+			OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+				return conn, &ConnConfig{
+					Handler: &clientCanFollowRedirectHandler{redirectTo: redirectTo},
+				}
+			},
+		})
+		servers = append(servers, srv)
+
+		go func() {
+			_ = srv.Serve(l)
+		}()
+
+		return l.Addr().String()
+	}
+
+	edgeAddr := startServer("")
+	originAddr := startServer(fmt.Sprintf("rtmp://%s/edge", edgeAddr))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Redirections are not followed by default
+	_, err := DialURL(ctx, fmt.Sprintf("rtmp://%s/app/key", originAddr), nil)
+	rejected, ok := err.(*ConnectRejectedError)
+	require.True(t, ok)
+	_, ok = rejected.Redirect()
+	require.True(t, ok)
+
+	c, err := DialURL(ctx, fmt.Sprintf("rtmp://%s/app/key", originAddr), &ConnConfig{
+		MaxConnectRedirects: 1,
+	})
+	require.Nil(t, err)
+	defer c.Close()
+
+	require.Equal(t, fmt.Sprintf("rtmp://%s/edge/key", edgeAddr), c.URL().String())
+}
+
 type serverCanAcceptCreateStreamHandler struct {
 	DefaultHandler
 }
@@ -145,35 +285,143 @@ func TestServerCanAcceptDeleteStream(t *testing.T) {
 	})
 }
 
-func prepareConnection(t *testing.T, config *ConnConfig, f func(c *ClientConn)) {
-	// prepare server
+type serverCanNegotiateEnhancedRTMPHandler struct {
+	DefaultHandler
+}
+
+func TestServerCanNegotiateEnhancedRTMP(t *testing.T) {
+	config := &ConnConfig{
+		Handler: &serverCanNegotiateEnhancedRTMPHandler{},
+		Logger:  logrus.StandardLogger(),
+		EnhancedRTMP: EnhancedRTMPConfig{
+			FourCcList: []string{"hvc1", "Opus"},
+			VideoFourCcInfoMap: map[string]int{
+				"hvc1": message.FourCcInfoCanDecode | message.FourCcInfoCanForward,
+				"avc1": message.FourCcInfoCanForward,
+			},
+			CapsEx: message.CapsExReconnect,
+		},
+	}
+
+	prepareConnection(t, config, func(c *ClientConn) {
+		err := c.Connect(&message.NetConnectionConnect{
+			Command: message.NetConnectionConnectCommand{
+				App:        "live",
+				FourCcList: []string{"av01", "hvc1"},
+				VideoFourCcInfoMap: map[string]int{
+					"hvc1": message.FourCcInfoCanDecode | message.FourCcInfoCanEncode,
+					"av01": message.FourCcInfoCanDecode,
+					"*":    message.FourCcInfoCanForward,
+				},
+				AudioFourCcInfoMap: map[string]int{
+					"Opus": message.FourCcInfoCanDecode | message.FourCcInfoCanForward,
+				},
+				CapsEx: message.CapsExReconnect | message.CapsExMultitrack,
+			},
+		})
+		require.Nil(t, err)
+
+		props := c.ConnectResult().Properties
+		require.Equal(t, []string{"hvc1"}, props.FourCcList)
+		require.Equal(t, map[string]int{
+			"hvc1": message.FourCcInfoCanDecode,
+			"avc1": message.FourCcInfoCanForward,
+		}, props.VideoFourCcInfoMap)
+		// Servers only forward codecs if the maps are not configured
+		require.Equal(t, map[string]int{
+			"Opus": message.FourCcInfoCanForward,
+		}, props.AudioFourCcInfoMap)
+		require.Equal(t, message.CapsExReconnect, props.CapsEx)
+	})
+}
+
+type serverCanAcceptURLConnectHandler struct {
+	DefaultHandler
+	connectCh chan *message.NetConnectionConnect
+}
+
+func (h *serverCanAcceptURLConnectHandler) OnConnect(_ uint32, cmd *message.NetConnectionConnect) error {
+	h.connectCh <- cmd
+	return nil
+}
+
+func TestClientCanDialURL(t *testing.T) {
 	l, err := net.Listen("tcp", "127.0.0.1:")
 	require.Nil(t, err)
 
+	connectCh := make(chan *message.NetConnectionConnect, 1)
 	srv := NewServer(&ServerConfig{
 		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
-			return conn, config
+			return conn, &ConnConfig{
+				Handler: &serverCanAcceptURLConnectHandler{
+					connectCh: connectCh,
+				},
+			}
 		},
 	})
+	defer srv.Close()
+
+	go func() {
+		_ = srv.Serve(l)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rawurl := fmt.Sprintf("rtmp://%s/app/instance/key?token=abc", l.Addr().String())
+	c, err := DialURL(ctx, rawurl, nil)
+	require.Nil(t, err)
+	defer c.Close()
+
+	cmd := <-connectCh
+	require.Equal(t, "app/instance", cmd.Command.App)
+	require.Equal(t, fmt.Sprintf("rtmp://%s/app/instance", l.Addr().String()), cmd.Command.TCURL)
+	require.Equal(t, "key?token=abc", c.URL().PlayPath())
+}
+
+// prepareServer Serves connections with config, and calls f with an address of the server. Servers which have
+// TLSConfig serve RTMPS.
+func prepareServer(t *testing.T, config *ServerConfig, f func(addr string)) {
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	require.Nil(t, err)
+
+	srv := NewServer(config)
 	defer func() {
 		err := srv.Close()
 		require.Nil(t, err)
 	}()
 
 	go func() {
-		err := srv.Serve(l)
+		var err error
+		if config.TLSConfig != nil {
+			err = srv.ServeTLS(l, "", "")
+		} else {
+			err = srv.Serve(l)
+		}
 		require.Equal(t, ErrClosed, err)
 	}()
 
-	// prepare client
-	c, err := Dial("rtmp", l.Addr().String(), &ConnConfig{
-		Logger: logrus.StandardLogger(),
-	})
-	require.Nil(t, err)
-	defer func() {
-		err := c.Close()
+	f(l.Addr().String())
+}
+
+func prepareConnection(t *testing.T, config *ConnConfig, f func(c *ClientConn)) {
+	// prepare server
+	srvConfig := &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			return conn, config
+		},
+	}
+	prepareServer(t, srvConfig, func(addr string) {
+		// prepare client
+		c, err := Dial("rtmp", addr, &ConnConfig{
+			Logger: logrus.StandardLogger(),
+		})
 		require.Nil(t, err)
-	}()
+		defer func() {
+			err := c.Close()
+			require.Nil(t, err)
+		}()
 
-	f(c)
+		f(c)
+	})
 }
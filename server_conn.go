@@ -25,11 +25,11 @@ func newServerConn(conn *Conn) *serverConn {
 }
 
 func (sc *serverConn) Serve() error {
-	if err := handshake.HandshakeWithClient(sc.conn.rwc, sc.conn.rwc, &handshake.Config{
-		SkipHandshakeVerification: sc.conn.config.SkipHandshakeVerification,
-	}); err != nil {
+	result, err := handshake.NegotiateWithClient(sc.conn.rwc, sc.conn.rwc, sc.conn.handshakeConfig())
+	if err != nil {
 		return errors.Wrap(err, "Failed to handshake")
 	}
+	sc.conn.setHandshakeResult(result)
 
 	ctrlStream, err := sc.conn.streams.Create(ControlStreamID)
 	if err != nil {
@@ -132,6 +132,24 @@ func (h *serverControlConnectedHandler) onCommand(
 
 		return nil
 
+	case *message.NetStreamGetStreamLength:
+		return replyGetStreamLength(h.sh, chunkStreamID, timestamp, tID, cmd)
+
+	case *message.NetConnectionCheckBandwidth:
+		l.Infof("Check bandwidth: CommandName = %s", cmdMsg.CommandName)
+
+		if tID != 0 {
+			if err := h.sh.stream.writeCommandMessage(chunkStreamID, timestamp, "_result", tID, cmd); err != nil {
+				return err
+			}
+		}
+		h.sh.stream.startBandwidthCheck(bandwidthCommandNamesFor(cmdMsg.CommandName))
+
+		return nil
+
+	case *message.NetConnectionOnBWCheck:
+		return replyOnBWCheck(h.sh, chunkStreamID, timestamp, tID)
+
 	case *message.NetStreamFCUnpublish:
 		l.Infof("FCUnpublish stream...: StreamName = %s", cmd.StreamName)
 
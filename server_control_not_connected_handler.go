@@ -55,7 +55,7 @@ func (h *serverControlNotConnectedHandler) onCommand(
 		l.Info("Connect")
 		defer func() {
 			if err != nil {
-				result := h.newConnectErrorResult()
+				result := h.newConnectErrorResult(err)
 
 				l.Infof("Connect(Error): ResponseBody = %#v, Err = %+v", result, err)
 				if err1 := h.sh.stream.ReplyConnect(chunkStreamID, timestamp, result); err1 != nil {
@@ -64,6 +64,12 @@ func (h *serverControlNotConnectedHandler) onCommand(
 			}
 		}()
 
+		if auth := h.sh.stream.conn.config.Authenticator; auth != nil {
+			if err := auth.authenticate(cmd); err != nil {
+				return err
+			}
+		}
+
 		if err := h.sh.stream.userHandler().OnConnect(timestamp, cmd); err != nil {
 			return err
 		}
@@ -95,7 +101,7 @@ func (h *serverControlNotConnectedHandler) onCommand(
 			return err
 		}
 
-		result := h.newConnectSuccessResult()
+		result := h.newConnectSuccessResult(cmd)
 
 		l.Infof("Connect: ResponseBody = %#v", result)
 		if err := h.sh.stream.ReplyConnect(chunkStreamID, timestamp, result); err != nil {
@@ -105,6 +111,10 @@ func (h *serverControlNotConnectedHandler) onCommand(
 
 		h.sh.ChangeState(streamStateServerConnected)
 
+		if h.sh.stream.conn.config.BandwidthCheck.OnConnect {
+			h.sh.stream.startBandwidthCheck(bandwidthCommandNamesFMS)
+		}
+
 		return nil
 
 	default:
@@ -112,13 +122,19 @@ func (h *serverControlNotConnectedHandler) onCommand(
 	}
 }
 
-func (h *serverControlNotConnectedHandler) newConnectSuccessResult() *message.NetConnectionConnectResult {
+func (h *serverControlNotConnectedHandler) newConnectSuccessResult(
+	cmd *message.NetConnectionConnect,
+) *message.NetConnectionConnectResult {
 	rPreset := h.sh.stream.conn.config.RPreset
 	if rPreset == nil {
 		rPreset = defaultResponsePreset
 	}
+
+	properties := rPreset.GetServerConnectResultProperties()
+	h.sh.stream.conn.config.EnhancedRTMP.negotiate(&cmd.Command, &properties)
+
 	return &message.NetConnectionConnectResult{
-		Properties: rPreset.GetServerConnectResultProperties(),
+		Properties: properties,
 		Information: message.NetConnectionConnectResultInformation{
 			Level:       "status",
 			Code:        message.NetConnectionConnectCodeSuccess,
@@ -128,11 +144,31 @@ func (h *serverControlNotConnectedHandler) newConnectSuccessResult() *message.Ne
 	}
 }
 
-func (h *serverControlNotConnectedHandler) newConnectErrorResult() *message.NetConnectionConnectResult {
+func (h *serverControlNotConnectedHandler) newConnectErrorResult(err error) *message.NetConnectionConnectResult {
 	rPreset := h.sh.stream.conn.config.RPreset
 	if rPreset == nil {
 		rPreset = defaultResponsePreset
 	}
+
+	if rejection, ok := errors.Cause(err).(*ConnectRejection); ok {
+		code := rejection.Code
+		if code == "" {
+			code = message.NetConnectionConnectCodeRejected
+		}
+
+		return &message.NetConnectionConnectResult{
+			Properties: rPreset.GetServerConnectResultProperties(),
+			Information: message.NetConnectionConnectResultInformation{
+				Level:       "error",
+				Code:        code,
+				Description: rejection.Description,
+				Data:        rPreset.GetServerConnectResultData(),
+				Application: rejection.Application,
+				Ex:          rejection.Ex,
+			},
+		}
+	}
+
 	return &message.NetConnectionConnectResult{
 		Properties: rPreset.GetServerConnectResultProperties(),
 		Information: message.NetConnectionConnectResultInformation{
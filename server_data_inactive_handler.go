@@ -57,17 +57,14 @@ func (h *serverDataInactiveHandler) onCommand(
 
 		streamCtx := &StreamContext{
 			StreamID: h.sh.stream.streamID,
+			Info:     h.sh.stream.info,
+			stream:   h.sh.stream,
 		}
 		if err := h.sh.stream.userHandler().OnPublish(streamCtx, timestamp, cmd); err != nil {
-			// TODO: Support message.NetStreamOnStatusCodePublishBadName
-			result := h.newOnStatus(message.NetStreamOnStatusCodePublishFailed, "Publish failed.")
+			result := h.newErrorOnStatus(err, message.NetStreamOnStatusCodePublishFailed, "Publish failed.")
 
 			l.Infof("Reject a Publish request: Response = %#v, Err = %+v", result, err)
-			if err1 := h.sh.stream.NotifyStatus(chunkStreamID, timestamp, result); err1 != nil {
-				return errors.Wrapf(err, "Failed to reply response: Err = %+v", err1)
-			}
-
-			return err
+			return h.reject(chunkStreamID, timestamp, result, err)
 		}
 
 		result := h.newOnStatus(message.NetStreamOnStatusCodePublishStart, "Publish succeeded.")
@@ -85,16 +82,26 @@ func (h *serverDataInactiveHandler) onCommand(
 
 		streamCtx := &StreamContext{
 			StreamID: h.sh.stream.streamID,
+			Info:     h.sh.stream.info,
+			stream:   h.sh.stream,
+			playCmd:  cmd,
 		}
 		if err := h.sh.stream.userHandler().OnPlay(streamCtx, timestamp, cmd); err != nil {
-			result := h.newOnStatus(message.NetStreamOnStatusCodePlayFailed, "Play failed.")
+			if player := h.sh.stream.attachPlayer(nil); player != nil {
+				player.stop()
+			}
+
+			result := h.newErrorOnStatus(err, message.NetStreamOnStatusCodePlayFailed, "Play failed.")
 
 			l.Infof("Reject a Play request: Response = %#v, Err = %+v", result, err)
-			if err1 := h.sh.stream.NotifyStatus(chunkStreamID, timestamp, result); err1 != nil {
-				return errors.Wrapf(err, "Failed to reply response: Err = %+v", err1)
-			}
+			return h.reject(chunkStreamID, timestamp, result, err)
+		}
 
-			return err
+		player := h.sh.stream.attachedPlayer()
+		if player != nil {
+			if err := player.notifyReset(chunkStreamID, timestamp); err != nil {
+				return err
+			}
 		}
 
 		result := h.newOnStatus(message.NetStreamOnStatusCodePlayStart, "Play succeeded.")
@@ -105,8 +112,16 @@ func (h *serverDataInactiveHandler) onCommand(
 
 		h.sh.ChangeState(streamStateServerPlay)
 
+		if player != nil {
+			l.Infof("VOD playback started: Start = %d, Duration = %d", cmd.Start, cmd.Duration)
+			player.run(chunkStreamID)
+		}
+
 		return nil
 
+	case *message.NetStreamGetStreamLength:
+		return replyGetStreamLength(h.sh, chunkStreamID, timestamp, cmdMsg.TransactionID, cmd)
+
 	default:
 		return internal.ErrPassThroughMsg
 	}
@@ -123,7 +138,11 @@ func (h *serverDataInactiveHandler) newOnStatus(
 		fallthrough
 	case message.NetStreamOnStatusCodePlayFailed:
 		fallthrough
+	case message.NetStreamOnStatusCodePlayStreamNotFound:
+		fallthrough
 	case message.NetStreamOnStatusCodePublishBadName, message.NetStreamOnStatusCodePublishFailed:
+		fallthrough
+	case message.NetStreamOnStatusCodePublishDenied:
 		level = message.NetStreamOnStatusLevelError
 	}
 
@@ -135,3 +154,47 @@ func (h *serverDataInactiveHandler) newOnStatus(
 		},
 	}
 }
+
+// newErrorOnStatus Builds onStatus from StatusError. Other errors are replied with code and description.
+func (h *serverDataInactiveHandler) newErrorOnStatus(
+	err error,
+	code message.NetStreamOnStatusCode,
+	description string,
+) *message.NetStreamOnStatus {
+	statusErr, ok := errors.Cause(err).(*StatusError)
+	if !ok {
+		return h.newOnStatus(code, description)
+	}
+
+	level := statusErr.Level
+	if level == "" {
+		level = message.NetStreamOnStatusLevelError
+	}
+
+	return &message.NetStreamOnStatus{
+		InfoObject: message.NetStreamOnStatusInfoObject{
+			Level:       level,
+			Code:        statusErr.Code,
+			Description: statusErr.Description,
+			Details:     statusErr.Details,
+		},
+	}
+}
+
+// reject Replies result, and returns err to close the connection unless StatusError.KeepConnection is set.
+func (h *serverDataInactiveHandler) reject(
+	chunkStreamID int,
+	timestamp uint32,
+	result *message.NetStreamOnStatus,
+	err error,
+) error {
+	if err1 := h.sh.stream.NotifyStatus(chunkStreamID, timestamp, result); err1 != nil {
+		return errors.Wrapf(err, "Failed to reply response: Err = %+v", err1)
+	}
+
+	if statusErr, ok := errors.Cause(err).(*StatusError); ok && statusErr.KeepConnection {
+		return nil
+	}
+
+	return err
+}
@@ -14,7 +14,8 @@ import (
 
 var _ stateHandler = (*serverDataPlayHandler)(nil)
 
-// serverDataPlayHandler Handle data messages from a player at server side (NOT IMPLEMENTED).
+// serverDataPlayHandler Handle data messages from a player at server side.
+// seek and pause are handled only for VOD playback started by StreamContext.PlayFile.
 //
 //	transitions:
 //	  | _ -> self
@@ -45,5 +46,27 @@ func (h *serverDataPlayHandler) onCommand(
 	cmdMsg *message.CommandMessage,
 	body interface{},
 ) error {
-	return internal.ErrPassThroughMsg
+	switch cmd := body.(type) {
+	case *message.NetStreamSeek, *message.NetStreamPause:
+		player := h.sh.stream.attachedPlayer()
+		if player == nil {
+			return internal.ErrPassThroughMsg
+		}
+		player.command(cmd)
+
+		return nil
+
+	case *message.NetStreamCloseStream:
+		if player := h.sh.stream.attachedPlayer(); player != nil {
+			player.stop()
+		}
+
+		return internal.ErrPassThroughMsg
+
+	case *message.NetStreamGetStreamLength:
+		return replyGetStreamLength(h.sh, chunkStreamID, timestamp, cmdMsg.TransactionID, cmd)
+
+	default:
+		return internal.ErrPassThroughMsg
+	}
 }
@@ -8,7 +8,11 @@
 package rtmp
 
 import (
+	"bytes"
+	"io"
+
 	"github.com/yutopp/go-rtmp/internal"
+	"github.com/yutopp/go-rtmp/media"
 	"github.com/yutopp/go-rtmp/message"
 )
 
@@ -27,12 +31,73 @@ func (h *serverDataPublishHandler) onMessage(
 	timestamp uint32,
 	msg message.Message,
 ) error {
+	handler := h.sh.stream.userHandler()
 	switch msg := msg.(type) {
 	case *message.AudioMessage:
-		return h.sh.stream.userHandler().OnAudio(timestamp, msg.Payload)
+		if !h.needsAudioPayload(handler, msg) {
+			// Streamed to the handler without copying
+			return handler.OnAudio(timestamp, msg.Payload)
+		}
+
+		data, err := readPayload(msg.Payload)
+		if err != nil {
+			return err
+		}
+		msg.Payload = bytes.NewReader(data) // Replaced to be read again
+
+		// Decoded at most once and shared
+		payload := &audioPayload{data: data}
+
+		h.updateAudioInfo(payload)
+		h.recordAudio(timestamp, data)
+		if a := h.sh.stream.attachedHealthAnalyzer(); a != nil {
+			a.writeAudio(timestamp, payload)
+		}
+
+		if th, ok := handler.(TrackHandler); ok {
+			if decoded, err := h.onAudioTracks(th, timestamp, payload); decoded || err != nil {
+				return err
+			}
+		} else if fh, ok := handler.(FrameHandler); ok {
+			if decoded, err := h.onAudioFrames(fh, timestamp, payload); decoded || err != nil {
+				return err
+			}
+		}
+		// Payloads which cannot be decoded such as empty ones are passed as they are
+		return handler.OnAudio(timestamp, msg.Payload)
 
 	case *message.VideoMessage:
-		return h.sh.stream.userHandler().OnVideo(timestamp, msg.Payload)
+		if !h.needsVideoPayload(handler, msg) {
+			// Streamed to the handler without copying
+			return handler.OnVideo(timestamp, msg.Payload)
+		}
+
+		data, err := readPayload(msg.Payload)
+		if err != nil {
+			return err
+		}
+		msg.Payload = bytes.NewReader(data) // Replaced to be read again
+
+		// Decoded at most once and shared
+		payload := &videoPayload{data: data}
+
+		h.updateVideoInfo(payload)
+		h.recordVideo(timestamp, data)
+		if a := h.sh.stream.attachedHealthAnalyzer(); a != nil {
+			a.writeVideo(timestamp, payload)
+		}
+
+		if th, ok := handler.(TrackHandler); ok {
+			if decoded, err := h.onVideoTracks(th, timestamp, payload); decoded || err != nil {
+				return err
+			}
+		} else if fh, ok := handler.(FrameHandler); ok {
+			if decoded, err := h.onVideoFrames(fh, timestamp, payload); decoded || err != nil {
+				return err
+			}
+		}
+		// Payloads which cannot be decoded such as empty ones are passed as they are
+		return handler.OnVideo(timestamp, msg.Payload)
 
 	default:
 		return internal.ErrPassThroughMsg
@@ -47,6 +112,14 @@ func (h *serverDataPublishHandler) onData(
 ) error {
 	switch data := body.(type) {
 	case *message.NetStreamSetDataFrame:
+		if rec := h.sh.stream.attachedRecorder(); rec != nil {
+			if err := rec.WriteMetaData(timestamp, data.Payload); err != nil {
+				h.sh.Logger().Warnf("Failed to record metadata: Err = %+v", err)
+			}
+		}
+		if a := h.sh.stream.attachedHealthAnalyzer(); a != nil {
+			a.WriteMetaData(timestamp, data.Payload)
+		}
 		return h.sh.stream.userHandler().OnSetDataFrame(timestamp, data)
 
 	default:
@@ -62,3 +135,194 @@ func (h *serverDataPublishHandler) onCommand(
 ) error {
 	return internal.ErrPassThroughMsg
 }
+
+// needsAudioPayload Returns true if consumers other than OnAudio need a whole payload. Only a header is read to know
+// it, and msg.Payload is replaced to be read from the beginning.
+func (h *serverDataPublishHandler) needsAudioPayload(handler Handler, msg *message.AudioMessage) bool {
+	if msg.Payload == nil {
+		return false
+	}
+	if h.hasMediaConsumers(handler) {
+		return true
+	}
+
+	var peeked bytes.Buffer
+	var header message.AudioHeader
+	err := message.DecodeAudioHeader(io.TeeReader(msg.Payload, &peeked), &header)
+	msg.Payload = io.MultiReader(&peeked, msg.Payload)
+	if err != nil {
+		return false // Payloads which cannot be decoded such as empty ones are passed as they are
+	}
+
+	return header.IsMultitrack || h.sh.stream.info.needsAudio(&media.AudioFrame{AudioHeader: header})
+}
+
+// needsVideoPayload Returns true if consumers other than OnVideo need a whole payload. Only a header is read to know
+// it, and msg.Payload is replaced to be read from the beginning.
+func (h *serverDataPublishHandler) needsVideoPayload(handler Handler, msg *message.VideoMessage) bool {
+	if msg.Payload == nil {
+		return false
+	}
+	if h.hasMediaConsumers(handler) {
+		return true
+	}
+
+	var peeked bytes.Buffer
+	var header message.VideoHeader
+	err := message.DecodeVideoHeader(io.TeeReader(msg.Payload, &peeked), &header)
+	msg.Payload = io.MultiReader(&peeked, msg.Payload)
+	if err != nil {
+		return false // Payloads which cannot be decoded such as empty ones are passed as they are
+	}
+
+	f := media.VideoFrame{VideoHeader: header}
+	return header.IsMultitrack || f.IsSequenceHeader()
+}
+
+// hasMediaConsumers Returns true if a handler or an attached recorder or analyzer consumes every media payload.
+func (h *serverDataPublishHandler) hasMediaConsumers(handler Handler) bool {
+	switch handler.(type) {
+	case TrackHandler, FrameHandler:
+		return true
+	}
+
+	return h.sh.stream.attachedRecorder() != nil || h.sh.stream.attachedHealthAnalyzer() != nil
+}
+
+// onAudioTracks Calls th for each track. decoded is false if data cannot be decoded.
+func (h *serverDataPublishHandler) onAudioTracks(th TrackHandler, timestamp uint32, p *audioPayload) (bool, error) {
+	header, tracks, err := p.decodeTracks()
+	if err != nil {
+		h.sh.Logger().Debugf("Failed to decode audio: Err = %+v", err)
+		return false, nil
+	}
+
+	for i := range tracks {
+		if err := th.OnAudioTrack(timestamp, header, &tracks[i]); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// onVideoTracks Calls th for each track. decoded is false if data cannot be decoded.
+func (h *serverDataPublishHandler) onVideoTracks(th TrackHandler, timestamp uint32, p *videoPayload) (bool, error) {
+	header, tracks, err := p.decodeTracks()
+	if err != nil {
+		h.sh.Logger().Debugf("Failed to decode video: Err = %+v", err)
+		return false, nil
+	}
+
+	for i := range tracks {
+		if err := th.OnVideoTrack(timestamp, header, &tracks[i]); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// onAudioFrames Calls fh for each frame. decoded is false if data cannot be decoded.
+func (h *serverDataPublishHandler) onAudioFrames(fh FrameHandler, timestamp uint32, p *audioPayload) (bool, error) {
+	frames, err := p.decodeFrames()
+	if err != nil {
+		h.sh.Logger().Debugf("Failed to decode audio: Err = %+v", err)
+		return false, nil
+	}
+
+	for i := range frames {
+		if err := fh.OnAudioFrame(timestamp, &frames[i]); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// onVideoFrames Calls fh for each frame. decoded is false if data cannot be decoded.
+func (h *serverDataPublishHandler) onVideoFrames(fh FrameHandler, timestamp uint32, p *videoPayload) (bool, error) {
+	frames, err := p.decodeFrames()
+	if err != nil {
+		h.sh.Logger().Debugf("Failed to decode video: Err = %+v", err)
+		return false, nil
+	}
+
+	for i := range frames {
+		if err := fh.OnVideoFrame(timestamp, &frames[i]); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// updateAudioInfo Updates StreamInfo. Errors are just logged because StreamInfo is just for introspection.
+// Payloads are decoded only if they have properties such as sequence headers.
+func (h *serverDataPublishHandler) updateAudioInfo(p *audioPayload) {
+	first, err := p.firstFrame()
+	if err != nil || !h.sh.stream.info.needsAudio(&first) {
+		return // Unknown formats are passed to handlers as they are
+	}
+
+	frames, err := p.decodeFrames()
+	if err != nil {
+		return
+	}
+
+	for i := range frames {
+		if frames[i].TrackID != 0 {
+			continue
+		}
+		if err := h.sh.stream.info.updateAudio(&frames[i]); err != nil {
+			h.sh.Logger().Warnf("Failed to update audio info: Err = %+v", err)
+		}
+		break
+	}
+}
+
+// updateVideoInfo Updates StreamInfo. Errors are just logged because StreamInfo is just for introspection.
+// Payloads are decoded only if they are sequence headers.
+func (h *serverDataPublishHandler) updateVideoInfo(p *videoPayload) {
+	first, err := p.firstFrame()
+	if err != nil || !first.IsSequenceHeader() {
+		return // Unknown formats are passed to handlers as they are
+	}
+
+	frames, err := p.decodeFrames()
+	if err != nil {
+		return
+	}
+
+	for i := range frames {
+		if frames[i].TrackID != 0 {
+			continue
+		}
+		if err := h.sh.stream.info.updateVideo(&frames[i]); err != nil {
+			h.sh.Logger().Warnf("Failed to update video info: Err = %+v", err)
+		}
+		break
+	}
+}
+
+// recordAudio Writes audio to an attached recorder. Failures of recording do not stop publishing.
+func (h *serverDataPublishHandler) recordAudio(timestamp uint32, data []byte) {
+	rec := h.sh.stream.attachedRecorder()
+	if rec == nil {
+		return
+	}
+	if err := rec.WriteAudio(timestamp, data); err != nil {
+		h.sh.Logger().Warnf("Failed to record audio: Err = %+v", err)
+	}
+}
+
+// recordVideo Writes video to an attached recorder. Failures of recording do not stop publishing.
+func (h *serverDataPublishHandler) recordVideo(timestamp uint32, data []byte) {
+	rec := h.sh.stream.attachedRecorder()
+	if rec == nil {
+		return
+	}
+	if err := rec.WriteVideo(timestamp, data); err != nil {
+		h.sh.Logger().Warnf("Failed to record video: Err = %+v", err)
+	}
+}
@@ -8,6 +8,7 @@
 package rtmp
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/yutopp/go-rtmp/message"
@@ -29,3 +30,24 @@ func BenchmarkHandlePublisherVideoMessage(b *testing.B) {
 		_ = s.handle(chunkStreamID, timestamp, msg)
 	}
 }
+
+// An AVC inter frame which has 4KB NAL units
+var benchAVCInter = append([]byte{0x27, 0x01, 0x00, 0x00, 0x00}, make([]byte, 4096)...)
+
+func BenchmarkHandlePublisherVideoMessageWithHealthAnalyzer(b *testing.B) {
+	rwc := &rwcMock{}
+	c := newConn(rwc, nil)
+
+	s := newStream(42, c)
+	s.handler.ChangeState(streamStateServerPublish)
+	s.attachHealthAnalyzer(NewHealthAnalyzer(nil))
+
+	chunkStreamID := 0
+	msg := &message.VideoMessage{}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg.Payload = bytes.NewReader(benchAVCInter)
+		_ = s.handle(chunkStreamID, uint32(i*33), msg)
+	}
+}
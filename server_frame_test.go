@@ -0,0 +1,91 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/media"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type serverCanReceiveFramesHandler struct {
+	DefaultHandler
+	audioCh chan *media.AudioFrame
+	videoCh chan *media.VideoFrame
+}
+
+func (h *serverCanReceiveFramesHandler) OnAudioFrame(timestamp uint32, frame *media.AudioFrame) error {
+	h.audioCh <- frame
+	return nil
+}
+
+func (h *serverCanReceiveFramesHandler) OnVideoFrame(timestamp uint32, frame *media.VideoFrame) error {
+	h.videoCh <- frame
+	return nil
+}
+
+func TestServerCanReceiveFrames(t *testing.T) {
+	audioCh := make(chan *media.AudioFrame, 1)
+	videoCh := make(chan *media.VideoFrame, 1)
+	config := &ConnConfig{
+		Handler: &serverCanReceiveFramesHandler{audioCh: audioCh, videoCh: videoCh},
+		Logger:  logrus.StandardLogger(),
+	}
+
+	prepareConnection(t, config, func(c *ClientConn) {
+		err := c.Connect(nil)
+		require.Nil(t, err)
+
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		err = s.Publish(&message.NetStreamPublish{
+			PublishingName: "stream",
+			PublishingType: "live",
+		})
+		require.Nil(t, err)
+
+		audio := &media.AudioFrame{
+			AudioHeader: message.AudioHeader{
+				SoundFormat: message.AudioSoundFormatAAC,
+				SoundRate:   3,
+				SoundSize:   1,
+				SoundType:   1,
+				FourCC:      message.FourCCAAC,
+				PacketType:  message.AudioPacketTypeSequenceStart,
+			},
+			Data: []byte{0x12, 0x10},
+		}
+		err = s.WriteAudioFrame(4, 0, audio)
+		require.Nil(t, err)
+		require.Equal(t, audio, <-audioCh)
+
+		video := &media.VideoFrame{
+			VideoHeader: message.VideoHeader{
+				FrameType:       message.VideoFrameTypeKeyFrame,
+				CodecID:         message.VideoCodecIDAVC,
+				FourCC:          message.FourCCAVC,
+				PacketType:      message.VideoPacketTypeCodedFrames,
+				CompositionTime: 66,
+			},
+			Data: []byte{0x00, 0x00, 0x00, 0x01, 0x65},
+		}
+		err = s.WriteVideoFrame(6, 0, video)
+		require.Nil(t, err)
+
+		received := <-videoCh
+		require.Equal(t, video, received)
+		require.True(t, received.IsKeyFrame())
+		require.False(t, received.IsSequenceHeader())
+	})
+}
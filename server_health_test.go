@@ -0,0 +1,106 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/yutopp/go-amf0"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type serverCanAnalyzeHealthHandler struct {
+	DefaultHandler
+	analyzer *HealthAnalyzer
+	mediaCh  chan struct{}
+}
+
+func (h *serverCanAnalyzeHealthHandler) OnPublish(ctx *StreamContext, _ uint32, _ *message.NetStreamPublish) error {
+	ctx.AttachHealthAnalyzer(h.analyzer)
+	return nil
+}
+
+func (h *serverCanAnalyzeHealthHandler) OnSetDataFrame(_ uint32, _ *message.NetStreamSetDataFrame) error {
+	h.mediaCh <- struct{}{}
+	return nil
+}
+
+func (h *serverCanAnalyzeHealthHandler) OnAudio(_ uint32, payload io.Reader) error {
+	_, _ = io.Copy(ioutil.Discard, payload)
+	h.mediaCh <- struct{}{}
+	return nil
+}
+
+func (h *serverCanAnalyzeHealthHandler) OnVideo(_ uint32, payload io.Reader) error {
+	_, _ = io.Copy(ioutil.Discard, payload)
+	h.mediaCh <- struct{}{}
+	return nil
+}
+
+func TestServerCanAnalyzeHealth(t *testing.T) {
+	eventCh := make(chan HealthEvent, 16)
+	analyzer := NewHealthAnalyzer(&HealthConfig{
+		MaxTimestampGap: 1 * time.Second,
+		OnEvent: func(e *HealthEvent) {
+			eventCh <- *e
+		},
+	})
+	mediaCh := make(chan struct{}, 1)
+	config := &ConnConfig{
+		Handler: &serverCanAnalyzeHealthHandler{analyzer: analyzer, mediaCh: mediaCh},
+		Logger:  logrus.StandardLogger(),
+	}
+
+	prepareConnection(t, config, func(c *ClientConn) {
+		err := c.Connect(nil)
+		require.Nil(t, err)
+
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		err = s.Publish(&message.NetStreamPublish{
+			PublishingName: "stream",
+			PublishingType: "live",
+		})
+		require.Nil(t, err)
+
+		err = s.WriteDataMessage(5, 0, "@setDataFrame", &message.NetStreamSetDataFrame{
+			AmfData: amf0.ECMAArray{"framerate": float64(30)},
+		})
+		require.Nil(t, err)
+		<-mediaCh
+
+		write := func(timestamp uint32, msg message.Message) {
+			err := s.Write(6, timestamp, msg)
+			require.Nil(t, err)
+			<-mediaCh
+		}
+		write(0, &message.VideoMessage{Payload: bytes.NewReader(recordAVCSeqHeader)})
+		write(0, &message.VideoMessage{Payload: bytes.NewReader(recordAVCKeyFrame)})
+		write(0, &message.AudioMessage{Payload: bytes.NewReader(recordAACRaw)})
+		write(2000, &message.AudioMessage{Payload: bytes.NewReader(recordAACRaw)})
+
+		e := <-eventCh
+		require.Equal(t, HealthEventTimestampGap, e.Type)
+		require.Equal(t, HealthTrackAudio, e.Track)
+
+		snapshot := analyzer.Snapshot()
+		require.Equal(t, uint64(1), snapshot.Video.Frames)
+		require.Equal(t, uint64(2), snapshot.Audio.Frames)
+		require.Equal(t, 1, snapshot.TimestampGaps)
+		require.Equal(t, float64(30), snapshot.DeclaredFrameRate)
+	})
+}
@@ -0,0 +1,185 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type serverCanCollectMetricsHandler struct {
+	DefaultHandler
+	audioCh chan struct{}
+}
+
+func (h *serverCanCollectMetricsHandler) OnAudio(_ uint32, payload io.Reader) error {
+	_, _ = io.Copy(ioutil.Discard, payload)
+	h.audioCh <- struct{}{}
+	return nil
+}
+
+func TestServerCanCollectMetrics(t *testing.T) {
+	for _, perConn := range []bool{false, true} {
+		t.Run(fmt.Sprintf("PerConnection=%v", perConn), func(t *testing.T) {
+			testServerCanCollectMetrics(t, perConn)
+		})
+	}
+}
+
+func testServerCanCollectMetrics(t *testing.T, perConn bool) {
+	metrics := NewMetrics(&MetricsConfig{PerConnection: perConn})
+	audioCh := make(chan struct{}, 2)
+	config := &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			return conn, &ConnConfig{
+				Handler: &serverCanCollectMetricsHandler{audioCh: audioCh},
+			}
+		},
+		Observer: metrics,
+	}
+	prepareServer(t, config, func(addr string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		c, err := Dial("rtmp", addr, nil)
+		require.Nil(t, err)
+		defer c.Close()
+
+		err = c.Connect(nil)
+		require.Nil(t, err)
+
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		err = s.Publish(&message.NetStreamPublish{
+			PublishingName: "key",
+			PublishingType: "live",
+		})
+		require.Nil(t, err)
+
+		for i := 0; i < 2; i++ {
+			err = s.Write(4, uint32(i), &message.AudioMessage{Payload: bytes.NewReader(recordAACRaw)})
+			require.Nil(t, err)
+
+			select {
+			case <-audioCh:
+			case <-ctx.Done():
+				require.FailNow(t, "Audio is not received")
+			}
+		}
+
+		var buf bytes.Buffer
+		require.Nil(t, metrics.WritePrometheus(&buf))
+		text := buf.String()
+
+		for _, line := range []string{
+			"# TYPE rtmp_connections_total counter",
+			"rtmp_connections_total 1",
+			"rtmp_connections_active 1",
+			"rtmp_streams_total 2", // The control stream and a created stream
+			`rtmp_messages_total{direction="read",type="audio"} 2`,
+		} {
+			require.Contains(t, text, line)
+		}
+
+		connLines := []string{
+			`rtmp_conn_messages_total{conn="1",direction="read",type="audio"} 2`,
+			`rtmp_conn_messages_total{conn="1",direction="read",type="command_amf0"} 3`, // connect, createStream and publish
+			`rtmp_stream_messages_total{conn="1",stream="1",direction="read"} 3`,        // publish and audio
+			`rtmp_stream_bytes_total{conn="1",stream="0",direction="write"}`,
+		}
+		for _, line := range connLines {
+			if perConn {
+				require.Contains(t, text, line)
+			} else {
+				require.NotContains(t, text, line)
+			}
+		}
+
+		// Removed after closing
+		require.Nil(t, c.Close())
+		require.Eventually(t, func() bool {
+			buf.Reset()
+			require.Nil(t, metrics.WritePrometheus(&buf))
+			return strings.Contains(buf.String(), "rtmp_connections_active 0\n")
+		}, 5*time.Second, 10*time.Millisecond)
+		require.NotContains(t, buf.String(), `conn="1"`)
+	})
+}
+
+func TestMetricsWritesStreamsInOrder(t *testing.T) {
+	metrics := NewMetrics(&MetricsConfig{PerConnection: true})
+	metrics.now = func() time.Time { return time.Unix(1000, 0) }
+
+	for i := 0; i < 2; i++ {
+		cm := metrics.NewConnObserver(nil)
+		for _, streamID := range []uint32{5, 1, 10, 3, 2} {
+			cm.OnStreamCreated(streamID)
+			cm.OnMessageRead(streamID, message.TypeIDAudioMessage, streamID)
+		}
+	}
+
+	var expected string
+	for i := 0; i < 10; i++ { // Maps are iterated in random order
+		var buf bytes.Buffer
+		require.Nil(t, metrics.WritePrometheus(&buf))
+
+		var lines []string
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if strings.HasPrefix(line, "rtmp_stream_messages_total{") && strings.Contains(line, `"read"`) {
+				lines = append(lines, line)
+			}
+		}
+		text := strings.Join(lines, "\n")
+
+		if expected == "" {
+			expected = text
+			continue
+		}
+		require.Equal(t, expected, text)
+	}
+
+	require.Equal(t, strings.Join([]string{
+		`rtmp_stream_messages_total{conn="1",stream="1",direction="read"} 1`,
+		`rtmp_stream_messages_total{conn="1",stream="2",direction="read"} 1`,
+		`rtmp_stream_messages_total{conn="1",stream="3",direction="read"} 1`,
+		`rtmp_stream_messages_total{conn="1",stream="5",direction="read"} 1`,
+		`rtmp_stream_messages_total{conn="1",stream="10",direction="read"} 1`,
+		`rtmp_stream_messages_total{conn="2",stream="1",direction="read"} 1`,
+		`rtmp_stream_messages_total{conn="2",stream="2",direction="read"} 1`,
+		`rtmp_stream_messages_total{conn="2",stream="3",direction="read"} 1`,
+		`rtmp_stream_messages_total{conn="2",stream="5",direction="read"} 1`,
+		`rtmp_stream_messages_total{conn="2",stream="10",direction="read"} 1`,
+	}, "\n"), expected)
+}
+
+func TestRateCounterSlidesWindow(t *testing.T) {
+	base := time.Unix(1000, 0)
+
+	var r rateCounter
+	r.add(base, 100)
+	require.Equal(t, 0.0, r.bitrate(base)) // The current second is not completed
+
+	r.add(base.Add(1*time.Second), 400)
+	require.Equal(t, float64(100*8)/(rateWindow-1), r.bitrate(base.Add(1*time.Second)))
+	require.Equal(t, float64(500*8)/(rateWindow-1), r.bitrate(base.Add(2*time.Second)))
+
+	require.Equal(t, 0.0, r.bitrate(base.Add(10*time.Second)))
+}
@@ -0,0 +1,113 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type receivedTrack struct {
+	timestamp uint32
+	trackID   uint8
+	fourCC    message.FourCC
+	payload   []byte
+}
+
+type serverCanReceiveTracksHandler struct {
+	DefaultHandler
+	trackCh chan receivedTrack
+}
+
+func (h *serverCanReceiveTracksHandler) OnAudioTrack(
+	timestamp uint32,
+	header *message.AudioHeader,
+	track *message.AudioTrack,
+) error {
+	h.trackCh <- receivedTrack{timestamp: timestamp, trackID: track.TrackID, fourCC: track.FourCC, payload: track.Payload}
+	return nil
+}
+
+func (h *serverCanReceiveTracksHandler) OnVideoTrack(
+	timestamp uint32,
+	header *message.VideoHeader,
+	track *message.VideoTrack,
+) error {
+	h.trackCh <- receivedTrack{timestamp: timestamp, trackID: track.TrackID, fourCC: track.FourCC, payload: track.Payload}
+	return nil
+}
+
+func (h *serverCanReceiveTracksHandler) OnAudio(timestamp uint32, payload io.Reader) error {
+	data, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return err
+	}
+	h.trackCh <- receivedTrack{timestamp: timestamp, payload: data}
+	return nil
+}
+
+func TestServerCanReceiveTracks(t *testing.T) {
+	trackCh := make(chan receivedTrack, 10)
+	config := &ConnConfig{
+		Handler: &serverCanReceiveTracksHandler{trackCh: trackCh},
+		Logger:  logrus.StandardLogger(),
+	}
+
+	prepareConnection(t, config, func(c *ClientConn) {
+		err := c.Connect(nil)
+		require.Nil(t, err)
+
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		err = s.Publish(&message.NetStreamPublish{
+			PublishingName: "stream",
+			PublishingType: "live",
+		})
+		require.Nil(t, err)
+
+		// Two languages of audio
+		err = s.WriteAudioTracks(4, 100, &message.AudioHeader{
+			IsExHeader:     true,
+			PacketType:     message.AudioPacketTypeCodedFrames,
+			FourCC:         message.FourCCOpus,
+			IsMultitrack:   true,
+			MultitrackType: message.AVMultitrackTypeManyTracks,
+		}, []message.AudioTrack{
+			{TrackID: 0, Payload: []byte("en")},
+			{TrackID: 1, Payload: []byte("ja")},
+		})
+		require.Nil(t, err)
+
+		// A legacy video is delivered as the track 0
+		err = s.Write(6, 200, &message.VideoMessage{
+			Payload: bytes.NewReader([]byte{0x17, 0x01, 0x00, 0x00, 0x00, 0xff}),
+		})
+		require.Nil(t, err)
+
+		require.Equal(t, receivedTrack{100, 0, message.FourCCOpus, []byte("en")}, <-trackCh)
+		require.Equal(t, receivedTrack{100, 1, message.FourCCOpus, []byte("ja")}, <-trackCh)
+		require.Equal(t, receivedTrack{200, 0, message.FourCCAVC, []byte{0xff}}, <-trackCh)
+
+		// An empty payload cannot be decoded, and is delivered as it is
+		err = s.Write(4, 300, &message.AudioMessage{
+			Payload: bytes.NewReader(nil),
+		})
+		require.Nil(t, err)
+
+		require.Equal(t, receivedTrack{timestamp: 300, payload: []byte{}}, <-trackCh)
+	})
+}
@@ -0,0 +1,349 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type serverCanRequestReconnectHandler struct {
+	DefaultHandler
+	conn      *Conn
+	publishCh chan *Conn
+	audioCh   chan *Conn
+}
+
+func (h *serverCanRequestReconnectHandler) OnServe(conn *Conn) {
+	h.conn = conn
+}
+
+func (h *serverCanRequestReconnectHandler) OnPublish(_ *StreamContext, _ uint32, _ *message.NetStreamPublish) error {
+	h.publishCh <- h.conn
+	return nil
+}
+
+func (h *serverCanRequestReconnectHandler) OnAudio(_ uint32, payload io.Reader) error {
+	_, _ = io.Copy(ioutil.Discard, payload)
+	h.audioCh <- h.conn
+	return nil
+}
+
+func TestServerCanRequestReconnect(t *testing.T) {
+	publishCh := make(chan *Conn, 2)
+	audioCh := make(chan *Conn, 2)
+	config := &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			return conn, &ConnConfig{
+				Handler: &serverCanRequestReconnectHandler{
+					publishCh: publishCh,
+					audioCh:   audioCh,
+				},
+			}
+		},
+	}
+	prepareServer(t, config, func(addr string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		tcURL := fmt.Sprintf("rtmp://%s/app", addr)
+		c, err := DialURL(ctx, tcURL+"/key", nil)
+		require.Nil(t, err)
+		defer c.Close()
+
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		err = s.Publish(&message.NetStreamPublish{
+			PublishingName: "key",
+			PublishingType: "live",
+		})
+		require.Nil(t, err)
+
+		first := <-publishCh
+
+		err = s.Write(4, 0, &message.AudioMessage{
+			Payload: bytes.NewReader(recordAACSeqHeader),
+		})
+		require.Nil(t, err)
+		require.True(t, first == <-audioCh)
+
+		err = first.RequestReconnect(tcURL, "Migrate")
+		require.Nil(t, err)
+
+		var second *Conn
+		select {
+		case second = <-publishCh:
+		case <-ctx.Done():
+			require.FailNow(t, "Client did not publish again")
+		}
+		require.True(t, first != second, "Client must connect with a new connection")
+
+		// The stream is moved to the new connection
+		err = s.Write(4, 0, &message.AudioMessage{
+			Payload: bytes.NewReader([]byte{0xaf, 0x01, 0x00}),
+		})
+		require.Nil(t, err)
+		require.True(t, second == <-audioCh, "Audio must be sent via the new connection")
+
+		require.Equal(t, "key", c.URL().PlayPath())
+		require.Nil(t, c.LastError())
+	})
+}
+
+type clientCanAutoReconnectHandler struct {
+	DefaultHandler
+	connCh  chan *Conn
+	eventCh chan string
+}
+
+func (h *clientCanAutoReconnectHandler) OnServe(conn *Conn) {
+	h.connCh <- conn
+}
+
+func (h *clientCanAutoReconnectHandler) OnPublish(_ *StreamContext, _ uint32, cmd *message.NetStreamPublish) error {
+	h.eventCh <- "publish:" + cmd.PublishingName
+	return nil
+}
+
+func (h *clientCanAutoReconnectHandler) OnSetDataFrame(_ uint32, _ *message.NetStreamSetDataFrame) error {
+	h.eventCh <- "metadata"
+	return nil
+}
+
+func (h *clientCanAutoReconnectHandler) OnAudio(_ uint32, payload io.Reader) error {
+	b, _ := ioutil.ReadAll(payload)
+	h.eventCh <- fmt.Sprintf("audio:%x", b)
+	return nil
+}
+
+func (h *clientCanAutoReconnectHandler) OnVideo(_ uint32, payload io.Reader) error {
+	b, _ := ioutil.ReadAll(payload)
+	h.eventCh <- fmt.Sprintf("video:%x", b)
+	return nil
+}
+
+func TestClientCanAutoReconnect(t *testing.T) {
+	eventCh := make(chan string, 16)
+	connCh := make(chan *Conn, 2)
+	config := &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			return conn, &ConnConfig{
+				Handler: &clientCanAutoReconnectHandler{connCh: connCh, eventCh: eventCh},
+			}
+		},
+	}
+	prepareServer(t, config, func(addr string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		reconnectEventCh := make(chan ReconnectEventType, 8)
+		c, err := DialURL(ctx, fmt.Sprintf("rtmp://%s/app/key", addr), &ConnConfig{
+			Reconnect: ReconnectConfig{
+				Enabled:     true,
+				MinBackoff:  10 * time.Millisecond,
+				MediaPolicy: ReconnectBufferMedia,
+				OnEvent: func(ev *ReconnectEvent) {
+					reconnectEventCh <- ev.Type
+				},
+			},
+		})
+		require.Nil(t, err)
+		defer c.Close()
+
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		err = s.Publish(&message.NetStreamPublish{
+			PublishingName: "key",
+			PublishingType: "live",
+		})
+		require.Nil(t, err)
+
+		err = s.Write(5, 0, &message.DataMessage{
+			Name:     "@setDataFrame",
+			Encoding: message.EncodingTypeAMF0,
+			Body:     bytes.NewReader(newRecordSetDataFrame(t)),
+		})
+		require.Nil(t, err)
+		err = s.Write(6, 0, &message.VideoMessage{Payload: bytes.NewReader(recordAVCSeqHeader)})
+		require.Nil(t, err)
+		err = s.Write(4, 0, &message.AudioMessage{Payload: bytes.NewReader(recordAACSeqHeader)})
+		require.Nil(t, err)
+
+		waitEvents := func(n int) []string {
+			events := make([]string, 0, n)
+			for len(events) < n {
+				select {
+				case ev := <-eventCh:
+					events = append(events, ev)
+				case <-ctx.Done():
+					require.FailNow(t, fmt.Sprintf("Timeout: Events = %v", events))
+				}
+			}
+			return events
+		}
+		headers := []string{
+			"metadata",
+			fmt.Sprintf("video:%x", recordAVCSeqHeader),
+			fmt.Sprintf("audio:%x", recordAACSeqHeader),
+		}
+		require.Equal(t, append([]string{"publish:key"}, headers...), waitEvents(4))
+
+		// Disconnect the client from the server side
+		first := <-connCh
+		require.Nil(t, first.Close())
+		require.Equal(t, ReconnectEventDisconnected, <-reconnectEventCh)
+
+		// Buffered until resuming
+		err = s.Write(4, 10, &message.AudioMessage{Payload: bytes.NewReader(recordAACRaw)})
+		require.Nil(t, err)
+
+		require.Equal(t, ReconnectEventReconnecting, <-reconnectEventCh)
+		require.Equal(t, ReconnectEventResumed, <-reconnectEventCh)
+
+		// Headers are sent again before media
+		require.Equal(t, append(append([]string{"publish:key"}, headers...), fmt.Sprintf("audio:%x", recordAACRaw)), waitEvents(5))
+
+		second := <-connCh
+		require.True(t, first != second, "Client must connect with a new connection")
+		require.Nil(t, c.LastError())
+	})
+}
+
+func TestClientGivesUpReconnecting(t *testing.T) {
+	connCh := make(chan *Conn, 1)
+	var accepted int32
+	config := &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			if atomic.AddInt32(&accepted, 1) > 1 {
+				_ = conn.Close() // Connections other than the first one fail
+			}
+			return conn, &ConnConfig{
+				Handler: &clientCanAutoReconnectHandler{connCh: connCh, eventCh: make(chan string, 16)},
+			}
+		},
+	}
+	prepareServer(t, config, func(addr string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		reconnectEventCh := make(chan *ReconnectEvent, 8)
+		c, err := DialURL(ctx, fmt.Sprintf("rtmp://%s/app/key", addr), &ConnConfig{
+			Reconnect: ReconnectConfig{
+				Enabled:    true,
+				MinBackoff: 10 * time.Millisecond,
+				MaxRetries: 2,
+				OnEvent: func(ev *ReconnectEvent) {
+					reconnectEventCh <- ev
+				},
+			},
+		})
+		require.Nil(t, err)
+		defer c.Close()
+
+		// Disconnect the client
+		first := <-connCh
+		require.Nil(t, first.Close())
+
+		var types []ReconnectEventType
+		for ev := range reconnectEventCh {
+			types = append(types, ev.Type)
+			if ev.Type == ReconnectEventGaveUp {
+				require.Equal(t, 2, ev.Attempt)
+				require.NotNil(t, ev.Err)
+				break
+			}
+		}
+		require.Equal(t, []ReconnectEventType{
+			ReconnectEventDisconnected,
+			ReconnectEventReconnecting,
+			ReconnectEventReconnecting,
+			ReconnectEventGaveUp,
+		}, types)
+		require.NotNil(t, c.LastError())
+	})
+}
+
+func TestPublishSessionDropsMediaUntilKeyFrame(t *testing.T) {
+	ps := newPublishSession(&ReconnectConfig{MediaPolicy: ReconnectDropMedia})
+
+	record := func(payload []byte) message.Message {
+		msg, _, err := ps.record(6, 0, &message.VideoMessage{Payload: bytes.NewReader(payload)})
+		require.Nil(t, err)
+		return msg
+	}
+
+	require.NotNil(t, record(recordAVCSeqHeader))
+	require.NotNil(t, record(recordAVCKeyFrame))
+
+	ps.suspend()
+	require.Nil(t, record(recordAVCInter))
+	require.Equal(t, 1, len(ps.resume())) // Only the sequence header
+	ps.resumed()
+
+	require.Nil(t, record(recordAVCInter)) // Waits for a key frame
+	require.NotNil(t, record(recordAVCKeyFrame))
+	require.NotNil(t, record(recordAVCInter))
+}
+
+func TestPublishSessionKeepsMediaUntilResumed(t *testing.T) {
+	ps := newPublishSession(&ReconnectConfig{MediaPolicy: ReconnectBufferMedia, MaxBufferedMessages: 1024})
+
+	record := func(payload []byte) message.Message {
+		msg, _, err := ps.record(4, 0, &message.AudioMessage{Payload: bytes.NewReader(payload)})
+		require.Nil(t, err)
+		return msg
+	}
+
+	require.NotNil(t, record(recordAACSeqHeader))
+
+	ps.suspend()
+	require.Nil(t, record(recordAACRaw))
+
+	// Resuming is failed. Media are still buffered
+	require.Equal(t, 2, len(ps.resume()))
+	ps.suspend()
+	require.Nil(t, record(recordAACRaw))
+	require.Equal(t, 3, len(ps.resume()))
+
+	ps.resumed()
+	require.NotNil(t, record(recordAACRaw))
+	require.Equal(t, 1, len(ps.resume())) // Only the sequence header
+}
+
+func TestPublishSessionKeepsOnlyHeadersWithoutBuffering(t *testing.T) {
+	ps := newPublishSession(&ReconnectConfig{MediaPolicy: ReconnectDropMedia})
+
+	_, header, err := ps.record(6, 0, &message.VideoMessage{Payload: bytes.NewReader(recordAVCSeqHeader)})
+	require.Nil(t, err)
+	require.Equal(t, recordAVCSeqHeader, header.payload)
+
+	msg, frame, err := ps.record(6, 0, &message.VideoMessage{Payload: bytes.NewReader(recordAVCKeyFrame)})
+	require.Nil(t, err)
+	require.True(t, frame.isKeyFrame)
+	require.Nil(t, frame.payload) // Not copied
+
+	// The payload is read from the beginning even if its header is decoded
+	b, err := ioutil.ReadAll(msg.(*message.VideoMessage).Payload)
+	require.Nil(t, err)
+	require.Equal(t, recordAVCKeyFrame, b)
+}
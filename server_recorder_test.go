@@ -0,0 +1,91 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/yutopp/go-amf0"
+	flvtag "github.com/yutopp/go-flv/tag"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type serverCanRecordHandler struct {
+	DefaultHandler
+	storage *memRecordStorage
+	closeCh chan struct{}
+}
+
+func (h *serverCanRecordHandler) OnPublish(ctx *StreamContext, _ uint32, cmd *message.NetStreamPublish) error {
+	rec, err := NewRecorder(cmd, &RecorderConfig{
+		Storage: h.storage,
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.AttachRecorder(rec)
+}
+
+func (h *serverCanRecordHandler) OnClose() {
+	close(h.closeCh)
+}
+
+func TestServerCanRecord(t *testing.T) {
+	storage := newMemRecordStorage()
+	closeCh := make(chan struct{})
+	config := &ConnConfig{
+		Handler: &serverCanRecordHandler{storage: storage, closeCh: closeCh},
+		Logger:  logrus.StandardLogger(),
+	}
+
+	prepareConnection(t, config, func(c *ClientConn) {
+		err := c.Connect(nil)
+		require.Nil(t, err)
+
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		err = s.Publish(&message.NetStreamPublish{
+			PublishingName: "stream",
+			PublishingType: "record",
+		})
+		require.Nil(t, err)
+
+		err = s.WriteDataMessage(5, 100, "@setDataFrame", &message.NetStreamSetDataFrame{
+			AmfData: amf0.ECMAArray{"width": float64(1280)},
+		})
+		require.Nil(t, err)
+
+		err = s.Write(6, 100, &message.VideoMessage{Payload: bytes.NewReader(recordAVCSeqHeader)})
+		require.Nil(t, err)
+		err = s.Write(6, 100, &message.VideoMessage{Payload: bytes.NewReader(recordAVCKeyFrame)})
+		require.Nil(t, err)
+		err = s.Write(4, 140, &message.AudioMessage{Payload: bytes.NewReader(recordAACRaw)})
+		require.Nil(t, err)
+
+		// The recorder is closed when the connection is closed
+		err = c.Close()
+		require.Nil(t, err)
+		<-closeCh
+
+		metaData, tags := readRecordedFile(t, storage.bytes("stream.flv"))
+		require.Equal(t, float64(1280), metaData["width"])
+		require.Equal(t, float64(0.04), metaData["duration"])
+		require.Equal(t, []recordedTag{
+			{flvtag.TagTypeScriptData, 0},
+			{flvtag.TagTypeVideo, 0},
+			{flvtag.TagTypeVideo, 0},
+			{flvtag.TagTypeAudio, 40},
+		}, tags)
+	})
+}
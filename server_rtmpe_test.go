@@ -0,0 +1,72 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/handshake"
+)
+
+func TestServerCanAcceptEncryptedConnection(t *testing.T) {
+	connCh := make(chan *Conn, 1)
+	config := &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			return conn, &ConnConfig{
+				Handler:                 &encryptedConnHandler{connCh: connCh},
+				AllowEncryptedHandshake: true,
+			}
+		},
+	}
+	prepareServer(t, config, func(addr string) {
+		c, err := Dial("rtmp", addr, &ConnConfig{
+			HandshakeVersion: handshake.VersionRTMPE,
+		})
+		require.Nil(t, err)
+		defer c.Close()
+
+		require.True(t, c.conn.IsEncrypted())
+
+		err = c.Connect(nil)
+		require.Nil(t, err)
+
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		serverConn := <-connCh
+		require.True(t, serverConn.IsEncrypted())
+	})
+}
+
+func TestServerRejectsEncryptedConnectionIfNotAllowed(t *testing.T) {
+	config := &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			return conn, &ConnConfig{}
+		},
+	}
+	prepareServer(t, config, func(addr string) {
+		_, err := Dial("rtmp", addr, &ConnConfig{
+			HandshakeVersion: handshake.VersionRTMPE,
+		})
+		require.Error(t, err)
+	})
+}
+
+type encryptedConnHandler struct {
+	DefaultHandler
+	connCh chan *Conn
+}
+
+func (h *encryptedConnHandler) OnServe(conn *Conn) {
+	h.connCh <- conn
+}
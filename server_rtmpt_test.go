@@ -0,0 +1,51 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/rtmpt"
+)
+
+func TestServerCanServeRTMPT(t *testing.T) {
+	h := rtmpt.NewHandler(nil)
+	httpSrv := httptest.NewServer(h)
+	defer httpSrv.Close()
+
+	srv := NewServer(&ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			return conn, &ConnConfig{
+				Handler: &serverCanAcceptConnectHandler{},
+			}
+		},
+	})
+	defer srv.Close()
+
+	go func() {
+		_ = srv.Serve(h)
+	}()
+
+	addr := strings.TrimPrefix(httpSrv.URL, "http://")
+	c, err := Dial("rtmpt", addr, nil)
+	require.Nil(t, err)
+	defer c.Close()
+
+	err = c.Connect(nil)
+	require.Nil(t, err)
+
+	s, err := c.CreateStream(nil, chunkSize)
+	require.Nil(t, err)
+	defer s.Close()
+}
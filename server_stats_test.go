@@ -0,0 +1,104 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/handshake"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type serverCanReportStatsHandler struct {
+	DefaultHandler
+	conn    *Conn
+	statsCh chan *ConnStats
+}
+
+func (h *serverCanReportStatsHandler) OnServe(conn *Conn) {
+	h.conn = conn
+}
+
+func (h *serverCanReportStatsHandler) OnAudio(_ uint32, payload io.Reader) error {
+	_, _ = io.Copy(ioutil.Discard, payload)
+	h.statsCh <- h.conn.Stats()
+	return nil
+}
+
+func TestServerCanReportStats(t *testing.T) {
+	statsCh := make(chan *ConnStats, 1)
+	config := &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			h := &serverCanReportStatsHandler{statsCh: statsCh}
+			return conn, &ConnConfig{
+				Handler: h,
+				ControlState: StreamControlStateConfig{
+					DefaultAckWindowSize: 64, // Both sides send acknowledgements frequently
+				},
+			}
+		},
+	}
+	prepareServer(t, config, func(addr string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		c, err := Dial("rtmp", addr, nil)
+		require.Nil(t, err)
+		defer c.Close()
+
+		err = c.Connect(nil)
+		require.Nil(t, err)
+
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		err = s.Publish(&message.NetStreamPublish{
+			PublishingName: "key",
+			PublishingType: "live",
+		})
+		require.Nil(t, err)
+
+		err = s.Write(4, 0, &message.AudioMessage{Payload: bytes.NewReader(recordAACRaw)})
+		require.Nil(t, err)
+
+		var stats *ConnStats
+		select {
+		case stats = <-statsCh:
+		case <-ctx.Done():
+			require.FailNow(t, "Audio is not received")
+		}
+
+		require.True(t, stats.BytesRead > 0)
+		require.True(t, stats.BytesWritten > 0)
+		require.Equal(t, uint64(1), stats.MessagesRead[message.TypeIDAudioMessage])
+		require.Equal(t, uint64(3), stats.MessagesRead[message.TypeIDCommandMessageAMF0]) // connect, createStream and publish
+		require.Equal(t, uint64(1), stats.MessagesWritten[message.TypeIDWinAckSize])
+		require.Equal(t, uint32(DefaultChunkSize), stats.SelfChunkSize)
+		require.Equal(t, uint32(chunkSize), stats.PeerChunkSize)
+		require.Equal(t, int32(64), stats.SelfAckWindowSize)
+		require.True(t, stats.LastAckSent > 0)
+		require.Equal(t, 2, stats.Streams) // The control stream and a created stream
+		require.True(t, stats.Age > 0)
+		require.Equal(t, handshake.VersionPlain, stats.HandshakeVersion)
+
+		// The client acknowledges bytes by the window which is sent by the server
+		clientStats := c.conn.Stats()
+		require.Equal(t, int32(64), clientStats.PeerAckWindowSize)
+		require.True(t, clientStats.LastAckSent > 0)
+		require.True(t, clientStats.UnackedBytes <= uint32(clientStats.BytesWritten))
+	})
+}
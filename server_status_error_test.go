@@ -0,0 +1,137 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type serverCanReplyStatusErrorHandler struct {
+	DefaultHandler
+	publishErr error
+	playErr    error
+}
+
+func (h *serverCanReplyStatusErrorHandler) OnPublish(_ *StreamContext, _ uint32, _ *message.NetStreamPublish) error {
+	return h.publishErr
+}
+
+func (h *serverCanReplyStatusErrorHandler) OnPlay(_ *StreamContext, _ uint32, _ *message.NetStreamPlay) error {
+	return h.playErr
+}
+
+type statusErrorClientHandler struct {
+	DefaultHandler
+	statusCh chan *message.NetStreamOnStatus
+}
+
+func (h *statusErrorClientHandler) OnStatus(_ uint32, status *message.NetStreamOnStatus) error {
+	h.statusCh <- status
+	return nil
+}
+
+func (h *statusErrorClientHandler) OnPlayStatus(_ uint32, _ *message.NetStreamOnPlayStatus) error {
+	return nil
+}
+
+func prepareStatusErrorConnection(
+	t *testing.T,
+	handler Handler,
+	f func(c *ClientConn, statusCh <-chan *message.NetStreamOnStatus),
+) {
+	config := &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			return conn, &ConnConfig{
+				Handler: handler,
+			}
+		},
+	}
+	prepareServer(t, config, func(addr string) {
+		statusCh := make(chan *message.NetStreamOnStatus, 4)
+		c, err := Dial("rtmp", addr, &ConnConfig{
+			Handler: &statusErrorClientHandler{statusCh: statusCh},
+		})
+		require.Nil(t, err)
+		defer c.Close()
+
+		err = c.Connect(nil)
+		require.Nil(t, err)
+
+		f(c, statusCh)
+	})
+}
+
+func TestServerCanReplyStatusError(t *testing.T) {
+	badName := NewPublishBadNameError("Name is already in use.", "key")
+	badName.KeepConnection = true
+
+	notFound := NewPlayStreamNotFoundError("Stream is not found.", "missing")
+	notFound.KeepConnection = true
+
+	handler := &serverCanReplyStatusErrorHandler{
+		publishErr: badName,
+		playErr:    notFound,
+	}
+	prepareStatusErrorConnection(t, handler, func(c *ClientConn, statusCh <-chan *message.NetStreamOnStatus) {
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+
+		err = s.Publish(&message.NetStreamPublish{PublishingName: "key", PublishingType: "live"})
+		require.Nil(t, err)
+		require.Equal(t, message.NetStreamOnStatusInfoObject{
+			Level:       message.NetStreamOnStatusLevelError,
+			Code:        message.NetStreamOnStatusCodePublishBadName,
+			Description: "Name is already in use.",
+			Details:     "key",
+		}, (<-statusCh).InfoObject)
+
+		// The connection is kept
+		err = s.Play(&message.NetStreamPlay{StreamName: "missing"})
+		require.Nil(t, err)
+		require.Equal(t, message.NetStreamOnStatusInfoObject{
+			Level:       message.NetStreamOnStatusLevelError,
+			Code:        message.NetStreamOnStatusCodePlayStreamNotFound,
+			Description: "Stream is not found.",
+			Details:     "missing",
+		}, (<-statusCh).InfoObject)
+
+		_, err = c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+	})
+}
+
+func TestServerClosesConnectionAfterStatusError(t *testing.T) {
+	handler := &serverCanReplyStatusErrorHandler{
+		publishErr: NewPublishDeniedError("Not authorized.", ""),
+	}
+	prepareStatusErrorConnection(t, handler, func(c *ClientConn, statusCh <-chan *message.NetStreamOnStatus) {
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+
+		err = s.Publish(&message.NetStreamPublish{PublishingName: "key", PublishingType: "live"})
+		require.Nil(t, err)
+		require.Equal(t, message.NetStreamOnStatusInfoObject{
+			Level:       message.NetStreamOnStatusLevelError,
+			Code:        message.NetStreamOnStatusCodePublishDenied,
+			Description: "Not authorized.",
+		}, (<-statusCh).InfoObject)
+
+		select {
+		case <-c.Done():
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "Connection must be closed")
+		}
+	})
+}
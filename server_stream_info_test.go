@@ -0,0 +1,117 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/media"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type serverCanTrackStreamInfoHandler struct {
+	DefaultHandler
+	infoCh  chan *StreamInfo
+	mediaCh chan struct{}
+}
+
+func (h *serverCanTrackStreamInfoHandler) OnPublish(ctx *StreamContext, _ uint32, _ *message.NetStreamPublish) error {
+	h.infoCh <- ctx.Info
+	return nil
+}
+
+func (h *serverCanTrackStreamInfoHandler) OnAudio(_ uint32, payload io.Reader) error {
+	_, _ = io.Copy(ioutil.Discard, payload)
+	h.mediaCh <- struct{}{}
+	return nil
+}
+
+func (h *serverCanTrackStreamInfoHandler) OnVideo(_ uint32, payload io.Reader) error {
+	_, _ = io.Copy(ioutil.Discard, payload)
+	h.mediaCh <- struct{}{}
+	return nil
+}
+
+func TestServerCanTrackStreamInfo(t *testing.T) {
+	infoCh := make(chan *StreamInfo, 1)
+	mediaCh := make(chan struct{}, 1)
+	config := &ConnConfig{
+		Handler: &serverCanTrackStreamInfoHandler{infoCh: infoCh, mediaCh: mediaCh},
+		Logger:  logrus.StandardLogger(),
+	}
+
+	prepareConnection(t, config, func(c *ClientConn) {
+		err := c.Connect(nil)
+		require.Nil(t, err)
+
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		err = s.Publish(&message.NetStreamPublish{
+			PublishingName: "stream",
+			PublishingType: "live",
+		})
+		require.Nil(t, err)
+
+		info := <-infoCh
+		require.Nil(t, info.Video())
+		require.Nil(t, info.Audio())
+
+		writeAVCSequenceHeader := func(profile, level byte) {
+			err := s.WriteVideoFrame(6, 0, &media.VideoFrame{
+				VideoHeader: message.VideoHeader{
+					FrameType:  message.VideoFrameTypeKeyFrame,
+					CodecID:    message.VideoCodecIDAVC,
+					PacketType: message.VideoPacketTypeSequenceStart,
+				},
+				// AVCDecoderConfigurationRecord without parameter sets
+				Data: []byte{0x01, profile, 0x00, level, 0xff, 0xe0, 0x00},
+			})
+			require.Nil(t, err)
+			<-mediaCh
+		}
+
+		writeAVCSequenceHeader(100, 31)
+		require.Equal(t, &media.VideoInfo{
+			Codec:   message.FourCCAVC,
+			CodecID: message.VideoCodecIDAVC,
+			Profile: 100,
+			Level:   31,
+		}, info.Video())
+
+		// Updated by a new sequence header
+		writeAVCSequenceHeader(66, 30)
+		require.Equal(t, uint8(66), info.Video().Profile)
+		require.Equal(t, uint8(30), info.Video().Level)
+
+		err = s.WriteAudioFrame(4, 0, &media.AudioFrame{
+			AudioHeader: message.AudioHeader{
+				SoundFormat: message.AudioSoundFormatAAC,
+				SoundRate:   3,
+				SoundSize:   1,
+				SoundType:   1,
+				PacketType:  message.AudioPacketTypeSequenceStart,
+			},
+			Data: []byte{0x11, 0x90}, // AAC-LC 48kHz stereo
+		})
+		require.Nil(t, err)
+		<-mediaCh
+
+		audio := info.Audio()
+		require.NotNil(t, audio)
+		require.Equal(t, message.FourCCAAC, audio.Codec)
+		require.Equal(t, 48000, audio.SampleRate)
+		require.Equal(t, 2, audio.Channels)
+	})
+}
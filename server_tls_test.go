@@ -0,0 +1,217 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type serverTLSStateHandler struct {
+	DefaultHandler
+	conn    *Conn
+	stateCh chan tls.ConnectionState
+}
+
+func (h *serverTLSStateHandler) OnServe(conn *Conn) {
+	h.conn = conn
+}
+
+func (h *serverTLSStateHandler) OnConnect(_ uint32, _ *message.NetConnectionConnect) error {
+	state, ok := h.conn.TLSConnectionState()
+	if ok {
+		h.stateCh <- state
+	}
+	return nil
+}
+
+func TestServerServeTLSWithSNI(t *testing.T) {
+	certA, poolA := generateTestCertificate(t, "a.example.com")
+	certB, poolB := generateTestCertificate(t, "b.example.com")
+
+	sni := &SNICertificates{}
+	sni.AddCertificate("a.example.com", certA)
+	sni.AddCertificate("*.example.com", certB)
+
+	stateCh := make(chan tls.ConnectionState, 1)
+	config := &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			return conn, &ConnConfig{
+				Handler: &serverTLSStateHandler{
+					stateCh: stateCh,
+				},
+			}
+		},
+		TLSConfig: &tls.Config{
+			GetCertificate: sni.GetCertificate,
+		},
+	}
+	prepareServer(t, config, func(addr string) {
+		for _, tc := range []struct {
+			serverName string
+			pool       *x509.CertPool
+		}{
+			{"a.example.com", poolA},
+			{"b.example.com", poolB}, // Matched by the wildcard
+		} {
+			c, err := TLSDial("rtmps", addr, nil, &tls.Config{
+				ServerName: tc.serverName,
+				RootCAs:    tc.pool,
+			})
+			require.Nil(t, err)
+
+			err = c.Connect(nil)
+			require.Nil(t, err)
+
+			select {
+			case state := <-stateCh:
+				require.Equal(t, tc.serverName, state.ServerName)
+				require.True(t, state.HandshakeComplete)
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timeout")
+			}
+
+			state, ok := c.conn.TLSConnectionState()
+			require.True(t, ok)
+			require.Equal(t, tc.serverName, state.PeerCertificates[0].Subject.CommonName)
+
+			require.Nil(t, c.Close())
+		}
+	})
+}
+
+func TestServerClosesStalledTLSHandshakes(t *testing.T) {
+	cert, _ := generateTestCertificate(t, "a.example.com")
+
+	config := &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			return conn, &ConnConfig{}
+		},
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{*cert},
+		},
+		TLSHandshakeTimeout: 100 * time.Millisecond,
+	}
+	prepareServer(t, config, func(addr string) {
+		conn, err := net.Dial("tcp", addr)
+		require.Nil(t, err)
+		defer conn.Close()
+
+		// Send nothing, then the server gives up the handshake
+		err = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		require.Nil(t, err)
+		_, err = conn.Read(make([]byte, 1))
+		require.Equal(t, io.EOF, err)
+	})
+}
+
+func TestServerServeTLSWithoutCertificates(t *testing.T) {
+	srv := NewServer(&ServerConfig{})
+
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	require.Nil(t, err)
+	defer l.Close()
+
+	err = srv.ServeTLS(l, "", "")
+	require.Error(t, err)
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-rtmp")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	writeTestCertificateFiles(t, "first.example.com", certFile, keyFile)
+	r, err := NewCertificateReloader(certFile, keyFile)
+	require.Nil(t, err)
+
+	require.Equal(t, "first.example.com", reloadedCommonName(t, r))
+
+	writeTestCertificateFiles(t, "second.example.com", certFile, keyFile)
+	future := time.Now().Add(1 * time.Hour) // Ensure that modification times are changed
+	require.Nil(t, os.Chtimes(certFile, future, future))
+	require.Nil(t, os.Chtimes(keyFile, future, future))
+
+	require.Equal(t, "second.example.com", reloadedCommonName(t, r))
+}
+
+func reloadedCommonName(t *testing.T, r *CertificateReloader) string {
+	cert, err := r.GetCertificate(nil)
+	require.Nil(t, err)
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.Nil(t, err)
+
+	return leaf.Subject.CommonName
+}
+
+func generateTestCertificate(t *testing.T, commonName string) (*tls.Certificate, *x509.CertPool) {
+	certPEM, keyPEM := generateTestCertificatePEM(t, commonName)
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.Nil(t, err)
+
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(certPEM))
+
+	return &cert, pool
+}
+
+func writeTestCertificateFiles(t *testing.T, commonName, certFile, keyFile string) {
+	certPEM, keyPEM := generateTestCertificatePEM(t, commonName)
+
+	require.Nil(t, ioutil.WriteFile(certFile, certPEM, 0600))
+	require.Nil(t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+}
+
+func generateTestCertificatePEM(t *testing.T, commonName string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{commonName},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(1 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM
+}
@@ -0,0 +1,283 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yutopp/go-rtmp/message"
+)
+
+type memVODStorage struct {
+	*memRecordStorage
+}
+
+func (s *memVODStorage) Open(name string) (VODFile, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	f, ok := s.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return f, nil
+}
+
+// newVODTestStorage Records a file which has key frames at 0, 200 and 400, and inter frames at 100, 300 and 500.
+func newVODTestStorage(t *testing.T) *memVODStorage {
+	storage := newMemRecordStorage()
+	rec, err := NewRecorder(&message.NetStreamPublish{
+		PublishingName: "vod",
+		PublishingType: "record",
+	}, &RecorderConfig{
+		Storage: storage,
+	})
+	require.Nil(t, err)
+
+	require.Nil(t, rec.WriteMetaData(0, newRecordSetDataFrame(t)))
+	require.Nil(t, rec.WriteVideo(0, recordAVCSeqHeader))
+	require.Nil(t, rec.WriteAudio(0, recordAACSeqHeader))
+	for ts := uint32(0); ts <= 400; ts += 200 {
+		require.Nil(t, rec.WriteVideo(ts, recordAVCKeyFrame))
+		require.Nil(t, rec.WriteVideo(ts+100, recordAVCInter))
+	}
+	require.Nil(t, rec.Close())
+
+	return &memVODStorage{memRecordStorage: storage}
+}
+
+type serverCanPlayVODHandler struct {
+	DefaultHandler
+	storage VODStorage
+}
+
+func (h *serverCanPlayVODHandler) OnPlay(ctx *StreamContext, _ uint32, cmd *message.NetStreamPlay) error {
+	return ctx.PlayFile(h.storage, cmd.StreamName+".flv")
+}
+
+func (h *serverCanPlayVODHandler) OnGetStreamLength(_ uint32, cmd *message.NetStreamGetStreamLength) (float64, error) {
+	return VODStreamLength(h.storage, cmd.StreamName+".flv")
+}
+
+type vodClientEvent struct {
+	name      string // Status codes, "audio" or "video"
+	timestamp uint32
+}
+
+type vodClientHandler struct {
+	DefaultHandler
+	eventCh chan vodClientEvent
+}
+
+func (h *vodClientHandler) OnStatus(timestamp uint32, status *message.NetStreamOnStatus) error {
+	h.eventCh <- vodClientEvent{string(status.InfoObject.Code), timestamp}
+	return nil
+}
+
+func (h *vodClientHandler) OnPlayStatus(timestamp uint32, status *message.NetStreamOnPlayStatus) error {
+	h.eventCh <- vodClientEvent{"onPlayStatus:" + string(status.InfoObject.Code), timestamp}
+	return nil
+}
+
+func (h *vodClientHandler) OnUnknownMessage(timestamp uint32, msg message.Message) error {
+	switch msg.(type) {
+	case *message.AudioMessage:
+		h.eventCh <- vodClientEvent{"audio", timestamp}
+	case *message.VideoMessage:
+		h.eventCh <- vodClientEvent{"video", timestamp}
+	}
+	return nil
+}
+
+// waitVODEvents Collects events until an event named name is received.
+func waitVODEvents(t *testing.T, eventCh <-chan vodClientEvent, name string) []vodClientEvent {
+	var events []vodClientEvent
+	for {
+		select {
+		case ev := <-eventCh:
+			events = append(events, ev)
+			if ev.name == name {
+				return events
+			}
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, fmt.Sprintf("Timeout: %s, Events = %v", name, events))
+		}
+	}
+}
+
+func prepareVODConnection(t *testing.T, f func(c *ClientConn, eventCh <-chan vodClientEvent)) {
+	storage := newVODTestStorage(t)
+	config := &ServerConfig{
+		OnConnect: func(conn net.Conn) (io.ReadWriteCloser, *ConnConfig) {
+			return conn, &ConnConfig{
+				Handler: &serverCanPlayVODHandler{storage: storage},
+			}
+		},
+	}
+	prepareServer(t, config, func(addr string) {
+		eventCh := make(chan vodClientEvent, 64)
+		c, err := Dial("rtmp", addr, &ConnConfig{
+			Handler: &vodClientHandler{eventCh: eventCh},
+		})
+		require.Nil(t, err)
+		defer c.Close()
+
+		err = c.Connect(nil)
+		require.Nil(t, err)
+
+		f(c, eventCh)
+	})
+}
+
+func TestServerCanPlayVOD(t *testing.T) {
+	prepareVODConnection(t, func(c *ClientConn, eventCh <-chan vodClientEvent) {
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		begin := time.Now()
+		err = s.Play(&message.NetStreamPlay{StreamName: "vod", Start: -2, Duration: -1})
+		require.Nil(t, err)
+
+		events := waitVODEvents(t, eventCh, string(message.NetStreamOnStatusCodePlayStop))
+		require.True(t, time.Since(begin) >= 400*time.Millisecond, "Must be played at real-time pace")
+		require.Equal(t, []vodClientEvent{
+			{string(message.NetStreamOnStatusCodePlayReset), 0},
+			{string(message.NetStreamOnStatusCodePlayStart), 0},
+			{"video", 0}, // Sequence headers
+			{"audio", 0},
+			{"video", 0},
+			{"video", 100},
+			{"video", 200},
+			{"video", 300},
+			{"video", 400},
+			{"video", 500},
+			{"onPlayStatus:" + string(message.NetStreamOnStatusCodePlayComplete), 0},
+			{string(message.NetStreamOnStatusCodePlayStop), 0},
+		}, events)
+
+		result, err := c.GetStreamLength(&message.NetStreamGetStreamLength{StreamName: "vod"})
+		require.Nil(t, err)
+		require.Equal(t, float64(0.5), result.Duration)
+
+		_, err = c.GetStreamLength(&message.NetStreamGetStreamLength{StreamName: "not-found"})
+		require.Error(t, err)
+	})
+}
+
+func TestServerCanPlayVODRange(t *testing.T) {
+	prepareVODConnection(t, func(c *ClientConn, eventCh <-chan vodClientEvent) {
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		err = s.Play(&message.NetStreamPlay{StreamName: "vod", Start: 250, Duration: 100})
+		require.Nil(t, err)
+
+		events := waitVODEvents(t, eventCh, string(message.NetStreamOnStatusCodePlayStop))
+		require.Equal(t, []vodClientEvent{
+			{string(message.NetStreamOnStatusCodePlayReset), 0},
+			{string(message.NetStreamOnStatusCodePlayStart), 0},
+			{"video", 200}, // Starts from the preceding key frame
+			{"audio", 200},
+			{"video", 200},
+			{"video", 300},
+			{"onPlayStatus:" + string(message.NetStreamOnStatusCodePlayComplete), 0},
+			{string(message.NetStreamOnStatusCodePlayStop), 0},
+		}, events)
+	})
+}
+
+func TestServerCanPauseAndSeekVOD(t *testing.T) {
+	prepareVODConnection(t, func(c *ClientConn, eventCh <-chan vodClientEvent) {
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		err = s.Play(&message.NetStreamPlay{StreamName: "vod", Start: -2, Duration: -1})
+		require.Nil(t, err)
+		waitVODEvents(t, eventCh, string(message.NetStreamOnStatusCodePlayStart))
+
+		err = s.Pause(&message.NetStreamPause{Pause: true, Milliseconds: 0})
+		require.Nil(t, err)
+		waitVODEvents(t, eventCh, string(message.NetStreamOnStatusCodePauseNotify))
+
+		err = s.Seek(&message.NetStreamSeek{Milliseconds: 400})
+		require.Nil(t, err)
+		events := waitVODEvents(t, eventCh, string(message.NetStreamOnStatusCodePlayStart))
+		require.Equal(t, vodClientEvent{string(message.NetStreamOnStatusCodeSeekNotify), 0}, events[len(events)-2])
+
+		err = s.Pause(&message.NetStreamPause{Pause: false, Milliseconds: 400})
+		require.Nil(t, err)
+		events = waitVODEvents(t, eventCh, string(message.NetStreamOnStatusCodePlayStop))
+
+		// Drop sequence headers sent by seeking while paused
+		for i, ev := range events {
+			if ev.name == string(message.NetStreamOnStatusCodeUnpauseNotify) {
+				events = events[i:]
+				break
+			}
+		}
+		require.Equal(t, []vodClientEvent{
+			{string(message.NetStreamOnStatusCodeUnpauseNotify), 0},
+			{"video", 400},
+			{"audio", 400},
+			{"video", 400},
+			{"video", 500},
+			{"onPlayStatus:" + string(message.NetStreamOnStatusCodePlayComplete), 0},
+			{string(message.NetStreamOnStatusCodePlayStop), 0},
+		}, events)
+	})
+}
+
+func TestServerRejectsPlayingMissingVOD(t *testing.T) {
+	prepareVODConnection(t, func(c *ClientConn, eventCh <-chan vodClientEvent) {
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		err = s.Play(&message.NetStreamPlay{StreamName: "not-found", Start: -2, Duration: -1})
+		require.Nil(t, err)
+
+		waitVODEvents(t, eventCh, string(message.NetStreamOnStatusCodePlayFailed))
+	})
+}
+
+func TestFLVIndexSeek(t *testing.T) {
+	storage := newVODTestStorage(t)
+	f, err := storage.Open("vod.flv")
+	require.Nil(t, err)
+
+	index, err := loadFLVIndex(f)
+	require.Nil(t, err)
+	require.Equal(t, uint32(500), index.duration)
+	require.Equal(t, recordAVCSeqHeader, index.videoSeqHeader)
+	require.Equal(t, recordAACSeqHeader, index.audioSeqHeader)
+
+	for _, tc := range []struct {
+		timestamp uint32
+		expected  uint32
+	}{
+		{0, 0},
+		{199, 0},
+		{200, 200},
+		{350, 200},
+		{1000, 400},
+	} {
+		sp, ok := index.seek(tc.timestamp)
+		require.True(t, ok)
+		require.Equal(t, tc.expected, sp.timestamp, tc.timestamp)
+	}
+}
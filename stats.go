@@ -0,0 +1,186 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yutopp/go-rtmp/handshake"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+// ConnStats A snapshot of statistics of a connection. See Conn.Stats.
+type ConnStats struct {
+	// BytesRead and BytesWritten are sizes of chunks. Handshakes are not included.
+	BytesRead    uint64
+	BytesWritten uint64
+
+	MessagesRead    map[message.TypeID]uint64
+	MessagesWritten map[message.TypeID]uint64
+
+	// SelfChunkSize is a chunk size of chunks which are written, and PeerChunkSize is of chunks which are read.
+	SelfChunkSize uint32
+	PeerChunkSize uint32
+
+	// SelfAckWindowSize is a window size which is sent to the peer by Window Acknowledgement Size.
+	// PeerAckWindowSize is a window size which is received from the peer, and acknowledgements are sent by it.
+	SelfAckWindowSize int32
+	PeerAckWindowSize int32
+
+	// LastAckReceived and LastAckSent are sequence numbers of the last acknowledgements. Zero if not exchanged yet.
+	LastAckReceived uint32
+	LastAckSent     uint32
+
+	// UnackedBytes is the number of bytes which are written but not acknowledged by the peer yet.
+	// It may be less than actual if the peer counts handshakes.
+	UnackedBytes uint32
+
+	// WriteQueueDepth is the number of chunk streams waiting to be written.
+	WriteQueueDepth int
+
+	// Streams is the number of message streams including the control stream.
+	Streams int
+
+	Age time.Duration
+
+	// HandshakeVersion is an RTMP version in C0/S0, and PeerVersion is a version in C1/S1 sent by the peer.
+	// On servers, PeerVersion is a version of a client (e.g. a version of Flash Player). They are zero before handshakes.
+	HandshakeVersion handshake.S0C0
+	PeerVersion      [4]byte
+}
+
+// Stats returns a snapshot of statistics of the connection. It is safe to call it from any goroutine.
+func (c *Conn) Stats() *ConnStats {
+	stats := c.stats.snapshot()
+
+	streamer := c.streamer
+	stats.SelfChunkSize = streamer.SelfState().ChunkSize()
+	stats.PeerChunkSize = streamer.PeerState().ChunkSize()
+	stats.SelfAckWindowSize = streamer.SelfState().AckWindowSize()
+	stats.PeerAckWindowSize = streamer.PeerState().AckWindowSize()
+	stats.LastAckSent = streamer.lastAckSent()
+
+	unacked := int64(uint32(stats.BytesWritten)) - int64(stats.LastAckReceived)
+	if unacked > 0 {
+		stats.UnackedBytes = uint32(unacked)
+	}
+
+	stats.Streams = len(c.streams.list())
+	stats.Age = time.Since(c.createdAt)
+
+	if result := c.handshakeResult; result != nil {
+		stats.HandshakeVersion = result.Version
+		stats.PeerVersion = result.PeerVersion
+	}
+
+	return stats
+}
+
+// connStats Counts statistics of a connection and forwards events to an observer given by users.
+type connStats struct {
+	next ConnObserver
+
+	bytesRead       uint64
+	bytesWritten    uint64
+	messagesRead    map[message.TypeID]uint64
+	messagesWritten map[message.TypeID]uint64
+	queueDepth      int
+	lastAckReceived uint32
+	m               sync.Mutex
+}
+
+var _ ConnObserver = (*connStats)(nil)
+
+func newConnStats(next ConnObserver) *connStats {
+	return &connStats{
+		next:            next,
+		messagesRead:    make(map[message.TypeID]uint64),
+		messagesWritten: make(map[message.TypeID]uint64),
+	}
+}
+
+func (s *connStats) OnBytesRead(n int) {
+	atomic.AddUint64(&s.bytesRead, uint64(n))
+	s.next.OnBytesRead(n)
+}
+
+func (s *connStats) OnBytesWritten(n int) {
+	atomic.AddUint64(&s.bytesWritten, uint64(n))
+	s.next.OnBytesWritten(n)
+}
+
+func (s *connStats) OnMessageRead(streamID uint32, typeID message.TypeID, length uint32) {
+	s.m.Lock()
+	s.messagesRead[typeID]++
+	s.m.Unlock()
+
+	s.next.OnMessageRead(streamID, typeID, length)
+}
+
+func (s *connStats) OnMessageWritten(streamID uint32, typeID message.TypeID, length uint32) {
+	s.m.Lock()
+	s.messagesWritten[typeID]++
+	s.m.Unlock()
+
+	s.next.OnMessageWritten(streamID, typeID, length)
+}
+
+func (s *connStats) OnChunkStreamCreated(chunkStreamID int, isWriter bool) {
+	s.next.OnChunkStreamCreated(chunkStreamID, isWriter)
+}
+
+func (s *connStats) OnWriteQueueDepth(depth int) {
+	s.m.Lock()
+	s.queueDepth = depth
+	s.m.Unlock()
+
+	s.next.OnWriteQueueDepth(depth)
+}
+
+func (s *connStats) OnStreamCreated(streamID uint32) {
+	s.next.OnStreamCreated(streamID)
+}
+
+func (s *connStats) OnStreamDeleted(streamID uint32) {
+	s.next.OnStreamDeleted(streamID)
+}
+
+func (s *connStats) OnClose() {
+	s.next.OnClose()
+}
+
+func (s *connStats) onAckReceived(sequenceNumber uint32) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.lastAckReceived = sequenceNumber
+}
+
+func (s *connStats) snapshot() *ConnStats {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	stats := &ConnStats{
+		BytesRead:       atomic.LoadUint64(&s.bytesRead),
+		BytesWritten:    atomic.LoadUint64(&s.bytesWritten),
+		MessagesRead:    make(map[message.TypeID]uint64, len(s.messagesRead)),
+		MessagesWritten: make(map[message.TypeID]uint64, len(s.messagesWritten)),
+		LastAckReceived: s.lastAckReceived,
+		WriteQueueDepth: s.queueDepth,
+	}
+	for k, v := range s.messagesRead {
+		stats.MessagesRead[k] = v
+	}
+	for k, v := range s.messagesWritten {
+		stats.MessagesWritten[k] = v
+	}
+
+	return stats
+}
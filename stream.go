@@ -10,11 +10,13 @@ package rtmp
 import (
 	"bytes"
 	"context"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/yutopp/go-rtmp/media"
 	"github.com/yutopp/go-rtmp/message"
 )
 
@@ -25,8 +27,16 @@ type Stream struct {
 	transactions *transactions
 	handler      *streamHandler
 	cmsg         ChunkMessage
+	publishCmd   *message.NetStreamPublish // Sent by Publish. It is used to publish again after reconnecting
+	info         *StreamInfo
+	recorder     *Recorder
+	health       *HealthAnalyzer
+	player       *vodPlayer
+	session      *publishSession // Client only. Keeps headers to publish again after reconnecting
 
 	conn *Conn
+	m    sync.Mutex
+	wm   sync.Mutex // Serializes writes without holding m. cmsg and session are guarded by it
 }
 
 func newStream(streamID uint32, conn *Conn) *Stream {
@@ -34,6 +44,7 @@ func newStream(streamID uint32, conn *Conn) *Stream {
 		streamID:     streamID,
 		encTy:        message.EncodingTypeAMF0, // Default AMF encoding type
 		transactions: newTransactions(),
+		info:         &StreamInfo{},
 		cmsg: ChunkMessage{
 			StreamID: streamID,
 		},
@@ -46,9 +57,17 @@ func newStream(streamID uint32, conn *Conn) *Stream {
 }
 
 func (s *Stream) StreamID() uint32 {
+	s.m.Lock()
+	defer s.m.Unlock()
+
 	return s.streamID
 }
 
+// Info returns properties of media which are published to the stream.
+func (s *Stream) Info() *StreamInfo {
+	return s.info
+}
+
 func (s *Stream) WriteWinAckSize(chunkStreamID int, timestamp uint32, msg *message.WinAckSize) error {
 	return s.Write(chunkStreamID, timestamp, msg)
 }
@@ -63,6 +82,14 @@ func (s *Stream) WriteUserCtrl(chunkStreamID int, timestamp uint32, msg *message
 
 func (s *Stream) Connect(
 	body *message.NetConnectionConnect,
+) (*message.NetConnectionConnectResult, error) {
+	return s.ConnectWithContext(context.TODO(), body)
+}
+
+// ConnectWithContext sends a connect command and waits for the result until ctx is done.
+func (s *Stream) ConnectWithContext(
+	ctx context.Context,
+	body *message.NetConnectionConnect,
 ) (*message.NetConnectionConnectResult, error) {
 	transactionID := int64(1) // Always 1 (7.2.1.1)
 	t, err := s.transactions.Create(transactionID)
@@ -85,11 +112,12 @@ func (s *Stream) Connect(
 		return nil, err
 	}
 
-	// TODO: support timeout
-	timeoutCtx := context.TODO()
 	select {
-	case <-timeoutCtx.Done():
-		return nil, timeoutCtx.Err()
+	case <-ctx.Done():
+		_ = s.transactions.Delete(transactionID)
+		return nil, ctx.Err()
+	case <-s.currentConn().loopDoneCh:
+		return nil, ErrConnectionClosed
 	case <-t.doneCh:
 		amfDec := message.NewAMFDecoder(t.body, t.encoding)
 
@@ -121,7 +149,7 @@ func (s *Stream) ReplyConnect(
 	switch body.Information.Code {
 	case message.NetConnectionConnectCodeSuccess, message.NetConnectionConnectCodeClosed:
 		commandName = "_result"
-	case message.NetConnectionConnectCodeFailed:
+	default:
 		commandName = "_error"
 	}
 
@@ -134,10 +162,11 @@ func (s *Stream) ReplyConnect(
 }
 
 func (s *Stream) CreateStream(body *message.NetConnectionCreateStream, chunkSize uint32) (*message.NetConnectionCreateStreamResult, error) {
-	oldChunkSize := s.conn.streamer.selfState.chunkSize
+	streamer := s.streamer()
+	oldChunkSize := streamer.selfState.chunkSize
 	if chunkSize > 0 && chunkSize != oldChunkSize {
 		logrus.Infof("Changing chunkSize %d->%d", oldChunkSize, chunkSize)
-		s.conn.streamer.selfState.chunkSize = chunkSize
+		streamer.selfState.chunkSize = chunkSize
 		err := s.WriteSetChunkSize(chunkSize)
 		if err != nil {
 			return nil, err
@@ -171,6 +200,8 @@ func (s *Stream) CreateStream(body *message.NetConnectionCreateStream, chunkSize
 	select {
 	case <-timeoutCtx.Done():
 		return nil, timeoutCtx.Err()
+	case <-s.currentConn().loopDoneCh:
+		return nil, ErrConnectionClosed
 	case <-t.doneCh:
 		amfDec := message.NewAMFDecoder(t.body, t.encoding)
 
@@ -193,6 +224,45 @@ func (s *Stream) CreateStream(body *message.NetConnectionCreateStream, chunkSize
 	//return nil, errors.New("Failed to get result")
 }
 
+func (s *Stream) GetStreamLength(body *message.NetStreamGetStreamLength) (*message.NetStreamGetStreamLengthResult, error) {
+	transactionID := int64(3) // TODO: fix
+	t, err := s.transactions.Create(transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkStreamID := 3 // TODO: fix
+	err = s.writeCommandMessage(
+		chunkStreamID, 0,
+		"getStreamLength",
+		transactionID,
+		body,
+	)
+	if err != nil {
+		_ = s.transactions.Delete(transactionID)
+		return nil, err
+	}
+
+	// TODO: support timeout
+	select {
+	case <-s.currentConn().loopDoneCh:
+		return nil, ErrConnectionClosed
+	case <-t.doneCh:
+	}
+	if t.commandName == "_error" {
+		return nil, errors.Errorf("Failed to get a stream length: StreamName = %s", body.StreamName)
+	}
+
+	amfDec := message.NewAMFDecoder(t.body, t.encoding)
+
+	var value message.AMFConvertible
+	if err := message.DecodeBodyGetStreamLengthResult(t.body, amfDec, &value); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode result")
+	}
+
+	return value.(*message.NetStreamGetStreamLengthResult), nil
+}
+
 func (s *Stream) DeleteStream(body *message.NetStreamDeleteStream) error {
 	chunkStreamID := 3 // TODO: fix
 
@@ -227,6 +297,26 @@ func (s *Stream) ReplyCreateStream(
 	)
 }
 
+func (s *Stream) ReplyGetStreamLength(
+	chunkStreamID int,
+	timestamp uint32,
+	transactionID int64,
+	body *message.NetStreamGetStreamLengthResult,
+) error {
+	commandName := "_result"
+	if body == nil {
+		commandName = "_error"
+		body = &message.NetStreamGetStreamLengthResult{}
+	}
+
+	return s.writeCommandMessage(
+		chunkStreamID, timestamp,
+		commandName,
+		transactionID,
+		body,
+	)
+}
+
 func (s *Stream) Publish(
 	body *message.NetStreamPublish,
 ) error {
@@ -234,6 +324,15 @@ func (s *Stream) Publish(
 		body = &message.NetStreamPublish{}
 	}
 
+	s.wm.Lock()
+	s.m.Lock()
+	s.publishCmd = body
+	if s.session == nil && s.conn.config.Reconnect.Enabled {
+		s.session = newPublishSession(&s.conn.config.Reconnect)
+	}
+	s.m.Unlock()
+	s.wm.Unlock()
+
 	chunkStreamID := 3 // TODO: fix
 	return s.writeCommandMessage(
 		chunkStreamID, 0, // TODO: fix, Timestamp is 0
@@ -243,6 +342,49 @@ func (s *Stream) Publish(
 	)
 }
 
+// Play sends a play command. Statuses are notified to StatusHandler if the handler implements it.
+func (s *Stream) Play(
+	body *message.NetStreamPlay,
+) error {
+	if body == nil {
+		body = &message.NetStreamPlay{Start: -2, Duration: -1}
+	}
+
+	chunkStreamID := 3 // TODO: fix
+	return s.writeCommandMessage(
+		chunkStreamID, 0, // TODO: fix, Timestamp is 0
+		"play",
+		int64(0), // Always 0, 7.2.2.1
+		body,
+	)
+}
+
+// Seek sends a seek command to a playing stream.
+func (s *Stream) Seek(
+	body *message.NetStreamSeek,
+) error {
+	chunkStreamID := 3 // TODO: fix
+	return s.writeCommandMessage(
+		chunkStreamID, 0, // TODO: fix, Timestamp is 0
+		"seek",
+		int64(0), // Always 0, 7.2.2.7
+		body,
+	)
+}
+
+// Pause sends a pause command to a playing stream.
+func (s *Stream) Pause(
+	body *message.NetStreamPause,
+) error {
+	chunkStreamID := 3 // TODO: fix
+	return s.writeCommandMessage(
+		chunkStreamID, 0, // TODO: fix, Timestamp is 0
+		"pause",
+		int64(0), // Always 0, 7.2.2.8
+		body,
+	)
+}
+
 func (s *Stream) NotifyStatus(
 	chunkStreamID int,
 	timestamp uint32,
@@ -257,12 +399,80 @@ func (s *Stream) NotifyStatus(
 }
 
 func (s *Stream) Close() error {
+	if s == nil {
+		return nil // Streams which are failed to be created
+	}
+
 	s.assumeClosed()
 	return nil // TODO: implement
 }
 
 func (s *Stream) assumeClosed() {
-	// TODO: implement
+	if player := s.attachPlayer(nil); player != nil {
+		player.stop()
+	}
+
+	rec := s.attachRecorder(nil)
+	if rec == nil {
+		return
+	}
+	if err := rec.Close(); err != nil {
+		s.logger().Warnf("Failed to close a recorder: Err = %+v", err)
+	}
+}
+
+// attachRecorder Replaces a recorder of the stream and returns the previous one.
+func (s *Stream) attachRecorder(rec *Recorder) *Recorder {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	prev := s.recorder
+	s.recorder = rec
+
+	return prev
+}
+
+// attachHealthAnalyzer Replaces a health analyzer of the stream and returns the previous one.
+func (s *Stream) attachHealthAnalyzer(a *HealthAnalyzer) *HealthAnalyzer {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	prev := s.health
+	s.health = a
+
+	return prev
+}
+
+// attachPlayer Replaces a VOD player of the stream and returns the previous one.
+func (s *Stream) attachPlayer(player *vodPlayer) *vodPlayer {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	prev := s.player
+	s.player = player
+
+	return prev
+}
+
+func (s *Stream) attachedPlayer() *vodPlayer {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.player
+}
+
+func (s *Stream) attachedRecorder() *Recorder {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.recorder
+}
+
+func (s *Stream) attachedHealthAnalyzer() *HealthAnalyzer {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.health
 }
 
 func (s *Stream) writeCommandMessage(
@@ -305,6 +515,66 @@ func (s *Stream) WriteDataMessage(
 	})
 }
 
+// WriteAudioTracks writes audio of several tracks as an Enhanced RTMP multitrack packet.
+// header.IsMultitrack must be true.
+func (s *Stream) WriteAudioTracks(
+	chunkStreamID int,
+	timestamp uint32,
+	header *message.AudioHeader,
+	tracks []message.AudioTrack,
+) error {
+	buf := new(bytes.Buffer)
+	if err := message.EncodeAudioTracks(buf, header, tracks); err != nil {
+		return err
+	}
+
+	return s.Write(chunkStreamID, timestamp, &message.AudioMessage{
+		Payload: buf,
+	})
+}
+
+// WriteVideoTracks writes video of several tracks as an Enhanced RTMP multitrack packet.
+// header.IsMultitrack must be true.
+func (s *Stream) WriteVideoTracks(
+	chunkStreamID int,
+	timestamp uint32,
+	header *message.VideoHeader,
+	tracks []message.VideoTrack,
+) error {
+	buf := new(bytes.Buffer)
+	if err := message.EncodeVideoTracks(buf, header, tracks); err != nil {
+		return err
+	}
+
+	return s.Write(chunkStreamID, timestamp, &message.VideoMessage{
+		Payload: buf,
+	})
+}
+
+// WriteAudioFrame writes a frame as an AudioMessage.
+func (s *Stream) WriteAudioFrame(chunkStreamID int, timestamp uint32, frame *media.AudioFrame) error {
+	buf := new(bytes.Buffer)
+	if err := media.EncodeAudioFrame(buf, frame); err != nil {
+		return err
+	}
+
+	return s.Write(chunkStreamID, timestamp, &message.AudioMessage{
+		Payload: buf,
+	})
+}
+
+// WriteVideoFrame writes a frame as a VideoMessage.
+func (s *Stream) WriteVideoFrame(chunkStreamID int, timestamp uint32, frame *media.VideoFrame) error {
+	buf := new(bytes.Buffer)
+	if err := media.EncodeVideoFrame(buf, frame); err != nil {
+		return err
+	}
+
+	return s.Write(chunkStreamID, timestamp, &message.VideoMessage{
+		Payload: buf,
+	})
+}
+
 func (s *Stream) WriteSetChunkSize(chunkSize uint32) error {
 	if chunkSize < 1 {
 		return errors.New("chunksize < 1")
@@ -322,26 +592,114 @@ func (s *Stream) Write(chunkStreamID int, timestamp uint32, msg message.Message)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // TODO: Fix 5s
 	defer cancel()
 
+	s.wm.Lock()
+	defer s.wm.Unlock()
+
+	var pm *pendingMessage
+	if s.session != nil {
+		m, p, err := s.session.record(chunkStreamID, timestamp, msg)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			return nil // Buffered or dropped while reconnecting
+		}
+		msg, pm = m, p
+	}
+
+	conn := s.currentConn()
+
 	s.cmsg.Message = msg
-	return s.streamer().Write(ctx, chunkStreamID, timestamp, &s.cmsg)
+	err := conn.streamer.Write(ctx, chunkStreamID, timestamp, &s.cmsg)
+	if err != nil && pm != nil && conn.onWriteError != nil && conn.onWriteError() {
+		// The connection is lost. The message is buffered or dropped as other media until resuming
+		conn.logger.Warnf("Failed to write. Suspended until reconnecting: Err = %+v", err)
+		s.session.suspend()
+		s.session.enqueue(pm)
+		return nil
+	}
+
+	return err
 }
 
 func (s *Stream) handle(chunkStreamID int, timestamp uint32, msg message.Message) error {
 	return s.handler.Handle(chunkStreamID, timestamp, msg)
 }
 
+// rebind Moves the stream to another connection. It is used to continue publishing after reconnecting.
+func (s *Stream) rebind(conn *Conn, streamID uint32) {
+	s.wm.Lock()
+	defer s.wm.Unlock()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.conn = conn
+	s.streamID = streamID
+	s.cmsg.StreamID = streamID
+}
+
+// suspend Starts buffering or dropping media until resumePublishing is called.
+func (s *Stream) suspend() {
+	s.wm.Lock()
+	defer s.wm.Unlock()
+
+	if s.session != nil {
+		s.session.suspend()
+	}
+}
+
+// resumePublishing Sends metadata, sequence headers and buffered media to the current connection.
+func (s *Stream) resumePublishing() error {
+	s.wm.Lock()
+	defer s.wm.Unlock()
+
+	if s.session == nil {
+		return nil
+	}
+	conn := s.currentConn()
+
+	// Headers and buffered media are kept until all of them are sent, so they can be sent again on a next connection
+	for _, pm := range s.session.resume() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // TODO: Fix 5s
+		s.cmsg.Message = pm.message()
+		err := conn.streamer.Write(ctx, pm.chunkStreamID, pm.timestamp, &s.cmsg)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	s.session.resumed()
+
+	return nil
+}
+
+func (s *Stream) publishCommand() *message.NetStreamPublish {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.publishCmd
+}
+
+func (s *Stream) currentConn() *Conn {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.conn
+}
+
 func (s *Stream) streams() *streams {
-	return s.conn.streams
+	return s.currentConn().streams
 }
 
 func (s *Stream) streamer() *ChunkStreamer {
-	return s.conn.streamer
+	return s.currentConn().streamer
 }
 
 func (s *Stream) userHandler() Handler {
-	return s.conn.handler
+	return s.currentConn().handler
 }
 
 func (s *Stream) logger() logrus.FieldLogger {
-	return s.conn.logger
+	return s.currentConn().logger
 }
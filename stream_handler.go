@@ -8,6 +8,8 @@
 package rtmp
 
 import (
+	"bytes"
+	"io/ioutil"
 	"sync"
 
 	"github.com/pkg/errors"
@@ -28,6 +30,7 @@ const (
 	streamStateServerPlay
 	streamStateClientNotConnected
 	streamStateClientConnected
+	streamStateClientData
 )
 
 func (s streamState) String() string {
@@ -46,6 +49,8 @@ func (s streamState) String() string {
 		return "NotConnected(Client)"
 	case streamStateClientConnected:
 		return "Connected(Client)"
+	case streamStateClientData:
+		return "Data(Client)"
 	default:
 		return "<Unknown>"
 	}
@@ -118,8 +123,10 @@ func (h *streamHandler) ChangeState(state streamState) {
 		h.handler = &serverDataPlayHandler{sh: h}
 	case streamStateClientNotConnected:
 		h.handler = &clientControlNotConnectedHandler{sh: h}
-		// 	case streamStateClientConnected:
-		// 		h.handler = &serverControlConnectedHandler{sh: h}
+	case streamStateClientConnected:
+		h.handler = &clientControlConnectedHandler{sh: h}
+	case streamStateClientData:
+		h.handler = &clientDataHandler{sh: h}
 	default:
 		panic("Unexpected")
 	}
@@ -150,17 +157,32 @@ func (h *streamHandler) handleData(
 	timestamp uint32,
 	dataMsg *message.DataMessage,
 ) error {
+	// Keep the body to pass messages which are not handled to the user handler as they are
+	body, err := ioutil.ReadAll(dataMsg.Body)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read data body")
+	}
+	passThrough := func() error {
+		dataMsg.Body = bytes.NewReader(body)
+		return h.stream.userHandler().OnUnknownDataMessage(timestamp, dataMsg)
+	}
+
+	r := bytes.NewReader(body)
 	bodyDecoder := message.DataBodyDecoderFor(dataMsg.Name)
 
-	amfDec := message.NewAMFDecoder(dataMsg.Body, dataMsg.Encoding)
+	amfDec := message.NewAMFDecoder(r, dataMsg.Encoding)
 	var value message.AMFConvertible
-	if err := bodyDecoder(dataMsg.Body, amfDec, &value); err != nil {
+	if err := bodyDecoder(r, amfDec, &value); err != nil {
+		if _, ok := err.(*message.UnknownDataBodyDecodeError); ok {
+			// e.g. onMetaData sent to players, onTextData and onCuePoint
+			return passThrough()
+		}
 		return err
 	}
 
-	err := h.handler.onData(chunkStreamID, timestamp, dataMsg, value)
+	err = h.handler.onData(chunkStreamID, timestamp, dataMsg, value)
 	if err == internal.ErrPassThroughMsg {
-		return h.stream.userHandler().OnUnknownDataMessage(timestamp, dataMsg)
+		return passThrough()
 	}
 	return err
 }
@@ -177,6 +199,11 @@ func (h *streamHandler) handleCommand(
 			return errors.Wrap(err, "Got response to the unexpected transaction")
 		}
 
+		// A result of connect (7.2.1.1) at client side
+		if h.State() == streamStateClientNotConnected && cmdMsg.CommandName == "_result" && cmdMsg.TransactionID == 1 {
+			h.ChangeState(streamStateClientConnected)
+		}
+
 		// Set result (NOTE: should use a mutex for it?)
 		t.Reply(cmdMsg.CommandName, cmdMsg.Encoding, cmdMsg.Body)
 
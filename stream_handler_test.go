@@ -8,9 +8,15 @@
 package rtmp
 
 import (
+	"bytes"
 	"testing"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"github.com/yutopp/go-amf0"
+
+	"github.com/yutopp/go-rtmp/message"
 )
 
 func TestStreamHandlerChangeState(t *testing.T) {
@@ -45,6 +51,14 @@ func TestStreamHandlerChangeState(t *testing.T) {
 	s.handler.ChangeState(streamStateClientNotConnected)
 	require.Equal(t, s.handler.state, streamStateClientNotConnected)
 	require.Equal(t, s.handler.handler, &clientControlNotConnectedHandler{sh: s.handler})
+
+	s.handler.ChangeState(streamStateClientConnected)
+	require.Equal(t, s.handler.state, streamStateClientConnected)
+	require.Equal(t, s.handler.handler, &clientControlConnectedHandler{sh: s.handler})
+
+	s.handler.ChangeState(streamStateClientData)
+	require.Equal(t, s.handler.state, streamStateClientData)
+	require.Equal(t, s.handler.handler, &clientDataHandler{sh: s.handler})
 }
 
 func TestStreamStateString(t *testing.T) {
@@ -56,4 +70,54 @@ func TestStreamStateString(t *testing.T) {
 	require.Equal(t, "Play(Server)", streamStateServerPlay.String())
 	require.Equal(t, "NotConnected(Client)", streamStateClientNotConnected.String())
 	require.Equal(t, "Connected(Client)", streamStateClientConnected.String())
+	require.Equal(t, "Data(Client)", streamStateClientData.String())
+}
+
+type serverCanPassUnknownDataHandler struct {
+	DefaultHandler
+	dataCh chan *message.DataMessage
+}
+
+func (h *serverCanPassUnknownDataHandler) OnUnknownDataMessage(_ uint32, data *message.DataMessage) error {
+	h.dataCh <- data
+	return nil
+}
+
+func TestStreamHandlerPassesUnknownDataWithBody(t *testing.T) {
+	dataCh := make(chan *message.DataMessage, 1)
+	config := &ConnConfig{
+		Handler: &serverCanPassUnknownDataHandler{dataCh: dataCh},
+		Logger:  logrus.StandardLogger(),
+	}
+
+	prepareConnection(t, config, func(c *ClientConn) {
+		err := c.Connect(nil)
+		require.Nil(t, err)
+
+		s, err := c.CreateStream(nil, chunkSize)
+		require.Nil(t, err)
+		defer s.Close()
+
+		body := new(bytes.Buffer)
+		err = amf0.NewEncoder(body).Encode(amf0.ECMAArray{"text": "hello"})
+		require.Nil(t, err)
+		err = s.Write(5, 0, &message.DataMessage{
+			Name:     "onTextData",
+			Encoding: message.EncodingTypeAMF0,
+			Body:     body,
+		})
+		require.Nil(t, err)
+
+		select {
+		case data := <-dataCh:
+			require.Equal(t, "onTextData", data.Name)
+
+			var v interface{}
+			err := amf0.NewDecoder(data.Body).Decode(&v)
+			require.Nil(t, err)
+			require.Equal(t, amf0.ECMAArray{"text": "hello"}, v)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "Timeout")
+		}
+	})
 }
@@ -0,0 +1,97 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"sync"
+
+	"github.com/yutopp/go-rtmp/media"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+// StreamInfo Properties of media which are published to a stream.
+// It is updated when a publisher sends sequence headers. For multitrack media, only the track 0 is tracked.
+type StreamInfo struct {
+	video *media.VideoInfo
+	audio *media.AudioInfo
+	m     sync.RWMutex
+}
+
+// Video returns a copy of properties of video. It returns nil if no sequence headers of video are received yet.
+func (i *StreamInfo) Video() *media.VideoInfo {
+	i.m.RLock()
+	defer i.m.RUnlock()
+
+	if i.video == nil {
+		return nil
+	}
+	v := *i.video
+	return &v
+}
+
+// Audio returns a copy of properties of audio. It returns nil if no audio is received yet.
+func (i *StreamInfo) Audio() *media.AudioInfo {
+	i.m.RLock()
+	defer i.m.RUnlock()
+
+	if i.audio == nil {
+		return nil
+	}
+	a := *i.audio
+	return &a
+}
+
+func (i *StreamInfo) updateVideo(f *media.VideoFrame) error {
+	if !f.IsSequenceHeader() {
+		return nil
+	}
+
+	info, err := media.ParseVideoInfo(f)
+	if err != nil {
+		return err
+	}
+
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	i.video = info
+
+	return nil
+}
+
+// needsAudio Returns true if properties of audio can be updated by the frame. Data of the frame is not used.
+func (i *StreamInfo) needsAudio(f *media.AudioFrame) bool {
+	if f.IsSequenceHeader() {
+		return true
+	}
+
+	i.m.RLock()
+	known := i.audio != nil
+	i.m.RUnlock()
+
+	// AAC has properties in sequence headers. Others have them in every headers
+	return !known && f.FourCC != message.FourCCAAC && !f.IsExHeader
+}
+
+func (i *StreamInfo) updateAudio(f *media.AudioFrame) error {
+	if !i.needsAudio(f) {
+		return nil
+	}
+
+	info, err := media.ParseAudioInfo(f)
+	if err != nil {
+		return err
+	}
+
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	i.audio = info
+
+	return nil
+}
@@ -47,10 +47,25 @@ func (ss *streams) Create(streamID uint32) (*Stream, error) {
 	}
 
 	ss.streams[streamID] = newStream(streamID, ss.conn)
+	ss.conn.observer.OnStreamCreated(streamID)
 
 	return ss.streams[streamID], nil
 }
 
+// add Registers a stream which is moved from another connection by Stream.rebind.
+func (ss *streams) add(s *Stream) error {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+
+	if _, ok := ss.streams[s.streamID]; ok {
+		return errors.Errorf("Stream already exists: StreamID = %d", s.streamID)
+	}
+	ss.streams[s.streamID] = s
+	ss.conn.observer.OnStreamCreated(s.streamID)
+
+	return nil
+}
+
 func (ss *streams) CreateIfAvailable() (*Stream, error) {
 	for i := 0; i < ss.conn.config.ControlState.MaxMessageStreams; i++ {
 		s, err := ss.Create(uint32(i))
@@ -76,6 +91,7 @@ func (ss *streams) Delete(streamID uint32) error {
 	}
 
 	delete(ss.streams, s.streamID)
+	ss.conn.observer.OnStreamDeleted(s.streamID)
 
 	s.assumeClosed()
 
@@ -83,6 +99,9 @@ func (ss *streams) Delete(streamID uint32) error {
 }
 
 func (ss *streams) At(streamID uint32) (*Stream, error) {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+
 	stream, ok := ss.streams[streamID]
 	if !ok {
 		return nil, errors.Errorf("Stream is not found: StreamID = %d", streamID)
@@ -90,3 +109,16 @@ func (ss *streams) At(streamID uint32) (*Stream, error) {
 
 	return stream, nil
 }
+
+// list Returns a snapshot of streams.
+func (ss *streams) list() []*Stream {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+
+	result := make([]*Stream, 0, len(ss.streams))
+	for _, s := range ss.streams {
+		result = append(result, s)
+	}
+
+	return result
+}
@@ -34,8 +34,12 @@ func (t *transaction) Reply(commandName string, encoding message.EncodingType, b
 	close(t.doneCh)
 }
 
+// reservedTransactionIDs Transaction IDs which are used by commands of clients with fixed IDs (e.g. 1 for connect).
+const reservedTransactionIDs = 3
+
 type transactions struct {
 	transactions map[int64]*transaction
+	lastID       int64 // The last ID which is allocated by CreateNext
 	m            sync.RWMutex
 }
 
@@ -61,6 +65,29 @@ func (ts *transactions) Create(transactionID int64) (*transaction, error) {
 	return ts.transactions[transactionID], nil
 }
 
+// CreateNext creates a transaction with an ID which is not used. IDs are allocated after reservedTransactionIDs.
+func (ts *transactions) CreateNext() (int64, *transaction) {
+	ts.m.Lock()
+	defer ts.m.Unlock()
+
+	for {
+		ts.lastID++
+		if ts.lastID <= reservedTransactionIDs {
+			ts.lastID = reservedTransactionIDs + 1
+		}
+		if _, ok := ts.transactions[ts.lastID]; !ok {
+			break
+		}
+	}
+
+	t := &transaction{
+		doneCh: make(chan struct{}),
+	}
+	ts.transactions[ts.lastID] = t
+
+	return ts.lastID, t
+}
+
 func (ts *transactions) Delete(transactionID int64) error {
 	ts.m.Lock()
 	defer ts.m.Unlock()
@@ -76,6 +103,9 @@ func (ts *transactions) Delete(transactionID int64) error {
 }
 
 func (ts *transactions) At(transactionID int64) (*transaction, error) {
+	ts.m.RLock()
+	defer ts.m.RUnlock()
+
 	t, ok := ts.transactions[transactionID]
 	if !ok {
 		return nil, errors.Errorf("Transaction is not found: TransactionID = %d", transactionID)
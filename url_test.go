@@ -0,0 +1,128 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseURL(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		URL      string
+		Expected *URL
+		TCURL    string
+		PlayPath string
+	}{
+		{
+			Name: "Only app",
+			URL:  "rtmp://example.com/live",
+			Expected: &URL{
+				Scheme: "rtmp",
+				Host:   "example.com",
+				Addr:   "example.com:1935",
+				App:    "live",
+			},
+			TCURL:    "rtmp://example.com/live",
+			PlayPath: "",
+		},
+		{
+			Name: "App and stream name",
+			URL:  "rtmp://example.com:1936/live/key",
+			Expected: &URL{
+				Scheme:     "rtmp",
+				Host:       "example.com:1936",
+				Addr:       "example.com:1936",
+				App:        "live",
+				StreamName: "key",
+			},
+			TCURL:    "rtmp://example.com:1936/live",
+			PlayPath: "key",
+		},
+		{
+			Name: "Instance and query",
+			URL:  "rtmps://example.com/app/instance/key?token=abc",
+			Expected: &URL{
+				Scheme:     "rtmps",
+				Host:       "example.com",
+				Addr:       "example.com:443",
+				App:        "app",
+				Instance:   "instance",
+				StreamName: "key",
+				RawQuery:   "token=abc",
+			},
+			TCURL:    "rtmps://example.com/app/instance",
+			PlayPath: "key?token=abc",
+		},
+		{
+			Name: "Prefixed stream name is not an instance",
+			URL:  "rtmp://127.0.0.1/vod/mp4:dir/file.mp4",
+			Expected: &URL{
+				Scheme:     "rtmp",
+				Host:       "127.0.0.1",
+				Addr:       "127.0.0.1:1935",
+				App:        "vod",
+				StreamName: "mp4:dir/file.mp4",
+			},
+			TCURL:    "rtmp://127.0.0.1/vod",
+			PlayPath: "mp4:dir/file.mp4",
+		},
+		{
+			Name: "IPv6 host",
+			URL:  "rtmp://[::1]/live/key",
+			Expected: &URL{
+				Scheme:     "rtmp",
+				Host:       "[::1]",
+				Addr:       "[::1]:1935",
+				App:        "live",
+				StreamName: "key",
+			},
+			TCURL:    "rtmp://[::1]/live",
+			PlayPath: "key",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc // capture
+
+		t.Run(tc.Name, func(t *testing.T) {
+			u, err := ParseURL(tc.URL)
+			require.Nil(t, err)
+			require.Equal(t, tc.Expected, u)
+			require.Equal(t, tc.TCURL, u.TCURL())
+			require.Equal(t, tc.PlayPath, u.PlayPath())
+			require.Equal(t, tc.URL, u.String())
+		})
+	}
+}
+
+func TestParseURLError(t *testing.T) {
+	for _, rawurl := range []string{
+		"http://example.com/live",
+		"rtmp:///live",
+		"://",
+	} {
+		_, err := ParseURL(rawurl)
+		require.Error(t, err, rawurl)
+	}
+}
+
+func TestParseTCURL(t *testing.T) {
+	for _, tcURL := range []string{
+		"rtmp://example.com/live",
+		"rtmp://example.com/live/instance",
+		"rtmp://example.com:1936/live/instance/sub",
+	} {
+		u, err := parseTCURL(tcURL)
+		require.Nil(t, err)
+		require.Equal(t, "", u.StreamName, tcURL)
+		require.Equal(t, tcURL, u.TCURL())
+	}
+}
@@ -0,0 +1,608 @@
+//
+// Copyright (c) 2018- yutopp (yutopp@gmail.com)
+//
+// Distributed under the Boost Software License, Version 1.0. (See accompanying
+// file LICENSE_1_0.txt or copy at  https://www.boost.org/LICENSE_1_0.txt)
+//
+
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yutopp/go-flv"
+	flvtag "github.com/yutopp/go-flv/tag"
+
+	"github.com/yutopp/go-rtmp/internal"
+	"github.com/yutopp/go-rtmp/message"
+)
+
+const (
+	vodChunkStreamIDAudio = 4
+	vodChunkStreamIDData  = 5
+	vodChunkStreamIDVideo = 6
+)
+
+// VODStorage A storage of FLV files which are played as video on demand.
+type VODStorage interface {
+	Open(name string) (VODFile, error)
+}
+
+// VODFile A file opened by VODStorage.
+type VODFile interface {
+	io.ReaderAt
+	io.Closer
+	Size() (int64, error)
+}
+
+// DirVODStorage A VODStorage which reads files under Dir in a local file system.
+type DirVODStorage struct {
+	Dir string
+}
+
+func (s *DirVODStorage) Open(name string) (VODFile, error) {
+	p := filepath.Join(s.Dir, filepath.Clean(filepath.Join("/", name)))
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &osRecordFile{File: f}, nil
+}
+
+// VODStreamLength returns a length of an FLV file in seconds. It can be used to answer getStreamLength.
+func VODStreamLength(storage VODStorage, name string) (float64, error) {
+	f, err := storage.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	index, err := loadFLVIndex(f)
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(index.duration) / 1000, nil
+}
+
+// replyGetStreamLength Answers getStreamLength by StreamLengthHandler. It is passed through if the user handler does not implement it.
+func replyGetStreamLength(
+	sh *streamHandler,
+	chunkStreamID int,
+	timestamp uint32,
+	transactionID int64,
+	cmd *message.NetStreamGetStreamLength,
+) error {
+	lh, ok := sh.stream.userHandler().(StreamLengthHandler)
+	if !ok {
+		return internal.ErrPassThroughMsg
+	}
+
+	var result *message.NetStreamGetStreamLengthResult
+	duration, err := lh.OnGetStreamLength(timestamp, cmd)
+	if err != nil {
+		sh.Logger().Warnf("Failed to get stream length: StreamName = %s, Err = %+v", cmd.StreamName, err)
+	} else {
+		result = &message.NetStreamGetStreamLengthResult{Duration: duration}
+	}
+
+	return sh.stream.ReplyGetStreamLength(chunkStreamID, timestamp, transactionID, result)
+}
+
+type flvSeekPoint struct {
+	timestamp uint32
+	offset    int64
+}
+
+// flvIndex Properties of an FLV file which are required to play it from any positions.
+type flvIndex struct {
+	size           int64
+	dataOffset     int64 // An offset of the first tag
+	duration       uint32
+	metaData       []byte // A body of onMetaData
+	audioSeqHeader []byte
+	videoSeqHeader []byte
+	seekPoints     []flvSeekPoint // Key frames, or all audio tags for audio only files
+}
+
+func loadFLVIndex(f VODFile) (*flvIndex, error) {
+	size, err := f.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, flv.HeaderLength)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return nil, errors.Wrap(err, "Failed to read FLV header")
+	}
+	if !bytes.Equal(header[:3], flv.HeaderSignature) {
+		return nil, errors.New("File is not FLV")
+	}
+
+	index := &flvIndex{
+		size:       size,
+		dataOffset: int64(binary.BigEndian.Uint32(header[5:9])) + flvPrevTagSizeBytes,
+	}
+
+	var audioPoints []flvSeekPoint
+	var buf [flvTagHeaderLength + 16]byte
+	for pos := index.dataOffset; pos+flvTagHeaderLength <= size; {
+		n, err := f.ReadAt(buf[:], pos)
+		if n < flvTagHeaderLength {
+			return nil, errors.Wrapf(err, "Failed to read a tag header: Offset = %d", pos)
+		}
+		ty, bodyLength, timestamp := decodeFLVTagHeader(buf[:])
+		if pos+flvTagHeaderLength+bodyLength > size {
+			break // Truncated
+		}
+		head := buf[flvTagHeaderLength:n]
+		if int64(len(head)) > bodyLength {
+			head = head[:bodyLength]
+		}
+
+		readBody := func() ([]byte, error) {
+			body := make([]byte, bodyLength)
+			if _, err := f.ReadAt(body, pos+flvTagHeaderLength); err != nil {
+				return nil, errors.Wrapf(err, "Failed to read a tag body: Offset = %d", pos)
+			}
+			return body, nil
+		}
+
+		switch ty {
+		case flvtag.TagTypeAudio:
+			var h message.AudioHeader
+			if err := message.DecodeAudioHeader(bytes.NewReader(head), &h); err == nil {
+				isSeqHeader := (h.FourCC != 0 || h.IsMultitrack) && h.PacketType == message.AudioPacketTypeSequenceStart
+				if isSeqHeader && index.audioSeqHeader == nil {
+					if index.audioSeqHeader, err = readBody(); err != nil {
+						return nil, err
+					}
+				}
+			}
+			audioPoints = append(audioPoints, flvSeekPoint{timestamp: timestamp, offset: pos})
+
+		case flvtag.TagTypeVideo:
+			var h message.VideoHeader
+			if err := message.DecodeVideoHeader(bytes.NewReader(head), &h); err == nil && h.FrameType != message.VideoFrameTypeCommand {
+				isSeqHeader := (h.FourCC != 0 || h.IsMultitrack) && h.PacketType == message.VideoPacketTypeSequenceStart
+				if isSeqHeader && index.videoSeqHeader == nil {
+					if index.videoSeqHeader, err = readBody(); err != nil {
+						return nil, err
+					}
+				}
+				if !isSeqHeader && h.FrameType == message.VideoFrameTypeKeyFrame {
+					index.seekPoints = append(index.seekPoints, flvSeekPoint{timestamp: timestamp, offset: pos})
+				}
+			}
+
+		case flvtag.TagTypeScriptData:
+			if index.metaData == nil {
+				body, err := readBody()
+				if err != nil {
+					return nil, err
+				}
+				if name, rest, ok := internal.SplitAMF0String(body); ok && name == "onMetaData" {
+					index.metaData = rest
+				}
+			}
+		}
+
+		if timestamp > index.duration {
+			index.duration = timestamp
+		}
+		pos += flvTagHeaderLength + bodyLength + flvPrevTagSizeBytes
+	}
+
+	if len(index.seekPoints) == 0 {
+		index.seekPoints = audioPoints
+	}
+
+	return index, nil
+}
+
+// seek returns a seek point at or before timestamp. It returns false if there are no seek points.
+func (index *flvIndex) seek(timestamp uint32) (flvSeekPoint, bool) {
+	if len(index.seekPoints) == 0 {
+		return flvSeekPoint{}, false
+	}
+
+	i := sort.Search(len(index.seekPoints), func(i int) bool {
+		return index.seekPoints[i].timestamp > timestamp
+	})
+	if i > 0 {
+		i--
+	}
+
+	return index.seekPoints[i], true
+}
+
+func decodeFLVTagHeader(b []byte) (flvtag.TagType, int64, uint32) {
+	ty := flvtag.TagType(b[0] & 0x1f)
+	bodyLength := int64(b[1])<<16 | int64(b[2])<<8 | int64(b[3])
+	timestamp := uint32(b[7])<<24 | uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6])
+
+	return ty, bodyLength, timestamp
+}
+
+// vodPlayer Sends tags of an FLV file to a stream at real-time pace.
+type vodPlayer struct {
+	stream        *Stream
+	file          VODFile
+	index         *flvIndex
+	start         int64
+	duration      int64
+	chunkStreamID int // Used to send statuses
+
+	cmdCh  chan interface{} // *message.NetStreamSeek | *message.NetStreamPause
+	stopCh chan struct{}
+	doneCh chan struct{}
+
+	isStarted bool
+	isStopped bool
+	m         sync.Mutex
+}
+
+func newVODPlayer(s *Stream, file VODFile, cmd *message.NetStreamPlay) (*vodPlayer, error) {
+	index, err := loadFLVIndex(file)
+	if err != nil {
+		return nil, err
+	}
+
+	start := cmd.Start
+	if start < 0 {
+		start = 0 // Live or recorded (-2) and live only (-1) are played from the head
+	}
+
+	return &vodPlayer{
+		stream:   s,
+		file:     file,
+		index:    index,
+		start:    start,
+		duration: cmd.Duration,
+
+		cmdCh:  make(chan interface{}),
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}, nil
+}
+
+// notifyReset Sends statuses which precede NetStream.Play.Start.
+func (p *vodPlayer) notifyReset(chunkStreamID int, timestamp uint32) error {
+	streamID := p.stream.StreamID()
+	if err := p.writeUserCtrl(timestamp, &message.UserCtrlEventStreamIsRecorded{StreamID: streamID}); err != nil {
+		return err
+	}
+	if err := p.writeUserCtrl(timestamp, &message.UserCtrlEventStreamBegin{StreamID: streamID}); err != nil {
+		return err
+	}
+
+	return p.stream.NotifyStatus(chunkStreamID, timestamp, newVODStatus(
+		message.NetStreamOnStatusCodePlayReset,
+		"Playing and resetting.",
+	))
+}
+
+func (p *vodPlayer) run(chunkStreamID int) {
+	p.m.Lock()
+	if p.isStarted || p.isStopped {
+		p.m.Unlock()
+		return
+	}
+	p.isStarted = true
+	p.chunkStreamID = chunkStreamID
+	p.m.Unlock()
+
+	go func() {
+		defer close(p.doneCh)
+		defer p.file.Close()
+
+		if err := p.loop(); err != nil {
+			p.stream.logger().Warnf("VOD playback is stopped: Err = %+v", err)
+		}
+	}()
+}
+
+// stop Stops playback and closes the file.
+func (p *vodPlayer) stop() {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.isStopped {
+		return
+	}
+	p.isStopped = true
+
+	close(p.stopCh)
+	if !p.isStarted {
+		_ = p.file.Close()
+	}
+}
+
+// command Passes seek or pause to the playback loop.
+func (p *vodPlayer) command(cmd interface{}) {
+	select {
+	case p.cmdCh <- cmd:
+	case <-p.doneCh:
+	case <-p.stopCh:
+	}
+}
+
+type vodPlaybackState struct {
+	playing   bool
+	paused    bool
+	pos       int64
+	endTS     int64 // -1: until the end
+	clockBase time.Time
+	tsBase    uint32
+}
+
+func (p *vodPlayer) loop() error {
+	st := &vodPlaybackState{endTS: -1}
+	if p.duration >= 0 {
+		st.endTS = p.start + p.duration
+	}
+
+	if err := p.seekTo(st, p.start); err != nil {
+		return err
+	}
+
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		if !st.playing || st.paused {
+			select {
+			case cmd := <-p.cmdCh:
+				if err := p.handleCommand(st, cmd); err != nil {
+					return err
+				}
+			case <-p.stopCh:
+				return nil
+			}
+			continue
+		}
+
+		ty, timestamp, body, next, err := p.readTag(st.pos)
+		if err == io.EOF || (err == nil && st.endTS >= 0 && int64(timestamp) > st.endTS) {
+			st.playing = false
+			if err := p.notifyComplete(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if d := time.Until(st.clockBase.Add(time.Duration(int64(timestamp)-int64(st.tsBase)) * time.Millisecond)); d > 0 {
+			if timer == nil {
+				timer = time.NewTimer(d)
+			} else {
+				timer.Reset(d)
+			}
+
+			select {
+			case <-timer.C:
+			case cmd := <-p.cmdCh:
+				if !timer.Stop() {
+					<-timer.C
+				}
+				if err := p.handleCommand(st, cmd); err != nil {
+					return err
+				}
+				continue
+			case <-p.stopCh:
+				return nil
+			}
+		}
+
+		if err := p.writeTag(ty, timestamp, body); err != nil {
+			return err
+		}
+		st.pos = next
+	}
+}
+
+func (p *vodPlayer) handleCommand(st *vodPlaybackState, cmd interface{}) error {
+	switch cmd := cmd.(type) {
+	case *message.NetStreamSeek:
+		if _, ok := p.index.seek(uint32(clampMilliseconds(cmd.Milliseconds))); !ok || cmd.Milliseconds < 0 {
+			return p.stream.NotifyStatus(p.chunkStreamID, 0, newVODStatus(
+				message.NetStreamOnStatusCodeSeekFailed,
+				fmt.Sprintf("Failed to seek %d.", cmd.Milliseconds),
+			))
+		}
+
+		if err := p.stream.NotifyStatus(p.chunkStreamID, 0, newVODStatus(
+			message.NetStreamOnStatusCodeSeekNotify,
+			fmt.Sprintf("Seeking %d.", cmd.Milliseconds),
+		)); err != nil {
+			return err
+		}
+		if err := p.stream.NotifyStatus(p.chunkStreamID, 0, newVODStatus(
+			message.NetStreamOnStatusCodePlayStart,
+			"Play succeeded.",
+		)); err != nil {
+			return err
+		}
+
+		return p.seekTo(st, cmd.Milliseconds)
+
+	case *message.NetStreamPause:
+		if cmd.Pause {
+			st.paused = true
+			return p.stream.NotifyStatus(p.chunkStreamID, 0, newVODStatus(
+				message.NetStreamOnStatusCodePauseNotify,
+				fmt.Sprintf("Pausing %d.", cmd.Milliseconds),
+			))
+		}
+
+		st.paused = false
+		if err := p.stream.NotifyStatus(p.chunkStreamID, 0, newVODStatus(
+			message.NetStreamOnStatusCodeUnpauseNotify,
+			fmt.Sprintf("Unpausing %d.", cmd.Milliseconds),
+		)); err != nil {
+			return err
+		}
+
+		return p.seekTo(st, cmd.Milliseconds)
+
+	default:
+		return errors.Errorf("Unexpected command: %T", cmd)
+	}
+}
+
+// seekTo Moves to a key frame at or before milliseconds, and sends metadata and sequence headers again.
+// Tags before milliseconds are sent without waiting.
+func (p *vodPlayer) seekTo(st *vodPlaybackState, milliseconds int64) error {
+	ms := uint32(clampMilliseconds(milliseconds))
+
+	sp, ok := p.index.seek(ms)
+	if !ok {
+		// No media. Completes immediately
+		st.pos = p.index.size
+		st.playing = true
+		return nil
+	}
+
+	st.pos = sp.offset
+	st.playing = true
+	st.clockBase = time.Now()
+	st.tsBase = ms
+	if ms < sp.timestamp {
+		st.tsBase = sp.timestamp
+	}
+
+	if p.index.metaData != nil {
+		if err := p.stream.Write(vodChunkStreamIDData, sp.timestamp, &message.DataMessage{
+			Name:     "onMetaData",
+			Encoding: message.EncodingTypeAMF0,
+			Body:     bytes.NewReader(p.index.metaData),
+		}); err != nil {
+			return err
+		}
+	}
+	if p.index.videoSeqHeader != nil {
+		if err := p.writeTag(flvtag.TagTypeVideo, sp.timestamp, p.index.videoSeqHeader); err != nil {
+			return err
+		}
+	}
+	if p.index.audioSeqHeader != nil {
+		if err := p.writeTag(flvtag.TagTypeAudio, sp.timestamp, p.index.audioSeqHeader); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *vodPlayer) readTag(pos int64) (flvtag.TagType, uint32, []byte, int64, error) {
+	if pos+flvTagHeaderLength > p.index.size {
+		return 0, 0, nil, 0, io.EOF
+	}
+
+	var header [flvTagHeaderLength]byte
+	if _, err := p.file.ReadAt(header[:], pos); err != nil {
+		return 0, 0, nil, 0, errors.Wrapf(err, "Failed to read a tag header: Offset = %d", pos)
+	}
+	ty, bodyLength, timestamp := decodeFLVTagHeader(header[:])
+	if pos+flvTagHeaderLength+bodyLength > p.index.size {
+		return 0, 0, nil, 0, io.EOF // Truncated
+	}
+
+	body := make([]byte, bodyLength)
+	if _, err := p.file.ReadAt(body, pos+flvTagHeaderLength); err != nil {
+		return 0, 0, nil, 0, errors.Wrapf(err, "Failed to read a tag body: Offset = %d", pos)
+	}
+
+	return ty, timestamp, body, pos + flvTagHeaderLength + bodyLength + flvPrevTagSizeBytes, nil
+}
+
+func (p *vodPlayer) writeTag(ty flvtag.TagType, timestamp uint32, body []byte) error {
+	switch ty {
+	case flvtag.TagTypeAudio:
+		return p.stream.Write(vodChunkStreamIDAudio, timestamp, &message.AudioMessage{
+			Payload: bytes.NewReader(body),
+		})
+
+	case flvtag.TagTypeVideo:
+		return p.stream.Write(vodChunkStreamIDVideo, timestamp, &message.VideoMessage{
+			Payload: bytes.NewReader(body),
+		})
+
+	default:
+		// Metadata in the middle of files are not sent because they are not for players
+		return nil
+	}
+}
+
+func (p *vodPlayer) notifyComplete() error {
+	if err := p.stream.WriteDataMessage(vodChunkStreamIDData, 0, "onPlayStatus", &message.NetStreamOnPlayStatus{
+		InfoObject: message.NetStreamOnStatusInfoObject{
+			Level: message.NetStreamOnStatusLevelStatus,
+			Code:  message.NetStreamOnStatusCodePlayComplete,
+		},
+	}); err != nil {
+		return err
+	}
+
+	if err := p.stream.NotifyStatus(p.chunkStreamID, 0, newVODStatus(
+		message.NetStreamOnStatusCodePlayStop,
+		"Stopped playing.",
+	)); err != nil {
+		return err
+	}
+
+	return p.writeUserCtrl(0, &message.UserCtrlEventStreamEOF{StreamID: p.stream.StreamID()})
+}
+
+// writeUserCtrl Sends a user control message on the control stream (7.1.7).
+func (p *vodPlayer) writeUserCtrl(timestamp uint32, event message.UserCtrlEvent) error {
+	ctrlStream, err := p.stream.streams().At(ControlStreamID)
+	if err != nil {
+		return err
+	}
+
+	return ctrlStream.WriteUserCtrl(ctrlMsgChunkStreamID, timestamp, &message.UserCtrl{
+		Event: event,
+	})
+}
+
+func newVODStatus(code message.NetStreamOnStatusCode, description string) *message.NetStreamOnStatus {
+	level := message.NetStreamOnStatusLevelStatus
+	if code == message.NetStreamOnStatusCodeSeekFailed {
+		level = message.NetStreamOnStatusLevelError
+	}
+
+	return &message.NetStreamOnStatus{
+		InfoObject: message.NetStreamOnStatusInfoObject{
+			Level:       level,
+			Code:        code,
+			Description: description,
+		},
+	}
+}
+
+func clampMilliseconds(ms int64) int64 {
+	if ms < 0 {
+		return 0
+	}
+	if ms > 0xffffffff {
+		return 0xffffffff
+	}
+	return ms
+}